@@ -0,0 +1,239 @@
+package fakeredis
+
+import (
+	"strings"
+)
+
+// command describes a command implemented by the server.
+type command struct {
+	// arity is the number of arguments including the command name. A
+	// negative value is the minimum number of arguments.
+	arity int
+
+	// write is set for commands that modify data. Blocked clients are woken
+	// after a write command.
+	write bool
+
+	fn func(c *client, args []string) interface{}
+}
+
+// noReply is returned by commands that write their replies directly.
+type noReply struct{}
+
+var commands = map[string]command{}
+
+func register(table map[string]command) {
+	for name, cmd := range table {
+		commands[name] = cmd
+	}
+}
+
+// subscribeCommands are the commands allowed in the subscribe state.
+var subscribeCommands = map[string]bool{
+	"SUBSCRIBE": true, "PSUBSCRIBE": true, "UNSUBSCRIBE": true,
+	"PUNSUBSCRIBE": true, "PING": true, "RESET": true,
+}
+
+// execute executes a command from c and returns the reply.
+func (s *Server) execute(c *client, args []string) interface{} {
+	name := strings.ToUpper(args[0])
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cmd, ok := commands[name]
+	if !ok {
+		if c.multi {
+			c.txError = true
+		}
+		return errorReply("ERR unknown command '" + args[0] + "'")
+	}
+	if (cmd.arity > 0 && len(args) != cmd.arity) || (cmd.arity < 0 && len(args) < -cmd.arity) {
+		if c.multi {
+			c.txError = true
+		}
+		return errWrongArgs(name)
+	}
+	if c.subscribed() && !subscribeCommands[name] {
+		return errorReply("ERR Can't execute '" + strings.ToLower(name) + "': only (P)SUBSCRIBE / (P)UNSUBSCRIBE / PING / QUIT / RESET are allowed in this context")
+	}
+	if c.multi {
+		switch name {
+		case "EXEC", "DISCARD", "MULTI", "WATCH", "RESET":
+		default:
+			c.queued = append(c.queued, args)
+			return status("QUEUED")
+		}
+	}
+	return s.call(c, cmd, args)
+}
+
+func (s *Server) call(c *client, cmd command, args []string) interface{} {
+	reply := cmd.fn(c, args)
+	if cmd.write {
+		s.cond.Broadcast()
+	}
+	return reply
+}
+
+func init() {
+	register(map[string]command{
+		"PING":     {-1, false, cmdPing},
+		"ECHO":     {2, false, func(c *client, args []string) interface{} { return args[1] }},
+		"SELECT":   {2, false, cmdSelect},
+		"AUTH":     {-2, false, func(c *client, args []string) interface{} { return statusOK }},
+		"CLIENT":   {-2, false, cmdClient},
+		"INFO":     {-1, false, cmdInfo},
+		"TIME":     {1, false, cmdTime},
+		"DBSIZE":   {1, false, cmdDBSize},
+		"FLUSHDB":  {-1, true, cmdFlushDB},
+		"FLUSHALL": {-1, true, cmdFlushAll},
+		"MULTI":    {1, false, cmdMulti},
+		"EXEC":     {1, false, cmdExec},
+		"DISCARD":  {1, false, cmdDiscard},
+		"WATCH":    {-2, false, cmdWatch},
+		"UNWATCH":  {1, false, cmdUnwatch},
+		"RESET":    {1, false, cmdReset},
+	})
+}
+
+func cmdPing(c *client, args []string) interface{} {
+	if len(args) > 2 {
+		return errWrongArgs(args[0])
+	}
+	if c.subscribed() {
+		msg := ""
+		if len(args) == 2 {
+			msg = args[1]
+		}
+		return []interface{}{"pong", msg}
+	}
+	if len(args) == 2 {
+		return args[1]
+	}
+	return status("PONG")
+}
+
+func cmdSelect(c *client, args []string) interface{} {
+	n, ok := parseInt(args[1])
+	if !ok {
+		return errNotInteger
+	}
+	if n < 0 || n >= 16 {
+		return errorReply("ERR DB index is out of range")
+	}
+	c.dbIndex = int(n)
+	return statusOK
+}
+
+func cmdClient(c *client, args []string) interface{} {
+	switch strings.ToUpper(args[1]) {
+	case "GETNAME":
+		return nil
+	case "ID":
+		return int64(1)
+	}
+	return statusOK
+}
+
+func cmdInfo(c *client, args []string) interface{} {
+	return "# Server\r\nredis_version:7.2.0\r\nredis_mode:standalone\r\n"
+}
+
+func cmdTime(c *client, args []string) interface{} {
+	now := c.s.now()
+	return []interface{}{
+		formatInt(now.Unix()),
+		formatInt(int64(now.Nanosecond() / 1000)),
+	}
+}
+
+func cmdDBSize(c *client, args []string) interface{} {
+	return int64(len(c.db().liveKeys()))
+}
+
+func cmdFlushDB(c *client, args []string) interface{} {
+	c.db().flush()
+	return statusOK
+}
+
+func cmdFlushAll(c *client, args []string) interface{} {
+	for _, d := range c.s.dbs {
+		d.flush()
+	}
+	return statusOK
+}
+
+func cmdMulti(c *client, args []string) interface{} {
+	if c.multi {
+		return errorReply("ERR MULTI calls can not be nested")
+	}
+	c.multi = true
+	c.queued = nil
+	c.txError = false
+	return statusOK
+}
+
+func cmdExec(c *client, args []string) interface{} {
+	if !c.multi {
+		return errorReply("ERR EXEC without MULTI")
+	}
+	queued, txError := c.queued, c.txError
+	c.multi, c.queued, c.txError = false, nil, false
+	watched := c.watched
+	c.watched = nil
+	if txError {
+		return errorReply("EXECABORT Transaction discarded because of previous errors.")
+	}
+	for k, v := range watched {
+		d := c.s.db(k.db)
+		d.get(k.key)
+		if d.version[k.key] != v {
+			return nilArray{}
+		}
+	}
+	replies := make([]interface{}, len(queued))
+	c.execing = true
+	for i, args := range queued {
+		cmd := commands[strings.ToUpper(args[0])]
+		replies[i] = c.s.call(c, cmd, args)
+	}
+	c.execing = false
+	return replies
+}
+
+func cmdDiscard(c *client, args []string) interface{} {
+	if !c.multi {
+		return errorReply("ERR DISCARD without MULTI")
+	}
+	c.multi, c.queued, c.txError = false, nil, false
+	c.watched = nil
+	return statusOK
+}
+
+func cmdWatch(c *client, args []string) interface{} {
+	if c.multi {
+		return errorReply("ERR WATCH inside MULTI is not allowed")
+	}
+	if c.watched == nil {
+		c.watched = make(map[watchKey]uint64)
+	}
+	d := c.db()
+	for _, key := range args[1:] {
+		d.get(key)
+		c.watched[watchKey{c.dbIndex, key}] = d.version[key]
+	}
+	return statusOK
+}
+
+func cmdUnwatch(c *client, args []string) interface{} {
+	c.watched = nil
+	return statusOK
+}
+
+func cmdReset(c *client, args []string) interface{} {
+	c.multi, c.queued, c.txError = false, nil, false
+	c.watched = nil
+	c.dbIndex = 0
+	c.s.unsubscribeAll(c)
+	return status("RESET")
+}
@@ -0,0 +1,287 @@
+package fakeredis
+
+import (
+	"sort"
+	"time"
+)
+
+// entry is the value stored at a key. The value is one of string,
+// hashValue, *listValue, setValue, *zsetValue or *streamValue.
+type entry struct {
+	value    interface{}
+	expireAt time.Time // zero for keys without a TTL
+	// fieldExpireAt holds the expiry times of the hash fields with a TTL.
+	fieldExpireAt map[string]time.Time
+}
+
+type (
+	hashValue map[string]string
+	setValue  map[string]struct{}
+	listValue struct{ items []string }
+)
+
+func typeName(v interface{}) string {
+	switch v.(type) {
+	case string:
+		return "string"
+	case hashValue:
+		return "hash"
+	case *listValue:
+		return "list"
+	case setValue:
+		return "set"
+	case *zsetValue:
+		return "zset"
+	case *streamValue:
+		return "stream"
+	}
+	return "none"
+}
+
+// db is a numbered database. The methods must be called with the server
+// mutex held.
+type db struct {
+	s       *Server
+	keys    map[string]*entry
+	version map[string]uint64 // incremented on modification for WATCH
+	counter uint64
+}
+
+func newDB(s *Server) *db {
+	return &db{s: s, keys: make(map[string]*entry), version: make(map[string]uint64)}
+}
+
+// get returns the entry for key or nil if the key does not exist. Expired
+// keys and expired hash fields are deleted.
+func (d *db) get(key string) *entry {
+	e := d.keys[key]
+	if e == nil {
+		return nil
+	}
+	if !e.expireAt.IsZero() && !d.s.now().Before(e.expireAt) {
+		delete(d.keys, key)
+		d.touch(key)
+		return nil
+	}
+	if len(e.fieldExpireAt) > 0 && d.expireFields(key, e) {
+		return nil
+	}
+	return e
+}
+
+// set stores v at key and clears the TTL.
+func (d *db) set(key string, v interface{}) {
+	d.keys[key] = &entry{value: v}
+	d.touch(key)
+}
+
+// del deletes key and returns true if the key existed.
+func (d *db) del(key string) bool {
+	if d.get(key) == nil {
+		return false
+	}
+	delete(d.keys, key)
+	d.touch(key)
+	return true
+}
+
+// touch records a modification of key.
+func (d *db) touch(key string) {
+	d.counter++
+	d.version[key] = d.counter
+}
+
+func (d *db) flush() {
+	for key := range d.keys {
+		d.touch(key)
+	}
+	d.keys = make(map[string]*entry)
+}
+
+// liveKeys returns the keys that have not expired in sorted order.
+func (d *db) liveKeys() []string {
+	keys := make([]string, 0, len(d.keys))
+	for key := range d.keys {
+		if d.get(key) != nil {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// deleteIfEmpty deletes key when a collection becomes empty.
+func (d *db) deleteIfEmpty(key string) {
+	e := d.keys[key]
+	if e == nil {
+		return
+	}
+	empty := false
+	switch v := e.value.(type) {
+	case hashValue:
+		empty = len(v) == 0
+	case *listValue:
+		empty = len(v.items) == 0
+	case setValue:
+		empty = len(v) == 0
+	case *zsetValue:
+		empty = len(v.scores) == 0
+	}
+	if empty {
+		delete(d.keys, key)
+	}
+}
+
+// The typed lookup functions return errWrongType when the key holds a
+// value of another type. The value is nil when the key does not exist and
+// create is false.
+
+func (d *db) getString(key string) (string, bool, interface{}) {
+	e := d.get(key)
+	if e == nil {
+		return "", false, nil
+	}
+	s, ok := e.value.(string)
+	if !ok {
+		return "", false, errWrongType
+	}
+	return s, true, nil
+}
+
+func (d *db) getHash(key string, create bool) (hashValue, interface{}) {
+	e := d.get(key)
+	if e == nil {
+		if !create {
+			return nil, nil
+		}
+		h := hashValue{}
+		d.keys[key] = &entry{value: h}
+		return h, nil
+	}
+	h, ok := e.value.(hashValue)
+	if !ok {
+		return nil, errWrongType
+	}
+	return h, nil
+}
+
+// expireFields deletes the expired fields of the hash in e and reports
+// whether the key was deleted because the hash became empty.
+func (d *db) expireFields(key string, e *entry) bool {
+	h, ok := e.value.(hashValue)
+	if !ok {
+		return false
+	}
+	now := d.s.now()
+	expired := false
+	for field, at := range e.fieldExpireAt {
+		if !now.Before(at) {
+			delete(h, field)
+			delete(e.fieldExpireAt, field)
+			expired = true
+		}
+	}
+	if !expired {
+		return false
+	}
+	d.touch(key)
+	if len(h) == 0 {
+		delete(d.keys, key)
+		return true
+	}
+	return false
+}
+
+// fieldExpire returns the expiry time of a hash field or the zero time for
+// fields without a TTL.
+func (d *db) fieldExpire(key, field string) time.Time {
+	if e := d.keys[key]; e != nil {
+		return e.fieldExpireAt[field]
+	}
+	return time.Time{}
+}
+
+// setFieldExpire sets the expiry time of a hash field. The zero time
+// removes the TTL.
+func (d *db) setFieldExpire(key, field string, at time.Time) {
+	e := d.keys[key]
+	if e == nil {
+		return
+	}
+	if at.IsZero() {
+		delete(e.fieldExpireAt, field)
+		return
+	}
+	if e.fieldExpireAt == nil {
+		e.fieldExpireAt = make(map[string]time.Time)
+	}
+	e.fieldExpireAt[field] = at
+}
+
+func (d *db) getList(key string, create bool) (*listValue, interface{}) {
+	e := d.get(key)
+	if e == nil {
+		if !create {
+			return nil, nil
+		}
+		l := &listValue{}
+		d.keys[key] = &entry{value: l}
+		return l, nil
+	}
+	l, ok := e.value.(*listValue)
+	if !ok {
+		return nil, errWrongType
+	}
+	return l, nil
+}
+
+func (d *db) getSet(key string, create bool) (setValue, interface{}) {
+	e := d.get(key)
+	if e == nil {
+		if !create {
+			return nil, nil
+		}
+		s := setValue{}
+		d.keys[key] = &entry{value: s}
+		return s, nil
+	}
+	s, ok := e.value.(setValue)
+	if !ok {
+		return nil, errWrongType
+	}
+	return s, nil
+}
+
+func (d *db) getZSet(key string, create bool) (*zsetValue, interface{}) {
+	e := d.get(key)
+	if e == nil {
+		if !create {
+			return nil, nil
+		}
+		z := newZSet()
+		d.keys[key] = &entry{value: z}
+		return z, nil
+	}
+	z, ok := e.value.(*zsetValue)
+	if !ok {
+		return nil, errWrongType
+	}
+	return z, nil
+}
+
+func (d *db) getStream(key string, create bool) (*streamValue, interface{}) {
+	e := d.get(key)
+	if e == nil {
+		if !create {
+			return nil, nil
+		}
+		st := &streamValue{}
+		d.keys[key] = &entry{value: st}
+		return st, nil
+	}
+	st, ok := e.value.(*streamValue)
+	if !ok {
+		return nil, errWrongType
+	}
+	return st, nil
+}
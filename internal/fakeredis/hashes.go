@@ -0,0 +1,588 @@
+package fakeredis
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+func init() {
+	register(map[string]command{
+		"HSET":         {-4, true, cmdHSet},
+		"HMSET":        {-4, true, cmdHSet},
+		"HSETNX":       {4, true, cmdHSetNX},
+		"HGET":         {3, false, cmdHGet},
+		"HMGET":        {-3, false, cmdHMGet},
+		"HGETALL":      {2, false, cmdHGetAll},
+		"HKEYS":        {2, false, cmdHGetAll},
+		"HVALS":        {2, false, cmdHGetAll},
+		"HDEL":         {-3, true, cmdHDel},
+		"HEXISTS":      {3, false, cmdHExists},
+		"HLEN":         {2, false, cmdHLen},
+		"HSTRLEN":      {3, false, cmdHStrLen},
+		"HINCRBY":      {4, true, cmdHIncrBy},
+		"HINCRBYFLOAT": {4, true, cmdHIncrByFloat},
+		"HSCAN":        {-3, false, cmdHScan},
+		"HRANDFIELD":   {-2, false, cmdHRandField},
+		"HEXPIRE":      {-6, true, cmdHExpire},
+		"HPEXPIRE":     {-6, true, cmdHExpire},
+		"HEXPIREAT":    {-6, true, cmdHExpire},
+		"HPEXPIREAT":   {-6, true, cmdHExpire},
+		"HTTL":         {-5, false, cmdHTTL},
+		"HPTTL":        {-5, false, cmdHTTL},
+		"HEXPIRETIME":  {-5, false, cmdHTTL},
+		"HPEXPIRETIME": {-5, false, cmdHTTL},
+		"HPERSIST":     {-5, true, cmdHPersist},
+		"HGETDEL":      {-5, true, cmdHGetDel},
+		"HGETEX":       {-5, true, cmdHGetEx},
+		"HSETEX":       {-6, true, cmdHSetEx},
+	})
+}
+
+func cmdHSet(c *client, args []string) interface{} {
+	if len(args)%2 != 0 {
+		return errWrongArgs(args[0])
+	}
+	d := c.db()
+	h, err := d.getHash(args[1], true)
+	if err != nil {
+		return err
+	}
+	var n int64
+	for i := 2; i < len(args); i += 2 {
+		if _, ok := h[args[i]]; !ok {
+			n++
+		}
+		h[args[i]] = args[i+1]
+		d.setFieldExpire(args[1], args[i], time.Time{})
+	}
+	d.touch(args[1])
+	if strings.EqualFold(args[0], "HMSET") {
+		return statusOK
+	}
+	return n
+}
+
+func cmdHSetNX(c *client, args []string) interface{} {
+	d := c.db()
+	h, err := d.getHash(args[1], true)
+	if err != nil {
+		return err
+	}
+	if _, ok := h[args[2]]; ok {
+		return int64(0)
+	}
+	h[args[2]] = args[3]
+	d.touch(args[1])
+	return int64(1)
+}
+
+func cmdHGet(c *client, args []string) interface{} {
+	h, err := c.db().getHash(args[1], false)
+	if err != nil {
+		return err
+	}
+	if v, ok := h[args[2]]; ok {
+		return v
+	}
+	return nil
+}
+
+func cmdHMGet(c *client, args []string) interface{} {
+	h, err := c.db().getHash(args[1], false)
+	if err != nil {
+		return err
+	}
+	values := make([]interface{}, len(args)-2)
+	for i, field := range args[2:] {
+		if v, ok := h[field]; ok {
+			values[i] = v
+		}
+	}
+	return values
+}
+
+// sortedFields returns the fields of h in sorted order so that replies are
+// deterministic.
+func (h hashValue) sortedFields() []string {
+	fields := make([]string, 0, len(h))
+	for field := range h {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+func cmdHGetAll(c *client, args []string) interface{} {
+	h, err := c.db().getHash(args[1], false)
+	if err != nil {
+		return err
+	}
+	name := strings.ToUpper(args[0])
+	result := []string{}
+	for _, field := range h.sortedFields() {
+		if name != "HVALS" {
+			result = append(result, field)
+		}
+		if name != "HKEYS" {
+			result = append(result, h[field])
+		}
+	}
+	return result
+}
+
+func cmdHDel(c *client, args []string) interface{} {
+	d := c.db()
+	h, err := d.getHash(args[1], false)
+	if err != nil {
+		return err
+	}
+	var n int64
+	for _, field := range args[2:] {
+		if _, ok := h[field]; ok {
+			delete(h, field)
+			d.setFieldExpire(args[1], field, time.Time{})
+			n++
+		}
+	}
+	if n > 0 {
+		d.touch(args[1])
+		d.deleteIfEmpty(args[1])
+	}
+	return n
+}
+
+func cmdHExists(c *client, args []string) interface{} {
+	h, err := c.db().getHash(args[1], false)
+	if err != nil {
+		return err
+	}
+	_, ok := h[args[2]]
+	return ok
+}
+
+func cmdHLen(c *client, args []string) interface{} {
+	h, err := c.db().getHash(args[1], false)
+	if err != nil {
+		return err
+	}
+	return int64(len(h))
+}
+
+func cmdHStrLen(c *client, args []string) interface{} {
+	h, err := c.db().getHash(args[1], false)
+	if err != nil {
+		return err
+	}
+	return int64(len(h[args[2]]))
+}
+
+func cmdHIncrBy(c *client, args []string) interface{} {
+	delta, ok := parseInt(args[3])
+	if !ok {
+		return errNotInteger
+	}
+	d := c.db()
+	h, err := d.getHash(args[1], true)
+	if err != nil {
+		return err
+	}
+	var n int64
+	if v, exists := h[args[2]]; exists {
+		if n, ok = parseInt(v); !ok {
+			return errorReply("ERR hash value is not an integer")
+		}
+	}
+	if (delta > 0 && n > math.MaxInt64-delta) || (delta < 0 && n < math.MinInt64-delta) {
+		return errOverflow
+	}
+	n += delta
+	h[args[2]] = formatInt(n)
+	d.touch(args[1])
+	return n
+}
+
+func cmdHIncrByFloat(c *client, args []string) interface{} {
+	delta, ok := parseFloat(args[3])
+	if !ok {
+		return errNotFloat
+	}
+	d := c.db()
+	h, err := d.getHash(args[1], true)
+	if err != nil {
+		return err
+	}
+	var f float64
+	if v, exists := h[args[2]]; exists {
+		if f, ok = parseFloat(v); !ok {
+			return errorReply("ERR hash value is not a float")
+		}
+	}
+	f += delta
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		return errorReply("ERR increment would produce NaN or Infinity")
+	}
+	s := formatIncrFloat(f)
+	h[args[2]] = s
+	d.touch(args[1])
+	return s
+}
+
+func cmdHScan(c *client, args []string) interface{} {
+	opts, err := parseScanOptions(args[2:])
+	if err != nil {
+		return err
+	}
+	h, err := c.db().getHash(args[1], false)
+	if err != nil {
+		return err
+	}
+	next, fields := opts.scan(h.sortedFields(), nil)
+	items := []string{}
+	for _, field := range fields {
+		items = append(items, field)
+		if !opts.noValues {
+			items = append(items, h[field])
+		}
+	}
+	return []interface{}{next, items}
+}
+
+func cmdHRandField(c *client, args []string) interface{} {
+	withValues := false
+	if len(args) == 4 {
+		if !strings.EqualFold(args[3], "WITHVALUES") {
+			return errSyntax
+		}
+		withValues = true
+		args = args[:3]
+	}
+	count, hasCount, err := parseCount(args)
+	if err != nil {
+		return err
+	}
+	h, err := c.db().getHash(args[1], false)
+	if err != nil {
+		return err
+	}
+	fields := h.sortedFields()
+	if !hasCount {
+		if len(fields) == 0 {
+			return nil
+		}
+		return fields[c.s.rand.Intn(len(fields))]
+	}
+	result := []string{}
+	add := func(field string) {
+		result = append(result, field)
+		if withValues {
+			result = append(result, h[field])
+		}
+	}
+	if len(fields) == 0 {
+		return result
+	}
+	if count < 0 {
+		// A negative count allows the same field more than once.
+		for ; count < 0; count++ {
+			add(fields[c.s.rand.Intn(len(fields))])
+		}
+		return result
+	}
+	for i, j := range c.s.rand.Perm(len(fields)) {
+		if int64(i) == count {
+			break
+		}
+		add(fields[j])
+	}
+	return result
+}
+
+// parseFields parses the FIELDS numfields field... arguments of the hash
+// field commands starting at args[i]. Each field is followed by size-1
+// values.
+func parseFields(args []string, i, size int) ([]string, interface{}) {
+	if i+1 >= len(args) || !strings.EqualFold(args[i], "FIELDS") {
+		return nil, errorReply("ERR Mandatory argument FIELDS is missing or not at the right position")
+	}
+	n, ok := parseInt(args[i+1])
+	if !ok || n <= 0 {
+		return nil, errorReply("ERR Number of fields must be a positive integer")
+	}
+	if int64(len(args)-i-2) != n*int64(size) {
+		return nil, errorReply("ERR The `numfields` parameter must match the number of arguments")
+	}
+	return args[i+2:], nil
+}
+
+func cmdHExpire(c *client, args []string) interface{} {
+	name := strings.ToUpper(args[0])
+	n, ok := parseInt(args[2])
+	if !ok {
+		return errNotInteger
+	}
+	if n < 0 {
+		return errorReply("ERR invalid expire time in '" + strings.ToLower(name) + "' command")
+	}
+	now := c.s.now()
+	var t time.Time
+	switch name {
+	case "HEXPIRE":
+		t = now.Add(time.Duration(n) * time.Second)
+	case "HPEXPIRE":
+		t = now.Add(time.Duration(n) * time.Millisecond)
+	case "HEXPIREAT":
+		t = time.Unix(n, 0)
+	case "HPEXPIREAT":
+		t = time.Unix(0, n*int64(time.Millisecond))
+	}
+	i := 3
+	condition := ""
+	switch option := strings.ToUpper(args[i]); option {
+	case "NX", "XX", "GT", "LT":
+		condition = option
+		i++
+	}
+	fields, err := parseFields(args, i, 1)
+	if err != nil {
+		return err
+	}
+	d := c.db()
+	h, err := d.getHash(args[1], false)
+	if err != nil {
+		return err
+	}
+	result := make([]interface{}, len(fields))
+	changed := false
+	for i, field := range fields {
+		if _, ok := h[field]; !ok {
+			result[i] = int64(-2)
+			continue
+		}
+		current := d.fieldExpire(args[1], field)
+		persistent := current.IsZero()
+		switch {
+		case condition == "NX" && !persistent,
+			condition == "XX" && persistent,
+			condition == "GT" && (persistent || !t.After(current)),
+			condition == "LT" && !persistent && !t.Before(current):
+			result[i] = int64(0)
+			continue
+		}
+		if !t.After(now) {
+			delete(h, field)
+			d.setFieldExpire(args[1], field, time.Time{})
+			result[i] = int64(2)
+			changed = true
+			continue
+		}
+		d.setFieldExpire(args[1], field, t)
+		result[i] = int64(1)
+		changed = true
+	}
+	if changed {
+		d.touch(args[1])
+		d.deleteIfEmpty(args[1])
+	}
+	return result
+}
+
+func cmdHTTL(c *client, args []string) interface{} {
+	fields, err := parseFields(args, 2, 1)
+	if err != nil {
+		return err
+	}
+	d := c.db()
+	h, err := d.getHash(args[1], false)
+	if err != nil {
+		return err
+	}
+	now := c.s.now()
+	result := make([]interface{}, len(fields))
+	for i, field := range fields {
+		if _, ok := h[field]; !ok {
+			result[i] = int64(-2)
+			continue
+		}
+		t := d.fieldExpire(args[1], field)
+		if t.IsZero() {
+			result[i] = int64(-1)
+			continue
+		}
+		switch strings.ToUpper(args[0]) {
+		case "HTTL":
+			result[i] = int64((t.Sub(now) + time.Second/2) / time.Second)
+		case "HPTTL":
+			result[i] = int64(t.Sub(now) / time.Millisecond)
+		case "HEXPIRETIME":
+			result[i] = t.Unix()
+		default:
+			result[i] = t.UnixNano() / int64(time.Millisecond)
+		}
+	}
+	return result
+}
+
+func cmdHPersist(c *client, args []string) interface{} {
+	fields, err := parseFields(args, 2, 1)
+	if err != nil {
+		return err
+	}
+	d := c.db()
+	h, err := d.getHash(args[1], false)
+	if err != nil {
+		return err
+	}
+	result := make([]interface{}, len(fields))
+	for i, field := range fields {
+		if _, ok := h[field]; !ok {
+			result[i] = int64(-2)
+		} else if d.fieldExpire(args[1], field).IsZero() {
+			result[i] = int64(-1)
+		} else {
+			d.setFieldExpire(args[1], field, time.Time{})
+			d.touch(args[1])
+			result[i] = int64(1)
+		}
+	}
+	return result
+}
+
+func cmdHGetDel(c *client, args []string) interface{} {
+	fields, err := parseFields(args, 2, 1)
+	if err != nil {
+		return err
+	}
+	d := c.db()
+	h, err := d.getHash(args[1], false)
+	if err != nil {
+		return err
+	}
+	values := make([]interface{}, len(fields))
+	for i, field := range fields {
+		if v, ok := h[field]; ok {
+			values[i] = v
+			delete(h, field)
+			d.setFieldExpire(args[1], field, time.Time{})
+			d.touch(args[1])
+		}
+	}
+	d.deleteIfEmpty(args[1])
+	return values
+}
+
+func cmdHGetEx(c *client, args []string) interface{} {
+	i := 2
+	var (
+		expireAt time.Time
+		persist  bool
+	)
+	switch option := strings.ToUpper(args[i]); option {
+	case "EX", "PX", "EXAT", "PXAT":
+		if i+1 >= len(args) {
+			return errSyntax
+		}
+		t, err := parseExpireOption(c, option, args[i+1], "hgetex")
+		if err != nil {
+			return err
+		}
+		expireAt = t
+		i += 2
+	case "PERSIST":
+		persist = true
+		i++
+	}
+	fields, err := parseFields(args, i, 1)
+	if err != nil {
+		return err
+	}
+	d := c.db()
+	h, err := d.getHash(args[1], false)
+	if err != nil {
+		return err
+	}
+	now := c.s.now()
+	values := make([]interface{}, len(fields))
+	for i, field := range fields {
+		v, ok := h[field]
+		if !ok {
+			continue
+		}
+		values[i] = v
+		switch {
+		case persist:
+			d.setFieldExpire(args[1], field, time.Time{})
+		case expireAt.IsZero():
+			continue
+		case !expireAt.After(now):
+			delete(h, field)
+			d.setFieldExpire(args[1], field, time.Time{})
+		default:
+			d.setFieldExpire(args[1], field, expireAt)
+		}
+		d.touch(args[1])
+	}
+	d.deleteIfEmpty(args[1])
+	return values
+}
+
+func cmdHSetEx(c *client, args []string) interface{} {
+	var (
+		fnx, fxx, keepTTL bool
+		expireAt          time.Time
+	)
+	i := 2
+options:
+	for ; i < len(args); i++ {
+		switch option := strings.ToUpper(args[i]); option {
+		case "FNX":
+			fnx = true
+		case "FXX":
+			fxx = true
+		case "KEEPTTL":
+			keepTTL = true
+		case "EX", "PX", "EXAT", "PXAT":
+			if i+1 >= len(args) {
+				return errSyntax
+			}
+			t, err := parseExpireOption(c, option, args[i+1], "hsetex")
+			if err != nil {
+				return err
+			}
+			expireAt = t
+			i++
+		default:
+			break options
+		}
+	}
+	if (fnx && fxx) || (keepTTL && !expireAt.IsZero()) {
+		return errSyntax
+	}
+	pairs, err := parseFields(args, i, 2)
+	if err != nil {
+		return err
+	}
+	d := c.db()
+	h, err := d.getHash(args[1], false)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < len(pairs); i += 2 {
+		_, exists := h[pairs[i]]
+		if (fnx && exists) || (fxx && !exists) {
+			return int64(0)
+		}
+	}
+	if h == nil {
+		h, _ = d.getHash(args[1], true)
+	}
+	for i := 0; i < len(pairs); i += 2 {
+		h[pairs[i]] = pairs[i+1]
+		if !keepTTL {
+			d.setFieldExpire(args[1], pairs[i], expireAt)
+		}
+	}
+	d.touch(args[1])
+	return int64(1)
+}
@@ -0,0 +1,359 @@
+package fakeredis
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+func init() {
+	register(map[string]command{
+		"DEL":         {-2, true, cmdDel},
+		"UNLINK":      {-2, true, cmdDel},
+		"EXISTS":      {-2, false, cmdExists},
+		"TYPE":        {2, false, cmdType},
+		"KEYS":        {2, false, cmdKeys},
+		"SCAN":        {-2, false, cmdScan},
+		"RANDOMKEY":   {1, false, cmdRandomKey},
+		"RENAME":      {3, true, cmdRename},
+		"RENAMENX":    {3, true, cmdRename},
+		"EXPIRE":      {-3, true, cmdExpire},
+		"PEXPIRE":     {-3, true, cmdExpire},
+		"EXPIREAT":    {-3, true, cmdExpire},
+		"PEXPIREAT":   {-3, true, cmdExpire},
+		"TTL":         {2, false, cmdTTL},
+		"PTTL":        {2, false, cmdTTL},
+		"EXPIRETIME":  {2, false, cmdTTL},
+		"PEXPIRETIME": {2, false, cmdTTL},
+		"PERSIST":     {2, true, cmdPersist},
+	})
+}
+
+func cmdDel(c *client, args []string) interface{} {
+	d := c.db()
+	var n int64
+	for _, key := range args[1:] {
+		if d.del(key) {
+			n++
+		}
+	}
+	return n
+}
+
+func cmdExists(c *client, args []string) interface{} {
+	d := c.db()
+	var n int64
+	for _, key := range args[1:] {
+		if d.get(key) != nil {
+			n++
+		}
+	}
+	return n
+}
+
+func cmdType(c *client, args []string) interface{} {
+	e := c.db().get(args[1])
+	if e == nil {
+		return status("none")
+	}
+	return status(typeName(e.value))
+}
+
+func cmdKeys(c *client, args []string) interface{} {
+	keys := []string{}
+	for _, key := range c.db().liveKeys() {
+		if matchPattern(args[1], key) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// scanOptions are the options of the SCAN family of commands.
+type scanOptions struct {
+	cursor   int
+	match    string
+	count    int
+	typeName string
+	noValues bool
+}
+
+func parseScanOptions(args []string) (scanOptions, interface{}) {
+	opts := scanOptions{count: 10}
+	cursor, ok := parseInt(args[0])
+	if !ok || cursor < 0 {
+		return opts, errorReply("ERR invalid cursor")
+	}
+	opts.cursor = int(cursor)
+	for i := 1; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "NOVALUES":
+			opts.noValues = true
+			continue
+		case "MATCH", "COUNT", "TYPE":
+		default:
+			return opts, errSyntax
+		}
+		if i+1 >= len(args) {
+			return opts, errSyntax
+		}
+		switch strings.ToUpper(args[i]) {
+		case "MATCH":
+			opts.match = args[i+1]
+		case "COUNT":
+			n, ok := parseInt(args[i+1])
+			if !ok {
+				return opts, errNotInteger
+			}
+			if n < 1 {
+				return opts, errSyntax
+			}
+			opts.count = int(n)
+		case "TYPE":
+			opts.typeName = strings.ToLower(args[i+1])
+		}
+		i++
+	}
+	return opts, nil
+}
+
+// scan returns the next cursor and the items in items[cursor:cursor+count]
+// that match the pattern. The cursor is an index into the sorted items.
+func (opts scanOptions) scan(items []string, include func(string) bool) (string, []string) {
+	start := opts.cursor
+	if start > len(items) {
+		start = len(items)
+	}
+	end := start + opts.count
+	next := end
+	if end >= len(items) {
+		end = len(items)
+		next = 0
+	}
+	matched := []string{}
+	for _, item := range items[start:end] {
+		if opts.match != "" && !matchPattern(opts.match, item) {
+			continue
+		}
+		if include != nil && !include(item) {
+			continue
+		}
+		matched = append(matched, item)
+	}
+	return strconv.Itoa(next), matched
+}
+
+func cmdScan(c *client, args []string) interface{} {
+	opts, err := parseScanOptions(args[1:])
+	if err != nil {
+		return err
+	}
+	d := c.db()
+	next, keys := opts.scan(d.liveKeys(), func(key string) bool {
+		return opts.typeName == "" || typeName(d.get(key).value) == opts.typeName
+	})
+	return []interface{}{next, keys}
+}
+
+func cmdRandomKey(c *client, args []string) interface{} {
+	keys := c.db().liveKeys()
+	if len(keys) == 0 {
+		return nil
+	}
+	return keys[c.s.rand.Intn(len(keys))]
+}
+
+func cmdRename(c *client, args []string) interface{} {
+	d := c.db()
+	e := d.get(args[1])
+	if e == nil {
+		return errNoSuchKey
+	}
+	nx := strings.EqualFold(args[0], "RENAMENX")
+	if nx && d.get(args[2]) != nil {
+		return int64(0)
+	}
+	delete(d.keys, args[1])
+	d.touch(args[1])
+	d.keys[args[2]] = e
+	d.touch(args[2])
+	if nx {
+		return int64(1)
+	}
+	return statusOK
+}
+
+func cmdExpire(c *client, args []string) interface{} {
+	name := strings.ToUpper(args[0])
+	n, ok := parseInt(args[2])
+	if !ok {
+		return errNotInteger
+	}
+	now := c.s.now()
+	var t time.Time
+	switch name {
+	case "EXPIRE":
+		t = now.Add(time.Duration(n) * time.Second)
+	case "PEXPIRE":
+		t = now.Add(time.Duration(n) * time.Millisecond)
+	case "EXPIREAT":
+		t = time.Unix(n, 0)
+	case "PEXPIREAT":
+		t = time.Unix(0, n*int64(time.Millisecond))
+	}
+	var nx, xx, gt, lt bool
+	for _, arg := range args[3:] {
+		switch strings.ToUpper(arg) {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		case "GT":
+			gt = true
+		case "LT":
+			lt = true
+		default:
+			return errorReply("ERR Unsupported option " + arg)
+		}
+	}
+	if nx && (xx || gt || lt) {
+		return errorReply("ERR NX and XX, GT or LT options at the same time are not compatible")
+	}
+	if gt && lt {
+		return errorReply("ERR GT and LT options at the same time are not compatible")
+	}
+	d := c.db()
+	e := d.get(args[1])
+	if e == nil {
+		return int64(0)
+	}
+	persistent := e.expireAt.IsZero()
+	switch {
+	case nx && !persistent,
+		xx && persistent,
+		gt && (persistent || !t.After(e.expireAt)),
+		lt && !persistent && !t.Before(e.expireAt):
+		return int64(0)
+	}
+	if !t.After(now) {
+		d.del(args[1])
+		return int64(1)
+	}
+	e.expireAt = t
+	d.touch(args[1])
+	return int64(1)
+}
+
+func cmdTTL(c *client, args []string) interface{} {
+	e := c.db().get(args[1])
+	if e == nil {
+		return int64(-2)
+	}
+	if e.expireAt.IsZero() {
+		return int64(-1)
+	}
+	switch strings.ToUpper(args[0]) {
+	case "TTL":
+		return int64((e.expireAt.Sub(c.s.now()) + time.Second/2) / time.Second)
+	case "PTTL":
+		return int64(e.expireAt.Sub(c.s.now()) / time.Millisecond)
+	case "EXPIRETIME":
+		return e.expireAt.Unix()
+	}
+	return e.expireAt.UnixNano() / int64(time.Millisecond)
+}
+
+func cmdPersist(c *client, args []string) interface{} {
+	d := c.db()
+	e := d.get(args[1])
+	if e == nil || e.expireAt.IsZero() {
+		return int64(0)
+	}
+	e.expireAt = time.Time{}
+	d.touch(args[1])
+	return int64(1)
+}
+
+// matchPattern reports whether s matches the glob-style pattern used by the
+// KEYS command and the MATCH option of SCAN.
+func matchPattern(pattern, s string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for len(pattern) > 1 && pattern[1] == '*' {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 1 {
+				return true
+			}
+			for i := 0; i <= len(s); i++ {
+				if matchPattern(pattern[1:], s[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(s) == 0 {
+				return false
+			}
+			s = s[1:]
+			pattern = pattern[1:]
+		case '[':
+			if len(s) == 0 {
+				return false
+			}
+			pattern = pattern[1:]
+			not := len(pattern) > 0 && pattern[0] == '^'
+			if not {
+				pattern = pattern[1:]
+			}
+			match := false
+			for len(pattern) > 0 && pattern[0] != ']' {
+				switch {
+				case pattern[0] == '\\' && len(pattern) > 1:
+					if pattern[1] == s[0] {
+						match = true
+					}
+					pattern = pattern[2:]
+				case len(pattern) > 2 && pattern[1] == '-':
+					lo, hi := pattern[0], pattern[2]
+					if lo > hi {
+						lo, hi = hi, lo
+					}
+					if s[0] >= lo && s[0] <= hi {
+						match = true
+					}
+					pattern = pattern[3:]
+				default:
+					if pattern[0] == s[0] {
+						match = true
+					}
+					pattern = pattern[1:]
+				}
+			}
+			if len(pattern) > 0 {
+				pattern = pattern[1:]
+			}
+			if match == not {
+				return false
+			}
+			s = s[1:]
+		case '\\':
+			if len(pattern) > 1 {
+				pattern = pattern[1:]
+			}
+			fallthrough
+		default:
+			if len(s) == 0 || pattern[0] != s[0] {
+				return false
+			}
+			s = s[1:]
+			pattern = pattern[1:]
+		}
+	}
+	return len(s) == 0
+}
+
+func formatInt(n int64) string {
+	return strconv.FormatInt(n, 10)
+}
@@ -0,0 +1,553 @@
+package fakeredis
+
+import (
+	"strings"
+	"time"
+)
+
+func init() {
+	register(map[string]command{
+		"LPUSH":      {-3, true, cmdPush},
+		"RPUSH":      {-3, true, cmdPush},
+		"LPUSHX":     {-3, true, cmdPush},
+		"RPUSHX":     {-3, true, cmdPush},
+		"LPOP":       {-2, true, cmdPop},
+		"RPOP":       {-2, true, cmdPop},
+		"LLEN":       {2, false, cmdLLen},
+		"LRANGE":     {4, false, cmdLRange},
+		"LINDEX":     {3, false, cmdLIndex},
+		"LSET":       {4, true, cmdLSet},
+		"LREM":       {4, true, cmdLRem},
+		"LTRIM":      {4, true, cmdLTrim},
+		"LINSERT":    {5, true, cmdLInsert},
+		"LPOS":       {-3, false, cmdLPos},
+		"RPOPLPUSH":  {3, true, cmdRPopLPush},
+		"LMOVE":      {5, true, cmdLMove},
+		"LMPOP":      {-4, true, cmdLMPop},
+		"BLPOP":      {-3, true, cmdBPop},
+		"BRPOP":      {-3, true, cmdBPop},
+		"BRPOPLPUSH": {4, true, cmdBRPopLPush},
+		"BLMOVE":     {6, true, cmdBLMove},
+		"BLMPOP":     {-5, true, cmdBLMPop},
+	})
+}
+
+func (l *listValue) push(left bool, values ...string) {
+	for _, v := range values {
+		if left {
+			l.items = append([]string{v}, l.items...)
+		} else {
+			l.items = append(l.items, v)
+		}
+	}
+}
+
+func (l *listValue) pop(left bool) string {
+	var v string
+	if left {
+		v, l.items = l.items[0], l.items[1:]
+	} else {
+		v, l.items = l.items[len(l.items)-1], l.items[:len(l.items)-1]
+	}
+	return v
+}
+
+// index converts a possibly negative index to an index into the list.
+func (l *listValue) index(i int64) (int, bool) {
+	if i < 0 {
+		i += int64(len(l.items))
+	}
+	if i < 0 || i >= int64(len(l.items)) {
+		return 0, false
+	}
+	return int(i), true
+}
+
+func cmdPush(c *client, args []string) interface{} {
+	name := strings.ToUpper(args[0])
+	d := c.db()
+	onlyExisting := strings.HasSuffix(name, "X")
+	l, err := d.getList(args[1], !onlyExisting)
+	if err != nil {
+		return err
+	}
+	if l == nil {
+		return int64(0)
+	}
+	l.push(name[0] == 'L', args[2:]...)
+	d.touch(args[1])
+	return int64(len(l.items))
+}
+
+func cmdPop(c *client, args []string) interface{} {
+	if len(args) > 3 {
+		return errSyntax
+	}
+	count := int64(-1)
+	if len(args) == 3 {
+		var ok bool
+		if count, ok = parseInt(args[2]); !ok || count < 0 {
+			return errorReply("ERR value is out of range, must be positive")
+		}
+	}
+	d := c.db()
+	l, err := d.getList(args[1], false)
+	if err != nil {
+		return err
+	}
+	if l == nil {
+		if count >= 0 {
+			return nilArray{}
+		}
+		return nil
+	}
+	left := strings.EqualFold(args[0], "LPOP")
+	if count < 0 {
+		v := l.pop(left)
+		d.touch(args[1])
+		d.deleteIfEmpty(args[1])
+		return v
+	}
+	values := []string{}
+	for ; count > 0 && len(l.items) > 0; count-- {
+		values = append(values, l.pop(left))
+	}
+	d.touch(args[1])
+	d.deleteIfEmpty(args[1])
+	return values
+}
+
+func cmdLLen(c *client, args []string) interface{} {
+	l, err := c.db().getList(args[1], false)
+	if err != nil {
+		return err
+	}
+	if l == nil {
+		return int64(0)
+	}
+	return int64(len(l.items))
+}
+
+func cmdLRange(c *client, args []string) interface{} {
+	start, ok1 := parseInt(args[2])
+	stop, ok2 := parseInt(args[3])
+	if !ok1 || !ok2 {
+		return errNotInteger
+	}
+	l, err := c.db().getList(args[1], false)
+	if err != nil {
+		return err
+	}
+	if l == nil {
+		return []string{}
+	}
+	i, j := stringRange(start, stop, len(l.items))
+	return append([]string{}, l.items[i:j]...)
+}
+
+func cmdLIndex(c *client, args []string) interface{} {
+	n, ok := parseInt(args[2])
+	if !ok {
+		return errNotInteger
+	}
+	l, err := c.db().getList(args[1], false)
+	if err != nil {
+		return err
+	}
+	if l == nil {
+		return nil
+	}
+	i, ok := l.index(n)
+	if !ok {
+		return nil
+	}
+	return l.items[i]
+}
+
+func cmdLSet(c *client, args []string) interface{} {
+	n, ok := parseInt(args[2])
+	if !ok {
+		return errNotInteger
+	}
+	d := c.db()
+	l, err := d.getList(args[1], false)
+	if err != nil {
+		return err
+	}
+	if l == nil {
+		return errNoSuchKey
+	}
+	i, ok := l.index(n)
+	if !ok {
+		return errIndexRange
+	}
+	l.items[i] = args[3]
+	d.touch(args[1])
+	return statusOK
+}
+
+func cmdLRem(c *client, args []string) interface{} {
+	count, ok := parseInt(args[2])
+	if !ok {
+		return errNotInteger
+	}
+	d := c.db()
+	l, err := d.getList(args[1], false)
+	if err != nil {
+		return err
+	}
+	if l == nil {
+		return int64(0)
+	}
+	var removed int64
+	items := l.items
+	keep := make([]bool, len(items))
+	for i := range keep {
+		keep[i] = true
+	}
+	if count >= 0 {
+		for i := 0; i < len(items) && (count == 0 || removed < count); i++ {
+			if items[i] == args[3] {
+				keep[i] = false
+				removed++
+			}
+		}
+	} else {
+		for i := len(items) - 1; i >= 0 && removed < -count; i-- {
+			if items[i] == args[3] {
+				keep[i] = false
+				removed++
+			}
+		}
+	}
+	var result []string
+	for i, item := range items {
+		if keep[i] {
+			result = append(result, item)
+		}
+	}
+	l.items = result
+	if removed > 0 {
+		d.touch(args[1])
+		d.deleteIfEmpty(args[1])
+	}
+	return removed
+}
+
+func cmdLTrim(c *client, args []string) interface{} {
+	start, ok1 := parseInt(args[2])
+	stop, ok2 := parseInt(args[3])
+	if !ok1 || !ok2 {
+		return errNotInteger
+	}
+	d := c.db()
+	l, err := d.getList(args[1], false)
+	if err != nil {
+		return err
+	}
+	if l == nil {
+		return statusOK
+	}
+	i, j := stringRange(start, stop, len(l.items))
+	l.items = append([]string{}, l.items[i:j]...)
+	d.touch(args[1])
+	d.deleteIfEmpty(args[1])
+	return statusOK
+}
+
+func cmdLInsert(c *client, args []string) interface{} {
+	var after bool
+	switch strings.ToUpper(args[2]) {
+	case "BEFORE":
+	case "AFTER":
+		after = true
+	default:
+		return errSyntax
+	}
+	d := c.db()
+	l, err := d.getList(args[1], false)
+	if err != nil {
+		return err
+	}
+	if l == nil {
+		return int64(0)
+	}
+	for i, item := range l.items {
+		if item != args[3] {
+			continue
+		}
+		if after {
+			i++
+		}
+		l.items = append(l.items[:i], append([]string{args[4]}, l.items[i:]...)...)
+		d.touch(args[1])
+		return int64(len(l.items))
+	}
+	return int64(-1)
+}
+
+func cmdLPos(c *client, args []string) interface{} {
+	rank, count, maxLen := int64(1), int64(-1), int64(0)
+	for i := 3; i < len(args); i += 2 {
+		if i+1 >= len(args) {
+			return errSyntax
+		}
+		n, ok := parseInt(args[i+1])
+		if !ok {
+			return errNotInteger
+		}
+		switch strings.ToUpper(args[i]) {
+		case "RANK":
+			if n == 0 {
+				return errorReply("ERR RANK can't be zero: use 1 to start from the first match, 2 from the second ... or use negative to start from the end of the list")
+			}
+			rank = n
+		case "COUNT":
+			if n < 0 {
+				return errorReply("ERR COUNT can't be negative")
+			}
+			count = n
+		case "MAXLEN":
+			if n < 0 {
+				return errorReply("ERR MAXLEN can't be negative")
+			}
+			maxLen = n
+		default:
+			return errSyntax
+		}
+	}
+	l, err := c.db().getList(args[1], false)
+	if err != nil {
+		return err
+	}
+	var items []string
+	if l != nil {
+		items = l.items
+	}
+	matches := []int64{}
+	skip := rank - 1
+	step, i := 1, 0
+	if rank < 0 {
+		skip = -rank - 1
+		step, i = -1, len(items)-1
+	}
+	for n := int64(0); i >= 0 && i < len(items) && (maxLen == 0 || n < maxLen); i, n = i+step, n+1 {
+		if items[i] != args[2] {
+			continue
+		}
+		if skip > 0 {
+			skip--
+			continue
+		}
+		matches = append(matches, int64(i))
+		if count != 0 && int64(len(matches)) == count {
+			break
+		}
+		if count < 0 {
+			break
+		}
+	}
+	if count < 0 {
+		if len(matches) == 0 {
+			return nil
+		}
+		return matches[0]
+	}
+	reply := make([]interface{}, len(matches))
+	for i, m := range matches {
+		reply[i] = m
+	}
+	return reply
+}
+
+func parseDirection(s string) (bool, bool) {
+	switch strings.ToUpper(s) {
+	case "LEFT":
+		return true, true
+	case "RIGHT":
+		return false, true
+	}
+	return false, false
+}
+
+// move pops an element from src and pushes it to dst. It returns nil when
+// src does not exist.
+func (c *client) move(src, dst string, fromLeft, toLeft bool) interface{} {
+	d := c.db()
+	l, err := d.getList(src, false)
+	if err != nil {
+		return err
+	}
+	if l == nil {
+		return nil
+	}
+	if _, err := d.getList(dst, false); err != nil {
+		return err
+	}
+	v := l.pop(fromLeft)
+	d.touch(src)
+	d.deleteIfEmpty(src)
+	dl, _ := d.getList(dst, true)
+	dl.push(toLeft, v)
+	d.touch(dst)
+	return v
+}
+
+func cmdRPopLPush(c *client, args []string) interface{} {
+	return c.move(args[1], args[2], false, true)
+}
+
+func cmdLMove(c *client, args []string) interface{} {
+	from, ok1 := parseDirection(args[3])
+	to, ok2 := parseDirection(args[4])
+	if !ok1 || !ok2 {
+		return errSyntax
+	}
+	return c.move(args[1], args[2], from, to)
+}
+
+// parseMPop parses the arguments of LMPOP and ZMPOP following the command
+// name: numkeys key [key ...] where [COUNT count].
+func parseMPop(args []string, parseWhere func(string) bool) (keys []string, where string, count int64, err interface{}) {
+	n, ok := parseInt(args[0])
+	if !ok || n <= 0 {
+		return nil, "", 0, errorReply("ERR numkeys should be greater than 0")
+	}
+	if int64(len(args)) < n+2 {
+		return nil, "", 0, errSyntax
+	}
+	keys = args[1 : n+1]
+	where = strings.ToUpper(args[n+1])
+	if !parseWhere(where) {
+		return nil, "", 0, errSyntax
+	}
+	count = 1
+	rest := args[n+2:]
+	switch {
+	case len(rest) == 0:
+	case len(rest) == 2 && strings.EqualFold(rest[0], "COUNT"):
+		if count, ok = parseInt(rest[1]); !ok || count <= 0 {
+			return nil, "", 0, errorReply("ERR count should be greater than 0")
+		}
+	default:
+		return nil, "", 0, errSyntax
+	}
+	return keys, where, count, nil
+}
+
+// lmpop pops up to count elements from the first non-empty list. The second
+// result is false when all lists are empty.
+func (c *client) lmpop(keys []string, left bool, count int64) (interface{}, bool) {
+	d := c.db()
+	for _, key := range keys {
+		l, err := d.getList(key, false)
+		if err != nil {
+			return err, true
+		}
+		if l == nil {
+			continue
+		}
+		values := []string{}
+		for ; count > 0 && len(l.items) > 0; count-- {
+			values = append(values, l.pop(left))
+		}
+		d.touch(key)
+		d.deleteIfEmpty(key)
+		return []interface{}{key, values}, true
+	}
+	return nilArray{}, false
+}
+
+func isDirection(s string) bool {
+	_, ok := parseDirection(s)
+	return ok
+}
+
+func cmdLMPop(c *client, args []string) interface{} {
+	keys, where, count, err := parseMPop(args[1:], isDirection)
+	if err != nil {
+		return err
+	}
+	reply, _ := c.lmpop(keys, where == "LEFT", count)
+	return reply
+}
+
+// block calls try until try succeeds or the timeout in seconds expires.
+// Commands executed in a transaction do not block.
+func (c *client) block(timeoutArg string, timeoutReply interface{}, try func() (interface{}, bool)) interface{} {
+	secs, ok := parseFloat(timeoutArg)
+	if !ok || secs < 0 {
+		return errorReply("ERR timeout is not a float or out of range")
+	}
+	if reply, ok := try(); ok {
+		return reply
+	}
+	s := c.s
+	if c.execing {
+		return timeoutReply
+	}
+	var deadline time.Time
+	if secs > 0 {
+		d := time.Duration(secs * float64(time.Second))
+		deadline = time.Now().Add(d)
+		t := time.AfterFunc(d, func() {
+			s.mu.Lock()
+			s.cond.Broadcast()
+			s.mu.Unlock()
+		})
+		defer t.Stop()
+	}
+	for {
+		s.cond.Wait()
+		if s.closed {
+			return timeoutReply
+		}
+		if reply, ok := try(); ok {
+			return reply
+		}
+		if !deadline.IsZero() && !time.Now().Before(deadline) {
+			return timeoutReply
+		}
+	}
+}
+
+func cmdBPop(c *client, args []string) interface{} {
+	keys := args[1 : len(args)-1]
+	left := strings.EqualFold(args[0], "BLPOP")
+	return c.block(args[len(args)-1], nilArray{}, func() (interface{}, bool) {
+		reply, ok := c.lmpop(keys, left, 1)
+		if r, isPop := reply.([]interface{}); ok && isPop {
+			return []interface{}{r[0], r[1].([]string)[0]}, true
+		}
+		return reply, ok
+	})
+}
+
+func cmdBRPopLPush(c *client, args []string) interface{} {
+	return c.block(args[3], nil, func() (interface{}, bool) {
+		reply := c.move(args[1], args[2], false, true)
+		return reply, reply != nil
+	})
+}
+
+func cmdBLMove(c *client, args []string) interface{} {
+	from, ok1 := parseDirection(args[3])
+	to, ok2 := parseDirection(args[4])
+	if !ok1 || !ok2 {
+		return errSyntax
+	}
+	return c.block(args[5], nil, func() (interface{}, bool) {
+		reply := c.move(args[1], args[2], from, to)
+		return reply, reply != nil
+	})
+}
+
+func cmdBLMPop(c *client, args []string) interface{} {
+	keys, where, count, err := parseMPop(args[2:], isDirection)
+	if err != nil {
+		return err
+	}
+	return c.block(args[1], nilArray{}, func() (interface{}, bool) {
+		return c.lmpop(keys, where == "LEFT", count)
+	})
+}
@@ -0,0 +1,132 @@
+package fakeredis
+
+import (
+	"sort"
+	"strings"
+)
+
+func init() {
+	register(map[string]command{
+		"SUBSCRIBE":    {-2, false, cmdSubscribe},
+		"PSUBSCRIBE":   {-2, false, cmdSubscribe},
+		"UNSUBSCRIBE":  {-1, false, cmdUnsubscribe},
+		"PUNSUBSCRIBE": {-1, false, cmdUnsubscribe},
+		"PUBLISH":      {3, false, cmdPublish},
+		"PUBSUB":       {-2, false, cmdPubSub},
+	})
+}
+
+// subscriptions returns the channels or patterns of c and the server index
+// for the subscription type.
+func (c *client) subscriptions(pattern bool) (map[string]struct{}, map[string]map[*client]struct{}) {
+	if pattern {
+		return c.patterns, c.s.pattern
+	}
+	return c.channels, c.s.channel
+}
+
+func (c *client) subscriptionCount() int64 {
+	return int64(len(c.channels) + len(c.patterns))
+}
+
+func cmdSubscribe(c *client, args []string) interface{} {
+	pattern := strings.EqualFold(args[0], "PSUBSCRIBE")
+	kind := strings.ToLower(args[0])
+	own, index := c.subscriptions(pattern)
+	for _, name := range args[1:] {
+		own[name] = struct{}{}
+		if index[name] == nil {
+			index[name] = make(map[*client]struct{})
+		}
+		index[name][c] = struct{}{}
+		c.write([]interface{}{kind, name, c.subscriptionCount()})
+	}
+	return noReply{}
+}
+
+func cmdUnsubscribe(c *client, args []string) interface{} {
+	pattern := strings.EqualFold(args[0], "PUNSUBSCRIBE")
+	kind := strings.ToLower(args[0])
+	own, _ := c.subscriptions(pattern)
+	names := args[1:]
+	if len(names) == 0 {
+		for name := range own {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+	if len(names) == 0 {
+		c.write([]interface{}{kind, nil, c.subscriptionCount()})
+		return noReply{}
+	}
+	for _, name := range names {
+		c.unsubscribe(pattern, name)
+		c.write([]interface{}{kind, name, c.subscriptionCount()})
+	}
+	return noReply{}
+}
+
+func (c *client) unsubscribe(pattern bool, name string) {
+	own, index := c.subscriptions(pattern)
+	delete(own, name)
+	if subs := index[name]; subs != nil {
+		delete(subs, c)
+		if len(subs) == 0 {
+			delete(index, name)
+		}
+	}
+}
+
+// unsubscribeAll removes all subscriptions of c. It must be called with the
+// server mutex held.
+func (s *Server) unsubscribeAll(c *client) {
+	for name := range c.channels {
+		c.unsubscribe(false, name)
+	}
+	for name := range c.patterns {
+		c.unsubscribe(true, name)
+	}
+}
+
+func cmdPublish(c *client, args []string) interface{} {
+	s := c.s
+	var n int64
+	for sub := range s.channel[args[1]] {
+		sub.write([]interface{}{"message", args[1], args[2]})
+		n++
+	}
+	for pattern, subs := range s.pattern {
+		if !matchPattern(pattern, args[1]) {
+			continue
+		}
+		for sub := range subs {
+			sub.write([]interface{}{"pmessage", pattern, args[1], args[2]})
+			n++
+		}
+	}
+	return n
+}
+
+func cmdPubSub(c *client, args []string) interface{} {
+	s := c.s
+	switch strings.ToUpper(args[1]) {
+	case "CHANNELS":
+		channels := []string{}
+		for name := range s.channel {
+			if len(args) < 3 || matchPattern(args[2], name) {
+				channels = append(channels, name)
+			}
+		}
+		sort.Strings(channels)
+		return channels
+	case "NUMSUB":
+		result := []interface{}{}
+		for _, name := range args[2:] {
+			result = append(result, name, int64(len(s.channel[name])))
+		}
+		return result
+	case "NUMPAT":
+		return int64(len(s.pattern))
+	}
+	return errorReply("ERR unknown subcommand '" + args[1] + "'")
+}
@@ -0,0 +1,184 @@
+package fakeredis
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Reply types that are not represented by a plain Go type. Strings are
+// written as bulk strings, nil as a null bulk string, integers as integers
+// and []interface{} as arrays.
+type (
+	// status is a simple string reply.
+	status string
+
+	// errorReply is an error reply.
+	errorReply string
+
+	// nilArray is the null array reply.
+	nilArray struct{}
+)
+
+const statusOK = status("OK")
+
+var (
+	errSyntax         = errorReply("ERR syntax error")
+	errNotInteger     = errorReply("ERR value is not an integer or out of range")
+	errNotFloat       = errorReply("ERR value is not a valid float")
+	errWrongType      = errorReply("WRONGTYPE Operation against a key holding the wrong kind of value")
+	errNoSuchKey      = errorReply("ERR no such key")
+	errIndexRange     = errorReply("ERR index out of range")
+	errMinMaxNotFloat = errorReply("ERR min or max is not a float")
+	errMinMaxNotValid = errorReply("ERR min or max not valid string range item")
+	errOverflow       = errorReply("ERR increment or decrement would overflow")
+)
+
+func errWrongArgs(name string) errorReply {
+	return errorReply("ERR wrong number of arguments for '" + strings.ToLower(name) + "' command")
+}
+
+var errProtocol = errors.New("fakeredis: protocol error")
+
+// readCommand reads a command sent as a RESP array of bulk strings or as an
+// inline command.
+func readCommand(br *bufio.Reader) ([]string, error) {
+	line, err := readLine(br)
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 {
+		return nil, nil
+	}
+	if line[0] != '*' {
+		return strings.Fields(line), nil
+	}
+	n, err := strconv.Atoi(line[1:])
+	if err != nil || n < 0 {
+		return nil, errProtocol
+	}
+	args := make([]string, n)
+	for i := range args {
+		line, err := readLine(br)
+		if err != nil {
+			return nil, err
+		}
+		if len(line) == 0 || line[0] != '$' {
+			return nil, errProtocol
+		}
+		size, err := strconv.Atoi(line[1:])
+		if err != nil || size < 0 {
+			return nil, errProtocol
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(br, buf); err != nil {
+			return nil, err
+		}
+		if buf[size] != '\r' || buf[size+1] != '\n' {
+			return nil, errProtocol
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
+
+func readLine(br *bufio.Reader) (string, error) {
+	line, err := br.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	line = strings.TrimSuffix(line, "\n")
+	return strings.TrimSuffix(line, "\r"), nil
+}
+
+// appendReply appends the RESP encoding of v to buf.
+func appendReply(buf []byte, v interface{}) []byte {
+	switch v := v.(type) {
+	case nil:
+		return append(buf, "$-1\r\n"...)
+	case nilArray:
+		return append(buf, "*-1\r\n"...)
+	case status:
+		buf = append(buf, '+')
+		buf = append(buf, v...)
+		return append(buf, "\r\n"...)
+	case errorReply:
+		buf = append(buf, '-')
+		buf = append(buf, v...)
+		return append(buf, "\r\n"...)
+	case int:
+		return appendInt(buf, ':', int64(v))
+	case int64:
+		return appendInt(buf, ':', v)
+	case bool:
+		if v {
+			return append(buf, ":1\r\n"...)
+		}
+		return append(buf, ":0\r\n"...)
+	case float64:
+		return appendReply(buf, formatFloat(v))
+	case string:
+		buf = appendInt(buf, '$', int64(len(v)))
+		buf = append(buf, v...)
+		return append(buf, "\r\n"...)
+	case []string:
+		buf = appendInt(buf, '*', int64(len(v)))
+		for _, s := range v {
+			buf = appendReply(buf, s)
+		}
+		return buf
+	case []interface{}:
+		buf = appendInt(buf, '*', int64(len(v)))
+		for _, e := range v {
+			buf = appendReply(buf, e)
+		}
+		return buf
+	}
+	panic("fakeredis: unexpected reply type")
+}
+
+func appendInt(buf []byte, prefix byte, n int64) []byte {
+	buf = append(buf, prefix)
+	buf = strconv.AppendInt(buf, n, 10)
+	return append(buf, "\r\n"...)
+}
+
+// formatFloat formats f the way the Redis server formats scores and the
+// result of INCRBYFLOAT.
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// formatIncrFloat formats the result of INCRBYFLOAT and HINCRBYFLOAT, which
+// never use exponent notation.
+func formatIncrFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+func parseInt(s string) (int64, bool) {
+	n, err := strconv.ParseInt(s, 10, 64)
+	return n, err == nil
+}
+
+func parseFloat(s string) (float64, bool) {
+	switch strings.ToLower(s) {
+	case "inf", "+inf":
+		return math.Inf(1), true
+	case "-inf":
+		return math.Inf(-1), true
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || f != f {
+		return 0, false
+	}
+	return f, true
+}
@@ -0,0 +1,313 @@
+// Package fakeredis implements the in-process Redis server exported by the
+// redistest package. The package does not depend on the redis package so
+// that the tests of the redis package can use the server.
+package fakeredis
+
+import (
+	"bufio"
+	"errors"
+	"math/rand"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+var errServerClosed = errors.New("fakeredis: server closed")
+
+// Server is an in-process Redis server for tests. The server keeps all
+// data in memory and executes one command at a time.
+//
+// Keys expire according to the server clock. The clock follows the system
+// time until SetTime or Advance is called.
+type Server struct {
+	ln   net.Listener
+	wg   sync.WaitGroup
+	mu   sync.Mutex
+	cond *sync.Cond // signaled after write commands for blocking commands
+
+	closed  bool
+	conns   map[*client]struct{}
+	dbs     map[int]*db
+	clock   time.Time
+	offset  time.Duration
+	frozen  bool
+	channel map[string]map[*client]struct{}
+	pattern map[string]map[*client]struct{}
+	rand    *rand.Rand
+}
+
+// NewServer starts a server listening on a random port of the loopback
+// interface.
+func NewServer() (*Server, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	s := newServer()
+	s.ln = ln
+	s.wg.Add(1)
+	go s.accept()
+	return s, nil
+}
+
+// NewPipeServer returns a server that does not listen on the network. Use
+// the Dial method to connect to the server.
+func NewPipeServer() *Server {
+	return newServer()
+}
+
+func newServer() *Server {
+	s := &Server{
+		conns:   make(map[*client]struct{}),
+		dbs:     make(map[int]*db),
+		channel: make(map[string]map[*client]struct{}),
+		pattern: make(map[string]map[*client]struct{}),
+		rand:    rand.New(rand.NewSource(1)),
+	}
+	s.cond = sync.NewCond(&s.mu)
+	return s
+}
+
+// Addr returns the network address of the server. Addr returns "" for a
+// server created with NewPipeServer.
+func (s *Server) Addr() string {
+	if s.ln == nil {
+		return ""
+	}
+	return s.ln.Addr().String()
+}
+
+// Dial returns a connection to the server over net.Pipe. Dial has the
+// signature of the Dial field of redis.Pool.
+func (s *Server) Dial() (net.Conn, error) {
+	c1, c2 := net.Pipe()
+	if !s.serve(c2) {
+		c1.Close()
+		return nil, errServerClosed
+	}
+	return c1, nil
+}
+
+// Close stops the server and closes all connections.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	var conns []*client
+	for c := range s.conns {
+		conns = append(conns, c)
+	}
+	s.cond.Broadcast()
+	s.mu.Unlock()
+
+	var err error
+	if s.ln != nil {
+		err = s.ln.Close()
+	}
+	for _, c := range conns {
+		c.netConn.Close()
+	}
+	s.wg.Wait()
+	return err
+}
+
+// Now returns the time of the server clock.
+func (s *Server) Now() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.now()
+}
+
+// SetTime stops the server clock at t.
+func (s *Server) SetTime(t time.Time) {
+	s.mu.Lock()
+	s.clock = t
+	s.frozen = true
+	s.mu.Unlock()
+}
+
+// Advance moves the server clock forward by d. Keys with a TTL less than or
+// equal to d expire.
+func (s *Server) Advance(d time.Duration) {
+	s.mu.Lock()
+	if s.frozen {
+		s.clock = s.clock.Add(d)
+	} else {
+		s.offset += d
+	}
+	s.mu.Unlock()
+}
+
+// FlushAll deletes all keys in all databases.
+func (s *Server) FlushAll() {
+	s.mu.Lock()
+	for _, db := range s.dbs {
+		db.flush()
+	}
+	s.mu.Unlock()
+}
+
+func (s *Server) now() time.Time {
+	if s.frozen {
+		return s.clock
+	}
+	return time.Now().Add(s.offset)
+}
+
+func (s *Server) db(n int) *db {
+	d := s.dbs[n]
+	if d == nil {
+		d = newDB(s)
+		s.dbs[n] = d
+	}
+	return d
+}
+
+func (s *Server) accept() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		if !s.serve(conn) {
+			conn.Close()
+			return
+		}
+	}
+}
+
+// serve starts the goroutines for a new connection. It returns false if the
+// server is closed.
+func (s *Server) serve(conn net.Conn) bool {
+	c := newClient(s, conn)
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return false
+	}
+	s.conns[c] = struct{}{}
+	s.wg.Add(2)
+	s.mu.Unlock()
+	go c.writeLoop()
+	go c.readLoop()
+	return true
+}
+
+// client is the server side of a connection.
+type client struct {
+	s       *Server
+	netConn net.Conn
+
+	// Accessed with s.mu held.
+	dbIndex  int
+	multi    bool
+	queued   [][]string
+	txError  bool
+	execing  bool
+	watched  map[watchKey]uint64
+	channels map[string]struct{}
+	patterns map[string]struct{}
+
+	outMu  sync.Mutex
+	outC   *sync.Cond
+	out    []byte
+	closed bool
+}
+
+type watchKey struct {
+	db  int
+	key string
+}
+
+func newClient(s *Server, conn net.Conn) *client {
+	c := &client{
+		s:        s,
+		netConn:  conn,
+		channels: make(map[string]struct{}),
+		patterns: make(map[string]struct{}),
+	}
+	c.outC = sync.NewCond(&c.outMu)
+	return c
+}
+
+func (c *client) db() *db {
+	return c.s.db(c.dbIndex)
+}
+
+func (c *client) subscribed() bool {
+	return len(c.channels)+len(c.patterns) > 0
+}
+
+// write queues a reply for the writer goroutine.
+func (c *client) write(v interface{}) {
+	c.outMu.Lock()
+	c.out = appendReply(c.out, v)
+	c.outMu.Unlock()
+	c.outC.Signal()
+}
+
+func (c *client) writeLoop() {
+	defer c.s.wg.Done()
+	var buf []byte
+	for {
+		c.outMu.Lock()
+		for len(c.out) == 0 && !c.closed {
+			c.outC.Wait()
+		}
+		if len(c.out) == 0 {
+			c.outMu.Unlock()
+			c.netConn.Close()
+			return
+		}
+		buf, c.out = c.out, buf[:0]
+		c.outMu.Unlock()
+		if _, err := c.netConn.Write(buf); err != nil {
+			c.netConn.Close()
+			c.outMu.Lock()
+			c.closed = true
+			c.outMu.Unlock()
+			return
+		}
+	}
+}
+
+func (c *client) readLoop() {
+	defer c.s.wg.Done()
+	defer c.close()
+	br := bufio.NewReader(c.netConn)
+	for {
+		args, err := readCommand(br)
+		if err != nil {
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+		if strings.EqualFold(args[0], "QUIT") {
+			c.write(statusOK)
+			return
+		}
+		if reply := c.s.execute(c, args); reply != (noReply{}) {
+			c.write(reply)
+		}
+	}
+}
+
+func (c *client) close() {
+	s := c.s
+	s.mu.Lock()
+	delete(s.conns, c)
+	s.unsubscribeAll(c)
+	s.mu.Unlock()
+
+	// Let the writer flush the pending replies and exit.
+	c.outMu.Lock()
+	c.closed = true
+	c.outMu.Unlock()
+	c.outC.Signal()
+}
@@ -0,0 +1,290 @@
+package fakeredis
+
+import (
+	"sort"
+	"strings"
+)
+
+func init() {
+	register(map[string]command{
+		"SADD":        {-3, true, cmdSAdd},
+		"SREM":        {-3, true, cmdSRem},
+		"SCARD":       {2, false, cmdSCard},
+		"SISMEMBER":   {3, false, cmdSIsMember},
+		"SMISMEMBER":  {-3, false, cmdSMIsMember},
+		"SMEMBERS":    {2, false, cmdSMembers},
+		"SPOP":        {-2, true, cmdSPop},
+		"SRANDMEMBER": {-2, false, cmdSRandMember},
+		"SMOVE":       {4, true, cmdSMove},
+		"SDIFF":       {-2, false, cmdSetOp},
+		"SINTER":      {-2, false, cmdSetOp},
+		"SUNION":      {-2, false, cmdSetOp},
+		"SDIFFSTORE":  {-3, true, cmdSetOpStore},
+		"SINTERSTORE": {-3, true, cmdSetOpStore},
+		"SUNIONSTORE": {-3, true, cmdSetOpStore},
+		"SSCAN":       {-3, false, cmdSScan},
+	})
+}
+
+// members returns the members of s in sorted order so that replies are
+// deterministic.
+func (s setValue) members() []string {
+	members := make([]string, 0, len(s))
+	for m := range s {
+		members = append(members, m)
+	}
+	sort.Strings(members)
+	return members
+}
+
+func cmdSAdd(c *client, args []string) interface{} {
+	d := c.db()
+	s, err := d.getSet(args[1], true)
+	if err != nil {
+		return err
+	}
+	var n int64
+	for _, m := range args[2:] {
+		if _, ok := s[m]; !ok {
+			s[m] = struct{}{}
+			n++
+		}
+	}
+	d.touch(args[1])
+	return n
+}
+
+func cmdSRem(c *client, args []string) interface{} {
+	d := c.db()
+	s, err := d.getSet(args[1], false)
+	if err != nil {
+		return err
+	}
+	var n int64
+	for _, m := range args[2:] {
+		if _, ok := s[m]; ok {
+			delete(s, m)
+			n++
+		}
+	}
+	if n > 0 {
+		d.touch(args[1])
+		d.deleteIfEmpty(args[1])
+	}
+	return n
+}
+
+func cmdSCard(c *client, args []string) interface{} {
+	s, err := c.db().getSet(args[1], false)
+	if err != nil {
+		return err
+	}
+	return int64(len(s))
+}
+
+func cmdSIsMember(c *client, args []string) interface{} {
+	s, err := c.db().getSet(args[1], false)
+	if err != nil {
+		return err
+	}
+	_, ok := s[args[2]]
+	return ok
+}
+
+func cmdSMIsMember(c *client, args []string) interface{} {
+	s, err := c.db().getSet(args[1], false)
+	if err != nil {
+		return err
+	}
+	result := make([]interface{}, len(args)-2)
+	for i, m := range args[2:] {
+		_, ok := s[m]
+		result[i] = ok
+	}
+	return result
+}
+
+func cmdSMembers(c *client, args []string) interface{} {
+	s, err := c.db().getSet(args[1], false)
+	if err != nil {
+		return err
+	}
+	return s.members()
+}
+
+// parseCount parses the optional count argument of SPOP and SRANDMEMBER.
+func parseCount(args []string) (count int64, hasCount bool, err interface{}) {
+	switch len(args) {
+	case 2:
+		return 1, false, nil
+	case 3:
+		n, ok := parseInt(args[2])
+		if !ok {
+			return 0, false, errNotInteger
+		}
+		return n, true, nil
+	}
+	return 0, false, errSyntax
+}
+
+func cmdSPop(c *client, args []string) interface{} {
+	count, hasCount, err := parseCount(args)
+	if err != nil {
+		return err
+	}
+	if count < 0 {
+		return errorReply("ERR value is out of range, must be positive")
+	}
+	d := c.db()
+	s, err := d.getSet(args[1], false)
+	if err != nil {
+		return err
+	}
+	members := s.members()
+	popped := []string{}
+	for ; count > 0 && len(members) > 0; count-- {
+		i := c.s.rand.Intn(len(members))
+		popped = append(popped, members[i])
+		delete(s, members[i])
+		members = append(members[:i], members[i+1:]...)
+	}
+	if len(popped) > 0 {
+		d.touch(args[1])
+		d.deleteIfEmpty(args[1])
+	}
+	if hasCount {
+		return popped
+	}
+	if len(popped) == 0 {
+		return nil
+	}
+	return popped[0]
+}
+
+func cmdSRandMember(c *client, args []string) interface{} {
+	count, hasCount, err := parseCount(args)
+	if err != nil {
+		return err
+	}
+	s, err := c.db().getSet(args[1], false)
+	if err != nil {
+		return err
+	}
+	members := s.members()
+	if !hasCount {
+		if len(members) == 0 {
+			return nil
+		}
+		return members[c.s.rand.Intn(len(members))]
+	}
+	result := []string{}
+	if len(members) == 0 {
+		return result
+	}
+	if count < 0 {
+		// A negative count allows the same member more than once.
+		for ; count < 0; count++ {
+			result = append(result, members[c.s.rand.Intn(len(members))])
+		}
+		return result
+	}
+	for _, i := range c.s.rand.Perm(len(members)) {
+		if int64(len(result)) == count {
+			break
+		}
+		result = append(result, members[i])
+	}
+	return result
+}
+
+func cmdSMove(c *client, args []string) interface{} {
+	d := c.db()
+	src, err := d.getSet(args[1], false)
+	if err != nil {
+		return err
+	}
+	if _, err := d.getSet(args[2], false); err != nil {
+		return err
+	}
+	if _, ok := src[args[3]]; !ok {
+		return int64(0)
+	}
+	delete(src, args[3])
+	d.touch(args[1])
+	d.deleteIfEmpty(args[1])
+	dst, _ := d.getSet(args[2], true)
+	dst[args[3]] = struct{}{}
+	d.touch(args[2])
+	return int64(1)
+}
+
+// setOp computes the difference, intersection or union of the sets at keys.
+func (c *client) setOp(op string, keys []string) (setValue, interface{}) {
+	d := c.db()
+	var result setValue
+	for i, key := range keys {
+		s, err := d.getSet(key, false)
+		if err != nil {
+			return nil, err
+		}
+		if i == 0 {
+			result = setValue{}
+			for m := range s {
+				result[m] = struct{}{}
+			}
+			continue
+		}
+		switch op {
+		case "SDIFF":
+			for m := range s {
+				delete(result, m)
+			}
+		case "SINTER":
+			for m := range result {
+				if _, ok := s[m]; !ok {
+					delete(result, m)
+				}
+			}
+		case "SUNION":
+			for m := range s {
+				result[m] = struct{}{}
+			}
+		}
+	}
+	return result, nil
+}
+
+func cmdSetOp(c *client, args []string) interface{} {
+	result, err := c.setOp(strings.ToUpper(args[0]), args[1:])
+	if err != nil {
+		return err
+	}
+	return result.members()
+}
+
+func cmdSetOpStore(c *client, args []string) interface{} {
+	op := strings.TrimSuffix(strings.ToUpper(args[0]), "STORE")
+	result, err := c.setOp(op, args[2:])
+	if err != nil {
+		return err
+	}
+	d := c.db()
+	d.del(args[1])
+	if len(result) > 0 {
+		d.set(args[1], result)
+	}
+	return int64(len(result))
+}
+
+func cmdSScan(c *client, args []string) interface{} {
+	opts, err := parseScanOptions(args[2:])
+	if err != nil {
+		return err
+	}
+	s, err := c.db().getSet(args[1], false)
+	if err != nil {
+		return err
+	}
+	next, members := opts.scan(s.members(), nil)
+	return []interface{}{next, members}
+}
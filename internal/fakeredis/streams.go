@@ -0,0 +1,197 @@
+package fakeredis
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	register(map[string]command{
+		"XADD":   {-5, true, cmdXAdd},
+		"XRANGE": {-4, false, cmdXRange},
+	})
+}
+
+var (
+	errStreamID      = errorReply("ERR Invalid stream ID specified as stream command argument")
+	errStreamIDSmall = errorReply("ERR The ID specified in XADD is equal or smaller than the target stream top item")
+	errStreamIDZero  = errorReply("ERR The ID specified in XADD must be greater than 0-0")
+	maxStreamID      = streamID{math.MaxUint64, math.MaxUint64}
+)
+
+type streamID struct{ ms, seq uint64 }
+
+func (id streamID) String() string {
+	return strconv.FormatUint(id.ms, 10) + "-" + strconv.FormatUint(id.seq, 10)
+}
+
+func (id streamID) less(other streamID) bool {
+	return id.ms < other.ms || (id.ms == other.ms && id.seq < other.seq)
+}
+
+// next returns the smallest ID greater than id.
+func (id streamID) next() (streamID, bool) {
+	switch {
+	case id.seq < math.MaxUint64:
+		return streamID{id.ms, id.seq + 1}, true
+	case id.ms < math.MaxUint64:
+		return streamID{id.ms + 1, 0}, true
+	}
+	return id, false
+}
+
+// parseStreamID parses an ID of the form ms-seq or ms. The seq part of an
+// ID without one is set to defaultSeq.
+func parseStreamID(s string, defaultSeq uint64) (streamID, bool) {
+	ms, seq := s, ""
+	if i := strings.Index(s, "-"); i >= 0 {
+		ms, seq = s[:i], s[i+1:]
+	}
+	var (
+		id  streamID
+		err error
+	)
+	if id.ms, err = strconv.ParseUint(ms, 10, 64); err != nil {
+		return id, false
+	}
+	if seq == "" {
+		id.seq = defaultSeq
+		return id, !strings.Contains(s, "-")
+	}
+	id.seq, err = strconv.ParseUint(seq, 10, 64)
+	return id, err == nil
+}
+
+// parseRangeID parses a start or end argument of XRANGE. The special IDs -
+// and + are the smallest and largest IDs. A ( prefix makes the bound
+// exclusive.
+func parseRangeID(s string, start bool) (streamID, bool) {
+	switch s {
+	case "-":
+		return streamID{}, true
+	case "+":
+		return maxStreamID, true
+	}
+	exclusive := strings.HasPrefix(s, "(")
+	if exclusive {
+		s = s[1:]
+	}
+	defaultSeq := uint64(0)
+	if !start {
+		defaultSeq = math.MaxUint64
+	}
+	id, ok := parseStreamID(s, defaultSeq)
+	if !ok || !exclusive {
+		return id, ok
+	}
+	if start {
+		return id.next()
+	}
+	if id == (streamID{}) {
+		return id, false
+	}
+	if id.seq > 0 {
+		return streamID{id.ms, id.seq - 1}, true
+	}
+	return streamID{id.ms - 1, math.MaxUint64}, true
+}
+
+type streamEntry struct {
+	id     streamID
+	fields []string
+}
+
+func (e streamEntry) reply() []interface{} {
+	return []interface{}{e.id.String(), e.fields}
+}
+
+type streamValue struct {
+	entries []streamEntry
+	last    streamID
+}
+
+func cmdXAdd(c *client, args []string) interface{} {
+	const i = 2
+	if (len(args)-i)%2 != 1 {
+		return errWrongArgs(args[0])
+	}
+	d := c.db()
+	st, err := d.getStream(args[1], true)
+	if err != nil {
+		return err
+	}
+
+	var id streamID
+	if args[i] == "*" {
+		ms := uint64(c.s.now().UnixNano() / 1e6)
+		if ms > st.last.ms {
+			id = streamID{ms, 0}
+		} else {
+			var ok bool
+			if id, ok = st.last.next(); !ok {
+				return errStreamIDSmall
+			}
+		}
+	} else {
+		var ok bool
+		if id, ok = parseStreamID(args[i], 0); !ok {
+			return errStreamID
+		}
+		if id == (streamID{}) {
+			return errStreamIDZero
+		}
+		if !st.last.less(id) {
+			return errStreamIDSmall
+		}
+	}
+
+	fields := make([]string, len(args)-i-1)
+	copy(fields, args[i+1:])
+	st.entries = append(st.entries, streamEntry{id: id, fields: fields})
+	st.last = id
+	d.touch(args[1])
+	return id.String()
+}
+
+func cmdXRange(c *client, args []string) interface{} {
+	start, ok := parseRangeID(args[2], true)
+	if !ok {
+		return errStreamID
+	}
+	end, ok := parseRangeID(args[3], false)
+	if !ok {
+		return errStreamID
+	}
+	count := int64(-1)
+	switch len(args) {
+	case 4:
+	case 6:
+		if !strings.EqualFold(args[4], "COUNT") {
+			return errSyntax
+		}
+		if count, ok = parseInt(args[5]); !ok {
+			return errNotInteger
+		}
+	default:
+		return errSyntax
+	}
+
+	st, err := c.db().getStream(args[1], false)
+	if err != nil {
+		return err
+	}
+	result := []interface{}{}
+	if st == nil || count == 0 {
+		return result
+	}
+	for _, e := range st.entries {
+		if count >= 0 && int64(len(result)) >= count {
+			break
+		}
+		if !e.id.less(start) && !end.less(e.id) {
+			result = append(result, e.reply())
+		}
+	}
+	return result
+}
@@ -0,0 +1,766 @@
+package fakeredis
+
+import (
+	"math"
+	"math/bits"
+	"strings"
+	"time"
+)
+
+func init() {
+	register(map[string]command{
+		"GET":         {2, false, cmdGet},
+		"SET":         {-3, true, cmdSet},
+		"SETNX":       {3, true, cmdSetNX},
+		"SETEX":       {4, true, cmdSetEX},
+		"PSETEX":      {4, true, cmdSetEX},
+		"GETSET":      {3, true, cmdGetSet},
+		"GETDEL":      {2, true, cmdGetDel},
+		"GETEX":       {-2, true, cmdGetEx},
+		"MGET":        {-2, false, cmdMGet},
+		"MSET":        {-3, true, cmdMSet},
+		"MSETNX":      {-3, true, cmdMSet},
+		"APPEND":      {3, true, cmdAppend},
+		"STRLEN":      {2, false, cmdStrLen},
+		"INCR":        {2, true, cmdIncr},
+		"DECR":        {2, true, cmdIncr},
+		"INCRBY":      {3, true, cmdIncr},
+		"DECRBY":      {3, true, cmdIncr},
+		"INCRBYFLOAT": {3, true, cmdIncrByFloat},
+		"GETRANGE":    {4, false, cmdGetRange},
+		"SUBSTR":      {4, false, cmdGetRange},
+		"SETRANGE":    {4, true, cmdSetRange},
+		"GETBIT":      {3, false, cmdGetBit},
+		"SETBIT":      {4, true, cmdSetBit},
+		"BITCOUNT":    {-2, false, cmdBitCount},
+		"BITPOS":      {-3, false, cmdBitPos},
+		"BITOP":       {-4, true, cmdBitOp},
+		"LCS":         {-3, false, cmdLCS},
+	})
+}
+
+func cmdGet(c *client, args []string) interface{} {
+	s, ok, err := c.db().getString(args[1])
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return nil
+	}
+	return s
+}
+
+// parseExpireOption parses the value of the EX, PX, EXAT and PXAT options.
+func parseExpireOption(c *client, option, value, cmd string) (time.Time, interface{}) {
+	n, ok := parseInt(value)
+	if !ok {
+		return time.Time{}, errNotInteger
+	}
+	if n <= 0 {
+		return time.Time{}, errorReply("ERR invalid expire time in '" + cmd + "' command")
+	}
+	switch option {
+	case "EX":
+		return c.s.now().Add(time.Duration(n) * time.Second), nil
+	case "PX":
+		return c.s.now().Add(time.Duration(n) * time.Millisecond), nil
+	case "EXAT":
+		return time.Unix(n, 0), nil
+	}
+	return time.Unix(0, n*int64(time.Millisecond)), nil
+}
+
+func cmdSet(c *client, args []string) interface{} {
+	key, value := args[1], args[2]
+	var (
+		nx, xx, get, keepTTL bool
+		expireAt             time.Time
+		expireSet            bool
+	)
+	for i := 3; i < len(args); i++ {
+		option := strings.ToUpper(args[i])
+		switch option {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		case "GET":
+			get = true
+		case "KEEPTTL":
+			keepTTL = true
+		case "EX", "PX", "EXAT", "PXAT":
+			if expireSet || i+1 >= len(args) {
+				return errSyntax
+			}
+			t, err := parseExpireOption(c, option, args[i+1], "set")
+			if err != nil {
+				return err
+			}
+			expireAt, expireSet = t, true
+			i++
+		default:
+			return errSyntax
+		}
+	}
+	if (nx && xx) || (keepTTL && expireSet) {
+		return errSyntax
+	}
+
+	d := c.db()
+	e := d.get(key)
+	var old interface{}
+	if get && e != nil {
+		s, ok := e.value.(string)
+		if !ok {
+			return errWrongType
+		}
+		old = s
+	}
+	if (nx && e != nil) || (xx && e == nil) {
+		if get {
+			return old
+		}
+		return nil
+	}
+	var ttl time.Time
+	if keepTTL && e != nil {
+		ttl = e.expireAt
+	}
+	if expireSet {
+		ttl = expireAt
+	}
+	d.keys[key] = &entry{value: value, expireAt: ttl}
+	d.touch(key)
+	if get {
+		return old
+	}
+	return statusOK
+}
+
+func cmdSetNX(c *client, args []string) interface{} {
+	d := c.db()
+	if d.get(args[1]) != nil {
+		return int64(0)
+	}
+	d.set(args[1], args[2])
+	return int64(1)
+}
+
+func cmdSetEX(c *client, args []string) interface{} {
+	option := "EX"
+	if strings.EqualFold(args[0], "PSETEX") {
+		option = "PX"
+	}
+	t, err := parseExpireOption(c, option, args[2], strings.ToLower(args[0]))
+	if err != nil {
+		return err
+	}
+	d := c.db()
+	d.keys[args[1]] = &entry{value: args[3], expireAt: t}
+	d.touch(args[1])
+	return statusOK
+}
+
+func cmdGetSet(c *client, args []string) interface{} {
+	d := c.db()
+	s, ok, err := d.getString(args[1])
+	if err != nil {
+		return err
+	}
+	d.set(args[1], args[2])
+	if !ok {
+		return nil
+	}
+	return s
+}
+
+func cmdGetDel(c *client, args []string) interface{} {
+	d := c.db()
+	s, ok, err := d.getString(args[1])
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return nil
+	}
+	d.del(args[1])
+	return s
+}
+
+func cmdGetEx(c *client, args []string) interface{} {
+	var (
+		expireAt  time.Time
+		expireSet bool
+		persist   bool
+	)
+	for i := 2; i < len(args); i++ {
+		option := strings.ToUpper(args[i])
+		switch option {
+		case "PERSIST":
+			persist = true
+		case "EX", "PX", "EXAT", "PXAT":
+			if expireSet || i+1 >= len(args) {
+				return errSyntax
+			}
+			t, err := parseExpireOption(c, option, args[i+1], "getex")
+			if err != nil {
+				return err
+			}
+			expireAt, expireSet = t, true
+			i++
+		default:
+			return errSyntax
+		}
+	}
+	if persist && expireSet {
+		return errSyntax
+	}
+	d := c.db()
+	s, ok, err := d.getString(args[1])
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return nil
+	}
+	switch {
+	case persist:
+		d.keys[args[1]].expireAt = time.Time{}
+		d.touch(args[1])
+	case expireSet && !expireAt.After(c.s.now()):
+		d.del(args[1])
+	case expireSet:
+		d.keys[args[1]].expireAt = expireAt
+		d.touch(args[1])
+	}
+	return s
+}
+
+func cmdMGet(c *client, args []string) interface{} {
+	d := c.db()
+	values := make([]interface{}, len(args)-1)
+	for i, key := range args[1:] {
+		if s, ok, err := d.getString(key); ok && err == nil {
+			values[i] = s
+		}
+	}
+	return values
+}
+
+func cmdMSet(c *client, args []string) interface{} {
+	if len(args)%2 != 1 {
+		return errWrongArgs(args[0])
+	}
+	d := c.db()
+	nx := strings.EqualFold(args[0], "MSETNX")
+	if nx {
+		for i := 1; i < len(args); i += 2 {
+			if d.get(args[i]) != nil {
+				return int64(0)
+			}
+		}
+	}
+	for i := 1; i < len(args); i += 2 {
+		d.set(args[i], args[i+1])
+	}
+	if nx {
+		return int64(1)
+	}
+	return statusOK
+}
+
+func cmdAppend(c *client, args []string) interface{} {
+	d := c.db()
+	s, ok, err := d.getString(args[1])
+	if err != nil {
+		return err
+	}
+	s += args[2]
+	if ok {
+		d.keys[args[1]].value = s
+		d.touch(args[1])
+	} else {
+		d.set(args[1], s)
+	}
+	return int64(len(s))
+}
+
+func cmdStrLen(c *client, args []string) interface{} {
+	s, _, err := c.db().getString(args[1])
+	if err != nil {
+		return err
+	}
+	return int64(len(s))
+}
+
+// setString updates the value of a string key, preserving the TTL.
+func (d *db) setString(key, s string) {
+	if e := d.get(key); e != nil {
+		e.value = s
+		d.touch(key)
+		return
+	}
+	d.set(key, s)
+}
+
+func cmdIncr(c *client, args []string) interface{} {
+	var delta int64 = 1
+	name := strings.ToUpper(args[0])
+	if len(args) == 3 {
+		var ok bool
+		if delta, ok = parseInt(args[2]); !ok {
+			return errNotInteger
+		}
+	}
+	if name == "DECR" || name == "DECRBY" {
+		if delta == math.MinInt64 {
+			return errorReply("ERR decrement would overflow")
+		}
+		delta = -delta
+	}
+	d := c.db()
+	s, ok, err := d.getString(args[1])
+	if err != nil {
+		return err
+	}
+	var n int64
+	if ok {
+		if n, ok = parseInt(s); !ok {
+			return errNotInteger
+		}
+	}
+	if (delta > 0 && n > math.MaxInt64-delta) || (delta < 0 && n < math.MinInt64-delta) {
+		return errOverflow
+	}
+	n += delta
+	d.setString(args[1], formatInt(n))
+	return n
+}
+
+func cmdIncrByFloat(c *client, args []string) interface{} {
+	delta, ok := parseFloat(args[2])
+	if !ok {
+		return errNotFloat
+	}
+	d := c.db()
+	s, exists, err := d.getString(args[1])
+	if err != nil {
+		return err
+	}
+	var f float64
+	if exists {
+		if f, ok = parseFloat(s); !ok {
+			return errNotFloat
+		}
+	}
+	f += delta
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		return errorReply("ERR increment would produce NaN or Infinity")
+	}
+	s = formatIncrFloat(f)
+	d.setString(args[1], s)
+	return s
+}
+
+// stringRange converts the start and end arguments of GETRANGE and similar
+// commands to a slice range of a string with length n.
+func stringRange(start, end int64, n int) (int, int) {
+	if start < 0 {
+		start += int64(n)
+	}
+	if end < 0 {
+		end += int64(n)
+	}
+	if start < 0 {
+		start = 0
+	}
+	if end < 0 {
+		end = 0
+	}
+	if end >= int64(n) {
+		end = int64(n) - 1
+	}
+	if start > end || n == 0 {
+		return 0, 0
+	}
+	return int(start), int(end) + 1
+}
+
+func cmdGetRange(c *client, args []string) interface{} {
+	start, ok1 := parseInt(args[2])
+	end, ok2 := parseInt(args[3])
+	if !ok1 || !ok2 {
+		return errNotInteger
+	}
+	s, _, err := c.db().getString(args[1])
+	if err != nil {
+		return err
+	}
+	if start < 0 && end < 0 && start > end {
+		return ""
+	}
+	i, j := stringRange(start, end, len(s))
+	return s[i:j]
+}
+
+func cmdSetRange(c *client, args []string) interface{} {
+	offset, ok := parseInt(args[2])
+	if !ok {
+		return errNotInteger
+	}
+	if offset < 0 || offset+int64(len(args[3])) > 512*1024*1024 {
+		return errorReply("ERR offset is out of range")
+	}
+	d := c.db()
+	s, exists, err := d.getString(args[1])
+	if err != nil {
+		return err
+	}
+	if len(args[3]) == 0 {
+		return int64(len(s))
+	}
+	b := []byte(s)
+	if end := int(offset) + len(args[3]); end > len(b) {
+		b = append(b, make([]byte, end-len(b))...)
+	}
+	copy(b[offset:], args[3])
+	if exists {
+		d.setString(args[1], string(b))
+	} else {
+		d.set(args[1], string(b))
+	}
+	return int64(len(b))
+}
+
+func cmdGetBit(c *client, args []string) interface{} {
+	offset, ok := parseInt(args[2])
+	if !ok || offset < 0 {
+		return errorReply("ERR bit offset is not an integer or out of range")
+	}
+	s, _, err := c.db().getString(args[1])
+	if err != nil {
+		return err
+	}
+	i := offset / 8
+	if i >= int64(len(s)) {
+		return int64(0)
+	}
+	return int64(s[i]>>(7-uint(offset%8))) & 1
+}
+
+func cmdSetBit(c *client, args []string) interface{} {
+	offset, ok := parseInt(args[2])
+	if !ok || offset < 0 || offset >= 4*1024*1024*1024 {
+		return errorReply("ERR bit offset is not an integer or out of range")
+	}
+	if args[3] != "0" && args[3] != "1" {
+		return errorReply("ERR bit is not an integer or out of range")
+	}
+	d := c.db()
+	s, exists, err := d.getString(args[1])
+	if err != nil {
+		return err
+	}
+	b := []byte(s)
+	i := int(offset / 8)
+	if i >= len(b) {
+		b = append(b, make([]byte, i+1-len(b))...)
+	}
+	mask := byte(1) << (7 - uint(offset%8))
+	old := int64(0)
+	if b[i]&mask != 0 {
+		old = 1
+	}
+	if args[3] == "1" {
+		b[i] |= mask
+	} else {
+		b[i] &^= mask
+	}
+	if exists {
+		d.setString(args[1], string(b))
+	} else {
+		d.set(args[1], string(b))
+	}
+	return old
+}
+
+// parseBitRange parses the optional start, end and unit arguments of
+// BITCOUNT and BITPOS. It returns the bit range [start, end) of a string
+// with length n and whether end was specified.
+func parseBitRange(args []string, n int) (start, end int64, endSet bool, err interface{}) {
+	bit := false
+	if len(args) == 3 {
+		switch strings.ToUpper(args[2]) {
+		case "BIT":
+			bit = true
+		case "BYTE":
+		default:
+			return 0, 0, false, errSyntax
+		}
+		args = args[:2]
+	}
+	if len(args) > 2 {
+		return 0, 0, false, errSyntax
+	}
+	size := int64(n)
+	if bit {
+		size *= 8
+	}
+	start, end = 0, size-1
+	if len(args) > 0 {
+		var ok bool
+		if start, ok = parseInt(args[0]); !ok {
+			return 0, 0, false, errNotInteger
+		}
+	}
+	if len(args) > 1 {
+		var ok bool
+		if end, ok = parseInt(args[1]); !ok {
+			return 0, 0, false, errNotInteger
+		}
+		endSet = true
+	}
+	if start < 0 {
+		start += size
+	}
+	if end < 0 {
+		end += size
+	}
+	if start < 0 {
+		start = 0
+	}
+	if end < 0 {
+		end = 0
+	}
+	if end >= size {
+		end = size - 1
+	}
+	if start > end {
+		return 0, 0, endSet, nil
+	}
+	if !bit {
+		return start * 8, (end + 1) * 8, endSet, nil
+	}
+	return start, end + 1, endSet, nil
+}
+
+func bitAt(s string, i int64) int64 {
+	return int64(s[i/8]>>(7-uint(i%8))) & 1
+}
+
+func cmdBitCount(c *client, args []string) interface{} {
+	s, _, err := c.db().getString(args[1])
+	if err != nil {
+		return err
+	}
+	if len(args) == 3 {
+		return errSyntax
+	}
+	start, end, _, err := parseBitRange(args[2:], len(s))
+	if err != nil {
+		return err
+	}
+	var n int64
+	for i := start; i < end; i++ {
+		if i%8 == 0 && i+8 <= end {
+			n += int64(bits.OnesCount8(s[i/8]))
+			i += 7
+			continue
+		}
+		n += bitAt(s, i)
+	}
+	return n
+}
+
+func cmdBitPos(c *client, args []string) interface{} {
+	if args[2] != "0" && args[2] != "1" {
+		return errorReply("ERR The bit argument must be 1 or 0.")
+	}
+	bit := int64(args[2][0] - '0')
+	s, exists, err := c.db().getString(args[1])
+	if err != nil {
+		return err
+	}
+	if !exists {
+		if bit == 1 {
+			return int64(-1)
+		}
+		return int64(0)
+	}
+	start, end, endSet, err := parseBitRange(args[3:], len(s))
+	if err != nil {
+		return err
+	}
+	for i := start; i < end; i++ {
+		if bitAt(s, i) == bit {
+			return i
+		}
+	}
+	if bit == 0 && !endSet && start < end {
+		// The string is padded with zeros on the right.
+		return end
+	}
+	return int64(-1)
+}
+
+func cmdBitOp(c *client, args []string) interface{} {
+	op := strings.ToUpper(args[1])
+	if op == "NOT" && len(args) != 4 {
+		return errorReply("ERR BITOP NOT must be called with a single source key.")
+	}
+	d := c.db()
+	var srcs []string
+	maxLen := 0
+	for _, key := range args[3:] {
+		s, _, err := d.getString(key)
+		if err != nil {
+			return err
+		}
+		srcs = append(srcs, s)
+		if len(s) > maxLen {
+			maxLen = len(s)
+		}
+	}
+	result := make([]byte, maxLen)
+	for i := range result {
+		var b byte
+		for j, s := range srcs {
+			var v byte
+			if i < len(s) {
+				v = s[i]
+			}
+			switch {
+			case j == 0 && op != "NOT":
+				b = v
+			case op == "AND":
+				b &= v
+			case op == "OR":
+				b |= v
+			case op == "XOR":
+				b ^= v
+			case op == "NOT":
+				b = ^v
+			default:
+				return errSyntax
+			}
+		}
+		result[i] = b
+	}
+	switch op {
+	case "AND", "OR", "XOR", "NOT":
+	default:
+		return errSyntax
+	}
+	if maxLen == 0 {
+		d.del(args[2])
+	} else {
+		d.set(args[2], string(result))
+	}
+	return int64(maxLen)
+}
+
+// cmdLCS implements LCS key1 key2 [LEN] [IDX] [MINMATCHLEN len]
+// [WITHMATCHLEN]. The matches are reported from the end of the strings, as
+// by Redis.
+func cmdLCS(c *client, args []string) interface{} {
+	var (
+		getLen, getIdx, withMatchLen bool
+		minMatchLen                  int64
+	)
+	for i := 3; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "LEN":
+			getLen = true
+		case "IDX":
+			getIdx = true
+		case "WITHMATCHLEN":
+			withMatchLen = true
+		case "MINMATCHLEN":
+			if i+1 >= len(args) {
+				return errSyntax
+			}
+			var ok bool
+			if minMatchLen, ok = parseInt(args[i+1]); !ok {
+				return errNotInteger
+			}
+			i++
+		default:
+			return errSyntax
+		}
+	}
+	if getLen && getIdx {
+		return errorReply("ERR If you want both the length and indexes, please just use IDX.")
+	}
+	d := c.db()
+	a, _, err := d.getString(args[1])
+	if err != nil {
+		return err
+	}
+	b, _, err := d.getString(args[2])
+	if err != nil {
+		return err
+	}
+
+	// lcs[i][j] is the length of the LCS of a[:i] and b[:j].
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+		for j := 1; i > 0 && j <= len(b); j++ {
+			switch {
+			case a[i-1] == b[j-1]:
+				lcs[i][j] = lcs[i-1][j-1] + 1
+			case lcs[i-1][j] > lcs[i][j-1]:
+				lcs[i][j] = lcs[i-1][j]
+			default:
+				lcs[i][j] = lcs[i][j-1]
+			}
+		}
+	}
+	n := lcs[len(a)][len(b)]
+	if getLen {
+		return int64(n)
+	}
+
+	result := make([]byte, n)
+	matches := []interface{}{}
+	// The current range is a[astart:aend] and b[bstart:bend].
+	astart, aend, bstart, bend := -1, -1, -1, -1
+	emit := func() {
+		if astart >= 0 && (minMatchLen <= 0 || int64(aend-astart) >= minMatchLen) {
+			match := []interface{}{
+				[]interface{}{int64(astart), int64(aend - 1)},
+				[]interface{}{int64(bstart), int64(bend - 1)},
+			}
+			if withMatchLen {
+				match = append(match, int64(aend-astart))
+			}
+			matches = append(matches, match)
+		}
+		astart = -1
+	}
+	for i, j, k := len(a), len(b), n; i > 0 && j > 0; {
+		if a[i-1] == b[j-1] {
+			if astart >= 0 && (astart != i || bstart != j) {
+				emit()
+			}
+			if astart < 0 {
+				aend, bend = i, j
+			}
+			astart, bstart = i-1, j-1
+			result[k-1] = a[i-1]
+			i, j, k = i-1, j-1, k-1
+			continue
+		}
+		emit()
+		if lcs[i-1][j] > lcs[i][j-1] {
+			i--
+		} else {
+			j--
+		}
+	}
+	emit()
+	if !getIdx {
+		return string(result)
+	}
+	return []interface{}{"matches", matches, "len", int64(n)}
+}
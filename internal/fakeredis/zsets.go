@@ -0,0 +1,967 @@
+package fakeredis
+
+import (
+	"math"
+	"sort"
+	"strings"
+)
+
+func init() {
+	register(map[string]command{
+		"ZADD":             {-4, true, cmdZAdd},
+		"ZINCRBY":          {4, true, cmdZIncrBy},
+		"ZCARD":            {2, false, cmdZCard},
+		"ZCOUNT":           {4, false, cmdZCount},
+		"ZLEXCOUNT":        {4, false, cmdZCount},
+		"ZSCORE":           {3, false, cmdZScore},
+		"ZMSCORE":          {-3, false, cmdZMScore},
+		"ZRANK":            {-3, false, cmdZRank},
+		"ZREVRANK":         {-3, false, cmdZRank},
+		"ZRANGE":           {-4, false, cmdZRange},
+		"ZRANGEBYSCORE":    {-4, false, cmdZRange},
+		"ZRANGEBYLEX":      {-4, false, cmdZRange},
+		"ZREVRANGE":        {-4, false, cmdZRange},
+		"ZREVRANGEBYSCORE": {-4, false, cmdZRange},
+		"ZREVRANGEBYLEX":   {-4, false, cmdZRange},
+		"ZREM":             {-3, true, cmdZRem},
+		"ZREMRANGEBYRANK":  {4, true, cmdZRemRange},
+		"ZREMRANGEBYSCORE": {4, true, cmdZRemRange},
+		"ZREMRANGEBYLEX":   {4, true, cmdZRemRange},
+		"ZRANGESTORE":      {-5, true, cmdZRangeStore},
+		"ZUNIONSTORE":      {-4, true, cmdZSetOpStore},
+		"ZINTERSTORE":      {-4, true, cmdZSetOpStore},
+		"ZDIFFSTORE":       {-4, true, cmdZSetOpStore},
+		"ZUNION":           {-3, false, cmdZSetOp},
+		"ZINTER":           {-3, false, cmdZSetOp},
+		"ZDIFF":            {-3, false, cmdZSetOp},
+		"ZINTERCARD":       {-3, false, cmdZInterCard},
+		"ZRANDMEMBER":      {-2, false, cmdZRandMember},
+		"ZPOPMIN":          {-2, true, cmdZPop},
+		"ZPOPMAX":          {-2, true, cmdZPop},
+		"BZPOPMIN":         {-3, true, cmdBZPop},
+		"BZPOPMAX":         {-3, true, cmdBZPop},
+		"ZMPOP":            {-4, true, cmdZMPop},
+		"BZMPOP":           {-5, true, cmdBZMPop},
+		"ZSCAN":            {-3, false, cmdZScan},
+	})
+}
+
+type zsetValue struct {
+	scores map[string]float64
+}
+
+func newZSet() *zsetValue {
+	return &zsetValue{scores: make(map[string]float64)}
+}
+
+type zmember struct {
+	member string
+	score  float64
+}
+
+type zmembers []zmember
+
+func (z zmembers) Len() int      { return len(z) }
+func (z zmembers) Swap(i, j int) { z[i], z[j] = z[j], z[i] }
+func (z zmembers) Less(i, j int) bool {
+	if z[i].score != z[j].score {
+		return z[i].score < z[j].score
+	}
+	return z[i].member < z[j].member
+}
+
+// sorted returns the members ordered by score and then by member.
+func (z *zsetValue) sorted() zmembers {
+	members := make(zmembers, 0, len(z.scores))
+	for m, score := range z.scores {
+		members = append(members, zmember{m, score})
+	}
+	sort.Sort(members)
+	return members
+}
+
+func (z zmembers) reverse() {
+	for i, j := 0, len(z)-1; i < j; i, j = i+1, j-1 {
+		z[i], z[j] = z[j], z[i]
+	}
+}
+
+// reply returns the members, followed by their scores when withScores is set.
+func (z zmembers) reply(withScores bool) []string {
+	result := []string{}
+	for _, m := range z {
+		result = append(result, m.member)
+		if withScores {
+			result = append(result, formatFloat(m.score))
+		}
+	}
+	return result
+}
+
+// scoreBound is the min or max argument of a score range.
+type scoreBound struct {
+	value     float64
+	exclusive bool
+}
+
+func parseScoreBound(s string) (scoreBound, bool) {
+	var b scoreBound
+	if strings.HasPrefix(s, "(") {
+		b.exclusive = true
+		s = s[1:]
+	}
+	var ok bool
+	b.value, ok = parseFloat(s)
+	return b, ok
+}
+
+type scoreRange struct{ min, max scoreBound }
+
+func parseScoreRange(min, max string) (scoreRange, interface{}) {
+	lo, ok1 := parseScoreBound(min)
+	hi, ok2 := parseScoreBound(max)
+	if !ok1 || !ok2 {
+		return scoreRange{}, errMinMaxNotFloat
+	}
+	return scoreRange{lo, hi}, nil
+}
+
+func (r scoreRange) contains(m zmember) bool {
+	if m.score < r.min.value || (r.min.exclusive && m.score == r.min.value) {
+		return false
+	}
+	if m.score > r.max.value || (r.max.exclusive && m.score == r.max.value) {
+		return false
+	}
+	return true
+}
+
+// lexBound is the min or max argument of a lexicographical range. The
+// arguments "-" and "+" are the lowest and highest possible strings.
+type lexBound struct {
+	value     string
+	exclusive bool
+	inf       int
+}
+
+func parseLexBound(s string) (lexBound, bool) {
+	switch {
+	case s == "-":
+		return lexBound{inf: -1}, true
+	case s == "+":
+		return lexBound{inf: 1}, true
+	case strings.HasPrefix(s, "["):
+		return lexBound{value: s[1:]}, true
+	case strings.HasPrefix(s, "("):
+		return lexBound{value: s[1:], exclusive: true}, true
+	}
+	return lexBound{}, false
+}
+
+type lexRange struct{ min, max lexBound }
+
+func parseLexRange(min, max string) (lexRange, interface{}) {
+	lo, ok1 := parseLexBound(min)
+	hi, ok2 := parseLexBound(max)
+	if !ok1 || !ok2 {
+		return lexRange{}, errMinMaxNotValid
+	}
+	return lexRange{lo, hi}, nil
+}
+
+func (r lexRange) contains(m zmember) bool {
+	switch r.min.inf {
+	case 1:
+		return false
+	case 0:
+		if m.member < r.min.value || (r.min.exclusive && m.member == r.min.value) {
+			return false
+		}
+	}
+	switch r.max.inf {
+	case -1:
+		return false
+	case 0:
+		if m.member > r.max.value || (r.max.exclusive && m.member == r.max.value) {
+			return false
+		}
+	}
+	return true
+}
+
+func cmdZAdd(c *client, args []string) interface{} {
+	var nx, xx, gt, lt, ch, incr bool
+	i := 2
+options:
+	for ; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		case "GT":
+			gt = true
+		case "LT":
+			lt = true
+		case "CH":
+			ch = true
+		case "INCR":
+			incr = true
+		default:
+			break options
+		}
+	}
+	pairs := args[i:]
+	if len(pairs) == 0 || len(pairs)%2 != 0 {
+		return errSyntax
+	}
+	if nx && xx {
+		return errorReply("ERR XX and NX options at the same time are not compatible")
+	}
+	if (gt && lt) || (nx && (gt || lt)) {
+		return errorReply("ERR GT, LT, and/or NX options at the same time are not compatible")
+	}
+	if incr && len(pairs) != 2 {
+		return errorReply("ERR INCR option supports a single increment-element pair")
+	}
+	scores := make([]float64, len(pairs)/2)
+	for j := range scores {
+		var ok bool
+		if scores[j], ok = parseFloat(pairs[2*j]); !ok {
+			return errNotFloat
+		}
+	}
+	d := c.db()
+	z, err := d.getZSet(args[1], true)
+	if err != nil {
+		return err
+	}
+	var added, changed int64
+	var result interface{}
+	for j, score := range scores {
+		member := pairs[2*j+1]
+		old, exists := z.scores[member]
+		if incr {
+			score += old
+			if math.IsNaN(score) {
+				d.deleteIfEmpty(args[1])
+				return errorReply("ERR resulting score is not a number (NaN)")
+			}
+		}
+		switch {
+		case nx && exists, xx && !exists,
+			gt && exists && score <= old,
+			lt && exists && score >= old:
+			continue
+		}
+		z.scores[member] = score
+		if !exists {
+			added++
+		} else if score != old {
+			changed++
+		}
+		result = formatFloat(score)
+	}
+	if added+changed > 0 {
+		d.touch(args[1])
+	}
+	d.deleteIfEmpty(args[1])
+	if incr {
+		return result
+	}
+	if ch {
+		return added + changed
+	}
+	return added
+}
+
+func cmdZIncrBy(c *client, args []string) interface{} {
+	delta, ok := parseFloat(args[2])
+	if !ok {
+		return errNotFloat
+	}
+	d := c.db()
+	z, err := d.getZSet(args[1], true)
+	if err != nil {
+		return err
+	}
+	score := z.scores[args[3]] + delta
+	if math.IsNaN(score) {
+		d.deleteIfEmpty(args[1])
+		return errorReply("ERR resulting score is not a number (NaN)")
+	}
+	z.scores[args[3]] = score
+	d.touch(args[1])
+	return formatFloat(score)
+}
+
+func cmdZCard(c *client, args []string) interface{} {
+	z, err := c.db().getZSet(args[1], false)
+	if err != nil {
+		return err
+	}
+	if z == nil {
+		return int64(0)
+	}
+	return int64(len(z.scores))
+}
+
+// zfilter returns a function that reports whether a member is in the score
+// or lexicographical range given by min and max.
+func zfilter(byLex bool, min, max string) (func(zmember) bool, interface{}) {
+	if byLex {
+		r, err := parseLexRange(min, max)
+		if err != nil {
+			return nil, err
+		}
+		return r.contains, nil
+	}
+	r, err := parseScoreRange(min, max)
+	if err != nil {
+		return nil, err
+	}
+	return r.contains, nil
+}
+
+func cmdZCount(c *client, args []string) interface{} {
+	contains, err := zfilter(strings.EqualFold(args[0], "ZLEXCOUNT"), args[2], args[3])
+	if err != nil {
+		return err
+	}
+	z, err := c.db().getZSet(args[1], false)
+	if err != nil {
+		return err
+	}
+	var n int64
+	if z != nil {
+		for _, m := range z.sorted() {
+			if contains(m) {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+func cmdZScore(c *client, args []string) interface{} {
+	z, err := c.db().getZSet(args[1], false)
+	if err != nil {
+		return err
+	}
+	if z == nil {
+		return nil
+	}
+	score, ok := z.scores[args[2]]
+	if !ok {
+		return nil
+	}
+	return formatFloat(score)
+}
+
+func cmdZMScore(c *client, args []string) interface{} {
+	z, err := c.db().getZSet(args[1], false)
+	if err != nil {
+		return err
+	}
+	result := make([]interface{}, len(args)-2)
+	for i, member := range args[2:] {
+		if z == nil {
+			continue
+		}
+		if score, ok := z.scores[member]; ok {
+			result[i] = formatFloat(score)
+		}
+	}
+	return result
+}
+
+func cmdZRank(c *client, args []string) interface{} {
+	withScore := false
+	switch {
+	case len(args) == 4 && strings.EqualFold(args[3], "WITHSCORE"):
+		withScore = true
+	case len(args) != 3:
+		return errSyntax
+	}
+	z, err := c.db().getZSet(args[1], false)
+	if err != nil {
+		return err
+	}
+	if z == nil {
+		if withScore {
+			return nilArray{}
+		}
+		return nil
+	}
+	members := z.sorted()
+	if strings.EqualFold(args[0], "ZREVRANK") {
+		members.reverse()
+	}
+	for i, m := range members {
+		if m.member == args[2] {
+			if withScore {
+				return []interface{}{int64(i), formatFloat(m.score)}
+			}
+			return int64(i)
+		}
+	}
+	if withScore {
+		return nilArray{}
+	}
+	return nil
+}
+
+// zrangeSpec is a range of a sorted set as specified by the arguments of
+// ZRANGE.
+type zrangeSpec struct {
+	byScore, byLex bool
+	rev            bool
+	start, stop    string
+	limit          bool
+	offset, count  int64
+	withScores     bool
+}
+
+// parseZRange parses the arguments of name following the key. The legacy
+// range commands are mapped to the equivalent ZRANGE options.
+func parseZRange(name string, args []string) (zrangeSpec, interface{}) {
+	spec := zrangeSpec{start: args[0], stop: args[1], count: -1}
+	switch name {
+	case "ZRANGEBYSCORE":
+		spec.byScore = true
+	case "ZRANGEBYLEX":
+		spec.byLex = true
+	case "ZREVRANGE":
+		spec.rev = true
+	case "ZREVRANGEBYSCORE":
+		spec.byScore, spec.rev = true, true
+	case "ZREVRANGEBYLEX":
+		spec.byLex, spec.rev = true, true
+	}
+	for i := 2; i < len(args); i++ {
+		switch option := strings.ToUpper(args[i]); {
+		case option == "WITHSCORES" && name != "ZRANGEBYLEX" && name != "ZREVRANGEBYLEX":
+			spec.withScores = true
+		case option == "LIMIT" && name != "ZREVRANGE":
+			if i+2 >= len(args) {
+				return spec, errSyntax
+			}
+			var ok1, ok2 bool
+			spec.offset, ok1 = parseInt(args[i+1])
+			spec.count, ok2 = parseInt(args[i+2])
+			if !ok1 || !ok2 {
+				return spec, errNotInteger
+			}
+			spec.limit = true
+			i += 2
+		case option == "BYSCORE" && name == "ZRANGE":
+			spec.byScore = true
+		case option == "BYLEX" && name == "ZRANGE":
+			spec.byLex = true
+		case option == "REV" && name == "ZRANGE":
+			spec.rev = true
+		default:
+			return spec, errSyntax
+		}
+	}
+	if spec.limit && !spec.byScore && !spec.byLex {
+		return spec, errorReply("ERR syntax error, LIMIT is only supported in combination with either BYSCORE or BYLEX")
+	}
+	if spec.byLex && spec.withScores {
+		return spec, errorReply("ERR syntax error, WITHSCORES not supported in combination with BYLEX")
+	}
+	if spec.byScore && spec.byLex {
+		return spec, errSyntax
+	}
+	return spec, nil
+}
+
+// zrange returns the members of z in the range given by spec.
+func (z *zsetValue) zrange(spec zrangeSpec) (zmembers, interface{}) {
+	members := zmembers{}
+	if z != nil {
+		members = z.sorted()
+	}
+	if !spec.byScore && !spec.byLex {
+		start, ok1 := parseInt(spec.start)
+		stop, ok2 := parseInt(spec.stop)
+		if !ok1 || !ok2 {
+			return nil, errNotInteger
+		}
+		if spec.rev {
+			members.reverse()
+		}
+		i, j := stringRange(start, stop, len(members))
+		return members[i:j], nil
+	}
+	min, max := spec.start, spec.stop
+	if spec.rev {
+		min, max = max, min
+	}
+	contains, err := zfilter(spec.byLex, min, max)
+	if err != nil {
+		return nil, err
+	}
+	if spec.rev {
+		members.reverse()
+	}
+	result := zmembers{}
+	offset := spec.offset
+	for _, m := range members {
+		if !contains(m) {
+			continue
+		}
+		if offset > 0 {
+			offset--
+			continue
+		}
+		if offset < 0 || (spec.count >= 0 && int64(len(result)) >= spec.count) {
+			break
+		}
+		result = append(result, m)
+	}
+	return result, nil
+}
+
+func cmdZRange(c *client, args []string) interface{} {
+	name := strings.ToUpper(args[0])
+	if len(args) < 4 {
+		return errWrongArgs(name)
+	}
+	spec, err := parseZRange(name, args[2:])
+	if err != nil {
+		return err
+	}
+	z, err := c.db().getZSet(args[1], false)
+	if err != nil {
+		return err
+	}
+	members, err := z.zrange(spec)
+	if err != nil {
+		return err
+	}
+	return members.reply(spec.withScores)
+}
+
+func cmdZRangeStore(c *client, args []string) interface{} {
+	spec, err := parseZRange("ZRANGE", args[3:])
+	if err != nil {
+		return err
+	}
+	if spec.withScores {
+		return errSyntax
+	}
+	d := c.db()
+	z, err := d.getZSet(args[2], false)
+	if err != nil {
+		return err
+	}
+	members, err := z.zrange(spec)
+	if err != nil {
+		return err
+	}
+	d.del(args[1])
+	if len(members) > 0 {
+		dst := newZSet()
+		for _, m := range members {
+			dst.scores[m.member] = m.score
+		}
+		d.set(args[1], dst)
+	}
+	return int64(len(members))
+}
+
+func cmdZRem(c *client, args []string) interface{} {
+	d := c.db()
+	z, err := d.getZSet(args[1], false)
+	if err != nil {
+		return err
+	}
+	if z == nil {
+		return int64(0)
+	}
+	var n int64
+	for _, member := range args[2:] {
+		if _, ok := z.scores[member]; ok {
+			delete(z.scores, member)
+			n++
+		}
+	}
+	if n > 0 {
+		d.touch(args[1])
+		d.deleteIfEmpty(args[1])
+	}
+	return n
+}
+
+func cmdZRemRange(c *client, args []string) interface{} {
+	spec := zrangeSpec{start: args[2], stop: args[3], count: -1}
+	switch strings.ToUpper(args[0]) {
+	case "ZREMRANGEBYSCORE":
+		spec.byScore = true
+	case "ZREMRANGEBYLEX":
+		spec.byLex = true
+	}
+	d := c.db()
+	z, err := d.getZSet(args[1], false)
+	if err != nil {
+		return err
+	}
+	members, err := z.zrange(spec)
+	if err != nil {
+		return err
+	}
+	for _, m := range members {
+		delete(z.scores, m.member)
+	}
+	if len(members) > 0 {
+		d.touch(args[1])
+		d.deleteIfEmpty(args[1])
+	}
+	return int64(len(members))
+}
+
+// zsetOp computes the union, intersection or difference of the sorted sets
+// given by the arguments numkeys key [key ...] [WEIGHTS weight [weight ...]]
+// [AGGREGATE SUM|MIN|MAX] [WITHSCORES]. Plain sets are treated as sorted sets
+// with a score of 1.
+func (c *client) zsetOp(op string, args []string, allowWithScores bool) (result map[string]float64, withScores bool, err interface{}) {
+	n, ok := parseInt(args[0])
+	if !ok {
+		return nil, false, errNotInteger
+	}
+	if n <= 0 {
+		return nil, false, errorReply("ERR at least 1 input key is needed for '" + strings.ToLower(op) + "' command")
+	}
+	if int64(len(args)) < n+1 {
+		return nil, false, errSyntax
+	}
+	keys := args[1 : n+1]
+	weights := make([]float64, n)
+	for i := range weights {
+		weights[i] = 1
+	}
+	aggregate := "SUM"
+	for i := int(n) + 1; i < len(args); i++ {
+		switch option := strings.ToUpper(args[i]); {
+		case option == "WEIGHTS" && op != "ZDIFF":
+			if i+int(n) >= len(args) {
+				return nil, false, errSyntax
+			}
+			for j := range weights {
+				if weights[j], ok = parseFloat(args[i+1+j]); !ok {
+					return nil, false, errorReply("ERR weight value is not a float")
+				}
+			}
+			i += int(n)
+		case option == "AGGREGATE" && op != "ZDIFF":
+			if i+1 >= len(args) {
+				return nil, false, errSyntax
+			}
+			aggregate = strings.ToUpper(args[i+1])
+			if aggregate != "SUM" && aggregate != "MIN" && aggregate != "MAX" {
+				return nil, false, errSyntax
+			}
+			i++
+		case option == "WITHSCORES" && allowWithScores:
+			withScores = true
+		default:
+			return nil, false, errSyntax
+		}
+	}
+
+	d := c.db()
+	for i, key := range keys {
+		var scores map[string]float64
+		if e := d.get(key); e != nil {
+			switch v := e.value.(type) {
+			case *zsetValue:
+				scores = v.scores
+			case setValue:
+				scores = make(map[string]float64, len(v))
+				for m := range v {
+					scores[m] = 1
+				}
+			default:
+				return nil, false, errWrongType
+			}
+		}
+		if i == 0 {
+			result = make(map[string]float64, len(scores))
+			for m, score := range scores {
+				result[m] = zweight(score, weights[0])
+			}
+			continue
+		}
+		switch op {
+		case "ZUNION":
+			for m, score := range scores {
+				score = zweight(score, weights[i])
+				if old, ok := result[m]; ok {
+					score = zaggregate(aggregate, old, score)
+				}
+				result[m] = score
+			}
+		case "ZINTER":
+			for m, old := range result {
+				score, ok := scores[m]
+				if !ok {
+					delete(result, m)
+					continue
+				}
+				result[m] = zaggregate(aggregate, old, zweight(score, weights[i]))
+			}
+		case "ZDIFF":
+			for m := range scores {
+				delete(result, m)
+			}
+		}
+	}
+	return result, withScores, nil
+}
+
+func zweight(score, weight float64) float64 {
+	if score == 0 || weight == 0 {
+		// Avoid NaN for inf * 0.
+		return 0
+	}
+	return score * weight
+}
+
+func zaggregate(aggregate string, a, b float64) float64 {
+	switch aggregate {
+	case "MIN":
+		return math.Min(a, b)
+	case "MAX":
+		return math.Max(a, b)
+	}
+	if sum := a + b; !math.IsNaN(sum) {
+		return sum
+	}
+	return 0
+}
+
+func cmdZSetOpStore(c *client, args []string) interface{} {
+	op := strings.TrimSuffix(strings.ToUpper(args[0]), "STORE")
+	result, _, err := c.zsetOp(op, args[2:], false)
+	if err != nil {
+		return err
+	}
+	d := c.db()
+	d.del(args[1])
+	if len(result) > 0 {
+		d.set(args[1], &zsetValue{scores: result})
+	}
+	return int64(len(result))
+}
+
+func cmdZSetOp(c *client, args []string) interface{} {
+	result, withScores, err := c.zsetOp(strings.ToUpper(args[0]), args[1:], true)
+	if err != nil {
+		return err
+	}
+	return (&zsetValue{scores: result}).sorted().reply(withScores)
+}
+
+func cmdZInterCard(c *client, args []string) interface{} {
+	n, ok := parseInt(args[1])
+	if !ok || n <= 0 {
+		return errorReply("ERR numkeys should be greater than 0")
+	}
+	if int64(len(args)) < n+2 {
+		return errSyntax
+	}
+	limit := int64(0)
+	switch rest := args[n+2:]; {
+	case len(rest) == 0:
+	case len(rest) == 2 && strings.EqualFold(rest[0], "LIMIT"):
+		if limit, ok = parseInt(rest[1]); !ok || limit < 0 {
+			return errorReply("ERR LIMIT can't be negative")
+		}
+	default:
+		return errSyntax
+	}
+	result, _, err := c.zsetOp("ZINTER", args[1:n+2], false)
+	if err != nil {
+		return err
+	}
+	if limit > 0 && int64(len(result)) > limit {
+		return limit
+	}
+	return int64(len(result))
+}
+
+func cmdZRandMember(c *client, args []string) interface{} {
+	withScores := false
+	if len(args) == 4 {
+		if !strings.EqualFold(args[3], "WITHSCORES") {
+			return errSyntax
+		}
+		withScores = true
+		args = args[:3]
+	}
+	count, hasCount, err := parseCount(args)
+	if err != nil {
+		return err
+	}
+	z, err := c.db().getZSet(args[1], false)
+	if err != nil {
+		return err
+	}
+	members := zmembers{}
+	if z != nil {
+		members = z.sorted()
+	}
+	if !hasCount {
+		if len(members) == 0 {
+			return nil
+		}
+		return members[c.s.rand.Intn(len(members))].member
+	}
+	result := zmembers{}
+	if len(members) == 0 {
+		return result.reply(withScores)
+	}
+	if count < 0 {
+		// A negative count allows the same member more than once.
+		for ; count < 0; count++ {
+			result = append(result, members[c.s.rand.Intn(len(members))])
+		}
+		return result.reply(withScores)
+	}
+	for _, i := range c.s.rand.Perm(len(members)) {
+		if int64(len(result)) == count {
+			break
+		}
+		result = append(result, members[i])
+	}
+	return result.reply(withScores)
+}
+
+// zpop removes up to count members with the lowest or highest scores.
+func (c *client) zpop(key string, max bool, count int64) (zmembers, interface{}) {
+	d := c.db()
+	z, err := d.getZSet(key, false)
+	if err != nil {
+		return nil, err
+	}
+	popped := zmembers{}
+	if z == nil {
+		return popped, nil
+	}
+	members := z.sorted()
+	if max {
+		members.reverse()
+	}
+	for _, m := range members {
+		if int64(len(popped)) >= count {
+			break
+		}
+		popped = append(popped, m)
+		delete(z.scores, m.member)
+	}
+	if len(popped) > 0 {
+		d.touch(key)
+		d.deleteIfEmpty(key)
+	}
+	return popped, nil
+}
+
+func cmdZPop(c *client, args []string) interface{} {
+	count := int64(1)
+	switch len(args) {
+	case 2:
+	case 3:
+		var ok bool
+		if count, ok = parseInt(args[2]); !ok || count < 0 {
+			return errorReply("ERR value is out of range, must be positive")
+		}
+	default:
+		return errSyntax
+	}
+	popped, err := c.zpop(args[1], strings.EqualFold(args[0], "ZPOPMAX"), count)
+	if err != nil {
+		return err
+	}
+	return popped.reply(true)
+}
+
+func isMinMax(s string) bool {
+	return s == "MIN" || s == "MAX"
+}
+
+// zmpop pops up to count members from the first non-empty sorted set. The
+// second result is false when all sorted sets are empty.
+func (c *client) zmpop(keys []string, max bool, count int64) (interface{}, bool) {
+	for _, key := range keys {
+		popped, err := c.zpop(key, max, count)
+		if err != nil {
+			return err, true
+		}
+		if len(popped) == 0 {
+			continue
+		}
+		members := make([]interface{}, len(popped))
+		for i, m := range popped {
+			members[i] = []string{m.member, formatFloat(m.score)}
+		}
+		return []interface{}{key, members}, true
+	}
+	return nilArray{}, false
+}
+
+func cmdZMPop(c *client, args []string) interface{} {
+	keys, where, count, err := parseMPop(args[1:], isMinMax)
+	if err != nil {
+		return err
+	}
+	reply, _ := c.zmpop(keys, where == "MAX", count)
+	return reply
+}
+
+func cmdBZMPop(c *client, args []string) interface{} {
+	keys, where, count, err := parseMPop(args[2:], isMinMax)
+	if err != nil {
+		return err
+	}
+	return c.block(args[1], nilArray{}, func() (interface{}, bool) {
+		return c.zmpop(keys, where == "MAX", count)
+	})
+}
+
+func cmdBZPop(c *client, args []string) interface{} {
+	keys := args[1 : len(args)-1]
+	max := strings.EqualFold(args[0], "BZPOPMAX")
+	return c.block(args[len(args)-1], nilArray{}, func() (interface{}, bool) {
+		reply, ok := c.zmpop(keys, max, 1)
+		if r, isPop := reply.([]interface{}); ok && isPop {
+			m := r[1].([]interface{})[0].([]string)
+			return []interface{}{r[0], m[0], m[1]}, true
+		}
+		return reply, ok
+	})
+}
+
+func cmdZScan(c *client, args []string) interface{} {
+	opts, err := parseScanOptions(args[2:])
+	if err != nil {
+		return err
+	}
+	z, err := c.db().getZSet(args[1], false)
+	if err != nil {
+		return err
+	}
+	var members []string
+	if z != nil {
+		for m := range z.scores {
+			members = append(members, m)
+		}
+		sort.Strings(members)
+	}
+	next, matched := opts.scan(members, nil)
+	items := []string{}
+	for _, m := range matched {
+		items = append(items, m, formatFloat(z.scores[m]))
+	}
+	return []interface{}{next, items}
+}
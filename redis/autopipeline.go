@@ -0,0 +1,226 @@
+package redis
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+var errAutoPipelineClosed = errors.New("redigo: auto pipeline closed")
+
+// AutoPipeline batches the commands executed concurrently through a
+// RedisClient. Queued commands are written to a connection from the client's
+// pool with a single flush and each caller receives its own reply. This
+// reduces the number of round trips and borrowed connections when many
+// goroutines issue small commands such as GET or HGET.
+//
+// Blocking commands, commands that change the state of the connection and
+// commands executed with DoWithTimeout bypass the batcher and run on their
+// own connection.
+//
+// An AutoPipeline is started on first use and must not be shared by clients
+// with different pools. The fields must not be modified after first use.
+type AutoPipeline struct {
+	// Window is how long a batch waits for more commands after the first
+	// command is queued. If zero, then a batch is written as soon as a
+	// connection is free. Commands queued while the previous batch is in
+	// flight are batched together.
+	Window time.Duration
+
+	// MaxBatch is the maximum number of commands per batch. If zero, then
+	// 128 is used.
+	MaxBatch int
+
+	// Conns is the number of connections used concurrently to write
+	// batches. If zero, then 2 is used.
+	Conns int
+
+	once   sync.Once
+	pool   *Pool
+	wake   chan struct{}
+	done   chan struct{}
+	mu     sync.Mutex
+	closed bool
+	queue  []*pipelineRequest
+}
+
+type pipelineRequest struct {
+	commandName string
+	args        []interface{}
+	reply       interface{}
+	err         error
+	probe       circuitProbe
+	done        chan struct{}
+}
+
+// accepts returns true if the command can be batched.
+func (ap *AutoPipeline) accepts(commandName string, args []interface{}) bool {
+	return !ChangesConnState(commandName) && commandName != "" &&
+		!isBlockingCommand(commandName, args)
+}
+
+func (ap *AutoPipeline) start(pool *Pool) {
+	ap.pool = pool
+	ap.wake = make(chan struct{}, 1)
+	ap.done = make(chan struct{})
+	n := ap.Conns
+	if n <= 0 {
+		n = 2
+	}
+	for i := 0; i < n; i++ {
+		go ap.worker()
+	}
+}
+
+// do queues a command and waits for the reply.
+func (ap *AutoPipeline) do(pool *Pool, commandName string, args []interface{}) (interface{}, error) {
+	ap.once.Do(func() { ap.start(pool) })
+	r := &pipelineRequest{commandName: commandName, args: args, done: make(chan struct{})}
+	ap.mu.Lock()
+	if ap.closed {
+		ap.mu.Unlock()
+		return nil, errAutoPipelineClosed
+	}
+	ap.queue = append(ap.queue, r)
+	ap.mu.Unlock()
+	ap.signal()
+	<-r.done
+	return r.reply, r.err
+}
+
+func (ap *AutoPipeline) signal() {
+	select {
+	case ap.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Close stops the AutoPipeline. Queued commands and commands executed after
+// Close return an error.
+func (ap *AutoPipeline) Close() error {
+	ap.once.Do(func() { ap.done = make(chan struct{}) })
+	ap.mu.Lock()
+	if ap.closed {
+		ap.mu.Unlock()
+		return nil
+	}
+	ap.closed = true
+	queue := ap.queue
+	ap.queue = nil
+	close(ap.done)
+	ap.mu.Unlock()
+	for _, r := range queue {
+		r.err = errAutoPipelineClosed
+		close(r.done)
+	}
+	return nil
+}
+
+func (ap *AutoPipeline) worker() {
+	for {
+		select {
+		case <-ap.wake:
+		case <-ap.done:
+			return
+		}
+		if ap.Window > 0 {
+			t := time.NewTimer(ap.Window)
+			select {
+			case <-t.C:
+			case <-ap.done:
+				t.Stop()
+				return
+			}
+		}
+		for {
+			batch := ap.take()
+			if len(batch) == 0 {
+				break
+			}
+			ap.exec(batch)
+		}
+	}
+}
+
+// take removes the next batch from the queue.
+func (ap *AutoPipeline) take() []*pipelineRequest {
+	maxBatch := ap.MaxBatch
+	if maxBatch <= 0 {
+		maxBatch = 128
+	}
+	ap.mu.Lock()
+	defer ap.mu.Unlock()
+	n := len(ap.queue)
+	if n > maxBatch {
+		n = maxBatch
+	}
+	batch := ap.queue[:n:n]
+	ap.queue = ap.queue[n:]
+	if len(ap.queue) > 0 {
+		// Let another worker write the rest concurrently.
+		ap.signal()
+	}
+	return batch
+}
+
+func (ap *AutoPipeline) exec(batch []*pipelineRequest) {
+	c := ap.pool.Get()
+	defer c.Close()
+	err := c.Err()
+	cb := ap.pool.CircuitBreaker
+	if _, ok := c.(errorConn); ok {
+		// Dial errors are reported by the pool.
+		cb = nil
+	}
+	sent := make([]*pipelineRequest, 0, len(batch))
+	for _, r := range batch {
+		if err == nil && cb != nil {
+			// The command is a probe when the circuit is half-open.
+			if r.probe, r.err = cb.acquire(); r.err != nil {
+				close(r.done)
+				continue
+			}
+		}
+		if err == nil {
+			err = c.Send(r.commandName, r.args...)
+		}
+		sent = append(sent, r)
+	}
+	if err == nil {
+		err = c.Flush()
+	}
+	for _, r := range sent {
+		if err != nil {
+			r.err = err
+		} else {
+			r.reply, r.err = c.Receive()
+		}
+		if cb != nil {
+			counted, failed := circuitOutcome(r.err)
+			cb.finish(r.probe, counted, failed, false)
+		}
+		close(r.done)
+	}
+}
+
+// doPipelined executes a command through the client's AutoPipeline and
+// retries transient errors according to the client's retry policy. Like
+// doWithRetry, each attempt fails fast when the pool's circuit breaker is
+// open and the outcome of each command is reported to the breaker.
+func (client *RedisClient) doPipelined(commandName string, args []interface{}) (interface{}, error) {
+	rp := client.RetryPolicy
+	cb := client.circuitBreaker()
+	attempts := rp.attempts()
+	for n := 1; ; n++ {
+		if cb != nil {
+			if err := cb.check(); err != nil {
+				return nil, err
+			}
+		}
+		reply, err := client.AutoPipeline.do(client.pool, commandName, args)
+		if err == nil || err == errAutoPipelineClosed || n >= attempts || !rp.retryable(err, commandName, args) {
+			return reply, err
+		}
+		sleepFunc(rp.backoff(n))
+	}
+}
@@ -0,0 +1,185 @@
+package redis
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+	"time"
+)
+
+// batchConn echoes the first argument of each command and counts flushes.
+type batchConn struct {
+	Conn
+	d       *batchDialer
+	pending []interface{}
+}
+
+func (c *batchConn) Send(commandName string, args ...interface{}) error {
+	if len(args) == 0 {
+		c.pending = append(c.pending, commandName)
+		return nil
+	}
+	c.pending = append(c.pending, args[0])
+	return nil
+}
+
+func (c *batchConn) Flush() error {
+	c.d.mu.Lock()
+	c.d.flushes++
+	c.d.mu.Unlock()
+	return nil
+}
+
+func (c *batchConn) Receive() (interface{}, error) {
+	v := c.pending[0]
+	c.pending = c.pending[1:]
+	c.d.mu.Lock()
+	defer c.d.mu.Unlock()
+	return v, c.d.err
+}
+
+func (c *batchConn) Do(commandName string, args ...interface{}) (interface{}, error) {
+	if commandName == "" {
+		return nil, nil
+	}
+	c.d.mu.Lock()
+	c.d.commands = append(c.d.commands, commandName)
+	c.d.mu.Unlock()
+	return args[0], nil
+}
+
+func (c *batchConn) Err() error   { return nil }
+func (c *batchConn) Close() error { return nil }
+
+type batchDialer struct {
+	mu       sync.Mutex
+	dialed   int
+	flushes  int
+	commands []string
+	err      error // returned by Receive
+}
+
+func (d *batchDialer) dial() (Conn, error) {
+	d.mu.Lock()
+	d.dialed++
+	d.mu.Unlock()
+	return &batchConn{d: d}, nil
+}
+
+func TestAutoPipeline(t *testing.T) {
+	d := &batchDialer{}
+	ap := &AutoPipeline{Window: 10 * time.Millisecond, Conns: 1}
+	defer ap.Close()
+	client := &RedisClient{pool: &Pool{Dial: d.dial, MaxIdle: 1}, AutoPipeline: ap}
+
+	const n = 50
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			key := fmt.Sprint("key", i)
+			s, err := client.Get(key)
+			if err != nil || s != key {
+				errs <- fmt.Errorf("Get(%q) = %q, %v", key, s, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+	if d.flushes >= n {
+		t.Errorf("flushes = %d, want fewer than %d", d.flushes, n)
+	}
+	if d.dialed != 1 {
+		t.Errorf("dialed = %d, want 1", d.dialed)
+	}
+	if len(d.commands) != 0 {
+		t.Errorf("commands executed with Do = %v, want none", d.commands)
+	}
+}
+
+func TestAutoPipelineBypass(t *testing.T) {
+	d := &batchDialer{}
+	ap := &AutoPipeline{}
+	defer ap.Close()
+	client := &RedisClient{pool: &Pool{Dial: d.dial}, AutoPipeline: ap}
+
+	client.Do("BLPOP", "list", 0)
+	client.Do("XREAD", "BLOCK", 0, "STREAMS", "s", "$")
+	client.Do("SELECT", 1)
+	client.Do("MULTI", "x")
+	client.Do("XREAD", "STREAMS", "s", "0")
+	want := []string{"BLPOP", "XREAD", "SELECT", "MULTI"}
+	if fmt.Sprint(d.commands) != fmt.Sprint(want) {
+		t.Errorf("commands executed with Do = %v, want %v", d.commands, want)
+	}
+	if d.flushes != 1 {
+		t.Errorf("flushes = %d, want 1", d.flushes)
+	}
+}
+
+func TestAutoPipelineClose(t *testing.T) {
+	d := &batchDialer{}
+	ap := &AutoPipeline{}
+	client := &RedisClient{pool: &Pool{Dial: d.dial}, AutoPipeline: ap}
+	if _, err := client.Get("key"); err != nil {
+		t.Fatal(err)
+	}
+	ap.Close()
+	if _, err := client.Get("key"); err != errAutoPipelineClosed {
+		t.Fatalf("Get() after Close returned %v, want %v", err, errAutoPipelineClosed)
+	}
+}
+
+func TestAutoPipelineCircuitBreaker(t *testing.T) {
+	// The clock is read by the pipeline workers.
+	var mu sync.Mutex
+	now := time.Unix(1600000000, 0)
+	nowFunc = func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return now
+	}
+	t.Cleanup(func() { nowFunc = time.Now })
+	d := &batchDialer{err: io.EOF}
+	ap := &AutoPipeline{}
+	defer ap.Close()
+	cb := &CircuitBreaker{ConsecutiveFailures: 2, ProbeInterval: time.Second}
+	client := &RedisClient{pool: &Pool{Dial: d.dial, MaxIdle: 1, CircuitBreaker: cb}, AutoPipeline: ap}
+
+	for i := 0; i < 2; i++ {
+		if _, err := client.Get("key"); err != io.EOF {
+			t.Fatalf("Get() returned error %v, want %v", err, io.EOF)
+		}
+	}
+	if s := cb.State(); s != CircuitOpen {
+		t.Fatalf("state = %v, want %v", s, CircuitOpen)
+	}
+	d.mu.Lock()
+	flushes := d.flushes
+	d.mu.Unlock()
+	if _, err := client.Get("key"); err != ErrCircuitOpen {
+		t.Fatalf("Get() with an open circuit returned %v, want %v", err, ErrCircuitOpen)
+	}
+	d.mu.Lock()
+	if d.flushes != flushes {
+		t.Errorf("flushes = %d, want %d", d.flushes, flushes)
+	}
+	d.err = nil
+	d.mu.Unlock()
+
+	mu.Lock()
+	now = now.Add(time.Second)
+	mu.Unlock()
+	if s, err := client.Get("key"); err != nil || s != "key" {
+		t.Fatalf("Get() in half-open state = %q, %v, want key, nil", s, err)
+	}
+	if s := cb.State(); s != CircuitClosed {
+		t.Errorf("state after a successful probe = %v, want %v", s, CircuitClosed)
+	}
+}
@@ -0,0 +1,603 @@
+package redis
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// The BinaryCodec format is a tag byte followed by the tag's payload.
+// Integers are written as varints and strings, byte slices, arrays and maps
+// are prefixed with their length as an unsigned varint.
+const (
+	binaryNil    = 0x00
+	binaryFalse  = 0x01
+	binaryTrue   = 0x02
+	binaryInt    = 0x03 // zig-zag encoded varint
+	binaryUint   = 0x04 // varint
+	binaryFloat  = 0x05 // 8 byte IEEE 754 big endian
+	binaryString = 0x06 // length, bytes
+	binaryBytes  = 0x07 // length, bytes
+	binaryArray  = 0x08 // count, elements
+	binaryMap    = 0x09 // count, alternating keys and values
+	binaryCustom = 0x0a // length, output of MarshalBinary
+)
+
+var (
+	errBinaryTruncated = errors.New("redigo: BinaryCodec data is truncated")
+	errBinaryTrailing  = errors.New("redigo: BinaryCodec data has trailing bytes")
+	errBinaryDest      = errors.New("redigo: BinaryCodec destination must be a non-nil pointer")
+	errBinaryDepth     = errors.New("redigo: BinaryCodec data exceeds the maximum nesting depth")
+
+	binaryMarshalerType   = reflect.TypeOf((*encoding.BinaryMarshaler)(nil)).Elem()
+	binaryUnmarshalerType = reflect.TypeOf((*encoding.BinaryUnmarshaler)(nil)).Elem()
+)
+
+// binaryCodec implements BinaryCodec.
+type binaryCodec struct{}
+
+func (binaryCodec) Marshal(v interface{}) ([]byte, error) {
+	e := binaryEncoder{}
+	if err := e.encode(reflect.ValueOf(v)); err != nil {
+		return nil, err
+	}
+	return e.buf, nil
+}
+
+func (binaryCodec) Unmarshal(data []byte, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return errBinaryDest
+	}
+	d := binaryDecoder{data: data}
+	if err := d.decode(rv.Elem()); err != nil {
+		return err
+	}
+	if len(d.data) != 0 {
+		return errBinaryTrailing
+	}
+	return nil
+}
+
+type binaryField struct {
+	name  string
+	index int
+}
+
+// binaryFields returns the encoded fields of struct type t.
+func binaryFields(t reflect.Type) []binaryField {
+	var fields []binaryField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		name := f.Name
+		if tag := strings.Split(f.Tag.Get("redis"), ",")[0]; tag == "-" {
+			continue
+		} else if tag != "" {
+			name = tag
+		}
+		fields = append(fields, binaryField{name: name, index: i})
+	}
+	return fields
+}
+
+type binaryEncoder struct {
+	buf []byte
+}
+
+func (e *binaryEncoder) uvarint(n uint64) {
+	var p [binary.MaxVarintLen64]byte
+	e.buf = append(e.buf, p[:binary.PutUvarint(p[:], n)]...)
+}
+
+func (e *binaryEncoder) bytes(tag byte, p []byte) {
+	e.buf = append(e.buf, tag)
+	e.uvarint(uint64(len(p)))
+	e.buf = append(e.buf, p...)
+}
+
+func (e *binaryEncoder) encode(v reflect.Value) error {
+	if !v.IsValid() {
+		e.buf = append(e.buf, binaryNil)
+		return nil
+	}
+	if v.Kind() != reflect.Interface && v.Type().Implements(binaryMarshalerType) && !(v.Kind() == reflect.Ptr && v.IsNil()) {
+		p, err := v.Interface().(encoding.BinaryMarshaler).MarshalBinary()
+		if err != nil {
+			return err
+		}
+		e.bytes(binaryCustom, p)
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			e.buf = append(e.buf, binaryTrue)
+		} else {
+			e.buf = append(e.buf, binaryFalse)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n := v.Int()
+		e.buf = append(e.buf, binaryInt)
+		e.uvarint(uint64(n<<1) ^ uint64(n>>63))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		e.buf = append(e.buf, binaryUint)
+		e.uvarint(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		var p [8]byte
+		binary.BigEndian.PutUint64(p[:], math.Float64bits(v.Float()))
+		e.buf = append(e.buf, binaryFloat)
+		e.buf = append(e.buf, p[:]...)
+	case reflect.String:
+		e.bytes(binaryString, []byte(v.String()))
+	case reflect.Slice:
+		if v.IsNil() {
+			e.buf = append(e.buf, binaryNil)
+			return nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			e.bytes(binaryBytes, v.Bytes())
+			return nil
+		}
+		return e.array(v)
+	case reflect.Array:
+		return e.array(v)
+	case reflect.Map:
+		if v.IsNil() {
+			e.buf = append(e.buf, binaryNil)
+			return nil
+		}
+		return e.mapEntries(v)
+	case reflect.Struct:
+		return e.structFields(v)
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			e.buf = append(e.buf, binaryNil)
+			return nil
+		}
+		return e.encode(v.Elem())
+	default:
+		return fmt.Errorf("redigo: BinaryCodec cannot encode type %s", v.Type())
+	}
+	return nil
+}
+
+func (e *binaryEncoder) array(v reflect.Value) error {
+	e.buf = append(e.buf, binaryArray)
+	e.uvarint(uint64(v.Len()))
+	for i := 0; i < v.Len(); i++ {
+		if err := e.encode(v.Index(i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *binaryEncoder) mapEntries(v reflect.Value) error {
+	type kv struct{ k, v []byte }
+	entries := make([]kv, 0, v.Len())
+	for _, k := range v.MapKeys() {
+		ke := binaryEncoder{}
+		if err := ke.encode(k); err != nil {
+			return err
+		}
+		ve := binaryEncoder{}
+		if err := ve.encode(v.MapIndex(k)); err != nil {
+			return err
+		}
+		entries = append(entries, kv{ke.buf, ve.buf})
+	}
+	sort.Slice(entries, func(i, j int) bool { return bytes.Compare(entries[i].k, entries[j].k) < 0 })
+	e.buf = append(e.buf, binaryMap)
+	e.uvarint(uint64(len(entries)))
+	for _, entry := range entries {
+		e.buf = append(e.buf, entry.k...)
+		e.buf = append(e.buf, entry.v...)
+	}
+	return nil
+}
+
+func (e *binaryEncoder) structFields(v reflect.Value) error {
+	fields := binaryFields(v.Type())
+	e.buf = append(e.buf, binaryMap)
+	e.uvarint(uint64(len(fields)))
+	for _, f := range fields {
+		e.bytes(binaryString, []byte(f.name))
+		if err := e.encode(v.Field(f.index)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// binaryMaxDepth is the maximum nesting depth of arrays and maps decoded by
+// BinaryCodec.
+const binaryMaxDepth = 1000
+
+type binaryDecoder struct {
+	data  []byte
+	depth int
+}
+
+// nest records that the decoder entered an array or map and returns
+// errBinaryDepth if the data is nested too deeply. The caller must decrement
+// d.depth when leaving the array or map.
+func (d *binaryDecoder) nest() error {
+	d.depth++
+	if d.depth > binaryMaxDepth {
+		return errBinaryDepth
+	}
+	return nil
+}
+
+func (d *binaryDecoder) uvarint() (uint64, error) {
+	n, size := binary.Uvarint(d.data)
+	if size <= 0 {
+		return 0, errBinaryTruncated
+	}
+	d.data = d.data[size:]
+	return n, nil
+}
+
+func (d *binaryDecoder) bytes() ([]byte, error) {
+	n, err := d.uvarint()
+	if err != nil {
+		return nil, err
+	}
+	if n > uint64(len(d.data)) {
+		return nil, errBinaryTruncated
+	}
+	p := d.data[:n:n]
+	d.data = d.data[n:]
+	return p, nil
+}
+
+// count reads the element count of an array or map. Each element takes at
+// least one byte, so counts larger than the remaining data are rejected
+// before allocating.
+func (d *binaryDecoder) count() (int, error) {
+	n, err := d.uvarint()
+	if err != nil {
+		return 0, err
+	}
+	if n > uint64(len(d.data)) {
+		return 0, errBinaryTruncated
+	}
+	return int(n), nil
+}
+
+func binaryTagName(tag byte) string {
+	switch tag {
+	case binaryFalse, binaryTrue:
+		return "bool"
+	case binaryInt:
+		return "int"
+	case binaryUint:
+		return "uint"
+	case binaryFloat:
+		return "float"
+	case binaryString:
+		return "string"
+	case binaryBytes:
+		return "bytes"
+	case binaryArray:
+		return "array"
+	case binaryMap:
+		return "map"
+	case binaryCustom:
+		return "binary"
+	}
+	return fmt.Sprintf("tag %#x", tag)
+}
+
+// decode decodes the next value into v. The value v must be settable.
+func (d *binaryDecoder) decode(v reflect.Value) error {
+	if len(d.data) == 0 {
+		return errBinaryTruncated
+	}
+	tag := d.data[0]
+	if tag == binaryNil {
+		d.data = d.data[1:]
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return d.decode(v.Elem())
+	case reflect.Interface:
+		if v.NumMethod() == 0 {
+			x, err := d.decodeInterface()
+			if err != nil {
+				return err
+			}
+			if x == nil {
+				v.Set(reflect.Zero(v.Type()))
+			} else {
+				v.Set(reflect.ValueOf(x))
+			}
+			return nil
+		}
+	}
+	d.data = d.data[1:]
+	if tag == binaryArray || tag == binaryMap {
+		defer func() { d.depth-- }()
+		if err := d.nest(); err != nil {
+			return err
+		}
+	}
+	if tag == binaryCustom && v.CanAddr() && v.Addr().Type().Implements(binaryUnmarshalerType) {
+		p, err := d.bytes()
+		if err != nil {
+			return err
+		}
+		return v.Addr().Interface().(encoding.BinaryUnmarshaler).UnmarshalBinary(p)
+	}
+
+	cannotDecode := func() error {
+		return fmt.Errorf("redigo: BinaryCodec cannot decode %s into %s", binaryTagName(tag), v.Type())
+	}
+	switch tag {
+	case binaryFalse, binaryTrue:
+		if v.Kind() != reflect.Bool {
+			return cannotDecode()
+		}
+		v.SetBool(tag == binaryTrue)
+	case binaryInt, binaryUint:
+		u, err := d.uvarint()
+		if err != nil {
+			return err
+		}
+		var n int64
+		negative := false
+		if tag == binaryInt {
+			n = int64(u>>1) ^ -int64(u&1)
+			negative = n < 0
+			u = uint64(n)
+		}
+		switch v.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			if tag == binaryUint {
+				if u > math.MaxInt64 {
+					return cannotDecode()
+				}
+				n = int64(u)
+			}
+			if v.OverflowInt(n) {
+				return cannotDecode()
+			}
+			v.SetInt(n)
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			if negative || v.OverflowUint(u) {
+				return cannotDecode()
+			}
+			v.SetUint(u)
+		case reflect.Float32, reflect.Float64:
+			if tag == binaryInt {
+				v.SetFloat(float64(n))
+			} else {
+				v.SetFloat(float64(u))
+			}
+		default:
+			return cannotDecode()
+		}
+	case binaryFloat:
+		if len(d.data) < 8 {
+			return errBinaryTruncated
+		}
+		f := math.Float64frombits(binary.BigEndian.Uint64(d.data))
+		d.data = d.data[8:]
+		switch v.Kind() {
+		case reflect.Float32, reflect.Float64:
+			v.SetFloat(f)
+		default:
+			return cannotDecode()
+		}
+	case binaryString, binaryBytes, binaryCustom:
+		p, err := d.bytes()
+		if err != nil {
+			return err
+		}
+		switch {
+		case v.Kind() == reflect.String:
+			v.SetString(string(p))
+		case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8:
+			v.SetBytes(append([]byte(nil), p...))
+		case v.Kind() == reflect.Array && v.Type().Elem().Kind() == reflect.Uint8 && v.Len() == len(p):
+			reflect.Copy(v, reflect.ValueOf(p))
+		default:
+			return cannotDecode()
+		}
+	case binaryArray:
+		n, err := d.count()
+		if err != nil {
+			return err
+		}
+		switch v.Kind() {
+		case reflect.Slice:
+			v.Set(reflect.MakeSlice(v.Type(), n, n))
+		case reflect.Array:
+			if v.Len() != n {
+				return cannotDecode()
+			}
+		default:
+			return cannotDecode()
+		}
+		for i := 0; i < n; i++ {
+			if err := d.decode(v.Index(i)); err != nil {
+				return err
+			}
+		}
+	case binaryMap:
+		n, err := d.count()
+		if err != nil {
+			return err
+		}
+		switch v.Kind() {
+		case reflect.Map:
+			return d.mapEntries(v, n)
+		case reflect.Struct:
+			return d.structFields(v, n)
+		}
+		return cannotDecode()
+	default:
+		return fmt.Errorf("redigo: BinaryCodec found unknown %s", binaryTagName(tag))
+	}
+	return nil
+}
+
+func (d *binaryDecoder) mapEntries(v reflect.Value, n int) error {
+	t := v.Type()
+	if v.IsNil() {
+		v.Set(reflect.MakeMap(t))
+	}
+	for i := 0; i < n; i++ {
+		k := reflect.New(t.Key()).Elem()
+		if err := d.decode(k); err != nil {
+			return err
+		}
+		if !hashable(k) {
+			return fmt.Errorf("redigo: BinaryCodec cannot decode unhashable key into %s", t)
+		}
+		e := reflect.New(t.Elem()).Elem()
+		if err := d.decode(e); err != nil {
+			return err
+		}
+		v.SetMapIndex(k, e)
+	}
+	return nil
+}
+
+// hashable reports whether v can be used as a map key. Interface values
+// holding slices, maps or functions cannot.
+func hashable(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Interface:
+		return v.IsNil() || hashable(v.Elem())
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if !hashable(v.Index(i)) {
+				return false
+			}
+		}
+		return true
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if !hashable(v.Field(i)) {
+				return false
+			}
+		}
+		return true
+	}
+	return v.Type().Comparable()
+}
+
+func (d *binaryDecoder) structFields(v reflect.Value, n int) error {
+	fields := binaryFields(v.Type())
+	for i := 0; i < n; i++ {
+		var name string
+		if err := d.decode(reflect.ValueOf(&name).Elem()); err != nil {
+			return err
+		}
+		index := -1
+		for _, f := range fields {
+			if f.name == name {
+				index = f.index
+				break
+			}
+		}
+		if index < 0 {
+			// Skip fields that are not in the struct.
+			if _, err := d.decodeInterface(); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := d.decode(v.Field(index)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decodeInterface decodes the next value to the interface{} representation
+// of the value.
+func (d *binaryDecoder) decodeInterface() (interface{}, error) {
+	if len(d.data) == 0 {
+		return nil, errBinaryTruncated
+	}
+	var x interface{}
+	switch tag := d.data[0]; tag {
+	case binaryNil:
+		d.data = d.data[1:]
+		return nil, nil
+	case binaryFalse, binaryTrue:
+		d.data = d.data[1:]
+		return tag == binaryTrue, nil
+	case binaryInt:
+		var n int64
+		x = &n
+	case binaryUint:
+		var n uint64
+		x = &n
+	case binaryFloat:
+		var f float64
+		x = &f
+	case binaryString:
+		var s string
+		x = &s
+	case binaryBytes, binaryCustom:
+		var p []byte
+		x = &p
+	case binaryArray:
+		var a []interface{}
+		x = &a
+	case binaryMap:
+		d.data = d.data[1:]
+		defer func() { d.depth-- }()
+		if err := d.nest(); err != nil {
+			return nil, err
+		}
+		n, err := d.count()
+		if err != nil {
+			return nil, err
+		}
+		m := make(map[string]interface{}, n)
+		for i := 0; i < n; i++ {
+			k, err := d.decodeInterface()
+			if err != nil {
+				return nil, err
+			}
+			e, err := d.decodeInterface()
+			if err != nil {
+				return nil, err
+			}
+			switch k := k.(type) {
+			case string:
+				m[k] = e
+			case []byte:
+				m[string(k)] = e
+			default:
+				m[fmt.Sprint(k)] = e
+			}
+		}
+		return m, nil
+	default:
+		return nil, fmt.Errorf("redigo: BinaryCodec found unknown %s", binaryTagName(tag))
+	}
+	rv := reflect.ValueOf(x).Elem()
+	if err := d.decode(rv); err != nil {
+		return nil, err
+	}
+	return rv.Interface(), nil
+}
@@ -0,0 +1,319 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned when a circuit breaker rejects a dial or a
+// command because the Redis server is considered unavailable.
+var ErrCircuitOpen = errors.New("redigo: circuit breaker is open")
+
+// CircuitState is the state of a CircuitBreaker.
+type CircuitState int
+
+const (
+	// CircuitClosed is the normal state. Requests are allowed and failures
+	// are counted.
+	CircuitClosed CircuitState = iota
+
+	// CircuitOpen rejects requests with ErrCircuitOpen until the probe
+	// interval elapses.
+	CircuitOpen
+
+	// CircuitHalfOpen allows a limited number of probe requests. The circuit
+	// closes when the probes succeed and opens again when a probe fails.
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// CircuitBreaker stops dialing and executing commands when the Redis server
+// is failing, so that applications fail fast instead of waiting for dial
+// timeouts and the pool does not hammer the server with reconnects.
+//
+// Set the CircuitBreaker field of a Pool to enable the breaker for dials
+// from the pool and for commands executed by a RedisClient that uses the
+// pool. Redis error replies other than the transient errors listed in
+// IsTransientError are not counted as failures because they show that the
+// server is up.
+//
+// The zero value is a breaker that opens after five consecutive failures.
+// The fields must not be modified after the breaker is first used.
+type CircuitBreaker struct {
+	// ConsecutiveFailures opens the circuit after this many failures in a
+	// row. If zero and FailureRate is zero, then 5 is used.
+	ConsecutiveFailures int
+
+	// FailureRate opens the circuit when the ratio of failures to requests
+	// in the current window is at least this value. Zero disables the rate
+	// check.
+	FailureRate float64
+
+	// MinRequests is the number of requests required in the current window
+	// before FailureRate is checked.
+	MinRequests int
+
+	// Window is the duration over which FailureRate is computed. If zero,
+	// then 10 seconds is used.
+	Window time.Duration
+
+	// ProbeInterval is how long the circuit stays open before probe
+	// requests are allowed. If zero, then 5 seconds is used.
+	ProbeInterval time.Duration
+
+	// HalfOpenProbes is the number of successful probes required to close
+	// the circuit. It is also the number of dials and commands allowed
+	// concurrently in the half-open state. If zero, then 1 is used.
+	HalfOpenProbes int
+
+	// OnStateChange is called after the circuit changes state. The function
+	// is called without holding any locks.
+	OnStateChange func(from, to CircuitState)
+
+	mu          sync.Mutex
+	state       CircuitState
+	consecutive int
+	requests    int
+	failures    int
+	windowStart time.Time
+	openedAt    time.Time
+	probing     int
+	successes   int
+	// generation counts the half-open periods so that a probe slot is
+	// released only in the period that reserved it.
+	generation uint64
+}
+
+// State returns the current state of the circuit.
+func (cb *CircuitBreaker) State() CircuitState {
+	cb.mu.Lock()
+	from := cb.state
+	to := cb.advance(nowFunc())
+	cb.mu.Unlock()
+	cb.notify(from, to)
+	return to
+}
+
+// Allow returns ErrCircuitOpen if a request should not be attempted. When
+// the circuit is half-open, Allow reserves one of the probe slots. The
+// caller must call the returned function with the outcome of an allowed
+// request, which also releases the probe slot.
+func (cb *CircuitBreaker) Allow() (func(err error), error) {
+	p, err := cb.acquire()
+	if err != nil {
+		return nil, err
+	}
+	return func(err error) {
+		counted, failed := circuitOutcome(err)
+		cb.finish(p, counted, failed, false)
+	}, nil
+}
+
+// Report records the outcome of a request that was not admitted by Allow.
+// In the half-open state only the outcomes of the probes admitted by Allow
+// are counted.
+func (cb *CircuitBreaker) Report(err error) {
+	counted, failed := circuitOutcome(err)
+	cb.finish(circuitProbe{}, counted, failed, false)
+}
+
+// circuitProbe records whether a request admitted by acquire reserved a
+// probe slot and in which half-open period.
+type circuitProbe struct {
+	reserved   bool
+	generation uint64
+}
+
+// acquire returns ErrCircuitOpen if a request should not be attempted and
+// reserves a probe slot in the half-open state.
+func (cb *CircuitBreaker) acquire() (circuitProbe, error) {
+	cb.mu.Lock()
+	from := cb.state
+	to := cb.advance(nowFunc())
+	var (
+		p   circuitProbe
+		err error
+	)
+	switch to {
+	case CircuitOpen:
+		err = ErrCircuitOpen
+	case CircuitHalfOpen:
+		if cb.probing >= cb.halfOpenProbes() {
+			err = ErrCircuitOpen
+		} else {
+			cb.probing++
+			p = circuitProbe{reserved: true, generation: cb.generation}
+		}
+	}
+	cb.mu.Unlock()
+	cb.notify(from, to)
+	return p, err
+}
+
+// finish records the outcome of a request admitted by acquire and releases
+// its probe slot. A successful dial does not reset the failure count of a
+// closed circuit because servers that accept connections can still fail to
+// execute commands.
+func (cb *CircuitBreaker) finish(p circuitProbe, counted, failed, dial bool) {
+	cb.mu.Lock()
+	now := nowFunc()
+	from := cb.state
+	cb.advance(now)
+	probe := p.reserved && p.generation == cb.generation && cb.state == CircuitHalfOpen
+	if probe {
+		cb.probing--
+	}
+	switch {
+	case dial && !failed && cb.state == CircuitClosed:
+		counted = false
+	case cb.state == CircuitHalfOpen && !probe:
+		// The request was admitted before the current probe period.
+		counted = false
+	}
+	if counted {
+		cb.record(now, failed)
+	}
+	to := cb.state
+	cb.mu.Unlock()
+	cb.notify(from, to)
+}
+
+// check returns ErrCircuitOpen if the circuit is open. Unlike acquire,
+// check does not reserve a probe slot.
+func (cb *CircuitBreaker) check() error {
+	cb.mu.Lock()
+	from := cb.state
+	to := cb.advance(nowFunc())
+	cb.mu.Unlock()
+	cb.notify(from, to)
+	if to == CircuitOpen {
+		return ErrCircuitOpen
+	}
+	return nil
+}
+
+// record updates the counters with the outcome of a request. The caller
+// must hold cb.mu.
+func (cb *CircuitBreaker) record(now time.Time, failed bool) {
+	switch cb.state {
+	case CircuitClosed:
+		if now.Sub(cb.windowStart) >= cb.window() {
+			cb.windowStart = now
+			cb.requests, cb.failures = 0, 0
+		}
+		cb.requests++
+		if !failed {
+			cb.consecutive = 0
+			return
+		}
+		cb.failures++
+		cb.consecutive++
+		if cb.tripped() {
+			cb.open(now)
+		}
+	case CircuitHalfOpen:
+		if failed {
+			cb.open(now)
+			return
+		}
+		cb.successes++
+		if cb.successes >= cb.halfOpenProbes() {
+			cb.close(now)
+		}
+	}
+}
+
+// advance moves an open circuit to half-open when the probe interval has
+// elapsed. The caller must hold cb.mu.
+func (cb *CircuitBreaker) advance(now time.Time) CircuitState {
+	if cb.state == CircuitOpen && now.Sub(cb.openedAt) >= cb.probeInterval() {
+		cb.state = CircuitHalfOpen
+		cb.probing = 0
+		cb.successes = 0
+		cb.generation++
+	}
+	return cb.state
+}
+
+func (cb *CircuitBreaker) tripped() bool {
+	threshold := cb.ConsecutiveFailures
+	if threshold == 0 && cb.FailureRate == 0 {
+		threshold = 5
+	}
+	if threshold > 0 && cb.consecutive >= threshold {
+		return true
+	}
+	return cb.FailureRate > 0 && cb.requests >= cb.MinRequests &&
+		float64(cb.failures)/float64(cb.requests) >= cb.FailureRate
+}
+
+func (cb *CircuitBreaker) open(now time.Time) {
+	cb.state = CircuitOpen
+	cb.openedAt = now
+	cb.probing = 0
+}
+
+func (cb *CircuitBreaker) close(now time.Time) {
+	cb.state = CircuitClosed
+	cb.consecutive = 0
+	cb.requests, cb.failures = 0, 0
+	cb.windowStart = now
+}
+
+func (cb *CircuitBreaker) notify(from, to CircuitState) {
+	if from != to && cb.OnStateChange != nil {
+		cb.OnStateChange(from, to)
+	}
+}
+
+func (cb *CircuitBreaker) window() time.Duration {
+	if cb.Window <= 0 {
+		return 10 * time.Second
+	}
+	return cb.Window
+}
+
+func (cb *CircuitBreaker) probeInterval() time.Duration {
+	if cb.ProbeInterval <= 0 {
+		return 5 * time.Second
+	}
+	return cb.ProbeInterval
+}
+
+func (cb *CircuitBreaker) halfOpenProbes() int {
+	if cb.HalfOpenProbes <= 0 {
+		return 1
+	}
+	return cb.HalfOpenProbes
+}
+
+// circuitOutcome classifies the error returned by a request. Requests that
+// did not reach the server are not counted. Error replies other than the
+// transient errors are counted as successes because they show that the
+// server is up.
+func circuitOutcome(err error) (counted, failed bool) {
+	switch err.(type) {
+	case nil:
+		return true, false
+	case Error:
+		return true, IsTransientError(err)
+	}
+	switch err {
+	case ErrCircuitOpen, ErrPoolExhausted, errPoolClosed, errConnClosed, context.Canceled:
+		return false, false
+	}
+	return true, true
+}
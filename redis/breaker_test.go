@@ -0,0 +1,226 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+func setBreakerClock(t *testing.T) *time.Time {
+	now := time.Unix(1600000000, 0)
+	nowFunc = func() time.Time { return now }
+	t.Cleanup(func() { nowFunc = time.Now })
+	return &now
+}
+
+type stateChange struct{ from, to CircuitState }
+
+func TestCircuitBreakerConsecutiveFailures(t *testing.T) {
+	now := setBreakerClock(t)
+	var changes []stateChange
+	cb := &CircuitBreaker{
+		ConsecutiveFailures: 3,
+		ProbeInterval:       time.Second,
+		OnStateChange:       func(from, to CircuitState) { changes = append(changes, stateChange{from, to}) },
+	}
+
+	for i := 0; i < 2; i++ {
+		done, err := cb.Allow()
+		if err != nil {
+			t.Fatalf("Allow() returned error %v", err)
+		}
+		done(io.EOF)
+	}
+	cb.Report(nil)
+	cb.Report(io.EOF)
+	cb.Report(Error("ERR wrong type"))
+	if s := cb.State(); s != CircuitClosed {
+		t.Fatalf("state = %v, want %v", s, CircuitClosed)
+	}
+
+	cb.Report(io.EOF)
+	cb.Report(io.EOF)
+	cb.Report(io.EOF)
+	if s := cb.State(); s != CircuitOpen {
+		t.Fatalf("state = %v, want %v", s, CircuitOpen)
+	}
+	if _, err := cb.Allow(); err != ErrCircuitOpen {
+		t.Fatalf("Allow() returned %v, want %v", err, ErrCircuitOpen)
+	}
+
+	*now = now.Add(time.Second)
+	done, err := cb.Allow()
+	if err != nil {
+		t.Fatalf("Allow() in half-open state returned error %v", err)
+	}
+	if _, err := cb.Allow(); err != ErrCircuitOpen {
+		t.Fatalf("second Allow() in half-open state returned %v, want %v", err, ErrCircuitOpen)
+	}
+	done(io.EOF)
+	if s := cb.State(); s != CircuitOpen {
+		t.Fatalf("state after failed probe = %v, want %v", s, CircuitOpen)
+	}
+
+	*now = now.Add(time.Second)
+	done, err = cb.Allow()
+	if err != nil {
+		t.Fatalf("Allow() in half-open state returned error %v", err)
+	}
+	done(nil)
+	if s := cb.State(); s != CircuitClosed {
+		t.Fatalf("state after successful probe = %v, want %v", s, CircuitClosed)
+	}
+
+	want := []stateChange{
+		{CircuitClosed, CircuitOpen},
+		{CircuitOpen, CircuitHalfOpen},
+		{CircuitHalfOpen, CircuitOpen},
+		{CircuitOpen, CircuitHalfOpen},
+		{CircuitHalfOpen, CircuitClosed},
+	}
+	if len(changes) != len(want) {
+		t.Fatalf("changes = %v, want %v", changes, want)
+	}
+	for i := range want {
+		if changes[i] != want[i] {
+			t.Fatalf("changes = %v, want %v", changes, want)
+		}
+	}
+}
+
+func TestCircuitBreakerFailureRate(t *testing.T) {
+	now := setBreakerClock(t)
+	cb := &CircuitBreaker{FailureRate: 0.5, MinRequests: 4, Window: time.Minute}
+
+	cb.Report(nil)
+	cb.Report(io.EOF)
+	cb.Report(io.EOF)
+	if s := cb.State(); s != CircuitClosed {
+		t.Fatalf("state before MinRequests = %v, want %v", s, CircuitClosed)
+	}
+
+	// Counters are reset when the window expires.
+	*now = now.Add(time.Minute)
+	cb.Report(nil)
+	cb.Report(nil)
+	cb.Report(nil)
+	cb.Report(io.EOF)
+	if s := cb.State(); s != CircuitClosed {
+		t.Fatalf("state with 25%% failures = %v, want %v", s, CircuitClosed)
+	}
+	cb.Report(io.EOF)
+	cb.Report(io.EOF)
+	if s := cb.State(); s != CircuitOpen {
+		t.Fatalf("state with 50%% failures = %v, want %v", s, CircuitOpen)
+	}
+}
+
+func TestCircuitBreakerPool(t *testing.T) {
+	setBreakerClock(t)
+	errDial := errors.New("dial error")
+	dials := 0
+	p := &Pool{
+		Dial: func() (Conn, error) {
+			dials++
+			return nil, errDial
+		},
+		CircuitBreaker: &CircuitBreaker{ConsecutiveFailures: 2},
+	}
+	c := NewRedisClient(p)
+	for i := 0; i < 2; i++ {
+		if _, err := c.Get("key"); err != errDial {
+			t.Fatalf("Get() returned error %v, want %v", err, errDial)
+		}
+	}
+	if _, err := c.Get("key"); err != ErrCircuitOpen {
+		t.Fatalf("Get() returned error %v, want %v", err, ErrCircuitOpen)
+	}
+	if _, err := p.GetContext(context.Background()); err != ErrCircuitOpen {
+		t.Fatalf("GetContext() returned error %v, want %v", err, ErrCircuitOpen)
+	}
+	if dials != 2 {
+		t.Errorf("dials = %d, want 2", dials)
+	}
+}
+
+func TestCircuitBreakerClient(t *testing.T) {
+	setBreakerClock(t)
+	d := &flakyDialer{failures: 3, err: io.EOF}
+	c := d.client(nil)
+	c.pool.CircuitBreaker = &CircuitBreaker{ConsecutiveFailures: 3}
+	for i := 0; i < 3; i++ {
+		c.Get("key")
+	}
+	if _, err := c.Get("key"); err != ErrCircuitOpen {
+		t.Fatalf("Get() returned error %v, want %v", err, ErrCircuitOpen)
+	}
+	if len(d.commands) != 3 {
+		t.Errorf("commands = %v, want 3", d.commands)
+	}
+}
+
+func TestCircuitBreakerHalfOpenProbes(t *testing.T) {
+	now := setBreakerClock(t)
+	cb := &CircuitBreaker{ConsecutiveFailures: 1, ProbeInterval: time.Second, HalfOpenProbes: 2}
+	cb.Report(io.EOF)
+
+	*now = now.Add(time.Second)
+	done1, err := cb.Allow()
+	if err != nil {
+		t.Fatalf("Allow() in half-open state returned error %v", err)
+	}
+	if _, err := cb.Allow(); err != nil {
+		t.Fatalf("second Allow() in half-open state returned error %v", err)
+	}
+
+	// Outcomes of requests without a probe slot neither release a slot nor
+	// close the circuit.
+	cb.Report(nil)
+	cb.Report(nil)
+	if _, err := cb.Allow(); err != ErrCircuitOpen {
+		t.Fatalf("third Allow() in half-open state returned %v, want %v", err, ErrCircuitOpen)
+	}
+	if s := cb.State(); s != CircuitHalfOpen {
+		t.Fatalf("state = %v, want %v", s, CircuitHalfOpen)
+	}
+
+	done1(nil)
+	if _, err := cb.Allow(); err != nil {
+		t.Fatalf("Allow() after a probe completed returned error %v", err)
+	}
+}
+
+func TestCircuitBreakerClientHalfOpen(t *testing.T) {
+	now := setBreakerClock(t)
+	d := &flakyDialer{}
+	c := d.client(nil)
+	cb := &CircuitBreaker{ConsecutiveFailures: 1, ProbeInterval: time.Second}
+	c.pool.CircuitBreaker = cb
+
+	// Borrow a connection so that the command below does not dial.
+	conn := c.pool.Get()
+	conn.Close()
+	cb.Report(io.EOF)
+	*now = now.Add(time.Second)
+
+	// A probe reserved by a dial blocks commands on idle connections.
+	done, err := cb.Allow()
+	if err != nil {
+		t.Fatalf("Allow() returned error %v", err)
+	}
+	if _, err := c.Get("key"); err != ErrCircuitOpen {
+		t.Fatalf("Get() in half-open state with no free probe returned %v, want %v", err, ErrCircuitOpen)
+	}
+	if len(d.commands) != 0 {
+		t.Errorf("commands = %v, want none", d.commands)
+	}
+	done(nil)
+	if s := cb.State(); s != CircuitClosed {
+		t.Fatalf("state = %v, want %v", s, CircuitClosed)
+	}
+	if _, err := c.Get("key"); err != nil {
+		t.Fatalf("Get() returned error %v", err)
+	}
+}
@@ -0,0 +1,404 @@
+package redis
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// Cache implements the cache-aside pattern on top of a RedisClient:
+//
+//	cache := &redis.Cache{Client: client, Jitter: 0.1, Beta: 1}
+//	var u User
+//	err := cache.Fetch(ctx, "user:1", time.Minute, &u, func(ctx context.Context) (interface{}, error) {
+//		return db.LoadUser(ctx, 1)
+//	})
+//
+// Fetch returns the cached value if present. Otherwise, the loader is
+// called and its result is cached for the given TTL. Concurrent misses of
+// the same key in the process are coalesced into a single call to the
+// loader. If LockTTL is set, then misses are also coalesced across
+// processes with a short lock stored in Redis.
+//
+// Values are encoded with the codec of the client and stored with a small
+// header that records when the value expires and how long the loader took
+// to compute it. Values written without the header, such as values written
+// by SetAsJson, are read as fresh values.
+//
+// The fields must not be modified after the cache is first used.
+type Cache struct {
+	// Client is the client used to read and write cached values.
+	Client *RedisClient
+
+	// Jitter is the fraction of the TTL that is randomly subtracted from
+	// the TTL of each value so that values written together do not expire
+	// together. Values are clamped to [0, 1].
+	Jitter float64
+
+	// Beta enables probabilistic early refresh as described in "Optimal
+	// Probabilistic Cache Stampede Prevention" (XFetch). Before a value
+	// expires, each Fetch refreshes it in the background with a
+	// probability that increases as the expiry approaches and with the
+	// time the loader took to compute the value. Larger values refresh
+	// earlier. Zero disables early refresh; 1 is a good default.
+	Beta float64
+
+	// StaleTTL is how long a value is kept after it expires. Fetch returns
+	// a stale value immediately and refreshes it in the background. Zero
+	// disables stale-while-revalidate.
+	StaleTTL time.Duration
+
+	// NegativeTTL is how long a not-found result is cached. The loader
+	// reports not found by returning ErrNil. Fetch returns ErrNil for a
+	// cached not-found result. Zero disables negative caching.
+	NegativeTTL time.Duration
+
+	// LockTTL enables a lock stored in Redis that coalesces the misses of
+	// a key across processes. The process that holds the lock calls the
+	// loader while the others wait for the value. The lock expires after
+	// LockTTL in case its holder fails. Zero disables the lock.
+	LockTTL time.Duration
+
+	// LockPoll is the interval at which processes waiting for the holder
+	// of the lock check for the value. If zero, then 10 milliseconds is
+	// used.
+	LockPoll time.Duration
+
+	// ErrorHandler is called with the errors of background refreshes. If
+	// nil, then the errors are ignored.
+	ErrorHandler func(key string, err error)
+
+	mu    sync.Mutex
+	calls map[string]*cacheCall
+}
+
+// cacheCall is a load of a key in progress.
+type cacheCall struct {
+	done    chan struct{}
+	payload []byte
+	err     error
+}
+
+// cacheMagic is the first byte of a value written by Cache. The header
+// continues with a flags byte, the uvarint time in milliseconds taken by the
+// loader and the uvarint expiry time in Unix milliseconds or zero for a
+// value that does not expire. The encoded value follows the header.
+const (
+	cacheMagic    = 0xf8
+	cacheNotFound = 1 << 0
+)
+
+// cacheEntry is a decoded cached value.
+type cacheEntry struct {
+	notFound bool
+	delta    time.Duration
+	expiry   time.Time
+	payload  []byte
+}
+
+func encodeCacheEntry(e *cacheEntry) []byte {
+	var flags byte
+	if e.notFound {
+		flags |= cacheNotFound
+	}
+	var expiry int64
+	if !e.expiry.IsZero() {
+		expiry = e.expiry.UnixNano() / int64(time.Millisecond)
+	}
+	p := make([]byte, 2, 2+2*binary.MaxVarintLen64+len(e.payload))
+	p[0], p[1] = cacheMagic, flags
+	p = appendUvarint(p, uint64(e.delta/time.Millisecond))
+	p = appendUvarint(p, uint64(expiry))
+	return append(p, e.payload...)
+}
+
+func appendUvarint(p []byte, x uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], x)
+	return append(p, buf[:n]...)
+}
+
+var errCacheHeader = errors.New("redigo: invalid cache header")
+
+func decodeCacheEntry(p []byte) (*cacheEntry, error) {
+	if len(p) == 0 || p[0] != cacheMagic {
+		return &cacheEntry{payload: p}, nil
+	}
+	if len(p) < 2 {
+		return nil, errCacheHeader
+	}
+	e := &cacheEntry{notFound: p[1]&cacheNotFound != 0}
+	p = p[2:]
+	delta, n := binary.Uvarint(p)
+	if n <= 0 {
+		return nil, errCacheHeader
+	}
+	p = p[n:]
+	expiry, n := binary.Uvarint(p)
+	if n <= 0 {
+		return nil, errCacheHeader
+	}
+	e.delta = time.Duration(delta) * time.Millisecond
+	if expiry > 0 {
+		e.expiry = time.Unix(0, int64(expiry)*int64(time.Millisecond))
+	}
+	e.payload = p[n:]
+	return e, nil
+}
+
+// randFloat returns a random number in (0, 1].
+func randFloat() float64 {
+	jitterMu.Lock()
+	f := jitterRand.Float64()
+	jitterMu.Unlock()
+	return 1 - f
+}
+
+// refreshEarly returns true if a fresh entry should be refreshed before it
+// expires.
+func (c *Cache) refreshEarly(e *cacheEntry, now time.Time) bool {
+	if c.Beta <= 0 || e.expiry.IsZero() || e.delta <= 0 {
+		return false
+	}
+	gap := -float64(e.delta) * c.Beta * math.Log(randFloat())
+	return !now.Add(time.Duration(gap)).Before(e.expiry)
+}
+
+// Fetch decodes the cached value of key into the value pointed to by dest.
+// If the key is not cached, then Fetch calls loader, caches the result for
+// ttl and decodes the result into dest. Zero ttl caches the result without
+// expiration. If the loader returns ErrNil and NegativeTTL is set, then the
+// not-found result is cached and Fetch returns ErrNil.
+//
+// The loader is called with a context that carries the values of the
+// context of the goroutine that starts the load, but is not canceled with
+// it, because the result is shared by all goroutines that wait for the load.
+// The context of each call stops Fetch from waiting for the load. A panic in
+// the loader is returned as an error to the waiting goroutines.
+func (c *Cache) Fetch(ctx context.Context, key string, ttl time.Duration, dest interface{}, loader func(ctx context.Context) (interface{}, error)) error {
+	p, err := Bytes(c.Client.Do(CmdGet, key))
+	switch {
+	case err == nil:
+		e, err := decodeCacheEntry(p)
+		if err != nil {
+			return err
+		}
+		now := nowFunc()
+		if !e.expiry.IsZero() && !now.Before(e.expiry) {
+			if c.StaleTTL <= 0 {
+				break
+			}
+			c.refresh(key, ttl, loader)
+		} else if c.refreshEarly(e, now) {
+			c.refresh(key, ttl, loader)
+		}
+		return c.decode(key, e, dest)
+	case err != ErrNil:
+		return err
+	}
+
+	call := c.load(ctx, key, ttl, loader, false)
+	for {
+		select {
+		case <-call.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if call.err != errCacheLockHeld {
+			break
+		}
+		// A background refresh that did not get the lock completed. Load
+		// the key in the foreground.
+		call = c.load(ctx, key, ttl, loader, false)
+	}
+	if call.err != nil {
+		return call.err
+	}
+	e, err := decodeCacheEntry(call.payload)
+	if err != nil {
+		return err
+	}
+	return c.decode(key, e, dest)
+}
+
+func (c *Cache) decode(key string, e *cacheEntry, dest interface{}) error {
+	if e.notFound {
+		return ErrNil
+	}
+	return c.Client.decodeKey(key, "", e.payload, dest)
+}
+
+// refresh reloads key in the background unless a load of the key is in
+// progress.
+func (c *Cache) refresh(key string, ttl time.Duration, loader func(ctx context.Context) (interface{}, error)) {
+	call := c.load(context.Background(), key, ttl, loader, true)
+	if c.ErrorHandler == nil {
+		return
+	}
+	go func() {
+		<-call.done
+		if call.err != nil && call.err != ErrNil && call.err != errCacheLockHeld {
+			c.ErrorHandler(key, call.err)
+		}
+	}()
+}
+
+// load starts a load of key or joins the load in progress. A background
+// load does not wait for a lock held by another process.
+func (c *Cache) load(ctx context.Context, key string, ttl time.Duration, loader func(ctx context.Context) (interface{}, error), background bool) *cacheCall {
+	c.mu.Lock()
+	if call, ok := c.calls[key]; ok {
+		c.mu.Unlock()
+		return call
+	}
+	if c.calls == nil {
+		c.calls = make(map[string]*cacheCall)
+	}
+	call := &cacheCall{done: make(chan struct{})}
+	c.calls[key] = call
+	c.mu.Unlock()
+
+	ctx = detachedContext{ctx}
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				call.payload, call.err = nil, fmt.Errorf("redigo: cache loader of %s panicked: %v", key, r)
+			}
+			c.mu.Lock()
+			delete(c.calls, key)
+			c.mu.Unlock()
+			close(call.done)
+		}()
+		call.payload, call.err = c.loadLocked(ctx, key, ttl, loader, background)
+	}()
+	return call
+}
+
+// detachedContext carries the values of a context without its deadline and
+// cancellation.
+type detachedContext struct{ parent context.Context }
+
+func (detachedContext) Deadline() (time.Time, bool)         { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}               { return nil }
+func (detachedContext) Err() error                          { return nil }
+func (c detachedContext) Value(key interface{}) interface{} { return c.parent.Value(key) }
+
+var errCacheLockHeld = errors.New("redigo: cache lock held by another process")
+
+// loadLocked acquires the lock of key if LockTTL is set and loads the key.
+// If another process holds the lock, then loadLocked waits for the value
+// written by that process and loads the key itself if the lock expires
+// without a value.
+func (c *Cache) loadLocked(ctx context.Context, key string, ttl time.Duration, loader func(ctx context.Context) (interface{}, error), background bool) ([]byte, error) {
+	if c.LockTTL <= 0 {
+		return c.store(ctx, key, ttl, loader)
+	}
+	lockKey := key + ":lock"
+	token, err := lockToken()
+	if err != nil {
+		return nil, err
+	}
+	poll := c.LockPoll
+	if poll <= 0 {
+		poll = 10 * time.Millisecond
+	}
+	deadline := nowFunc().Add(c.LockTTL)
+	for {
+		_, err := String(c.Client.Do(CmdSet, lockKey, token, ParamPX, formatMs(c.LockTTL), ParamNX))
+		if err == nil {
+			defer c.unlock(lockKey, token)
+			return c.store(ctx, key, ttl, loader)
+		} else if err != ErrNil {
+			return nil, err
+		}
+		if background {
+			return nil, errCacheLockHeld
+		}
+		if !nowFunc().Before(deadline) {
+			return c.store(ctx, key, ttl, loader)
+		}
+		select {
+		case <-time.After(poll):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		p, err := Bytes(c.Client.Do(CmdGet, key))
+		if err == nil {
+			return p, nil
+		} else if err != ErrNil {
+			return nil, err
+		}
+	}
+}
+
+func lockToken() (string, error) {
+	var p [16]byte
+	if _, err := rand.Read(p[:]); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(p[:]), nil
+}
+
+// unlock deletes the lock if it is still held with token.
+func (c *Cache) unlock(lockKey, token string) error {
+	conn, err := c.Client.GetConn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if _, err := conn.Do(CmdWatch, lockKey); err != nil {
+		return err
+	}
+	if s, err := String(conn.Do(CmdGet, lockKey)); err != nil || s != token {
+		return err
+	}
+	conn.Send(CmdMulti)
+	conn.Send(CmdDel, lockKey)
+	_, err = conn.Do(CmdExec)
+	return err
+}
+
+// store calls the loader and writes the result to key. It returns the
+// stored value.
+func (c *Cache) store(ctx context.Context, key string, ttl time.Duration, loader func(ctx context.Context) (interface{}, error)) ([]byte, error) {
+	start := nowFunc()
+	v, err := loader(ctx)
+	e := &cacheEntry{delta: nowFunc().Sub(start)}
+	switch {
+	case err == ErrNil && c.NegativeTTL > 0:
+		e.notFound = true
+		ttl = c.NegativeTTL
+	case err != nil:
+		return nil, err
+	default:
+		if e.payload, err = c.Client.encodeKey(key, "", v); err != nil {
+			return nil, err
+		}
+	}
+	if ttl > 0 {
+		if f := math.Min(math.Max(c.Jitter, 0), 1); f > 0 {
+			ttl -= jitter(time.Duration(f * float64(ttl)))
+		}
+		e.expiry = nowFunc().Add(ttl)
+		if c.StaleTTL > 0 && !e.notFound {
+			ttl += c.StaleTTL
+		}
+	}
+	p := encodeCacheEntry(e)
+	if _, err := c.Client.Set(key, p, ttl); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Invalidate deletes the cached values of keys.
+func (c *Cache) Invalidate(keys ...string) error {
+	_, err := c.Client.Del(keys...)
+	return err
+}
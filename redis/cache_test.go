@@ -0,0 +1,285 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingLoader returns a loader that returns value after delay and
+// counts its calls.
+func countingLoader(n *int32, delay time.Duration, value interface{}) func(context.Context) (interface{}, error) {
+	return func(ctx context.Context) (interface{}, error) {
+		atomic.AddInt32(n, 1)
+		time.Sleep(delay)
+		return value, nil
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		if cond() {
+			return
+		}
+	}
+	t.Fatal("condition not reached")
+}
+
+func TestCacheFetch(t *testing.T) {
+	client := getClient()
+	client.Del("cache:a")
+	defer client.Del("cache:a")
+
+	ctx := context.Background()
+	cache := &Cache{Client: client}
+	var n int32
+	for i := 0; i < 3; i++ {
+		var v map[string]int
+		if err := cache.Fetch(ctx, "cache:a", time.Minute, &v, countingLoader(&n, 0, map[string]int{"x": 1})); err != nil {
+			t.Fatalf("Fetch returned %v", err)
+		}
+		if v["x"] != 1 {
+			t.Errorf("Fetch returned %v, want map[x:1]", v)
+		}
+	}
+	if n != 1 {
+		t.Errorf("loader called %d times, want 1", n)
+	}
+	if ttl, _ := client.PTTL("cache:a"); ttl <= 0 || ttl > int64(time.Minute/time.Millisecond) {
+		t.Errorf("PTTL is %d, want (0, 60000]", ttl)
+	}
+
+	// Values written without the cache header are read as is.
+	client.SetAsJson("cache:a", 42, 0)
+	var v int
+	if err := cache.Fetch(ctx, "cache:a", time.Minute, &v, countingLoader(&n, 0, 1)); err != nil || v != 42 {
+		t.Errorf("Fetch of plain value returned %d, %v, want 42, nil", v, err)
+	}
+
+	loadErr := errors.New("load failed")
+	client.Del("cache:a")
+	err := cache.Fetch(ctx, "cache:a", time.Minute, &v, func(context.Context) (interface{}, error) { return nil, loadErr })
+	if err != loadErr {
+		t.Errorf("Fetch returned %v, want %v", err, loadErr)
+	}
+}
+
+func TestCacheCoalesce(t *testing.T) {
+	client := getClient()
+	client.Del("cache:b", "cache:b:lock")
+	defer client.Del("cache:b")
+
+	// Two caches with a lock model two processes.
+	caches := []*Cache{
+		{Client: client, LockTTL: time.Second, LockPoll: time.Millisecond},
+		{Client: client, LockTTL: time.Second, LockPoll: time.Millisecond},
+	}
+	var n int32
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var s string
+			err := caches[i%2].Fetch(context.Background(), "cache:b", time.Minute, &s, countingLoader(&n, 20*time.Millisecond, "hello"))
+			if err != nil || s != "hello" {
+				t.Errorf("Fetch returned %q, %v, want hello, nil", s, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if n != 1 {
+		t.Errorf("loader called %d times, want 1", n)
+	}
+	if n, _ := client.Exists("cache:b:lock"); n != 0 {
+		t.Errorf("lock exists after load")
+	}
+}
+
+func TestCacheContext(t *testing.T) {
+	client := getClient()
+	client.Del("cache:ctx")
+	defer client.Del("cache:ctx")
+
+	cache := &Cache{Client: client}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	var s string
+	var n int32
+	go cache.Fetch(context.Background(), "cache:ctx", time.Minute, &s, countingLoader(&n, 100*time.Millisecond, "slow"))
+	waitFor(t, func() bool { return atomic.LoadInt32(&n) == 1 })
+	if err := cache.Fetch(ctx, "cache:ctx", time.Minute, &s, countingLoader(&n, 0, "fast")); err != context.DeadlineExceeded {
+		t.Errorf("Fetch returned %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+type cacheTestKey struct{}
+
+func TestCacheCanceledLoad(t *testing.T) {
+	client := getClient()
+	client.Del("cache:cancel")
+	defer client.Del("cache:cancel")
+
+	cache := &Cache{Client: client}
+	release := make(chan struct{})
+	var n int32
+	loader := func(ctx context.Context) (interface{}, error) {
+		atomic.AddInt32(&n, 1)
+		<-release
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		return ctx.Value(cacheTestKey{}), nil
+	}
+
+	// The goroutine that starts the load cancels its context.
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), cacheTestKey{}, "v"))
+	first := make(chan error, 1)
+	go func() {
+		var s string
+		first <- cache.Fetch(ctx, "cache:cancel", time.Minute, &s, loader)
+	}()
+	waitFor(t, func() bool { return atomic.LoadInt32(&n) == 1 })
+	cancel()
+	if err := <-first; err != context.Canceled {
+		t.Errorf("Fetch with canceled context returned %v, want %v", err, context.Canceled)
+	}
+
+	// The load continues for the other goroutines that wait for it.
+	close(release)
+	waitFor(t, func() bool {
+		n, _ := client.Exists("cache:cancel")
+		return n == 1
+	})
+	var s string
+	if err := cache.Fetch(context.Background(), "cache:cancel", time.Minute, &s, loader); err != nil || s != "v" {
+		t.Errorf("Fetch returned %q, %v, want v, nil", s, err)
+	}
+	if n := atomic.LoadInt32(&n); n != 1 {
+		t.Errorf("loader called %d times, want 1", n)
+	}
+}
+
+func TestCacheLoaderPanic(t *testing.T) {
+	client := getClient()
+	client.Del("cache:panic")
+	defer client.Del("cache:panic")
+
+	cache := &Cache{Client: client}
+	var s string
+	err := cache.Fetch(context.Background(), "cache:panic", time.Minute, &s, func(context.Context) (interface{}, error) {
+		panic("boom")
+	})
+	if err == nil {
+		t.Fatal("Fetch with panicking loader returned nil error")
+	}
+	var n int32
+	if err := cache.Fetch(context.Background(), "cache:panic", time.Minute, &s, countingLoader(&n, 0, "ok")); err != nil || s != "ok" {
+		t.Errorf("Fetch after panic returned %q, %v, want ok, nil", s, err)
+	}
+}
+
+func TestCacheNegative(t *testing.T) {
+	client := getClient()
+	client.Del("cache:c")
+	defer client.Del("cache:c")
+
+	cache := &Cache{Client: client, NegativeTTL: time.Minute}
+	var n int32
+	loader := func(context.Context) (interface{}, error) {
+		atomic.AddInt32(&n, 1)
+		return nil, ErrNil
+	}
+	for i := 0; i < 2; i++ {
+		var s string
+		if err := cache.Fetch(context.Background(), "cache:c", time.Hour, &s, loader); err != ErrNil {
+			t.Errorf("Fetch returned %v, want ErrNil", err)
+		}
+	}
+	if n != 1 {
+		t.Errorf("loader called %d times, want 1", n)
+	}
+	if ttl, _ := client.PTTL("cache:c"); ttl > int64(time.Minute/time.Millisecond) {
+		t.Errorf("PTTL is %d, want at most NegativeTTL", ttl)
+	}
+}
+
+func TestCacheStaleWhileRevalidate(t *testing.T) {
+	client := getClient()
+	client.Del("cache:d")
+	defer client.Del("cache:d")
+
+	cache := &Cache{Client: client, StaleTTL: time.Minute}
+	ctx := context.Background()
+	var n int32
+	var s string
+	if err := cache.Fetch(ctx, "cache:d", 20*time.Millisecond, &s, countingLoader(&n, 0, "v1")); err != nil {
+		t.Fatalf("Fetch returned %v", err)
+	}
+	time.Sleep(30 * time.Millisecond)
+
+	// The stale value is returned while the value is refreshed.
+	if err := cache.Fetch(ctx, "cache:d", time.Minute, &s, countingLoader(&n, 0, "v2")); err != nil || s != "v1" {
+		t.Errorf("Fetch returned %q, %v, want v1, nil", s, err)
+	}
+	waitFor(t, func() bool {
+		var s string
+		cache.Fetch(ctx, "cache:d", time.Minute, &s, countingLoader(&n, 0, "v2"))
+		return s == "v2"
+	})
+}
+
+func TestCacheEarlyRefresh(t *testing.T) {
+	client := getClient()
+	client.Del("cache:e")
+	defer client.Del("cache:e")
+
+	// A large Beta refreshes a value on every hit.
+	cache := &Cache{Client: client, Beta: 1e9}
+	ctx := context.Background()
+	var n int32
+	var s string
+	if err := cache.Fetch(ctx, "cache:e", time.Minute, &s, countingLoader(&n, 2*time.Millisecond, "v1")); err != nil {
+		t.Fatalf("Fetch returned %v", err)
+	}
+	if err := cache.Fetch(ctx, "cache:e", time.Minute, &s, countingLoader(&n, 2*time.Millisecond, "v2")); err != nil || s != "v1" {
+		t.Errorf("Fetch returned %q, %v, want v1, nil", s, err)
+	}
+	waitFor(t, func() bool { return atomic.LoadInt32(&n) == 2 })
+	waitFor(t, func() bool {
+		p, _ := Bytes(client.Do(CmdGet, "cache:e"))
+		e, err := decodeCacheEntry(p)
+		return err == nil && string(e.payload) == `"v2"`
+	})
+}
+
+func TestCacheJitter(t *testing.T) {
+	client := getClient()
+	client.Del("cache:f")
+	defer client.Del("cache:f")
+
+	cache := &Cache{Client: client, Jitter: 0.5}
+	var s string
+	var n int32
+	if err := cache.Fetch(context.Background(), "cache:f", 100*time.Second, &s, countingLoader(&n, 0, "v")); err != nil {
+		t.Fatalf("Fetch returned %v", err)
+	}
+	if ttl, _ := client.PTTL("cache:f"); ttl < 50000 || ttl > 100000 {
+		t.Errorf("PTTL is %d, want [50000, 100000]", ttl)
+	}
+}
+
+func TestCacheEntryEncoding(t *testing.T) {
+	e := &cacheEntry{delta: 1500 * time.Millisecond, expiry: time.Unix(1600000000, 123e6), payload: []byte("abc")}
+	got, err := decodeCacheEntry(encodeCacheEntry(e))
+	if err != nil || got.delta != e.delta || !got.expiry.Equal(e.expiry) || string(got.payload) != "abc" || got.notFound {
+		t.Errorf("decodeCacheEntry returned %+v, %v, want %+v", got, err, e)
+	}
+	if _, err := decodeCacheEntry([]byte{cacheMagic, 0, 0x80}); err != errCacheHeader {
+		t.Errorf("decodeCacheEntry of truncated header returned %v, want %v", err, errCacheHeader)
+	}
+}
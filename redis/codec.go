@@ -0,0 +1,349 @@
+package redis
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// Codec encodes and decodes values stored in Redis strings, hash fields,
+// list elements and stream entries.
+type Codec interface {
+	// Marshal returns the encoding of v.
+	Marshal(v interface{}) ([]byte, error)
+
+	// Unmarshal decodes data into the value pointed to by v.
+	Unmarshal(data []byte, v interface{}) error
+}
+
+var (
+	// JSONCodec encodes values with the encoding/json package.
+	JSONCodec Codec = jsonCodec{}
+
+	// GobCodec encodes values with the encoding/gob package. Each value is
+	// encoded with its own type information, so the encoding is larger than
+	// a stream of gob values.
+	GobCodec Codec = gobCodec{}
+
+	// BinaryCodec encodes values in a compact self-describing binary format.
+	//
+	// The codec encodes booleans, integers, floats, strings, byte slices,
+	// slices, arrays, maps, pointers and structs. Map entries are sorted by
+	// the encoding of the key so that equal values have equal encodings.
+	// Structs are encoded as maps from the names of exported fields to field
+	// values. The 'redis' field tag overrides the field name and the tag
+	// redis:"-" skips the field. Values that implement
+	// encoding.BinaryMarshaler, such as time.Time and protobuf-style
+	// generated messages, are encoded with their MarshalBinary method and
+	// decoded with UnmarshalBinary.
+	//
+	// Values decoded into an interface{} have the types nil, bool, int64,
+	// uint64, float64, string, []byte, []interface{} and
+	// map[string]interface{}. Decoding fails for arrays and maps nested more
+	// than 1000 levels deep.
+	BinaryCodec Codec = binaryCodec{}
+)
+
+// KeyedCodec is implemented by codecs that bind encoded values to the key
+// and hash field that store them. The value helpers of RedisClient use
+// MarshalKey and UnmarshalKey when the client's codec is a KeyedCodec. The
+// field is empty for values that are not stored in a hash field or stream
+// entry field.
+type KeyedCodec interface {
+	Codec
+	MarshalKey(key, field string, v interface{}) ([]byte, error)
+	UnmarshalKey(key, field string, data []byte, v interface{}) error
+}
+
+// marshalWith encodes v with codec. If codec is nil, then v must be a string
+// or byte slice and is returned as is.
+func marshalWith(codec Codec, v interface{}) ([]byte, error) {
+	if codec != nil {
+		return codec.Marshal(v)
+	}
+	switch v := v.(type) {
+	case []byte:
+		return v, nil
+	case string:
+		return []byte(v), nil
+	}
+	return nil, fmt.Errorf("redigo: cannot encode %T without a Codec", v)
+}
+
+// unmarshalWith decodes data with codec. If codec is nil, then v must be a
+// *string, *[]byte or *interface{}.
+func unmarshalWith(codec Codec, data []byte, v interface{}) error {
+	if codec != nil {
+		return codec.Unmarshal(data, v)
+	}
+	switch v := v.(type) {
+	case *[]byte:
+		*v = data
+	case *string:
+		*v = string(data)
+	case *interface{}:
+		*v = data
+	default:
+		return fmt.Errorf("redigo: cannot decode into %T without a Codec", v)
+	}
+	return nil
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) { return json.Marshal(v) }
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+
+type gobCodec struct{}
+
+func (gobCodec) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gobCodec) Unmarshal(data []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+// envelopeMagic is the first byte of a VersionedCodec header. The byte does
+// not start a valid JSON text, gob value or BinaryCodec value.
+const envelopeMagic = 0xf5
+
+// VersionedCodec wraps values in an envelope with a two byte header: a
+// magic byte and the format version. Unmarshal selects the codec for the
+// version found in the header, so that values written in an old format are
+// readable while new values are written in the current format. This allows
+// the stored format to be migrated without downtime:
+//
+//	codec := &redis.VersionedCodec{
+//		Version: 2,
+//		Codecs:  map[byte]redis.Codec{1: redis.JSONCodec, 2: redis.BinaryCodec},
+//		Legacy:  redis.JSONCodec, // values written before the envelope
+//	}
+type VersionedCodec struct {
+	// Version is the version written by Marshal.
+	Version byte
+
+	// Codecs maps versions to codecs.
+	Codecs map[byte]Codec
+
+	// Legacy decodes values that do not have an envelope header. If nil,
+	// then such values are rejected.
+	Legacy Codec
+}
+
+func (vc *VersionedCodec) codec(version byte) (Codec, error) {
+	codec := vc.Codecs[version]
+	if codec == nil {
+		return nil, fmt.Errorf("redigo: unknown codec version %d", version)
+	}
+	return codec, nil
+}
+
+// Marshal encodes v with the codec for vc.Version and prepends the envelope
+// header.
+func (vc *VersionedCodec) Marshal(v interface{}) ([]byte, error) {
+	codec, err := vc.codec(vc.Version)
+	if err != nil {
+		return nil, err
+	}
+	p, err := codec.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{envelopeMagic, vc.Version}, p...), nil
+}
+
+// Unmarshal decodes data with the codec for the version in the envelope
+// header or with vc.Legacy if data does not have a header.
+func (vc *VersionedCodec) Unmarshal(data []byte, v interface{}) error {
+	if len(data) < 2 || data[0] != envelopeMagic {
+		if vc.Legacy == nil {
+			return errors.New("redigo: value does not have a codec envelope")
+		}
+		return vc.Legacy.Unmarshal(data, v)
+	}
+	codec, err := vc.codec(data[1])
+	if err != nil {
+		return err
+	}
+	return codec.Unmarshal(data[2:], v)
+}
+
+// codec returns the codec of the client.
+func (client *RedisClient) codec() Codec {
+	if client.Codec == nil {
+		return JSONCodec
+	}
+	return client.Codec
+}
+
+// WithCodec returns a copy of the client that encodes values with codec. The
+// copy shares the connection pool with the client. Use WithCodec to
+// override the codec for a single call:
+//
+//	client.WithCodec(redis.GobCodec).GetValue(&v, key)
+func (client *RedisClient) WithCodec(codec Codec) *RedisClient {
+	c := *client
+	c.Codec = codec
+	return &c
+}
+
+// Encode encodes v with the codec of the client.
+func (client *RedisClient) Encode(v interface{}) ([]byte, error) {
+	return client.codec().Marshal(v)
+}
+
+// Decode decodes data encoded with the codec of the client into the value
+// pointed to by v.
+func (client *RedisClient) Decode(data []byte, v interface{}) error {
+	return client.codec().Unmarshal(data, v)
+}
+
+// DecodeField decodes the value of field in the stream or hash stored at
+// key. Use DecodeField instead of Decode for values that are bound to the
+// key by a KeyedCodec, such as the stream values written by XAddValues.
+func (client *RedisClient) DecodeField(key, field string, data []byte, v interface{}) error {
+	return client.decodeKey(key, field, data, v)
+}
+
+func (client *RedisClient) encodeKey(key, field string, v interface{}) ([]byte, error) {
+	if kc, ok := client.codec().(KeyedCodec); ok {
+		return kc.MarshalKey(key, field, v)
+	}
+	return client.Encode(v)
+}
+
+func (client *RedisClient) decodeKey(key, field string, data []byte, v interface{}) error {
+	if kc, ok := client.codec().(KeyedCodec); ok {
+		return kc.UnmarshalKey(key, field, data, v)
+	}
+	return client.Decode(data, v)
+}
+
+// scanner returns a function that converts a reply read from key and field
+// to dest. Bulk strings are decoded with the codec of the client if set.
+// Other replies are converted using the rules of Scan.
+func (client *RedisClient) scanner(key, field string) func(dest, reply interface{}) error {
+	return func(dest, reply interface{}) error {
+		if p, ok := reply.([]byte); ok && client.Codec != nil {
+			return client.decodeKey(key, field, p, dest)
+		}
+		return convertAssign(dest, reply)
+	}
+}
+
+func (client *RedisClient) encodeValues(key string, values []interface{}) ([]interface{}, error) {
+	args := make([]interface{}, len(values))
+	for i, v := range values {
+		p, err := client.encodeKey(key, "", v)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = p
+	}
+	return args, nil
+}
+
+// SetValue sets key to the encoding of value. Zero expiration means the key
+// has no expiration time.
+func (client *RedisClient) SetValue(key string, value interface{}, expiration time.Duration) (string, error) {
+	p, err := client.encodeKey(key, "", value)
+	if err != nil {
+		return "", err
+	}
+	return client.Set(key, p, expiration)
+}
+
+// GetValue decodes the value of key into the value pointed to by dest. It
+// returns ErrNil when the key does not exist.
+func (client *RedisClient) GetValue(dest interface{}, key string) error {
+	p, err := Bytes(client.Do(CmdGet, key))
+	if err != nil {
+		return err
+	}
+	return client.decodeKey(key, "", p, dest)
+}
+
+// HSetValue sets field in the hash stored at key to the encoding of value.
+func (client *RedisClient) HSetValue(key, field string, value interface{}) (bool, error) {
+	p, err := client.encodeKey(key, field, value)
+	if err != nil {
+		return false, err
+	}
+	return client.HSet(key, field, p)
+}
+
+// HGetValue decodes field of the hash stored at key into the value pointed
+// to by dest. It returns ErrNil when the key or field does not exist.
+func (client *RedisClient) HGetValue(dest interface{}, key, field string) error {
+	p, err := Bytes(client.Do(HGet, key, field))
+	if err != nil {
+		return err
+	}
+	return client.decodeKey(key, field, p, dest)
+}
+
+// LPushValues prepends the encodings of values to the list stored at key.
+func (client *RedisClient) LPushValues(key string, values ...interface{}) (int64, error) {
+	args, err := client.encodeValues(key, values)
+	if err != nil {
+		return 0, err
+	}
+	return client.LPush(key, args...)
+}
+
+// RPushValues appends the encodings of values to the list stored at key.
+func (client *RedisClient) RPushValues(key string, values ...interface{}) (int64, error) {
+	args, err := client.encodeValues(key, values)
+	if err != nil {
+		return 0, err
+	}
+	return client.RPush(key, args...)
+}
+
+// LRangeValues decodes the elements of the list stored at key between start
+// and stop into the slice pointed to by dest.
+func (client *RedisClient) LRangeValues(dest interface{}, key string, start, stop int64) error {
+	d := reflect.ValueOf(dest)
+	if d.Kind() != reflect.Ptr || d.IsNil() || d.Elem().Kind() != reflect.Slice {
+		return errors.New("redigo: LRangeValues dest must be a non-nil pointer to a slice")
+	}
+	values, err := ByteSlices(client.Do(CmdLRange, key, start, stop))
+	if err != nil {
+		return err
+	}
+	s := d.Elem()
+	ensureLen(s, len(values))
+	for i, p := range values {
+		e := s.Index(i)
+		e.Set(reflect.Zero(e.Type()))
+		if err := client.decodeKey(key, "", p, e.Addr().Interface()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// XAddValues appends an entry with the encodings of the field values to the
+// stream stored at key and returns the ID of the entry. Use "*" as the id to
+// let the server generate the ID.
+func (client *RedisClient) XAddValues(key, id string, values map[string]interface{}) (string, error) {
+	args := []interface{}{key, id}
+	for field, v := range values {
+		p, err := client.encodeKey(key, field, v)
+		if err != nil {
+			return "", err
+		}
+		args = append(args, field, p)
+	}
+	return client.String(CmdXAdd, args...)
+}
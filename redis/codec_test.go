@@ -0,0 +1,222 @@
+package redis
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type codecTestValue struct {
+	Name     string
+	Count    int
+	Ratio    float64
+	Tags     []string
+	Attrs    map[string]int
+	Created  time.Time
+	Next     *codecTestValue
+	Ignored  string `redis:"-"`
+	Renamed  bool   `redis:"r"`
+	internal int
+}
+
+func newCodecTestValue() codecTestValue {
+	return codecTestValue{
+		Name:    "root",
+		Count:   -3,
+		Ratio:   0.25,
+		Tags:    []string{"a", "b"},
+		Attrs:   map[string]int{"x": 1, "y": 2},
+		Created: time.Date(2020, 1, 2, 3, 4, 5, 6, time.UTC),
+		Next:    &codecTestValue{Name: "child", Count: 7},
+		Renamed: true,
+	}
+}
+
+func TestCodecRoundTrip(t *testing.T) {
+	for _, codec := range []struct {
+		name  string
+		codec Codec
+	}{
+		{"json", JSONCodec},
+		{"gob", GobCodec},
+		{"binary", BinaryCodec},
+	} {
+		v := newCodecTestValue()
+		p, err := codec.codec.Marshal(v)
+		if err != nil {
+			t.Errorf("%s: Marshal returned %v", codec.name, err)
+			continue
+		}
+		var actual codecTestValue
+		if err := codec.codec.Unmarshal(p, &actual); err != nil {
+			t.Errorf("%s: Unmarshal returned %v", codec.name, err)
+			continue
+		}
+		if codec.name == "gob" {
+			// gob ignores the redis field tag.
+			v.Ignored = actual.Ignored
+		}
+		if !reflect.DeepEqual(actual, v) {
+			t.Errorf("%s: round trip returned %+v, want %+v", codec.name, actual, v)
+		}
+	}
+}
+
+func TestBinaryCodec(t *testing.T) {
+	m := map[string]interface{}{"b": int64(-1), "a": []interface{}{true, nil, "s", 1.5, uint64(2)}}
+	p1, err := BinaryCodec.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		if p2, _ := BinaryCodec.Marshal(m); !bytes.Equal(p1, p2) {
+			t.Fatal("encodings of equal maps differ")
+		}
+	}
+	var actual interface{}
+	if err := BinaryCodec.Unmarshal(p1, &actual); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(actual, m) {
+		t.Errorf("Unmarshal returned %#v, want %#v", actual, m)
+	}
+
+	if p, _ := BinaryCodec.Marshal(42); len(p) != 2 {
+		t.Errorf("encoding of 42 has %d bytes, want 2", len(p))
+	}
+
+	var small int8
+	p, _ := BinaryCodec.Marshal(1000)
+	if err := BinaryCodec.Unmarshal(p, &small); err == nil {
+		t.Error("Unmarshal of 1000 into int8 returned nil error")
+	}
+	var u uint
+	p, _ = BinaryCodec.Marshal(-1)
+	if err := BinaryCodec.Unmarshal(p, &u); err == nil {
+		t.Error("Unmarshal of -1 into uint returned nil error")
+	}
+	if err := BinaryCodec.Unmarshal(p[:0], &u); err != errBinaryTruncated {
+		t.Errorf("Unmarshal of empty data returned %v, want %v", err, errBinaryTruncated)
+	}
+	if err := BinaryCodec.Unmarshal(append(p, 0), new(int)); err != errBinaryTrailing {
+		t.Errorf("Unmarshal with trailing data returned %v, want %v", err, errBinaryTrailing)
+	}
+
+	// Keys that are slices or maps cannot be stored in a map.
+	p = []byte{binaryMap, 1, binaryArray, 0, binaryTrue}
+	var keyed map[interface{}]bool
+	if err := BinaryCodec.Unmarshal(p, &keyed); err == nil {
+		t.Error("Unmarshal of an array key returned nil error")
+	}
+
+	// Deeply nested data is rejected.
+	p = bytes.Repeat([]byte{binaryArray, 1}, binaryMaxDepth+1)
+	p = append(p, binaryNil)
+	if err := BinaryCodec.Unmarshal(p, &actual); err != errBinaryDepth {
+		t.Errorf("Unmarshal of deeply nested data returned %v, want %v", err, errBinaryDepth)
+	}
+	p = bytes.Repeat([]byte{binaryMap, 1, binaryString, 1, 'k'}, binaryMaxDepth+1)
+	p = append(p, binaryNil)
+	if err := BinaryCodec.Unmarshal(p, &actual); err != errBinaryDepth {
+		t.Errorf("Unmarshal of deeply nested maps returned %v, want %v", err, errBinaryDepth)
+	}
+	p = bytes.Repeat([]byte{binaryArray, 1}, binaryMaxDepth)
+	p = append(p, binaryNil)
+	if err := BinaryCodec.Unmarshal(p, &actual); err != nil {
+		t.Errorf("Unmarshal of data at the maximum depth returned %v", err)
+	}
+
+	// Fields that are not in the destination struct are skipped.
+	p, _ = BinaryCodec.Marshal(map[string]interface{}{"Name": "n", "Extra": []int{1, 2}})
+	var v codecTestValue
+	if err := BinaryCodec.Unmarshal(p, &v); err != nil || v.Name != "n" {
+		t.Errorf("Unmarshal returned %v, %q, want nil, n", err, v.Name)
+	}
+}
+
+func TestVersionedCodec(t *testing.T) {
+	v1 := &VersionedCodec{Version: 1, Codecs: map[byte]Codec{1: JSONCodec}}
+	v2 := &VersionedCodec{
+		Version: 2,
+		Codecs:  map[byte]Codec{1: JSONCodec, 2: BinaryCodec},
+		Legacy:  JSONCodec,
+	}
+	legacy, _ := JSONCodec.Marshal("legacy")
+	old, _ := v1.Marshal("old")
+	current, err := v2.Marshal("current")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if current[0] != envelopeMagic || current[1] != 2 {
+		t.Errorf("header is %x, want %x02", current[:2], envelopeMagic)
+	}
+	for _, p := range [][]byte{legacy, old, current} {
+		var s string
+		if err := v2.Unmarshal(p, &s); err != nil {
+			t.Errorf("Unmarshal(%q) returned %v", p, err)
+		}
+	}
+	var s string
+	if err := v1.Unmarshal(current, &s); err == nil {
+		t.Error("Unmarshal of unknown version returned nil error")
+	}
+	if err := v1.Unmarshal(legacy, &s); err == nil {
+		t.Error("Unmarshal without header and Legacy codec returned nil error")
+	}
+}
+
+func TestClientValues(t *testing.T) {
+	client := getClient()
+	client.Codec = BinaryCodec
+	keys := []string{"codec:s", "codec:h", "codec:l", "codec:x"}
+	client.Del(keys...)
+	defer client.Del(keys...)
+
+	v := newCodecTestValue()
+	if _, err := client.SetValue("codec:s", v, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	var actual codecTestValue
+	if err := client.GetValue(&actual, "codec:s"); err != nil || !reflect.DeepEqual(actual, v) {
+		t.Errorf("GetValue returned %v, %+v, want nil, %+v", err, actual, v)
+	}
+	if err := client.WithCodec(JSONCodec).GetValue(&actual, "codec:s"); err == nil {
+		t.Error("GetValue with JSON codec of binary value returned nil error")
+	}
+	if err := client.GetValue(&actual, "codec:missing"); err != ErrNil {
+		t.Errorf("GetValue of missing key returned %v, want %v", err, ErrNil)
+	}
+
+	if _, err := client.HSetValue("codec:h", "f", []int{1, 2}); err != nil {
+		t.Fatal(err)
+	}
+	var ints []int
+	if err := client.HGetValue(&ints, "codec:h", "f"); err != nil || !reflect.DeepEqual(ints, []int{1, 2}) {
+		t.Errorf("HGetValue returned %v, %v, want nil, [1 2]", err, ints)
+	}
+
+	if _, err := client.RPushValues("codec:l", 1.5, 2.5); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.LPushValues("codec:l", 0.5); err != nil {
+		t.Fatal(err)
+	}
+	var floats []float64
+	if err := client.LRangeValues(&floats, "codec:l", 0, -1); err != nil || !reflect.DeepEqual(floats, []float64{0.5, 1.5, 2.5}) {
+		t.Errorf("LRangeValues returned %v, %v, want nil, [0.5 1.5 2.5]", err, floats)
+	}
+
+	id, err := client.XAddValues("codec:x", "*", map[string]interface{}{"v": v})
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := client.XRange("codec:x", "-", "+", 0)
+	if err != nil || len(entries) != 1 || entries[0].ID != id {
+		t.Fatalf("XRange returned %v, %v, want entry %s", entries, err, id)
+	}
+	actual = codecTestValue{}
+	if err := client.DecodeField("codec:x", "v", []byte(entries[0].Fields["v"]), &actual); err != nil || !reflect.DeepEqual(actual, v) {
+		t.Errorf("Decode of stream value returned %v, %+v, want nil, %+v", err, actual, v)
+	}
+}
@@ -15,6 +15,8 @@
 package redis
 
 import (
+	"fmt"
+	"strconv"
 	"strings"
 )
 
@@ -28,6 +30,39 @@ const (
 type commandInfo struct {
 	// Set or Clear these states on connection.
 	Set, Clear int
+
+	// Idempotent is true for commands that can be sent again without
+	// changing the outcome when the first attempt may have executed.
+	Idempotent bool
+
+	// Blocking is true for commands that block the connection until data
+	// is available or a timeout expires.
+	Blocking bool
+
+	// ConnState is true for commands that change the state of the
+	// connection in ways other than the states tracked by Set and Clear.
+	ConnState bool
+
+	// Keys specifies the positions of the key arguments. Keys is nil for
+	// commands whose keys are not known.
+	Keys *keySpec
+}
+
+// keySpec specifies the positions of the key arguments of a command. The
+// positions are indexes into the arguments that follow the command name.
+type keySpec struct {
+	// The keys are at First, First+Step and so on up to Last. A negative
+	// Last counts from the end of the arguments. A zero Step selects no
+	// keys.
+	First, Last, Step int
+
+	// NumKeys is the position of an argument with the number of keys that
+	// follow it, or -1 if the command does not have such an argument.
+	NumKeys int
+
+	// Streams is true for commands with the keys in the first half of the
+	// arguments after the STREAMS option.
+	Streams bool
 }
 
 var commandInfos = map[string]commandInfo{
@@ -41,7 +76,152 @@ var commandInfos = map[string]commandInfo{
 	"MONITOR":    {Set: connectionMonitorState},
 }
 
+// idempotentCommands lists the read commands and the writes that leave the
+// database in the same state and return the same reply no matter how many
+// times they are executed. Writes such as DEL, HSET or SADD reply with the
+// number of changed elements, which differs on a second attempt, and are
+// retried only when RetryPolicy.RetryNonIdempotent is set.
+var idempotentCommands = []string{
+	// Connection and server
+	"PING", "ECHO", "EXISTS", "TYPE", "TTL", "PTTL", "DBSIZE", "TIME", "INFO",
+	"KEYS", "SCAN", "RANDOMKEY",
+
+	// Strings
+	"GET", "MGET", "STRLEN", "GETRANGE", "GETBIT", "BITCOUNT", "BITPOS",
+	"SET", "MSET", "SETRANGE",
+
+	// Hashes
+	"HGET", "HMGET", "HGETALL", "HKEYS", "HVALS", "HLEN", "HEXISTS",
+	"HSTRLEN", "HSCAN", "HMSET", "HTTL", "HPTTL", "HEXPIRETIME",
+	"HPEXPIRETIME",
+
+	// Lists
+	"LINDEX", "LLEN", "LRANGE", "LSET",
+
+	// Sets
+	"SCARD", "SISMEMBER", "SMEMBERS", "SRANDMEMBER", "SSCAN", "SDIFF",
+	"SINTER", "SUNION", "SDIFFSTORE", "SINTERSTORE", "SUNIONSTORE",
+
+	// Sorted sets
+	"ZCARD", "ZCOUNT", "ZLEXCOUNT", "ZRANGE", "ZRANGEBYLEX",
+	"ZRANGEBYSCORE", "ZRANK", "ZREVRANGE", "ZREVRANGEBYLEX",
+	"ZREVRANGEBYSCORE", "ZREVRANK", "ZSCORE", "ZSCAN",
+
+	// Keys
+	"EXPIREAT", "PEXPIREAT",
+
+	// Scripting
+	"EVALSHA_RO", "EVAL_RO", "SCRIPT",
+}
+
+// blockingCommands lists the commands that block the connection. XREAD and
+// XREADGROUP block only with the BLOCK option; see isBlockingCommand.
+var blockingCommands = []string{
+	"BLPOP", "BRPOP", "BRPOPLPUSH", "BLMOVE", "BLMPOP", "BZPOPMIN", "BZPOPMAX",
+	"BZMPOP", "WAIT",
+}
+
+// connStateCommands lists the commands that change the state of the
+// connection.
+var connStateCommands = []string{
+	"AUTH", "HELLO", "SELECT", "CLIENT", "QUIT", "RESET", "READONLY",
+	"READWRITE", "ASKING", "UNSUBSCRIBE", "PUNSUBSCRIBE", "SSUBSCRIBE",
+	"SUNSUBSCRIBE",
+}
+
+// keySpecs lists the key positions of commands. The commands without keys
+// are listed with a zero Step.
+var keySpecs = []struct {
+	keys     keySpec
+	commands []string
+}{
+	{keySpec{NumKeys: -1}, []string{
+		"PING", "ECHO", "AUTH", "HELLO", "SELECT", "QUIT", "RESET", "MULTI",
+		"EXEC", "DISCARD", "UNWATCH", "TIME", "INFO", "WAIT", "CLIENT",
+		"SCRIPT", "READONLY", "READWRITE", "KEYS", "SCAN", "RANDOMKEY",
+		"PUBLISH", "SUBSCRIBE", "UNSUBSCRIBE", "PSUBSCRIBE", "PUNSUBSCRIBE",
+	}},
+	{keySpec{First: 0, Last: 0, Step: 1, NumKeys: -1}, []string{
+		// Keys
+		"TYPE", "TTL", "PTTL", "EXPIRE", "PEXPIRE", "EXPIREAT", "PEXPIREAT",
+		"EXPIRETIME", "PEXPIRETIME", "PERSIST", "DUMP", "RESTORE",
+
+		// Strings
+		"GET", "SET", "SETNX", "SETEX", "PSETEX", "GETSET", "GETDEL", "GETEX",
+		"APPEND", "STRLEN", "GETRANGE", "SETRANGE", "INCR", "INCRBY",
+		"INCRBYFLOAT", "DECR", "DECRBY", "GETBIT", "SETBIT", "BITCOUNT",
+		"BITPOS", "BITFIELD", "PFADD",
+
+		// Hashes
+		"HGET", "HSET", "HSETNX", "HMSET", "HMGET", "HGETALL", "HDEL",
+		"HEXISTS", "HINCRBY", "HINCRBYFLOAT", "HKEYS", "HVALS", "HLEN",
+		"HSTRLEN", "HSCAN", "HRANDFIELD", "HEXPIRE", "HPEXPIRE", "HEXPIREAT",
+		"HPEXPIREAT", "HTTL", "HPTTL", "HEXPIRETIME", "HPEXPIRETIME",
+		"HPERSIST", "HGETDEL", "HGETEX", "HSETEX",
+
+		// Lists
+		"LPUSH", "RPUSH", "LPUSHX", "RPUSHX", "LPOP", "RPOP", "LRANGE",
+		"LINDEX", "LINSERT", "LLEN", "LREM", "LSET", "LTRIM", "LPOS",
+
+		// Sets
+		"SADD", "SREM", "SMEMBERS", "SISMEMBER", "SMISMEMBER", "SCARD",
+		"SPOP", "SRANDMEMBER", "SSCAN",
+
+		// Sorted sets
+		"ZADD", "ZINCRBY", "ZCARD", "ZCOUNT", "ZLEXCOUNT", "ZSCORE",
+		"ZMSCORE", "ZRANK", "ZREVRANK", "ZRANGE", "ZRANGEBYSCORE",
+		"ZRANGEBYLEX", "ZREVRANGE", "ZREVRANGEBYSCORE", "ZREVRANGEBYLEX",
+		"ZREM", "ZREMRANGEBYRANK", "ZREMRANGEBYSCORE", "ZREMRANGEBYLEX",
+		"ZPOPMIN", "ZPOPMAX", "ZRANDMEMBER", "ZSCAN",
+
+		// Streams and geo
+		"XADD", "XLEN", "XRANGE", "XREVRANGE", "XDEL", "XTRIM", "XACK",
+		"XCLAIM", "XAUTOCLAIM", "XPENDING", "GEOADD", "GEODIST", "GEOHASH",
+		"GEOPOS", "GEOSEARCH",
+	}},
+	{keySpec{First: 1, Last: 1, Step: 1, NumKeys: -1}, []string{"XGROUP", "XINFO"}},
+	{keySpec{First: 0, Last: 1, Step: 1, NumKeys: -1}, []string{
+		"RENAME", "RENAMENX", "COPY", "RPOPLPUSH", "BRPOPLPUSH", "LMOVE",
+		"BLMOVE", "SMOVE", "ZRANGESTORE", "GEOSEARCHSTORE", "LCS",
+	}},
+	{keySpec{First: 0, Last: -1, Step: 1, NumKeys: -1}, []string{
+		"DEL", "UNLINK", "EXISTS", "TOUCH", "WATCH", "MGET", "SDIFF", "SINTER",
+		"SUNION", "SDIFFSTORE", "SINTERSTORE", "SUNIONSTORE", "PFCOUNT",
+		"PFMERGE",
+	}},
+	{keySpec{First: 0, Last: -1, Step: 2, NumKeys: -1}, []string{"MSET", "MSETNX"}},
+	{keySpec{First: 1, Last: -1, Step: 1, NumKeys: -1}, []string{"BITOP"}},
+	{keySpec{First: 0, Last: -2, Step: 1, NumKeys: -1}, []string{"BLPOP", "BRPOP", "BZPOPMIN", "BZPOPMAX"}},
+	{keySpec{NumKeys: 0}, []string{"ZUNION", "ZINTER", "ZDIFF", "ZINTERCARD", "SINTERCARD", "LMPOP", "ZMPOP"}},
+	{keySpec{NumKeys: 1}, []string{"EVAL", "EVALSHA", "EVAL_RO", "EVALSHA_RO", "FCALL", "FCALL_RO", "BLMPOP", "BZMPOP"}},
+	{keySpec{First: 0, Last: 0, Step: 1, NumKeys: 1}, []string{"ZUNIONSTORE", "ZINTERSTORE", "ZDIFFSTORE"}},
+	{keySpec{Streams: true, NumKeys: -1}, []string{"XREAD", "XREADGROUP"}},
+}
+
 func init() {
+	for _, n := range idempotentCommands {
+		ci := commandInfos[n]
+		ci.Idempotent = true
+		commandInfos[n] = ci
+	}
+	for _, n := range blockingCommands {
+		ci := commandInfos[n]
+		ci.Blocking = true
+		commandInfos[n] = ci
+	}
+	for _, n := range connStateCommands {
+		ci := commandInfos[n]
+		ci.ConnState = true
+		commandInfos[n] = ci
+	}
+	for _, ks := range keySpecs {
+		ks := ks
+		for _, n := range ks.commands {
+			ci := commandInfos[n]
+			ci.Keys = &ks.keys
+			commandInfos[n] = ci
+		}
+	}
 	for n, ci := range commandInfos {
 		commandInfos[strings.ToLower(n)] = ci
 	}
@@ -53,3 +233,111 @@ func lookupCommandInfo(commandName string) commandInfo {
 	}
 	return commandInfos[strings.ToUpper(commandName)]
 }
+
+// ChangesConnState returns true if the command associates server side state
+// with the connection or puts the connection in a special mode, such as
+// MULTI, WATCH, SUBSCRIBE, SELECT, AUTH or CLIENT. These commands cannot be
+// executed on a connection shared by other callers.
+func ChangesConnState(commandName string) bool {
+	ci := lookupCommandInfo(commandName)
+	return ci.Set != 0 || ci.Clear != 0 || ci.ConnState
+}
+
+// isBlockingCommand returns true if the command blocks the connection.
+func isBlockingCommand(commandName string, args []interface{}) bool {
+	if lookupCommandInfo(commandName).Blocking {
+		return true
+	}
+	if !strings.EqualFold(commandName, "XREAD") && !strings.EqualFold(commandName, "XREADGROUP") {
+		return false
+	}
+	for _, arg := range args {
+		if s, ok := arg.(string); ok && strings.EqualFold(s, "BLOCK") {
+			return true
+		}
+	}
+	return false
+}
+
+// keyPositions returns the positions of the key arguments of a command. The
+// ok result is false if the keys of the command cannot be determined.
+func keyPositions(commandName string, args []interface{}) (positions []int, ok bool) {
+	ks := lookupCommandInfo(commandName).Keys
+	if ks == nil {
+		return nil, false
+	}
+	if ks.Step > 0 {
+		last := ks.Last
+		if last < 0 {
+			last += len(args)
+		}
+		for i := ks.First; i <= last && i < len(args); i += ks.Step {
+			positions = append(positions, i)
+		}
+	}
+	if ks.NumKeys >= 0 {
+		if ks.NumKeys >= len(args) {
+			return nil, false
+		}
+		n, err := strconv.Atoi(argString(args[ks.NumKeys]))
+		if err != nil || n < 0 || ks.NumKeys+n >= len(args) {
+			return nil, false
+		}
+		for i := ks.NumKeys + 1; i <= ks.NumKeys+n; i++ {
+			positions = append(positions, i)
+		}
+	}
+	if ks.Streams {
+		i := 0
+	options:
+		for ; i < len(args); i++ {
+			switch strings.ToUpper(argString(args[i])) {
+			case "STREAMS":
+				break options
+			case "COUNT", "BLOCK":
+				i++
+			case "GROUP":
+				i += 2
+			}
+		}
+		rest := len(args) - i - 1
+		if rest <= 0 || rest%2 != 0 {
+			return nil, false
+		}
+		for j := i + 1; j <= i+rest/2; j++ {
+			positions = append(positions, j)
+		}
+	}
+	return positions, true
+}
+
+// argString returns the string sent to the server for a command argument.
+func argString(arg interface{}) string {
+	switch arg := arg.(type) {
+	case string:
+		return arg
+	case []byte:
+		return string(arg)
+	case int:
+		return strconv.Itoa(arg)
+	case int64:
+		return strconv.FormatInt(arg, 10)
+	case float64:
+		return strconv.FormatFloat(arg, 'g', -1, 64)
+	case bool:
+		if arg {
+			return "1"
+		}
+		return "0"
+	case nil:
+		return ""
+	case Argument:
+		v := arg.RedisArg()
+		if _, ok := v.(Argument); !ok {
+			return argString(v)
+		}
+		return fmt.Sprint(v)
+	default:
+		return fmt.Sprint(arg)
+	}
+}
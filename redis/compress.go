@@ -0,0 +1,224 @@
+package redis
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sync"
+)
+
+// Compression is a compression algorithm used by CompressionCodec.
+type Compression byte
+
+const (
+	CompressGzip  Compression = 1
+	CompressFlate Compression = 2
+	CompressZlib  Compression = 3
+)
+
+func (c Compression) String() string {
+	switch c {
+	case CompressGzip:
+		return "gzip"
+	case CompressFlate:
+		return "flate"
+	case CompressZlib:
+		return "zlib"
+	}
+	return fmt.Sprintf("Compression(%d)", byte(c))
+}
+
+// compressMagic starts the header of a value written by CompressionCodec.
+// The byte after the magic is the Compression or compressRaw for an
+// uncompressed value that starts with compressMagic. The first byte of the
+// magic does not occur in UTF-8 text, JSON or the encodings of BinaryCodec.
+const (
+	compressMagic = "\xf6RDC"
+	compressRaw   = 0
+)
+
+// CompressionCodec compresses encoded values that are larger than a
+// threshold. Compressed values are prefixed with a five byte header that
+// starts with a four byte magic. Smaller values are stored as is:
+//
+//	client.Codec = &redis.CompressionCodec{
+//		Codec:     redis.JSONCodec,
+//		Threshold: 4096,
+//	}
+//
+// Values written before compression was enabled are read as is unless they
+// start with the magic followed by a known Compression byte. Values encoded
+// by JSONCodec or BinaryCodec and UTF-8 text never do. Arbitrary binary
+// values written without the codec that may start with the magic must be
+// rewritten through the codec before compression is enabled.
+//
+// A CompressionCodec is safe for concurrent use and can be used with
+// pipelines by encoding command arguments with Marshal and decoding replies
+// with Unmarshal.
+type CompressionCodec struct {
+	// Codec encodes values before compression. If nil, then values must be
+	// strings or byte slices and are stored as is.
+	Codec Codec
+
+	// Algorithm is the compression algorithm. If zero, then CompressGzip is
+	// used. Values compressed with any algorithm can be read.
+	Algorithm Compression
+
+	// Level is the compression level as defined by the compress/flate
+	// package. If zero, then flate.DefaultCompression is used.
+	Level int
+
+	// Threshold is the minimum size in bytes of an encoded value to
+	// compress. Values are stored uncompressed when compression does not
+	// reduce the size.
+	Threshold int
+
+	mu    sync.Mutex
+	stats CompressionStats
+}
+
+// CompressionStats contains compression statistics.
+type CompressionStats struct {
+	// Compressed is the number of values stored compressed.
+	Compressed int64
+
+	// Uncompressed is the number of values stored uncompressed.
+	Uncompressed int64
+
+	// BytesIn is the total size of the compressed values before compression.
+	BytesIn int64
+
+	// BytesOut is the total size of the compressed values after compression.
+	BytesOut int64
+}
+
+// Ratio returns BytesOut divided by BytesIn or 1 if no values were
+// compressed.
+func (s CompressionStats) Ratio() float64 {
+	if s.BytesIn == 0 {
+		return 1
+	}
+	return float64(s.BytesOut) / float64(s.BytesIn)
+}
+
+// Stats returns the compression statistics of the values written by Marshal.
+func (cc *CompressionCodec) Stats() CompressionStats {
+	cc.mu.Lock()
+	stats := cc.stats
+	cc.mu.Unlock()
+	return stats
+}
+
+func (cc *CompressionCodec) record(in, out int, compressed bool) {
+	cc.mu.Lock()
+	if compressed {
+		cc.stats.Compressed++
+		cc.stats.BytesIn += int64(in)
+		cc.stats.BytesOut += int64(out)
+	} else {
+		cc.stats.Uncompressed++
+	}
+	cc.mu.Unlock()
+}
+
+func (cc *CompressionCodec) compress(p []byte) ([]byte, error) {
+	algorithm := cc.Algorithm
+	if algorithm == 0 {
+		algorithm = CompressGzip
+	}
+	level := cc.Level
+	if level == 0 {
+		level = flate.DefaultCompression
+	}
+	var buf bytes.Buffer
+	buf.WriteString(compressMagic)
+	buf.WriteByte(byte(algorithm))
+	var (
+		w   io.WriteCloser
+		err error
+	)
+	switch algorithm {
+	case CompressGzip:
+		w, err = gzip.NewWriterLevel(&buf, level)
+	case CompressFlate:
+		w, err = flate.NewWriter(&buf, level)
+	case CompressZlib:
+		w, err = zlib.NewWriterLevel(&buf, level)
+	default:
+		err = fmt.Errorf("redigo: unknown compression algorithm %v", algorithm)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(p); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Marshal encodes v and compresses the encoding when it is at least
+// Threshold bytes long.
+func (cc *CompressionCodec) Marshal(v interface{}) ([]byte, error) {
+	p, err := marshalWith(cc.Codec, v)
+	if err != nil {
+		return nil, err
+	}
+	if len(p) >= cc.Threshold && len(p) > 0 {
+		c, err := cc.compress(p)
+		if err != nil {
+			return nil, err
+		}
+		if len(c) < len(p) {
+			cc.record(len(p), len(c), true)
+			return c, nil
+		}
+	}
+	cc.record(len(p), len(p), false)
+	if bytes.HasPrefix(p, []byte(compressMagic)) {
+		return append(append([]byte(compressMagic), compressRaw), p...), nil
+	}
+	return p, nil
+}
+
+// Unmarshal decompresses data if it has a compression header and decodes
+// the result into the value pointed to by v. Data without a header or with
+// an unknown Compression byte after the magic is decoded as is.
+func (cc *CompressionCodec) Unmarshal(data []byte, v interface{}) error {
+	n := len(compressMagic)
+	if len(data) <= n || !bytes.HasPrefix(data, []byte(compressMagic)) {
+		return unmarshalWith(cc.Codec, data, v)
+	}
+	var (
+		r   io.ReadCloser
+		err error
+	)
+	body := bytes.NewReader(data[n+1:])
+	switch data[n] {
+	case compressRaw:
+		return unmarshalWith(cc.Codec, data[n+1:], v)
+	case byte(CompressGzip):
+		r, err = gzip.NewReader(body)
+	case byte(CompressFlate):
+		r = flate.NewReader(body)
+	case byte(CompressZlib):
+		r, err = zlib.NewReader(body)
+	default:
+		return unmarshalWith(cc.Codec, data, v)
+	}
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	p, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	return unmarshalWith(cc.Codec, p, v)
+}
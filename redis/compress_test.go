@@ -0,0 +1,125 @@
+package redis
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestCompressionCodec(t *testing.T) {
+	large := strings.Repeat("compressible ", 1000)
+	for _, algorithm := range []Compression{0, CompressGzip, CompressFlate, CompressZlib} {
+		cc := &CompressionCodec{Algorithm: algorithm, Threshold: 100}
+		p, err := cc.Marshal(large)
+		if err != nil {
+			t.Fatalf("%v: Marshal returned %v", algorithm, err)
+		}
+		if !bytes.HasPrefix(p, []byte(compressMagic)) || len(p) >= len(large) {
+			t.Errorf("%v: large value is not compressed", algorithm)
+		}
+		var s string
+		if err := cc.Unmarshal(p, &s); err != nil || s != large {
+			t.Errorf("%v: Unmarshal returned %v, value equal %v", algorithm, err, s == large)
+		}
+	}
+
+	cc := &CompressionCodec{Codec: JSONCodec, Threshold: 100}
+	for _, v := range []string{"small", large} {
+		p, err := cc.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var s string
+		if err := cc.Unmarshal(p, &s); err != nil || s != v {
+			t.Errorf("round trip of %d byte value returned %v", len(v), err)
+		}
+	}
+	stats := cc.Stats()
+	if stats.Compressed != 1 || stats.Uncompressed != 1 {
+		t.Errorf("stats are %+v, want one compressed and one uncompressed value", stats)
+	}
+	if r := stats.Ratio(); r <= 0 || r >= 0.1 {
+		t.Errorf("ratio is %v, want less than 0.1", r)
+	}
+
+	// Values written before compression was enabled and values that start
+	// with the magic are read back unchanged.
+	raw := &CompressionCodec{}
+	for _, v := range []string{`"legacy"`, "\xf6\x01abc", compressMagic + "\x01abc", compressMagic, ""} {
+		p, err := raw.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var s string
+		if err := raw.Unmarshal(p, &s); err != nil || s != v {
+			t.Errorf("round trip of %q returned %q, %v", v, s, err)
+		}
+	}
+	// Legacy values with the magic but no known algorithm are read as is.
+	for _, v := range []string{"\xf6\x01abc", compressMagic + "\x09abc"} {
+		var s string
+		if err := raw.Unmarshal([]byte(v), &s); err != nil || s != v {
+			t.Errorf("Unmarshal of legacy value %q returned %q, %v", v, s, err)
+		}
+	}
+}
+
+func TestCompressionCodecClient(t *testing.T) {
+	cc := &CompressionCodec{Codec: BinaryCodec, Threshold: 64}
+	client := getClient()
+	client.Codec = cc
+	client.AutoPipeline = &AutoPipeline{}
+	defer client.AutoPipeline.Close()
+	client.Del("compress:s", "compress:h")
+	defer client.Del("compress:s", "compress:h")
+
+	blob := bytes.Repeat([]byte("blob"), 1000)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := client.SetValue("compress:s", blob, 0); err != nil {
+				t.Error(err)
+			}
+			if _, err := client.HSetValue("compress:h", "f", blob); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n, _ := client.StrLen("compress:s"); n == 0 || n >= int64(len(blob)) {
+		t.Errorf("stored size is %d, want less than %d", n, len(blob))
+	}
+	var p []byte
+	if err := client.GetValue(&p, "compress:s"); err != nil || !bytes.Equal(p, blob) {
+		t.Errorf("GetValue returned %v, value equal %v", err, bytes.Equal(p, blob))
+	}
+	if err := client.HGetValue(&p, "compress:h", "f"); err != nil || !bytes.Equal(p, blob) {
+		t.Errorf("HGetValue returned %v, value equal %v", err, bytes.Equal(p, blob))
+	}
+	if stats := cc.Stats(); stats.Compressed != 8 {
+		t.Errorf("Compressed is %d, want 8", stats.Compressed)
+	}
+
+	// Pipeline the commands on a connection.
+	c, _ := client.GetConn()
+	defer c.Close()
+	arg, err := cc.Marshal(blob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Send("SET", "compress:s", arg)
+	c.Send("GET", "compress:s")
+	c.Flush()
+	c.Receive()
+	reply, err := Bytes(c.Receive())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cc.Unmarshal(reply, &p); err != nil || !bytes.Equal(p, blob) {
+		t.Errorf("Unmarshal of pipelined reply returned %v, value equal %v", err, bytes.Equal(p, blob))
+	}
+}
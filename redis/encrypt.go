@@ -0,0 +1,267 @@
+package redis
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+)
+
+// KeyProvider supplies the keys of an EncryptionCodec. The ID of the key
+// that encrypted a value is stored in the value's header, so values
+// encrypted with an old key remain readable after the current key is
+// rotated.
+type KeyProvider interface {
+	// CurrentKey returns the ID and the key used to encrypt new values. The
+	// key must be 16, 24 or 32 bytes long to select AES-128, AES-192 or
+	// AES-256. The ID must not be longer than 255 bytes.
+	CurrentKey() (id string, key []byte, err error)
+
+	// Key returns the key with the given ID.
+	Key(id string) ([]byte, error)
+}
+
+// StaticKeys is a KeyProvider backed by a map from key IDs to keys.
+type StaticKeys struct {
+	// Current is the ID of the key used to encrypt new values.
+	Current string
+
+	// Keys maps key IDs to keys.
+	Keys map[string][]byte
+}
+
+// CurrentKey returns the key with ID sk.Current.
+func (sk *StaticKeys) CurrentKey() (string, []byte, error) {
+	key, err := sk.Key(sk.Current)
+	return sk.Current, key, err
+}
+
+// Key returns the key with the given ID.
+func (sk *StaticKeys) Key(id string) ([]byte, error) {
+	key, ok := sk.Keys[id]
+	if !ok {
+		return nil, fmt.Errorf("redigo: unknown encryption key %q", id)
+	}
+	return key, nil
+}
+
+// encryptMagic is the first byte of a value encrypted by EncryptionCodec.
+// The header continues with the format version, the length of the key ID
+// and the key ID. The nonce and the sealed value follow the header.
+const (
+	encryptMagic   = 0xf7
+	encryptVersion = 1
+)
+
+var (
+	errEncryptHeader = errors.New("redigo: invalid encryption header")
+	errDecrypt       = errors.New("redigo: value cannot be decrypted")
+)
+
+// EncryptionCodec encrypts encoded values with AES-GCM. Values written
+// through the RedisClient value helpers are bound to the name of the key
+// that stores them, and hash field values are also bound to the field
+// name, so an encrypted value copied to another key or field cannot be
+// decrypted.
+//
+// Values encoded with Marshal are not bound to a key. To encrypt the
+// arguments of a pipeline, use MarshalKey and UnmarshalKey with the key
+// name:
+//
+//	p, err := ec.MarshalKey("user:1", "", v)
+//	c.Send("SET", "user:1", p)
+//
+// Compression, if any, must be done by the wrapped codec because
+// encrypted values do not compress.
+type EncryptionCodec struct {
+	// Codec encodes values before encryption. If nil, then values must be
+	// strings or byte slices and are stored as is.
+	Codec Codec
+
+	// Keys supplies the encryption keys.
+	Keys KeyProvider
+}
+
+// associatedData returns the data that binds a value to key and field.
+func associatedData(key, field string) []byte {
+	var p [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(p[:], uint64(len(key)))
+	ad := make([]byte, 0, n+len(key)+len(field))
+	ad = append(ad, p[:n]...)
+	ad = append(ad, key...)
+	return append(ad, field...)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Seal encrypts plaintext with the current key and binds the result to key
+// and field.
+func (ec *EncryptionCodec) Seal(key, field string, plaintext []byte) ([]byte, error) {
+	id, k, err := ec.Keys.CurrentKey()
+	if err != nil {
+		return nil, err
+	}
+	if len(id) > 255 {
+		return nil, fmt.Errorf("redigo: encryption key ID %q is too long", id)
+	}
+	gcm, err := newGCM(k)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, 0, 3+len(id)+gcm.NonceSize()+len(plaintext)+gcm.Overhead())
+	out = append(out, encryptMagic, encryptVersion, byte(len(id)))
+	out = append(out, id...)
+	nonce := out[len(out) : len(out)+gcm.NonceSize()]
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	out = out[:len(out)+len(nonce)]
+	return gcm.Seal(out, nonce, plaintext, associatedData(key, field)), nil
+}
+
+// Open decrypts data sealed for key and field.
+func (ec *EncryptionCodec) Open(key, field string, data []byte) ([]byte, error) {
+	if len(data) < 3 || data[0] != encryptMagic || data[1] != encryptVersion || len(data) < 3+int(data[2]) {
+		return nil, errEncryptHeader
+	}
+	id := string(data[3 : 3+data[2]])
+	data = data[3+len(id):]
+	k, err := ec.Keys.Key(id)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(k)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, errEncryptHeader
+	}
+	p, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], associatedData(key, field))
+	if err != nil {
+		return nil, errDecrypt
+	}
+	return p, nil
+}
+
+// MarshalKey encodes and encrypts v for storage in key and field. Use an
+// empty field for values that are not stored in a hash field.
+func (ec *EncryptionCodec) MarshalKey(key, field string, v interface{}) ([]byte, error) {
+	p, err := marshalWith(ec.Codec, v)
+	if err != nil {
+		return nil, err
+	}
+	return ec.Seal(key, field, p)
+}
+
+// UnmarshalKey decrypts a value stored in key and field and decodes the
+// result into the value pointed to by v.
+func (ec *EncryptionCodec) UnmarshalKey(key, field string, data []byte, v interface{}) error {
+	p, err := ec.Open(key, field, data)
+	if err != nil {
+		return err
+	}
+	return unmarshalWith(ec.Codec, p, v)
+}
+
+// Marshal encodes and encrypts v without binding it to a key.
+func (ec *EncryptionCodec) Marshal(v interface{}) ([]byte, error) {
+	return ec.MarshalKey("", "", v)
+}
+
+// Unmarshal decrypts a value encrypted by Marshal and decodes the result
+// into the value pointed to by v.
+func (ec *EncryptionCodec) Unmarshal(data []byte, v interface{}) error {
+	return ec.UnmarshalKey("", "", data, v)
+}
+
+var errNoEncryption = errors.New("redigo: struct has encrypted fields and the client has no Encryption")
+
+// encryptedFields returns the spec of the struct pointed to or stored in v
+// if the struct has fields with the encrypt tag option.
+func encryptedFields(v interface{}) *structSpec {
+	t := reflect.TypeOf(v)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil
+	}
+	ss := structSpecForType(t)
+	for _, fs := range ss.l {
+		if fs.encrypt {
+			return ss
+		}
+	}
+	return nil
+}
+
+// argBytes returns arg as sent to the server.
+func argBytes(arg interface{}) ([]byte, error) {
+	words, err := encodeCommand("ARG", []interface{}{arg})
+	if err != nil {
+		return nil, err
+	}
+	return []byte(words[1]), nil
+}
+
+// encryptFields encrypts the values of the encrypted fields of object in
+// the alternating names and values of pairs.
+func (client *RedisClient) encryptFields(key string, object interface{}, pairs []interface{}) error {
+	ss := encryptedFields(object)
+	if ss == nil {
+		return nil
+	}
+	if client.Encryption == nil {
+		return errNoEncryption
+	}
+	for i := 0; i+1 < len(pairs); i += 2 {
+		name, _ := pairs[i].(string)
+		if fs := ss.m[name]; fs == nil || !fs.encrypt {
+			continue
+		}
+		p, err := argBytes(pairs[i+1])
+		if err != nil {
+			return err
+		}
+		if pairs[i+1], err = client.Encryption.Seal(key, name, p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decryptFields decrypts the values of the encrypted fields of dest in the
+// alternating names and values of pairs.
+func (client *RedisClient) decryptFields(key string, dest interface{}, pairs []interface{}) error {
+	ss := encryptedFields(dest)
+	if ss == nil {
+		return nil
+	}
+	if client.Encryption == nil {
+		return errNoEncryption
+	}
+	for i := 0; i+1 < len(pairs); i += 2 {
+		name, _ := pairs[i].([]byte)
+		p, ok := pairs[i+1].([]byte)
+		if fs := ss.m[string(name)]; fs == nil || !fs.encrypt || !ok {
+			continue
+		}
+		p, err := client.Encryption.Open(key, string(name), p)
+		if err != nil {
+			return fmt.Errorf("redigo: cannot decrypt field %s: %v", name, err)
+		}
+		pairs[i+1] = p
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package redis
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func testKeys() *StaticKeys {
+	return &StaticKeys{
+		Current: "k1",
+		Keys: map[string][]byte{
+			"k1": bytes.Repeat([]byte{1}, 32),
+			"k2": bytes.Repeat([]byte{2}, 16),
+		},
+	}
+}
+
+func TestEncryptionCodec(t *testing.T) {
+	keys := testKeys()
+	ec := &EncryptionCodec{Codec: JSONCodec, Keys: keys}
+
+	p, err := ec.MarshalKey("user:1", "", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(p, []byte("secret")) {
+		t.Error("encrypted value contains the plaintext")
+	}
+	if p[0] != encryptMagic || string(p[3:3+p[2]]) != "k1" {
+		t.Errorf("header is %q, want key ID k1", p[:5])
+	}
+
+	// Values encrypted with an old key are readable after rotation.
+	keys.Current = "k2"
+	var s string
+	if err := ec.UnmarshalKey("user:1", "", p, &s); err != nil || s != "secret" {
+		t.Errorf("UnmarshalKey returned %q, %v, want secret, nil", s, err)
+	}
+	if p2, _ := ec.MarshalKey("user:1", "", "secret"); string(p2[3:3+p2[2]]) != "k2" {
+		t.Error("value is not encrypted with the current key")
+	}
+
+	// Values cannot be moved to another key or field.
+	for _, kf := range [][2]string{{"user:2", ""}, {"user:1", "f"}, {"user:", "1"}} {
+		if err := ec.UnmarshalKey(kf[0], kf[1], p, &s); err != errDecrypt {
+			t.Errorf("UnmarshalKey(%q, %q) returned %v, want %v", kf[0], kf[1], err, errDecrypt)
+		}
+	}
+
+	tampered := append([]byte(nil), p...)
+	tampered[len(tampered)-1] ^= 1
+	if err := ec.UnmarshalKey("user:1", "", tampered, &s); err != errDecrypt {
+		t.Errorf("UnmarshalKey of tampered value returned %v, want %v", err, errDecrypt)
+	}
+	delete(keys.Keys, "k1")
+	if err := ec.UnmarshalKey("user:1", "", p, &s); err == nil || !strings.Contains(err.Error(), "k1") {
+		t.Errorf("UnmarshalKey with unknown key returned %v", err)
+	}
+	if err := ec.UnmarshalKey("user:1", "", []byte("plain"), &s); err != errEncryptHeader {
+		t.Errorf("UnmarshalKey of plaintext returned %v, want %v", err, errEncryptHeader)
+	}
+}
+
+type encryptedUser struct {
+	Name string `redis:"name"`
+	SSN  string `redis:"ssn,encrypt"`
+	Age  int    `redis:"age,encrypt"`
+}
+
+func TestClientEncryption(t *testing.T) {
+	ec := &EncryptionCodec{Keys: testKeys()}
+	client := getClient()
+	client.Codec = ec
+	client.Encryption = ec
+	keys := []string{"encrypt:s", "encrypt:copy", "encrypt:h"}
+	client.Del(keys...)
+	defer client.Del(keys...)
+
+	if _, err := client.SetValue("encrypt:s", "secret", 0); err != nil {
+		t.Fatal(err)
+	}
+	var s string
+	if err := client.GetValue(&s, "encrypt:s"); err != nil || s != "secret" {
+		t.Errorf("GetValue returned %q, %v, want secret, nil", s, err)
+	}
+	raw, _ := client.Get("encrypt:s")
+	client.Set("encrypt:copy", raw, 0)
+	if err := client.GetValue(&s, "encrypt:copy"); err != errDecrypt {
+		t.Errorf("GetValue of copied value returned %v, want %v", err, errDecrypt)
+	}
+
+	u := encryptedUser{Name: "alice", SSN: "123-45-6789", Age: 42}
+	if _, err := client.HMSetObject("encrypt:h", &u); err != nil {
+		t.Fatal(err)
+	}
+	if name, _ := client.HGet("encrypt:h", "name"); name != "alice" {
+		t.Errorf("name is %q, want alice", name)
+	}
+	if ssn, _ := client.HGet("encrypt:h", "ssn"); strings.Contains(ssn, "6789") {
+		t.Error("ssn is stored in plaintext")
+	}
+	var actual encryptedUser
+	if err := client.HGetAllToStruct(&actual, "encrypt:h"); err != nil || actual != u {
+		t.Errorf("HGetAllToStruct returned %+v, %v, want %+v", actual, err, u)
+	}
+	actual = encryptedUser{}
+	if err := client.HMGetToStruct(&actual, "encrypt:h", "ssn", "missing"); err != nil || actual.SSN != u.SSN {
+		t.Errorf("HMGetToStruct returned %+v, %v, want SSN %s", actual, err, u.SSN)
+	}
+
+	client.Encryption = nil
+	if _, err := client.HMSetObject("encrypt:h", &u); err != errNoEncryption {
+		t.Errorf("HMSetObject without Encryption returned %v, want %v", err, errNoEncryption)
+	}
+
+	// Pipeline the commands on a connection.
+	c, _ := client.GetConn()
+	defer c.Close()
+	arg, err := ec.MarshalKey("encrypt:s", "", "pipelined")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Send("SET", "encrypt:s", arg)
+	c.Send("GET", "encrypt:s")
+	c.Flush()
+	c.Receive()
+	reply, err := Bytes(c.Receive())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ec.UnmarshalKey("encrypt:s", "", reply, &s); err != nil || s != "pipelined" {
+		t.Errorf("UnmarshalKey of pipelined reply returned %q, %v, want pipelined, nil", s, err)
+	}
+}
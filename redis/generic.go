@@ -0,0 +1,94 @@
+//go:build go1.18
+// +build go1.18
+
+package redis
+
+// As is a helper that converts a command reply to a value of type T. If err
+// is not equal to nil, then As returns the zero value, false, err. A nil
+// reply is reported as the zero value and found equal to false. Other
+// replies are converted using the rules of Scan, including the RedisScan
+// method when *T implements Scanner.
+//
+//	n, found, err := redis.As[int](c.Do("GET", "counter"))
+func As[T any](reply interface{}, err error) (T, bool, error) {
+	return as[T](convertAssign, reply, err)
+}
+
+type assignFunc func(dest, src interface{}) error
+
+// SliceAs is a helper that converts an array command reply to a []T. If err
+// is not equal to nil, then SliceAs returns nil, nil, err. The found slice
+// reports which elements of the reply are not nil. Elements are converted
+// using the rules of Scan.
+func SliceAs[T any](reply interface{}, err error) ([]T, []bool, error) {
+	return sliceAs[T](func(int) assignFunc { return convertAssign }, reply, err)
+}
+
+func as[T any](assign assignFunc, reply interface{}, err error) (value T, found bool, _ error) {
+	if err != nil {
+		return value, false, err
+	}
+	if reply == nil {
+		return value, false, nil
+	}
+	if err := assign(&value, reply); err != nil {
+		return value, true, err
+	}
+	return value, true, nil
+}
+
+func sliceAs[T any](assign func(i int) assignFunc, reply interface{}, err error) ([]T, []bool, error) {
+	values, err := Values(reply, err)
+	if err != nil {
+		return nil, nil, err
+	}
+	result := make([]T, len(values))
+	found := make([]bool, len(values))
+	for i, v := range values {
+		if v == nil {
+			continue
+		}
+		if err := assign(i)(&result[i], v); err != nil {
+			return nil, nil, err
+		}
+		found[i] = true
+	}
+	return result, found, nil
+}
+
+// The accessors below convert values using the rules of Scan. If the client
+// has a Codec, then values are decoded with the codec instead.
+
+// GetAs returns the value of key converted to type T. The found result is
+// false when the key does not exist.
+func GetAs[T any](client *RedisClient, key string) (T, bool, error) {
+	reply, err := client.Do(CmdGet, key)
+	return as[T](client.scanner(key, ""), reply, err)
+}
+
+// HGetAs returns the value of field in the hash stored at key converted to
+// type T. The found result is false when the key or field does not exist.
+func HGetAs[T any](client *RedisClient, key, field string) (T, bool, error) {
+	reply, err := client.Do(HGet, key, field)
+	return as[T](client.scanner(key, field), reply, err)
+}
+
+// MGetAs returns the values of keys converted to type T. The found slice
+// reports which of the keys exist.
+func MGetAs[T any](client *RedisClient, keys ...string) ([]T, []bool, error) {
+	args := make([]interface{}, len(keys))
+	for i, key := range keys {
+		args[i] = key
+	}
+	reply, err := client.Do(CmdMGet, args...)
+	return sliceAs[T](func(i int) assignFunc { return client.scanner(keys[i], "") }, reply, err)
+}
+
+// LRangeAs returns the elements of the list stored at key between start and
+// stop converted to type T.
+func LRangeAs[T any](client *RedisClient, key string, start, stop int64) ([]T, error) {
+	reply, err := client.Do(CmdLRange, key, start, stop)
+	scan := client.scanner(key, "")
+	values, _, err := sliceAs[T](func(int) assignFunc { return scan }, reply, err)
+	return values, err
+}
@@ -0,0 +1,73 @@
+//go:build go1.18
+// +build go1.18
+
+package redis
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGenericAccessors(t *testing.T) {
+	client := getClient()
+	client.Del("generic:n", "generic:f", "generic:h", "generic:l", "generic:missing")
+	defer client.Del("generic:n", "generic:f", "generic:h", "generic:l")
+
+	client.Set("generic:n", 42, 0)
+	client.Set("generic:f", 1.5, 0)
+	client.HSet("generic:h", "field", "true")
+	client.RPush("generic:l", 1, 2, 3)
+
+	if n, found, err := GetAs[int](client, "generic:n"); err != nil || !found || n != 42 {
+		t.Errorf("GetAs[int] returned %v, %v, %v, want 42, true, nil", n, found, err)
+	}
+	if n, found, err := GetAs[int64](client, "generic:missing"); err != nil || found || n != 0 {
+		t.Errorf("GetAs[int64] of missing key returned %v, %v, %v, want 0, false, nil", n, found, err)
+	}
+	if _, found, err := GetAs[int](client, "generic:f"); err == nil || !found {
+		t.Errorf("GetAs[int] of float returned %v, %v, want true, error", found, err)
+	}
+	if b, found, err := HGetAs[bool](client, "generic:h", "field"); err != nil || !found || !b {
+		t.Errorf("HGetAs[bool] returned %v, %v, %v, want true, true, nil", b, found, err)
+	}
+	if _, found, err := HGetAs[bool](client, "generic:h", "other"); err != nil || found {
+		t.Errorf("HGetAs[bool] of missing field returned %v, %v, want false, nil", found, err)
+	}
+
+	values, found, err := MGetAs[float64](client, "generic:n", "generic:missing", "generic:f")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []float64{42, 0, 1.5}; !reflect.DeepEqual(values, want) {
+		t.Errorf("MGetAs values are %v, want %v", values, want)
+	}
+	if want := []bool{true, false, true}; !reflect.DeepEqual(found, want) {
+		t.Errorf("MGetAs found is %v, want %v", found, want)
+	}
+
+	list, err := LRangeAs[uint8](client, "generic:l", 0, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []uint8{1, 2, 3}; !reflect.DeepEqual(list, want) {
+		t.Errorf("LRangeAs is %v, want %v", list, want)
+	}
+
+	if _, _, err := GetAs[string](client, "generic:l"); err == nil {
+		t.Error("GetAs of list returned nil error")
+	}
+}
+
+func TestGenericAccessorsCodec(t *testing.T) {
+	client := getClient().WithCodec(GobCodec)
+	client.Del("generic:v")
+	defer client.Del("generic:v")
+
+	if _, err := client.SetValue("generic:v", map[string]int{"a": 1}, 0); err != nil {
+		t.Fatal(err)
+	}
+	m, found, err := GetAs[map[string]int](client, "generic:v")
+	if err != nil || !found || m["a"] != 1 {
+		t.Errorf("GetAs returned %v, %v, %v, want map[a:1], true, nil", m, found, err)
+	}
+}
@@ -0,0 +1,145 @@
+package redis
+
+import (
+	"log"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"time"
+)
+
+// LeakInfo describes a connection that was borrowed from a pool with
+// DebugBorrows set.
+type LeakInfo struct {
+	// Borrowed is the time the connection was returned by Get.
+	Borrowed time.Time
+
+	// Held is how long the connection has been held by the application.
+	Held time.Duration
+
+	// Stack is the stack trace of the goroutine that borrowed the
+	// connection.
+	Stack []byte
+
+	// Collected is true when the connection was garbage collected without a
+	// call to Close. The pool closes the underlying network connection and
+	// releases the connection's slot in the pool.
+	Collected bool
+}
+
+type leaksByBorrowed []LeakInfo
+
+func (l leaksByBorrowed) Len() int           { return len(l) }
+func (l leaksByBorrowed) Less(i, j int) bool { return l[i].Borrowed.Before(l[j].Borrowed) }
+func (l leaksByBorrowed) Swap(i, j int)      { l[i], l[j] = l[j], l[i] }
+
+// borrow records a connection borrowed from the pool.
+type borrow struct {
+	t        time.Time
+	stack    []byte
+	reported bool
+}
+
+func (b *borrow) info(now time.Time) LeakInfo {
+	return LeakInfo{Borrowed: b.t, Held: now.Sub(b.t), Stack: b.stack}
+}
+
+func (p *Pool) newActiveConn(pc *poolConn) *activeConn {
+	ac := &activeConn{p: p, pc: pc}
+	if !p.DebugBorrows {
+		return ac
+	}
+	ac.b = &borrow{t: nowFunc(), stack: debug.Stack()}
+	p.mu.Lock()
+	if p.borrows == nil {
+		p.borrows = make(map[*borrow]struct{})
+	}
+	p.borrows[ac.b] = struct{}{}
+	p.mu.Unlock()
+	runtime.SetFinalizer(ac, (*activeConn).finalize)
+	return ac
+}
+
+// endBorrow removes the borrow record of a connection that is no longer
+// held by the application.
+func (p *Pool) endBorrow(ac *activeConn) {
+	p.mu.Lock()
+	delete(p.borrows, ac.b)
+	p.mu.Unlock()
+	runtime.SetFinalizer(ac, nil)
+}
+
+// finalize reports and releases a connection that was garbage collected
+// without a call to Close.
+func (ac *activeConn) finalize() {
+	pc := ac.pc
+	if pc == nil {
+		return
+	}
+	ac.pc = nil
+	p := ac.p
+	p.mu.Lock()
+	delete(p.borrows, ac.b)
+	p.mu.Unlock()
+	info := ac.b.info(nowFunc())
+	info.Collected = true
+	p.reportLeak(info)
+	// The state of the connection is unknown. Close it.
+	p.put(pc, true)
+}
+
+// Leaks returns the connections that are borrowed from the pool and held
+// longer than LeakThreshold, oldest first. All borrowed connections are
+// returned when LeakThreshold is zero. Leaks returns nil unless DebugBorrows
+// is set.
+func (p *Pool) Leaks() []LeakInfo {
+	now := nowFunc()
+	var leaks []LeakInfo
+	p.mu.Lock()
+	for b := range p.borrows {
+		if now.Sub(b.t) >= p.LeakThreshold {
+			leaks = append(leaks, b.info(now))
+		}
+	}
+	p.mu.Unlock()
+	sort.Sort(leaksByBorrowed(leaks))
+	return leaks
+}
+
+func (p *Pool) checkLeakThreshold() bool {
+	return p.DebugBorrows && p.LeakThreshold > 0
+}
+
+// checkLeaks reports connections held longer than LeakThreshold that were
+// not reported before.
+func (p *Pool) checkLeaks() {
+	if !p.checkLeakThreshold() {
+		return
+	}
+	now := nowFunc()
+	var leaks []LeakInfo
+	p.mu.Lock()
+	for b := range p.borrows {
+		if !b.reported && now.Sub(b.t) >= p.LeakThreshold {
+			b.reported = true
+			leaks = append(leaks, b.info(now))
+		}
+	}
+	p.mu.Unlock()
+	sort.Sort(leaksByBorrowed(leaks))
+	for _, info := range leaks {
+		p.reportLeak(info)
+	}
+}
+
+func (p *Pool) reportLeak(info LeakInfo) {
+	if p.OnLeak != nil {
+		p.OnLeak(info)
+		return
+	}
+	if info.Collected {
+		log.Printf("redigo: connection borrowed at %v was garbage collected without Close:\n%s", info.Borrowed, info.Stack)
+		return
+	}
+	log.Printf("redigo: connection borrowed at %v held for %v:\n%s", info.Borrowed, info.Held, info.Stack)
+}
@@ -0,0 +1,303 @@
+package redis
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	_ ConnWithTimeout = (*namespacedConn)(nil)
+)
+
+// NewNamespacedConn returns a wrapper around a connection that prefixes the
+// keys of commands with prefix. The key positions are looked up in the
+// command table, including multi-key commands such as MGET, DEL and MSET,
+// commands with a key count such as ZUNIONSTORE and EVAL, and the streams
+// of XREAD. Commands whose keys cannot be determined are refused with an
+// error, so that a tenant cannot read or write keys outside its namespace.
+//
+// The prefix is removed from the keys in the replies of KEYS, SCAN,
+// RANDOMKEY, XREAD and the blocking pops such as BLPOP. The patterns of KEYS
+// and SCAN are matched within the namespace. RANDOMKEY picks a key from the
+// whole database and returns nil if the key is outside the namespace.
+//
+// Pub/Sub channels and the members of sets and hashes are not prefixed.
+func NewNamespacedConn(conn Conn, prefix string) Conn {
+	return &namespacedConn{Conn: conn, prefix: prefix}
+}
+
+type namespacedConn struct {
+	Conn
+	prefix string
+
+	mu sync.Mutex
+	// pending holds the reply functions of the sent commands in the order
+	// of their replies. A nil function leaves the reply as is.
+	pending []func(interface{}) interface{}
+	multi   bool
+	// queued holds the reply functions of the commands queued by MULTI.
+	queued []func(interface{}) interface{}
+}
+
+// command returns the namespaced arguments and the reply function of a
+// command.
+func (c *namespacedConn) command(commandName string, args []interface{}) ([]interface{}, func(interface{}) interface{}, error) {
+	args, f, err := namespaceCommand(c.prefix, commandName, args)
+	if err != nil {
+		return nil, nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch strings.ToUpper(commandName) {
+	case "MULTI":
+		c.multi, c.queued = true, nil
+	case "DISCARD":
+		c.multi, c.queued = false, nil
+	case "EXEC":
+		queued := c.queued
+		c.multi, c.queued = false, nil
+		f = func(reply interface{}) interface{} {
+			if replies, ok := reply.([]interface{}); ok && len(replies) == len(queued) {
+				for i, f := range queued {
+					if f != nil {
+						replies[i] = f(replies[i])
+					}
+				}
+			}
+			return reply
+		}
+	default:
+		if c.multi {
+			// The reply to a queued command is QUEUED.
+			c.queued = append(c.queued, f)
+			f = nil
+		}
+	}
+	return args, f, nil
+}
+
+func (c *namespacedConn) do(commandName string, args []interface{}, do func(commandName string, args ...interface{}) (interface{}, error)) (interface{}, error) {
+	if commandName == "" {
+		c.mu.Lock()
+		pending := c.pending
+		c.pending = nil
+		c.mu.Unlock()
+		reply, err := do("")
+		if replies, ok := reply.([]interface{}); ok && len(replies) == len(pending) {
+			for i, f := range pending {
+				if f != nil {
+					replies[i] = f(replies[i])
+				}
+			}
+		}
+		return reply, err
+	}
+
+	args, f, err := c.command(commandName, args)
+	if err != nil {
+		return nil, err
+	}
+	// Do discards the replies of the pending commands.
+	c.mu.Lock()
+	c.pending = nil
+	c.mu.Unlock()
+	reply, err := do(commandName, args...)
+	if err != nil || f == nil {
+		return reply, err
+	}
+	return f(reply), nil
+}
+
+func (c *namespacedConn) Do(commandName string, args ...interface{}) (interface{}, error) {
+	return c.do(commandName, args, c.Conn.Do)
+}
+
+func (c *namespacedConn) DoWithTimeout(timeout time.Duration, commandName string, args ...interface{}) (interface{}, error) {
+	return c.do(commandName, args, func(commandName string, args ...interface{}) (interface{}, error) {
+		return DoWithTimeout(c.Conn, timeout, commandName, args...)
+	})
+}
+
+func (c *namespacedConn) Send(commandName string, args ...interface{}) error {
+	args, f, err := c.command(commandName, args)
+	if err != nil {
+		return err
+	}
+	if err := c.Conn.Send(commandName, args...); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.pending = append(c.pending, f)
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *namespacedConn) received(reply interface{}, err error) (interface{}, error) {
+	var f func(interface{}) interface{}
+	c.mu.Lock()
+	// Pub/Sub messages are received without a pending command.
+	if len(c.pending) > 0 {
+		f = c.pending[0]
+		c.pending = c.pending[1:]
+	}
+	c.mu.Unlock()
+	if err != nil || f == nil {
+		return reply, err
+	}
+	return f(reply), nil
+}
+
+func (c *namespacedConn) Receive() (interface{}, error) {
+	return c.received(c.Conn.Receive())
+}
+
+func (c *namespacedConn) ReceiveWithTimeout(timeout time.Duration) (interface{}, error) {
+	return c.received(ReceiveWithTimeout(c.Conn, timeout))
+}
+
+// namespaceCommand returns the arguments of a command with the keys
+// prefixed and a function that removes the prefix from the keys in the
+// reply. The function is nil for replies without keys.
+func namespaceCommand(prefix, commandName string, args []interface{}) ([]interface{}, func(interface{}) interface{}, error) {
+	positions, ok := keyPositions(commandName, args)
+	if !ok {
+		return nil, nil, fmt.Errorf("redigo: cannot determine the keys of command %s", commandName)
+	}
+	nargs := make([]interface{}, len(args))
+	copy(nargs, args)
+	for _, i := range positions {
+		nargs[i] = prefixKey(prefix, args[i])
+	}
+
+	strip := func(key interface{}) interface{} {
+		return stripPrefix(prefix, key)
+	}
+	switch strings.ToUpper(commandName) {
+	case "KEYS":
+		if len(nargs) > 0 {
+			nargs[0] = escapePattern(prefix) + argString(nargs[0])
+		}
+		return nargs, func(reply interface{}) interface{} {
+			return mapValues(reply, strip)
+		}, nil
+	case "SCAN":
+		match := false
+		for i := 1; i+1 < len(nargs); i += 2 {
+			if strings.EqualFold(argString(nargs[i]), ParamMatch) {
+				nargs[i+1] = escapePattern(prefix) + argString(nargs[i+1])
+				match = true
+			}
+		}
+		if !match {
+			nargs = append(nargs, ParamMatch, escapePattern(prefix)+"*")
+		}
+		return nargs, func(reply interface{}) interface{} {
+			if r, ok := reply.([]interface{}); ok && len(r) == 2 {
+				r[1] = mapValues(r[1], strip)
+			}
+			return reply
+		}, nil
+	case "RANDOMKEY":
+		return nargs, func(reply interface{}) interface{} {
+			if p, ok := reply.([]byte); ok && !bytes.HasPrefix(p, []byte(prefix)) {
+				return nil
+			}
+			return strip(reply)
+		}, nil
+	case "BLPOP", "BRPOP", "BZPOPMIN", "BZPOPMAX", "LMPOP", "BLMPOP", "ZMPOP", "BZMPOP":
+		// The reply starts with the key.
+		return nargs, func(reply interface{}) interface{} {
+			if r, ok := reply.([]interface{}); ok && len(r) > 0 {
+				r[0] = strip(r[0])
+			}
+			return reply
+		}, nil
+	case "XREAD", "XREADGROUP":
+		// The reply is a list of streams that start with the key.
+		return nargs, func(reply interface{}) interface{} {
+			return mapValues(reply, func(stream interface{}) interface{} {
+				if r, ok := stream.([]interface{}); ok && len(r) > 0 {
+					r[0] = strip(r[0])
+				}
+				return stream
+			})
+		}, nil
+	}
+	return nargs, nil, nil
+}
+
+// mapValues replaces the elements of an array reply with the results of f.
+func mapValues(reply interface{}, f func(interface{}) interface{}) interface{} {
+	if r, ok := reply.([]interface{}); ok {
+		for i := range r {
+			r[i] = f(r[i])
+		}
+	}
+	return reply
+}
+
+func prefixKey(prefix string, key interface{}) interface{} {
+	if p, ok := key.([]byte); ok {
+		return append([]byte(prefix), p...)
+	}
+	return prefix + argString(key)
+}
+
+// stripPrefix removes prefix from a key in a reply. Keys without the prefix
+// are returned as is.
+func stripPrefix(prefix string, key interface{}) interface{} {
+	switch k := key.(type) {
+	case []byte:
+		if bytes.HasPrefix(k, []byte(prefix)) {
+			return k[len(prefix):]
+		}
+	case string:
+		return strings.TrimPrefix(k, prefix)
+	}
+	return key
+}
+
+// escapePattern escapes the glob special characters in s.
+func escapePattern(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch r {
+		case '*', '?', '[', ']', '\\':
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// WithNamespace returns a copy of the client that prefixes the keys of
+// commands with prefix. The connections returned by GetConn of the copy are
+// wrapped with NewNamespacedConn, see NewNamespacedConn for the commands
+// that are supported.
+func (client *RedisClient) WithNamespace(prefix string) *RedisClient {
+	c := *client
+	c.namespace = prefix
+	return &c
+}
+
+// Namespace returns the key prefix set by WithNamespace.
+func (client *RedisClient) Namespace() string {
+	return client.namespace
+}
+
+// doNamespaced calls do with the command with the keys prefixed by the
+// client's namespace.
+func (client *RedisClient) doNamespaced(commandName string, args []interface{}, do func(commandName string, args []interface{}) (interface{}, error)) (interface{}, error) {
+	args, f, err := namespaceCommand(client.namespace, commandName, args)
+	if err != nil {
+		return nil, err
+	}
+	reply, err := do(commandName, args)
+	if err != nil || f == nil {
+		return reply, err
+	}
+	return f(reply), nil
+}
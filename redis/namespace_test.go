@@ -0,0 +1,157 @@
+package redis
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+var namespaceCommandTests = []struct {
+	commandName string
+	args        []interface{}
+	expected    []interface{}
+}{
+	{"GET", []interface{}{"a"}, []interface{}{"t:a"}},
+	{"SET", []interface{}{[]byte("a"), "v", "PX", 10}, []interface{}{[]byte("t:a"), "v", "PX", 10}},
+	{"MGET", []interface{}{"a", "b"}, []interface{}{"t:a", "t:b"}},
+	{"MSET", []interface{}{"a", 1, "b", 2}, []interface{}{"t:a", 1, "t:b", 2}},
+	{"DEL", []interface{}{"a", "b", "c"}, []interface{}{"t:a", "t:b", "t:c"}},
+	{"BLPOP", []interface{}{"a", "b", 0}, []interface{}{"t:a", "t:b", 0}},
+	{"BITOP", []interface{}{"AND", "d", "a"}, []interface{}{"AND", "t:d", "t:a"}},
+	{"ZUNIONSTORE", []interface{}{"d", 2, "a", "b", "WEIGHTS", 1, 2}, []interface{}{"t:d", 2, "t:a", "t:b", "WEIGHTS", 1, 2}},
+	{"EVAL", []interface{}{"return 1", "1", "a", "arg"}, []interface{}{"return 1", "1", "t:a", "arg"}},
+	{"EVALSHA", []interface{}{"sha", 0, "arg"}, []interface{}{"sha", 0, "arg"}},
+	{"BLMPOP", []interface{}{1, 2, "a", "b", "LEFT"}, []interface{}{1, 2, "t:a", "t:b", "LEFT"}},
+	{"XREADGROUP", []interface{}{"GROUP", "g", "streams", "COUNT", 1, "STREAMS", "a", "b", ">", ">"},
+		[]interface{}{"GROUP", "g", "streams", "COUNT", 1, "STREAMS", "t:a", "t:b", ">", ">"}},
+	{"HEXPIRE", []interface{}{"a", 10, "NX", "FIELDS", 1, "f"}, []interface{}{"t:a", 10, "NX", "FIELDS", 1, "f"}},
+	{"KEYS", []interface{}{"user:*"}, []interface{}{"t:user:*"}},
+	{"SCAN", []interface{}{0, "COUNT", 10}, []interface{}{0, "COUNT", 10, "MATCH", "t:*"}},
+	{"SCAN", []interface{}{0, "match", "a*"}, []interface{}{0, "match", "t:a*"}},
+	{"PING", nil, []interface{}{}},
+}
+
+func TestNamespaceCommand(t *testing.T) {
+	for _, tt := range namespaceCommandTests {
+		args, _, err := namespaceCommand("t:", tt.commandName, tt.args)
+		if err != nil {
+			t.Errorf("namespaceCommand(%s, %v) returned error %v", tt.commandName, tt.args, err)
+			continue
+		}
+		if !reflect.DeepEqual(args, tt.expected) {
+			t.Errorf("namespaceCommand(%s, %v) = %v, want %v", tt.commandName, tt.args, args, tt.expected)
+		}
+	}
+
+	for _, cmd := range [][]interface{}{
+		{"FLUSHDB"},
+		{"OBJECT", "ENCODING", "a"},
+		{"EVAL", "return 1", 2, "a"},
+		{"XREAD", "COUNT", 1, "STREAMS", "a"},
+	} {
+		if _, _, err := namespaceCommand("t:", cmd[0].(string), cmd[1:]); err == nil {
+			t.Errorf("namespaceCommand(%v) did not return an error", cmd)
+		}
+	}
+
+	if args, _, _ := namespaceCommand("t[1]*:", "KEYS", []interface{}{"*"}); args[0] != `t\[1\]\*:*` {
+		t.Errorf("KEYS pattern is %q, want the prefix escaped", args[0])
+	}
+}
+
+func TestNamespacedClient(t *testing.T) {
+	client := getClient()
+	ns := client.WithNamespace("tenant:")
+	client.Del("ns:a", "tenant:ns:a", "tenant:ns:b", "tenant:ns:z1", "tenant:ns:z2", "tenant:ns:dest", "tenant:ns:list")
+	defer client.Del("ns:a", "tenant:ns:a", "tenant:ns:b", "tenant:ns:z1", "tenant:ns:z2", "tenant:ns:dest", "tenant:ns:list")
+
+	client.Set("ns:a", "outside", 0)
+	if _, err := ns.MSet("ns:a", "1", "ns:b", "2"); err != nil {
+		t.Fatalf("MSet returned %v", err)
+	}
+	if s, _ := client.Get("tenant:ns:a"); s != "1" {
+		t.Errorf("tenant:ns:a is %q, want 1", s)
+	}
+	if s, _ := client.Get("ns:a"); s != "outside" {
+		t.Errorf("ns:a is %q, want outside", s)
+	}
+	if values, err := ns.MGet("ns:a", "ns:b"); err != nil || !reflect.DeepEqual(values, []string{"1", "2"}) {
+		t.Errorf("MGet returned %v, %v, want [1 2], nil", values, err)
+	}
+
+	keys, err := ns.Keys("ns:*")
+	sort.Strings(keys)
+	if err != nil || !reflect.DeepEqual(keys, []string{"ns:a", "ns:b"}) {
+		t.Errorf("Keys returned %v, %v, want [ns:a ns:b], nil", keys, err)
+	}
+	var scanned []string
+	for cursor := uint64(0); ; {
+		next, keys, err := ns.Scan(cursor, "ns:*", 0)
+		if err != nil {
+			t.Fatalf("Scan returned %v", err)
+		}
+		scanned = append(scanned, keys...)
+		if cursor = next; cursor == 0 {
+			break
+		}
+	}
+	sort.Strings(scanned)
+	if !reflect.DeepEqual(scanned, []string{"ns:a", "ns:b"}) {
+		t.Errorf("Scan returned %v, want [ns:a ns:b]", scanned)
+	}
+
+	ns.ZAdd("ns:z1", Z{Score: 1, Member: "x"})
+	ns.ZAdd("ns:z2", Z{Score: 2, Member: "y"})
+	if n, err := ns.ZUnionStore("ns:dest", ZStore{}, "ns:z1", "ns:z2"); err != nil || n != 2 {
+		t.Errorf("ZUnionStore returned %d, %v, want 2, nil", n, err)
+	}
+	if n, _ := client.ZCard("tenant:ns:dest"); n != 2 {
+		t.Errorf("ZCard of tenant:ns:dest is %d, want 2", n)
+	}
+
+	ns.RPush("ns:list", "x")
+	if reply, err := ns.BLPop(time.Second, "ns:missing", "ns:list"); err != nil || !reflect.DeepEqual(reply, []string{"ns:list", "x"}) {
+		t.Errorf("BLPop returned %v, %v, want [ns:list x], nil", reply, err)
+	}
+
+	if n, err := ns.Del("ns:a", "ns:b"); err != nil || n != 2 {
+		t.Errorf("Del returned %d, %v, want 2, nil", n, err)
+	}
+	if _, err := ns.Do("FLUSHDB"); err == nil {
+		t.Errorf("FLUSHDB did not return an error")
+	}
+}
+
+func TestNamespacedConnPipeline(t *testing.T) {
+	client := getClient()
+	client.Del("tenant:pipe:a")
+	defer client.Del("tenant:pipe:a")
+
+	conn, err := client.WithNamespace("tenant:").GetConn()
+	if err != nil {
+		t.Fatalf("GetConn returned %v", err)
+	}
+	defer conn.Close()
+
+	conn.Send("MULTI")
+	conn.Send("SET", "pipe:a", "1")
+	conn.Send("KEYS", "pipe:*")
+	replies, err := Values(conn.Do("EXEC"))
+	if err != nil || len(replies) != 2 {
+		t.Fatalf("EXEC returned %v, %v", replies, err)
+	}
+	if keys, _ := Strings(replies[1], nil); !reflect.DeepEqual(keys, []string{"pipe:a"}) {
+		t.Errorf("KEYS in transaction returned %v, want [pipe:a]", keys)
+	}
+
+	conn.Send("GET", "pipe:a")
+	conn.Send("KEYS", "pipe:*")
+	conn.Flush()
+	if s, err := String(conn.Receive()); err != nil || s != "1" {
+		t.Errorf("GET returned %q, %v, want 1, nil", s, err)
+	}
+	if keys, err := Strings(conn.Receive()); err != nil || !reflect.DeepEqual(keys, []string{"pipe:a"}) {
+		t.Errorf("KEYS returned %v, %v, want [pipe:a], nil", keys, err)
+	}
+}
@@ -161,7 +161,54 @@ type Pool struct {
 	// the pool does not close connections based on age.
 	MaxConnLifetime time.Duration
 
-	chInitialized uint32 // set to 1 when field ch is initialized
+	// MaxConnLifetimeJitter shortens the lifetime of each connection by a
+	// random duration up to this value so that connections created at the
+	// same time do not all expire at once. The jitter is limited to half of
+	// MaxConnLifetime.
+	MaxConnLifetimeJitter time.Duration
+
+	// MinIdle is the number of idle connections that the pool keeps open.
+	// When MinIdle is greater than zero, a background goroutine dials new
+	// connections when the number of idle connections falls below MinIdle.
+	// MinIdle is capped at MaxIdle.
+	MinIdle int
+
+	// HealthCheckInterval is the interval at which a background goroutine
+	// checks idle connections and replaces dead ones. If zero, then idle
+	// connections are only checked by TestOnBorrow and the goroutine only
+	// runs when MinIdle is set.
+	HealthCheckInterval time.Duration
+
+	// HealthCheck is an optional application supplied function for checking
+	// the health of an idle connection from the background goroutine. If
+	// nil, then the connection is checked with the PING command.
+	HealthCheck func(c Conn) error
+
+	// DebugBorrows enables leak detection. When set, the pool records the
+	// time and the caller's stack each time a connection is borrowed with Get
+	// or GetContext. Borrowed connections are reported by Leaks, reported to
+	// OnLeak when held longer than LeakThreshold and reported when garbage
+	// collected without a call to Close. Recording the stack is expensive;
+	// enable this option for debugging only.
+	DebugBorrows bool
+
+	// LeakThreshold is the time after which a borrowed connection is
+	// reported as a possible leak. Each borrow is reported at most once.
+	// Zero disables the reports from the background goroutine.
+	LeakThreshold time.Duration
+
+	// OnLeak is called with possible leaks found by the pool. If nil, then
+	// leaks are written to the standard logger.
+	OnLeak func(info LeakInfo)
+
+	// CircuitBreaker optionally stops the pool from dialing new connections
+	// while the server is failing. Dials rejected by the breaker fail with
+	// ErrCircuitOpen. A RedisClient using the pool also consults the breaker
+	// before executing commands.
+	CircuitBreaker *CircuitBreaker
+
+	chInitialized    uint32 // set to 1 when field ch is initialized
+	maintInitialized uint32 // set to 1 when the maintenance goroutine is started
 
 	mu           sync.Mutex    // mu protects the following fields
 	closed       bool          // set to true when the pool is closed.
@@ -170,6 +217,8 @@ type Pool struct {
 	idle         idleList      // idle connections
 	waitCount    int64         // total number of connections waited for.
 	waitDuration time.Duration // total time waited for new connections.
+	maintStop    chan struct{} // closed to stop the maintenance goroutine
+	borrows      map[*borrow]struct{}
 }
 
 // NewPool creates a new pool.
@@ -199,6 +248,8 @@ func (p *Pool) Get() Conn {
 // If the function completes without error, then the application must close the
 // returned connection.
 func (p *Pool) GetContext(ctx context.Context) (Conn, error) {
+	p.startMaintenance()
+
 	// Wait until there is a vacant connection in the pool.
 	waited, err := p.waitVacantConn(ctx)
 	if err != nil {
@@ -231,8 +282,8 @@ func (p *Pool) GetContext(ctx context.Context) (Conn, error) {
 		p.idle.popFront()
 		p.mu.Unlock()
 		if (p.TestOnBorrow == nil || p.TestOnBorrow(pc.c, pc.t) == nil) &&
-			(p.MaxConnLifetime == 0 || nowFunc().Sub(pc.created) < p.MaxConnLifetime) {
-			return &activeConn{p: p, pc: pc}, nil
+			!p.expired(pc, nowFunc()) {
+			return p.newActiveConn(pc), nil
 		}
 		pc.c.Close()
 		p.mu.Lock()
@@ -265,7 +316,24 @@ func (p *Pool) GetContext(ctx context.Context) (Conn, error) {
 		p.mu.Unlock()
 		return errorConn{err}, err
 	}
-	return &activeConn{p: p, pc: &poolConn{c: c, created: nowFunc()}}, nil
+	return p.newActiveConn(p.newPoolConn(c)), nil
+}
+
+func (p *Pool) newPoolConn(c Conn) *poolConn {
+	pc := &poolConn{c: c, created: nowFunc()}
+	if p.MaxConnLifetime > 0 {
+		d := p.MaxConnLifetimeJitter
+		if d > p.MaxConnLifetime/2 {
+			d = p.MaxConnLifetime / 2
+		}
+		pc.jitter = jitter(d)
+	}
+	return pc
+}
+
+// expired returns true if the connection has exceeded its lifetime.
+func (p *Pool) expired(pc *poolConn, now time.Time) bool {
+	return p.MaxConnLifetime > 0 && now.Sub(pc.created) >= p.MaxConnLifetime-pc.jitter
 }
 
 // PoolStats contains pool statistics.
@@ -324,6 +392,9 @@ func (p *Pool) Close() error {
 		return nil
 	}
 	p.closed = true
+	if p.maintStop != nil {
+		close(p.maintStop)
+	}
 	p.active -= p.idle.count
 	pc := p.idle.front
 	p.idle.count = 0
@@ -401,6 +472,21 @@ func (p *Pool) waitVacantConn(ctx context.Context) (waited time.Duration, err er
 }
 
 func (p *Pool) dial(ctx context.Context) (Conn, error) {
+	cb := p.CircuitBreaker
+	if cb == nil {
+		return p.dialConn(ctx)
+	}
+	probe, err := cb.acquire()
+	if err != nil {
+		return nil, err
+	}
+	c, err := p.dialConn(ctx)
+	counted, failed := circuitOutcome(err)
+	cb.finish(probe, counted, failed, true)
+	return c, err
+}
+
+func (p *Pool) dialConn(ctx context.Context) (Conn, error) {
 	if p.DialContext != nil {
 		return p.DialContext(ctx)
 	}
@@ -410,6 +496,171 @@ func (p *Pool) dial(ctx context.Context) (Conn, error) {
 	return nil, errors.New("redigo: must pass Dial or DialContext to pool")
 }
 
+// WarmUp dials connections until the pool has MinIdle idle connections, or
+// MaxIdle idle connections when MinIdle is not set. WarmUp returns the first
+// dial error. Call WarmUp at application startup so that the first requests
+// do not pay the dial latency.
+func (p *Pool) WarmUp(ctx context.Context) error {
+	p.startMaintenance()
+	n := p.minIdle()
+	if n == 0 {
+		n = p.MaxIdle
+	}
+	return p.fillIdle(ctx, n)
+}
+
+func (p *Pool) minIdle() int {
+	if p.MinIdle > p.MaxIdle {
+		return p.MaxIdle
+	}
+	return p.MinIdle
+}
+
+// startMaintenance starts the goroutine that checks idle connections and
+// keeps MinIdle connections open.
+func (p *Pool) startMaintenance() {
+	// Fast path.
+	if atomic.LoadUint32(&p.maintInitialized) == 1 {
+		return
+	}
+	// Slow path.
+	p.mu.Lock()
+	if p.maintInitialized == 0 {
+		if !p.closed && (p.MinIdle > 0 || p.HealthCheckInterval > 0 || p.checkLeakThreshold()) {
+			p.maintStop = make(chan struct{})
+			go p.maintain(p.maintStop)
+		}
+		atomic.StoreUint32(&p.maintInitialized, 1)
+	}
+	p.mu.Unlock()
+}
+
+func (p *Pool) maintain(stop chan struct{}) {
+	interval := p.HealthCheckInterval
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+	if p.checkLeakThreshold() && p.LeakThreshold < interval {
+		interval = p.LeakThreshold
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-t.C:
+		}
+		p.checkIdle()
+		p.fillIdle(context.Background(), p.minIdle())
+		p.checkLeaks()
+	}
+}
+
+// checkIdle closes idle connections that are stale, expired or that fail
+// the health check.
+func (p *Pool) checkIdle() {
+	healthCheck := p.HealthCheckInterval > 0
+	start := nowFunc()
+	p.mu.Lock()
+	for n := p.idle.count; n > 0 && p.idle.back != nil && p.idle.back.t.Before(start); n-- {
+		pc := p.idle.back
+		p.idle.popBack()
+		p.mu.Unlock()
+		now := nowFunc()
+		ok := !p.expired(pc, now) && (p.IdleTimeout == 0 || now.Sub(pc.t) < p.IdleTimeout)
+		if ok && healthCheck {
+			ok = p.healthCheck(pc.c) == nil
+		}
+		p.mu.Lock()
+		if ok && !p.closed && p.idle.count < p.MaxIdle {
+			if !healthCheck {
+				// Without a health check, the connections in front of
+				// this one are newer and do not need to be examined.
+				p.idle.pushBack(pc)
+				break
+			}
+			// The successful check resets the server's idle timer.
+			pc.t = now
+			p.idle.pushFront(pc)
+			continue
+		}
+		p.mu.Unlock()
+		pc.c.Close()
+		p.mu.Lock()
+		p.active--
+	}
+	p.mu.Unlock()
+}
+
+func (p *Pool) healthCheck(c Conn) error {
+	if err := c.Err(); err != nil {
+		return err
+	}
+	if p.HealthCheck != nil {
+		return p.HealthCheck(c)
+	}
+	_, err := c.Do("PING")
+	return err
+}
+
+// fillIdle dials connections until there are n idle connections in the
+// pool or the MaxActive limit is reached.
+func (p *Pool) fillIdle(ctx context.Context, n int) error {
+	for {
+		p.mu.Lock()
+		if p.closed || p.idle.count >= n || (p.MaxActive > 0 && p.active >= p.MaxActive) {
+			p.mu.Unlock()
+			return nil
+		}
+		p.active++
+		p.mu.Unlock()
+
+		// Hold a slot while dialing so that concurrent calls to Get do not
+		// exceed MaxActive.
+		waited := p.Wait && p.MaxActive > 0
+		if waited {
+			p.lazyInit()
+			select {
+			case _, ok := <-p.ch:
+				if !ok {
+					waited = false
+				}
+			default:
+				waited = false
+			}
+			if !waited {
+				p.mu.Lock()
+				p.active--
+				p.mu.Unlock()
+				return nil
+			}
+		}
+
+		c, err := p.dial(ctx)
+		p.mu.Lock()
+		if err == nil && !p.closed {
+			pc := p.newPoolConn(c)
+			pc.t = nowFunc()
+			p.idle.pushFront(pc)
+			c = nil
+		} else {
+			p.active--
+		}
+		closed := p.closed
+		if waited && !closed {
+			p.ch <- struct{}{}
+		}
+		p.mu.Unlock()
+		if c != nil {
+			c.Close()
+		}
+		if err != nil || closed {
+			return err
+		}
+	}
+}
+
 func (p *Pool) put(pc *poolConn, forceClose bool) error {
 	p.mu.Lock()
 	if !p.closed && !forceClose {
@@ -441,6 +692,7 @@ type activeConn struct {
 	p     *Pool
 	pc    *poolConn
 	state int
+	b     *borrow
 }
 
 var (
@@ -466,6 +718,9 @@ func (ac *activeConn) Close() error {
 		return nil
 	}
 	ac.pc = nil
+	if ac.b != nil {
+		ac.p.endBorrow(ac)
+	}
 
 	if ac.state&connectionMultiState != 0 {
 		pc.c.Send("DISCARD")
@@ -590,6 +845,7 @@ type poolConn struct {
 	c          Conn
 	t          time.Time
 	created    time.Time
+	jitter     time.Duration
 	next, prev *poolConn
 }
 
@@ -606,6 +862,18 @@ func (l *idleList) pushFront(pc *poolConn) {
 	return
 }
 
+func (l *idleList) pushBack(pc *poolConn) {
+	pc.next = nil
+	pc.prev = l.back
+	if l.count == 0 {
+		l.front = pc
+	} else {
+		l.back.next = pc
+	}
+	l.back = pc
+	l.count++
+}
+
 func (l *idleList) popFront() {
 	pc := l.front
 	l.count--
@@ -20,6 +20,8 @@ import (
 	"io"
 	"net"
 	"reflect"
+	"runtime"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -934,3 +936,271 @@ func TestWaitPoolGetCanceledContext(t *testing.T) {
 		}
 	})
 }
+
+// stubConn is a connection that does not talk to a server. The PING command
+// fails after the connection is marked dead.
+type stubConn struct {
+	redis.Conn
+	d    *stubDialer
+	dead bool
+}
+
+func (c *stubConn) Do(commandName string, args ...interface{}) (interface{}, error) {
+	if c.dead {
+		return nil, io.EOF
+	}
+	return "PONG", nil
+}
+
+func (c *stubConn) Err() error { return nil }
+
+func (c *stubConn) Close() error {
+	c.d.mu.Lock()
+	c.d.open--
+	c.d.mu.Unlock()
+	return nil
+}
+
+type stubDialer struct {
+	mu     sync.Mutex
+	dialed int
+	open   int
+	conns  []*stubConn
+}
+
+func (d *stubDialer) dial() (redis.Conn, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.dialed++
+	d.open++
+	c := &stubConn{d: d}
+	d.conns = append(d.conns, c)
+	return c, nil
+}
+
+func (d *stubDialer) check(t *testing.T, message string, p *redis.Pool, dialed, open, idle int) {
+	t.Helper()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.dialed != dialed {
+		t.Errorf("%s: dialed=%d, want %d", message, d.dialed, dialed)
+	}
+	if d.open != open {
+		t.Errorf("%s: open=%d, want %d", message, d.open, open)
+	}
+	if n := p.IdleCount(); n != idle {
+		t.Errorf("%s: idle=%d, want %d", message, n, idle)
+	}
+}
+
+func TestPoolWarmUp(t *testing.T) {
+	var d stubDialer
+	p := &redis.Pool{MaxIdle: 3, Dial: d.dial}
+	defer p.Close()
+	if err := p.WarmUp(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	d.check(t, "MaxIdle", p, 3, 3, 3)
+
+	d = stubDialer{}
+	p = &redis.Pool{MaxIdle: 3, MinIdle: 2, MaxActive: 1, Wait: true, Dial: d.dial, HealthCheckInterval: time.Hour}
+	defer p.Close()
+	if err := p.WarmUp(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	d.check(t, "MaxActive", p, 1, 1, 1)
+	c := p.Get()
+	if err := c.Err(); err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+	d.check(t, "after get", p, 1, 1, 1)
+}
+
+func TestPoolMinIdle(t *testing.T) {
+	var d stubDialer
+	p := &redis.Pool{MaxIdle: 4, MinIdle: 2, Dial: d.dial, HealthCheckInterval: time.Hour}
+	defer p.Close()
+	if err := p.WarmUp(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	d.check(t, "warm up", p, 2, 2, 2)
+
+	c1, c2 := p.Get(), p.Get()
+	d.check(t, "get", p, 2, 2, 0)
+	redis.MaintainPool(p)
+	d.check(t, "maintain", p, 4, 4, 2)
+	c1.Close()
+	c2.Close()
+	d.check(t, "close", p, 4, 4, 4)
+}
+
+func TestPoolHealthCheck(t *testing.T) {
+	var d stubDialer
+	p := &redis.Pool{MaxIdle: 2, MinIdle: 2, Dial: d.dial, HealthCheckInterval: time.Hour}
+	defer p.Close()
+	if err := p.WarmUp(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	d.conns[0].dead = true
+	redis.MaintainPool(p)
+	d.check(t, "maintain", p, 3, 2, 2)
+
+	errUnhealthy := errors.New("unhealthy")
+	checked := 0
+	p.HealthCheck = func(c redis.Conn) error {
+		checked++
+		return errUnhealthy
+	}
+	p.MinIdle = 0
+	redis.MaintainPool(p)
+	if checked != 2 {
+		t.Errorf("checked=%d, want 2", checked)
+	}
+	d.check(t, "custom check", p, 3, 0, 0)
+}
+
+func TestPoolMaxLifetimeJitter(t *testing.T) {
+	var d stubDialer
+	p := &redis.Pool{
+		MaxIdle:               10,
+		MaxConnLifetime:       300 * time.Second,
+		MaxConnLifetimeJitter: 100 * time.Second,
+		Dial:                  d.dial,
+	}
+	defer p.Close()
+
+	now := time.Now()
+	redis.SetNowFunc(func() time.Time { return now })
+	defer redis.SetNowFunc(time.Now)
+
+	if err := p.WarmUp(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(200 * time.Second)
+	redis.MaintainPool(p)
+	d.check(t, "before jitter", p, 10, 10, 10)
+
+	now = now.Add(100 * time.Second)
+	redis.MaintainPool(p)
+	d.check(t, "after lifetime", p, 10, 0, 0)
+}
+
+func TestPoolMaxLifetimeJitterClamped(t *testing.T) {
+	var d stubDialer
+	p := &redis.Pool{
+		MaxIdle:               10,
+		MaxConnLifetime:       100 * time.Second,
+		MaxConnLifetimeJitter: time.Hour,
+		Dial:                  d.dial,
+	}
+	defer p.Close()
+
+	now := time.Now()
+	redis.SetNowFunc(func() time.Time { return now })
+	defer redis.SetNowFunc(time.Now)
+
+	if err := p.WarmUp(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	redis.MaintainPool(p)
+	d.check(t, "after create", p, 10, 10, 10)
+
+	now = now.Add(49 * time.Second)
+	redis.MaintainPool(p)
+	d.check(t, "before half lifetime", p, 10, 10, 10)
+
+	now = now.Add(51 * time.Second)
+	redis.MaintainPool(p)
+	d.check(t, "after lifetime", p, 10, 0, 0)
+}
+
+func TestPoolLeaks(t *testing.T) {
+	var d stubDialer
+	var leaks []redis.LeakInfo
+	p := &redis.Pool{
+		MaxIdle:       2,
+		Dial:          d.dial,
+		DebugBorrows:  true,
+		LeakThreshold: time.Minute,
+		OnLeak:        func(info redis.LeakInfo) { leaks = append(leaks, info) },
+	}
+	defer p.Close()
+
+	now := time.Now()
+	redis.SetNowFunc(func() time.Time { return now })
+	defer redis.SetNowFunc(time.Now)
+
+	c1 := p.Get()
+	now = now.Add(30 * time.Second)
+	c2 := p.Get()
+	if l := p.Leaks(); len(l) != 0 {
+		t.Fatalf("Leaks() = %v, want none", l)
+	}
+
+	now = now.Add(30 * time.Second)
+	l := p.Leaks()
+	if len(l) != 1 || l[0].Held != time.Minute {
+		t.Fatalf("Leaks() = %v, want one connection held for 1m", l)
+	}
+	if !strings.Contains(string(l[0].Stack), "TestPoolLeaks") {
+		t.Errorf("stack does not contain caller:\n%s", l[0].Stack)
+	}
+
+	redis.MaintainPool(p)
+	redis.MaintainPool(p)
+	if len(leaks) != 1 {
+		t.Fatalf("OnLeak called %d times, want 1", len(leaks))
+	}
+
+	c1.Close()
+	now = now.Add(30 * time.Second)
+	if l := p.Leaks(); len(l) != 1 || l[0].Held != time.Minute {
+		t.Fatalf("Leaks() after close = %v, want one connection held for 1m", l)
+	}
+	c2.Close()
+	if l := p.Leaks(); len(l) != 0 {
+		t.Fatalf("Leaks() after close = %v, want none", l)
+	}
+}
+
+func TestPoolLeakFinalizer(t *testing.T) {
+	var d stubDialer
+	leaks := make(chan redis.LeakInfo, 1)
+	p := &redis.Pool{
+		MaxIdle:      1,
+		MaxActive:    1,
+		Dial:         d.dial,
+		DebugBorrows: true,
+		OnLeak:       func(info redis.LeakInfo) { leaks <- info },
+	}
+	defer p.Close()
+
+	func() {
+		c := p.Get()
+		c.Do("PING")
+	}()
+
+	var info redis.LeakInfo
+	for i := 0; ; i++ {
+		runtime.GC()
+		select {
+		case info = <-leaks:
+		case <-time.After(10 * time.Millisecond):
+			if i < 100 {
+				continue
+			}
+			t.Fatal("leaked connection not reported")
+		}
+		break
+	}
+	if !info.Collected {
+		t.Errorf("Collected = false, want true")
+	}
+	d.check(t, "collected", p, 1, 0, 0)
+	c := p.Get()
+	if err := c.Err(); err != nil {
+		t.Fatalf("Get() after leak returned error %v", err)
+	}
+	c.Close()
+}
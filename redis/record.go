@@ -0,0 +1,499 @@
+package redis
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	_ ConnWithTimeout = (*recordingConn)(nil)
+	_ ConnWithTimeout = (*replayConn)(nil)
+)
+
+// The golden file format written by NewRecordingConn and read by
+// NewReplayConn is line oriented. A line starting with "do" or "send" is a
+// command with the arguments separated by spaces, a line containing "flush"
+// or "receive" is a call of the method with the same name, a line starting
+// with "<" is a line of the RESP encoded reply and a line starting with "!"
+// is an error returned by the preceding call. Error replies from the server
+// are written as "! -" followed by the message. Arguments and reply lines
+// are quoted using Go syntax when they contain special characters. Blank
+// lines and lines starting with "#" are ignored. Example:
+//
+//	do SET greeting "hello world"
+//	< +OK
+//	send GET greeting
+//	flush
+//	receive
+//	< $11
+//	< hello world
+//	do INCR greeting
+//	< -ERR value is not an integer or out of range
+
+// NewRecordingConn returns a wrapper around conn that writes the commands
+// and replies to w in the golden file format.
+func NewRecordingConn(conn Conn, w io.Writer) Conn {
+	return &recordingConn{Conn: conn, w: w}
+}
+
+type recordingConn struct {
+	Conn
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (c *recordingConn) record(op, commandName string, args []interface{}, hasReply bool, reply interface{}, err error) {
+	var buf bytes.Buffer
+	buf.WriteString(op)
+	if op == "do" || op == "send" {
+		words, aerr := encodeCommand(commandName, args)
+		if aerr != nil {
+			// Record the arguments as the error prevents replay.
+			words = []string{fmt.Sprint(commandName, args)}
+		}
+		for _, word := range words {
+			buf.WriteByte(' ')
+			buf.WriteString(quoteGolden(word, false))
+		}
+	}
+	buf.WriteByte('\n')
+	if hasReply && (reply != nil || err == nil) {
+		lines, rerr := encodeReply(reply)
+		if rerr != nil {
+			lines = []string{"-" + rerr.Error()}
+		}
+		for _, line := range lines {
+			buf.WriteByte('<')
+			if line != "" {
+				buf.WriteByte(' ')
+				buf.WriteString(quoteGolden(line, true))
+			}
+			buf.WriteByte('\n')
+		}
+	}
+	if rerr, ok := reply.(Error); err != nil && !(ok && rerr == err) {
+		msg := err.Error()
+		if _, ok := err.(Error); ok {
+			msg = "-" + msg
+		}
+		buf.WriteString("! ")
+		buf.WriteString(quoteGolden(msg, true))
+		buf.WriteByte('\n')
+	}
+	c.mu.Lock()
+	c.w.Write(buf.Bytes())
+	c.mu.Unlock()
+}
+
+func (c *recordingConn) Do(commandName string, args ...interface{}) (interface{}, error) {
+	reply, err := c.Conn.Do(commandName, args...)
+	c.recordDo(commandName, args, reply, err)
+	return reply, err
+}
+
+func (c *recordingConn) DoWithTimeout(timeout time.Duration, commandName string, args ...interface{}) (interface{}, error) {
+	reply, err := DoWithTimeout(c.Conn, timeout, commandName, args...)
+	c.recordDo(commandName, args, reply, err)
+	return reply, err
+}
+
+func (c *recordingConn) recordDo(commandName string, args []interface{}, reply interface{}, err error) {
+	if commandName == "" && reply == nil && err == nil {
+		// Do("") without pending commands is a no-op. Skip the call to
+		// keep the recording independent of the pool's use of Do("").
+		return
+	}
+	c.record("do", commandName, args, true, reply, err)
+}
+
+func (c *recordingConn) Send(commandName string, args ...interface{}) error {
+	err := c.Conn.Send(commandName, args...)
+	c.record("send", commandName, args, false, nil, err)
+	return err
+}
+
+func (c *recordingConn) Flush() error {
+	err := c.Conn.Flush()
+	c.record("flush", "", nil, false, nil, err)
+	return err
+}
+
+func (c *recordingConn) Receive() (interface{}, error) {
+	reply, err := c.Conn.Receive()
+	c.record("receive", "", nil, true, reply, err)
+	return reply, err
+}
+
+func (c *recordingConn) ReceiveWithTimeout(timeout time.Duration) (interface{}, error) {
+	reply, err := ReceiveWithTimeout(c.Conn, timeout)
+	c.record("receive", "", nil, true, reply, err)
+	return reply, err
+}
+
+// NewReplayConn returns a connection that replays the exchanges read from r
+// in the golden file format. The commands executed on the connection must
+// match the recorded commands. On the first difference, the connection
+// returns an error describing the difference and is not usable after that.
+// Close returns an error if some of the recorded exchanges were not
+// replayed.
+func NewReplayConn(r io.Reader) (Conn, error) {
+	p, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	exchanges, err := parseGolden(p)
+	if err != nil {
+		return nil, err
+	}
+	return &replayConn{exchanges: exchanges}, nil
+}
+
+type exchange struct {
+	line  int
+	op    string
+	args  []string
+	reply []byte // RESP encoded reply, nil if none
+	err   error
+}
+
+func (e *exchange) String() string {
+	s := e.op
+	for _, arg := range e.args {
+		s += " " + quoteGolden(arg, false)
+	}
+	return s
+}
+
+type replayConn struct {
+	mu        sync.Mutex
+	exchanges []*exchange
+	err       error
+}
+
+// next returns the next exchange if it matches the operation and command.
+func (c *replayConn) next(op, commandName string, args []interface{}) (*exchange, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	got := &exchange{op: op}
+	if op == "do" || op == "send" {
+		words, err := encodeCommand(commandName, args)
+		if err != nil {
+			return nil, err
+		}
+		got.args = words
+	}
+	if len(c.exchanges) == 0 {
+		c.err = fmt.Errorf("redigo: replay diverged: got %s after end of recording", got)
+		return nil, c.err
+	}
+	e := c.exchanges[0]
+	if e.String() != got.String() {
+		c.err = fmt.Errorf("redigo: replay diverged at line %d: got %s, want %s", e.line, got, e)
+		return nil, c.err
+	}
+	c.exchanges = c.exchanges[1:]
+	return e, nil
+}
+
+// result decodes the recorded reply and error.
+func (e *exchange) result() (interface{}, error) {
+	var reply interface{}
+	if e.reply != nil {
+		c := &conn{br: bufio.NewReader(bytes.NewReader(e.reply))}
+		var err error
+		if reply, err = c.readReply(); err != nil {
+			return nil, err
+		}
+	}
+	err := e.err
+	if rerr, ok := reply.(Error); ok && err == nil {
+		err = rerr
+	}
+	return reply, err
+}
+
+func (c *replayConn) Do(commandName string, args ...interface{}) (interface{}, error) {
+	return c.DoWithTimeout(0, commandName, args...)
+}
+
+func (c *replayConn) DoWithTimeout(timeout time.Duration, commandName string, args ...interface{}) (interface{}, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if commandName == "" && c.err == nil && (len(c.exchanges) == 0 || c.exchanges[0].op != "do" || len(c.exchanges[0].args) != 0) {
+		return nil, nil
+	}
+	e, err := c.next("do", commandName, args)
+	if err != nil {
+		return nil, err
+	}
+	return e.result()
+}
+
+func (c *replayConn) Send(commandName string, args ...interface{}) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, err := c.next("send", commandName, args)
+	if err != nil {
+		return err
+	}
+	return e.err
+}
+
+func (c *replayConn) Flush() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, err := c.next("flush", "", nil)
+	if err != nil {
+		return err
+	}
+	return e.err
+}
+
+func (c *replayConn) Receive() (interface{}, error) {
+	return c.ReceiveWithTimeout(0)
+}
+
+func (c *replayConn) ReceiveWithTimeout(timeout time.Duration) (interface{}, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, err := c.next("receive", "", nil)
+	if err != nil {
+		return nil, err
+	}
+	reply, err := e.result()
+	if _, ok := reply.(Error); ok {
+		reply = nil
+	}
+	return reply, err
+}
+
+func (c *replayConn) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+func (c *replayConn) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err == nil {
+		c.err = errors.New("redigo: closed")
+		if len(c.exchanges) > 0 {
+			return fmt.Errorf("redigo: replay closed before %s at line %d", c.exchanges[0], c.exchanges[0].line)
+		}
+	}
+	return nil
+}
+
+// encodeCommand returns the command name and arguments as sent to the
+// server.
+func encodeCommand(commandName string, args []interface{}) ([]string, error) {
+	if commandName == "" {
+		return nil, nil
+	}
+	var buf bytes.Buffer
+	c := &conn{bw: bufio.NewWriter(&buf), br: bufio.NewReader(&buf)}
+	if err := c.writeCommand(commandName, args); err != nil {
+		return nil, err
+	}
+	if err := c.bw.Flush(); err != nil {
+		return nil, err
+	}
+	reply, err := c.readReply()
+	if err != nil {
+		return nil, err
+	}
+	values := reply.([]interface{})
+	words := make([]string, len(values))
+	for i, v := range values {
+		words[i] = string(v.([]byte))
+	}
+	return words, nil
+}
+
+// writeReply writes v in the RESP encoding.
+func (c *conn) writeReply(v interface{}) error {
+	switch v := v.(type) {
+	case nil:
+		_, err := c.bw.WriteString("$-1\r\n")
+		return err
+	case string:
+		_, err := c.bw.WriteString("+" + v + "\r\n")
+		return err
+	case Error:
+		_, err := c.bw.WriteString("-" + string(v) + "\r\n")
+		return err
+	case int64:
+		_, err := c.bw.WriteString(":" + strconv.FormatInt(v, 10) + "\r\n")
+		return err
+	case []byte:
+		return c.writeBytes(v)
+	case []interface{}:
+		if err := c.writeLen('*', len(v)); err != nil {
+			return err
+		}
+		for _, v := range v {
+			if err := c.writeReply(v); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("redigo: unexpected reply type %T", v)
+}
+
+// encodeReply returns the lines of the RESP encoding of v. The data of a
+// bulk string is one line.
+func encodeReply(v interface{}) ([]string, error) {
+	var buf bytes.Buffer
+	c := &conn{bw: bufio.NewWriter(&buf)}
+	if err := c.writeReply(v); err != nil {
+		return nil, err
+	}
+	if err := c.bw.Flush(); err != nil {
+		return nil, err
+	}
+	var lines []string
+	p := buf.Bytes()
+	for len(p) > 0 {
+		i := bytes.Index(p, []byte("\r\n"))
+		line := p[:i]
+		p = p[i+2:]
+		lines = append(lines, string(line))
+		if line[0] == '$' {
+			if n, _ := strconv.Atoi(string(line[1:])); n >= 0 {
+				lines = append(lines, string(p[:n]))
+				p = p[n+2:]
+			}
+		}
+	}
+	return lines, nil
+}
+
+// quoteGolden quotes s using Go syntax if s contains characters that are
+// not printable ASCII. Spaces are allowed in lines, but not in words.
+func quoteGolden(s string, line bool) string {
+	if s == "" {
+		if line {
+			return s
+		}
+		return `""`
+	}
+	if s[0] == '"' || s[len(s)-1] == ' ' {
+		return strconv.Quote(s)
+	}
+	for i := 0; i < len(s); i++ {
+		if b := s[i]; b < ' ' || b > '~' || (b == ' ' && !line) {
+			return strconv.Quote(s)
+		}
+	}
+	return s
+}
+
+func unquoteGolden(s string) (string, error) {
+	if strings.HasPrefix(s, `"`) {
+		return strconv.Unquote(s)
+	}
+	return s, nil
+}
+
+// splitWords splits a command line into words. Quoted words may contain
+// spaces.
+func splitWords(s string) ([]string, error) {
+	var words []string
+	for {
+		s = strings.TrimLeft(s, " ")
+		if s == "" {
+			return words, nil
+		}
+		end := strings.IndexByte(s, ' ')
+		if s[0] == '"' {
+			end = -1
+			for i := 1; i < len(s); i++ {
+				if s[i] == '\\' {
+					i++
+				} else if s[i] == '"' {
+					end = i + 1
+					break
+				}
+			}
+			if end < 0 {
+				return nil, errors.New("unterminated quoted string")
+			}
+		}
+		if end < 0 {
+			end = len(s)
+		}
+		word, err := unquoteGolden(s[:end])
+		if err != nil {
+			return nil, err
+		}
+		words = append(words, word)
+		s = s[end:]
+	}
+}
+
+func parseGolden(p []byte) ([]*exchange, error) {
+	var exchanges []*exchange
+	var e *exchange
+	for i, text := range strings.Split(string(p), "\n") {
+		lineno := i + 1
+		text = strings.TrimSuffix(text, "\r")
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		bad := func(err error) error {
+			return fmt.Errorf("redigo: golden line %d: %v", lineno, err)
+		}
+		switch {
+		case strings.HasPrefix(text, "<"):
+			if e == nil || e.err != nil {
+				return nil, bad(errors.New("reply without command"))
+			}
+			line, err := unquoteGolden(strings.TrimPrefix(text[1:], " "))
+			if err != nil {
+				return nil, bad(err)
+			}
+			e.reply = append(append(e.reply, line...), "\r\n"...)
+		case strings.HasPrefix(text, "!"):
+			if e == nil || e.err != nil {
+				return nil, bad(errors.New("error without command"))
+			}
+			msg, err := unquoteGolden(strings.TrimPrefix(text[1:], " "))
+			if err != nil {
+				return nil, bad(err)
+			}
+			if strings.HasPrefix(msg, "-") {
+				e.err = Error(msg[1:])
+			} else {
+				e.err = errors.New(msg)
+			}
+		default:
+			words, err := splitWords(text)
+			if err != nil {
+				return nil, bad(err)
+			}
+			e = &exchange{line: lineno, op: words[0], args: words[1:]}
+			switch e.op {
+			case "do", "send":
+			case "flush", "receive":
+				if len(e.args) != 0 {
+					return nil, bad(fmt.Errorf("unexpected arguments to %s", e.op))
+				}
+			default:
+				return nil, bad(fmt.Errorf("unknown operation %q", e.op))
+			}
+			exchanges = append(exchanges, e)
+		}
+	}
+	return exchanges, nil
+}
@@ -0,0 +1,107 @@
+package redis_test
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/swanwish/redigo/internal/fakeredis"
+	"github.com/swanwish/redigo/redis"
+)
+
+const recordGolden = `do SET greeting "hello world"
+< +OK
+send GET greeting
+send GET missing
+flush
+receive
+< $11
+< hello world
+receive
+< $-1
+do INCR greeting
+< -ERR value is not an integer or out of range
+do RPUSH list "a\r\nb" ""
+< :2
+do LRANGE list 0 -1
+< *2
+< $4
+< "a\r\nb"
+< $0
+<
+`
+
+func recordExchanges(c redis.Conn) []interface{} {
+	var results []interface{}
+	add := func(reply interface{}, err error) {
+		results = append(results, reply, err)
+	}
+	add(c.Do("SET", "greeting", "hello world"))
+	c.Send("GET", "greeting")
+	c.Send("GET", "missing")
+	c.Flush()
+	add(c.Receive())
+	add(c.Receive())
+	add(c.Do("INCR", "greeting"))
+	add(c.Do("RPUSH", "list", []byte("a\r\nb"), ""))
+	add(c.Do("LRANGE", "list", 0, -1))
+	return results
+}
+
+func TestRecordReplay(t *testing.T) {
+	s, err := fakeredis.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	c, err := redis.Dial("tcp", s.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	var buf bytes.Buffer
+	recorded := recordExchanges(redis.NewRecordingConn(c, &buf))
+	if buf.String() != recordGolden {
+		t.Errorf("recording is\n%s\nwant\n%s", buf.String(), recordGolden)
+	}
+
+	rc, err := redis.NewReplayConn(strings.NewReader(recordGolden))
+	if err != nil {
+		t.Fatal(err)
+	}
+	replayed := recordExchanges(rc)
+	if !reflect.DeepEqual(replayed, recorded) {
+		t.Errorf("replayed %#v, want %#v", replayed, recorded)
+	}
+	if err := rc.Close(); err != nil {
+		t.Errorf("Close() returned %v", err)
+	}
+}
+
+func TestReplayDivergence(t *testing.T) {
+	rc, err := redis.NewReplayConn(strings.NewReader(recordGolden))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rc.Do("SET", "greeting", "hello world"); err != nil {
+		t.Fatal(err)
+	}
+	err = rc.Send("GET", "other")
+	if err == nil || !strings.Contains(err.Error(), "line 3: got send GET other, want send GET greeting") {
+		t.Errorf("Send returned %v, want divergence error", err)
+	}
+	if rc.Err() == nil {
+		t.Error("Err() returned nil after divergence")
+	}
+
+	rc, _ = redis.NewReplayConn(strings.NewReader(recordGolden))
+	if err := rc.Close(); err == nil {
+		t.Error("Close() returned nil with exchanges left")
+	}
+
+	if _, err := redis.NewReplayConn(strings.NewReader("< +OK\n")); err == nil {
+		t.Error("NewReplayConn accepted a reply without a command")
+	}
+}
@@ -3,12 +3,48 @@ package redis
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
+	"strconv"
 	"time"
 )
 
 type RedisClient struct {
 	pool         *Pool
 	ErrorHandler func(err error)
+
+	// RetryPolicy specifies how commands that fail with a transient error
+	// are retried. If nil, then commands are not retried.
+	RetryPolicy *RetryPolicy
+
+	// AutoPipeline optionally batches concurrent commands executed with Do
+	// and the typed helpers. If nil, then each command borrows a connection
+	// from the pool.
+	AutoPipeline *AutoPipeline
+
+	// Codec encodes and decodes the values of SetValue, GetValue and the
+	// other value helpers. If nil, then JSONCodec is used by the value
+	// helpers and the generic accessors such as GetAs convert values using
+	// the rules of Scan.
+	Codec Codec
+
+	// Encryption encrypts the struct fields with the encrypt tag option in
+	// HMSetObject and decrypts them in HGetAllToStruct and HMGetToStruct:
+	//
+	//	SSN string `redis:"ssn,encrypt"`
+	//
+	// To encrypt the values of SetValue and the other value helpers, set
+	// Codec to an EncryptionCodec.
+	Encryption *EncryptionCodec
+
+	// TagKeyPrefix is the prefix of the keys of the sorted sets that record
+	// the keys tagged by SetWithTags. If empty, then DefaultTagKeyPrefix is
+	// used. Applications that share a database should use different
+	// prefixes or namespaces. Like other keys, the tag keys are prefixed by
+	// the namespace of WithNamespace.
+	TagKeyPrefix string
+
+	// namespace is the key prefix set by WithNamespace.
+	namespace string
 }
 
 const (
@@ -47,6 +83,13 @@ func GetRedisClient(addr, pass string, maxIdle, maxActive int, dialOptions ...Di
 	return nil
 }
 
+// NewRedisClient returns a client that executes commands on connections from
+// pool. Use NewRedisClient instead of GetRedisClient to configure pool
+// options such as a CircuitBreaker.
+func NewRedisClient(pool *Pool) *RedisClient {
+	return &RedisClient{pool: pool}
+}
+
 var ErrInternalError = errors.New("Internal error")
 
 const (
@@ -62,33 +105,58 @@ const (
 const (
 	HDel         = "HDEL"
 	HExists      = "HEXISTS"
+	HExpire      = "HEXPIRE"
+	HExpireAt    = "HEXPIREAT"
+	HExpireTime  = "HEXPIRETIME"
 	HGet         = "HGET"
 	HGetAll      = "HGETALL"
+	HGetDel      = "HGETDEL"
+	HGetEx       = "HGETEX"
 	HIncrBy      = "HINCRBY"
 	HIncrByFloat = "HINCRBYFLOAT"
 	HKeys        = "HKEYS"
 	HLen         = "HLEN"
 	HMGet        = "HMGET"
 	HMSet        = "HMSET"
+	HPersist     = "HPERSIST"
+	HPExpire     = "HPEXPIRE"
+	HPExpireAt   = "HPEXPIREAT"
+	HPExpireTime = "HPEXPIRETIME"
+	HPTTL        = "HPTTL"
+	HRandField   = "HRANDFIELD"
+	HScan        = "HSCAN"
 	HSet         = "HSET"
+	HSetEx       = "HSETEX"
 	HSetNX       = "HSETNX"
 	HStrLen      = "HSTRLEN"
+	HTTL         = "HTTL"
 	HVals        = "HVALS"
 )
 
 // Sorted CmdSet
 const (
+	BZMPop           = "BZMPOP"
+	BZPopMax         = "BZPOPMAX"
+	BZPopMin         = "BZPOPMIN"
 	ZAdd             = "ZADD"
 	ZCard            = "ZCARD"
 	ZCount           = "ZCOUNT"
+	ZDiff            = "ZDIFF"
+	ZDiffStore       = "ZDIFFSTORE"
 	ZLexCount        = "ZLEXCOUNT"
 	ZIncBy           = "ZINCRBY"
+	ZInter           = "ZINTER"
+	ZInterCard       = "ZINTERCARD"
 	ZInterStore      = "ZINTERSTORE"
+	ZMPop            = "ZMPOP"
+	ZMScore          = "ZMSCORE"
 	ZPopMax          = "ZPOPMAX"
 	ZPopMin          = "ZPOPMIN"
+	ZRandMember      = "ZRANDMEMBER"
 	ZRange           = "ZRANGE"
 	ZRangeByLex      = "ZRANGEBYLEX"
 	ZRangeByScore    = "ZRANGEBYSCORE"
+	ZRangeStore      = "ZRANGESTORE"
 	ZRank            = "ZRANK"
 	ZRem             = "ZREM"
 	ZRemRangeByLex   = "ZREMRANGEBYLEX"
@@ -99,6 +167,7 @@ const (
 	ZRevRangeByScore = "ZREVRANGEBYSCORE"
 	ZRevRank         = "ZREVRANK"
 	ZScore           = "ZSCORE"
+	ZUnion           = "ZUNION"
 	ZUnionStore      = "ZUNIONSTORE"
 )
 
@@ -113,10 +182,13 @@ const (
 	CmdGet         = "GET"
 	CmdGetBit      = "GETBIT"
 	CmdGetRange    = "GETRANGE"
+	CmdGetDel      = "GETDEL"
+	CmdGetEx       = "GETEX"
 	CmdGetSet      = "GETSET"
 	CmdIncr        = "INCR"
 	CmdIncrBy      = "INCRBY"
 	CmdIncrByFloat = "INCRBYFLOAT"
+	CmdLCS         = "LCS"
 	CmdMGet        = "MGET"
 	CmdMSet        = "MSET"
 	CmdMSetNX      = "MSETNX"
@@ -147,13 +219,18 @@ const (
 
 // List
 const (
+	CmdBLMove     = "BLMOVE"
+	CmdBLMPop     = "BLMPOP"
 	CmdBLPop      = "BLPOP"
 	CmdBRPop      = "BRPOP"
 	CmdBRPopLPush = "BRPOPLPUSH"
 	CmdLIndex     = "LINDEX"
 	CmdLInsert    = "LINSERT"
 	CmdLLen       = "LLEN"
+	CmdLMove      = "LMOVE"
+	CmdLMPop      = "LMPOP"
 	CmdLPop       = "LPOP"
+	CmdLPos       = "LPOS"
 	CmdLPush      = "LPUSH"
 	CmdLPushX     = "LPUSHX"
 	CmdLRange     = "LRANGE"
@@ -166,6 +243,12 @@ const (
 	CmdRPushX     = "RPUSHX"
 )
 
+// Stream
+const (
+	CmdXAdd   = "XADD"
+	CmdXRange = "XRANGE"
+)
+
 // Database
 const (
 	CmdDel       = "DEL"
@@ -194,27 +277,53 @@ const (
 	CmdWatch   = "WATCH"
 )
 
+// Pub/Sub
 const (
-	ParamXX         = "XX"
-	ParamNX         = "NX"
-	ParamCH         = "CH"
-	ParamINCR       = "INCR"
-	ParamWeights    = "WEIGHTS"
-	ParamAggregate  = "AGGREGATE"
-	ParamWithScores = "WITHSCORES"
-	ParamLimit      = "LIMIT"
-	ParamAnd        = "AND"
-	ParamOr         = "OR"
-	ParamXOR        = "XOR"
-	ParamNot        = "NOT"
-	ParamPX         = "PX"
-	ParamEX         = "EX"
-	ParamBefore     = "BEFORE"
-	ParamAfter      = "AFTER"
-	ParamMinimum    = "-inf"
-	ParamMaximum    = "+inf"
-	ParamMatch      = "MATCH"
-	ParamCount      = "COUNT"
+	CmdPublish = "PUBLISH"
+)
+
+const (
+	ParamXX           = "XX"
+	ParamNX           = "NX"
+	ParamCH           = "CH"
+	ParamINCR         = "INCR"
+	ParamWeights      = "WEIGHTS"
+	ParamAggregate    = "AGGREGATE"
+	ParamWithScores   = "WITHSCORES"
+	ParamLimit        = "LIMIT"
+	ParamAnd          = "AND"
+	ParamOr           = "OR"
+	ParamXOR          = "XOR"
+	ParamNot          = "NOT"
+	ParamPX           = "PX"
+	ParamEX           = "EX"
+	ParamBefore       = "BEFORE"
+	ParamAfter        = "AFTER"
+	ParamMinimum      = "-inf"
+	ParamMaximum      = "+inf"
+	ParamMatch        = "MATCH"
+	ParamCount        = "COUNT"
+	ParamMaxLen       = "MAXLEN"
+	ParamRank         = "RANK"
+	ParamByScore      = "BYSCORE"
+	ParamByLex        = "BYLEX"
+	ParamRev          = "REV"
+	ParamEXAT         = "EXAT"
+	ParamPXAT         = "PXAT"
+	ParamKeepTTL      = "KEEPTTL"
+	ParamGet          = "GET"
+	ParamPersist      = "PERSIST"
+	ParamLen          = "LEN"
+	ParamIdx          = "IDX"
+	ParamMinMatchLen  = "MINMATCHLEN"
+	ParamWithMatchLen = "WITHMATCHLEN"
+	ParamGT           = "GT"
+	ParamLT           = "LT"
+	ParamFields       = "FIELDS"
+	ParamFNX          = "FNX"
+	ParamFXX          = "FXX"
+	ParamWithValues   = "WITHVALUES"
+	ParamNoValues     = "NOVALUES"
 )
 
 func (client *RedisClient) GetConn() (Conn, error) {
@@ -226,19 +335,33 @@ func (client *RedisClient) GetConn() (Conn, error) {
 		//logs.Errorf("The connection pool does not exists")
 		return nil, ErrInternalError
 	}
-	return client.pool.Get(), nil
+	conn := client.pool.Get()
+	if _, ok := conn.(errorConn); !ok && client.namespace != "" {
+		conn = NewNamespacedConn(conn, client.namespace)
+	}
+	return conn, nil
 }
 
-func (client *RedisClient) Do(commandName string, args ...interface{}) (reply interface{}, err error) {
-	conn, err := client.GetConn()
-	if err != nil {
-		return 0, err
+func (client *RedisClient) circuitBreaker() *CircuitBreaker {
+	if client == nil || client.pool == nil {
+		return nil
 	}
-	defer func() {
-		_ = conn.Close()
-	}()
+	return client.pool.CircuitBreaker
+}
 
-	result, err := conn.Do(commandName, args...)
+func (client *RedisClient) Do(commandName string, args ...interface{}) (reply interface{}, err error) {
+	var result interface{}
+	if ap := client.AutoPipeline; ap != nil && client.pool != nil && ap.accepts(commandName, args) {
+		if client.namespace != "" {
+			result, err = client.doNamespaced(commandName, args, client.doPipelined)
+		} else {
+			result, err = client.doPipelined(commandName, args)
+		}
+	} else {
+		result, err = client.doWithRetry(commandName, args, func(conn Conn) (interface{}, error) {
+			return conn.Do(commandName, args...)
+		})
+	}
 	if err != nil && client.ErrorHandler != nil {
 		client.ErrorHandler(err)
 	}
@@ -246,15 +369,9 @@ func (client *RedisClient) Do(commandName string, args ...interface{}) (reply in
 }
 
 func (client *RedisClient) DoWithTimeout(timeout time.Duration, cmd string, args ...interface{}) (interface{}, error) {
-	conn, err := client.GetConn()
-	if err != nil {
-		return 0, err
-	}
-	defer func() {
-		_ = conn.Close()
-	}()
-
-	result, err := DoWithTimeout(conn, timeout, cmd, args...)
+	result, err := client.doWithRetry(cmd, args, func(conn Conn) (interface{}, error) {
+		return DoWithTimeout(conn, timeout, cmd, args...)
+	})
 	if err != nil && client.ErrorHandler != nil {
 		client.ErrorHandler(err)
 	}
@@ -333,6 +450,30 @@ func formatSec(dur time.Duration) int64 {
 	return int64(dur / time.Second)
 }
 
+// blockingTimeoutMargin is added to the read timeout of blocking commands,
+// so that the reply of a command that times out on the server is not lost
+// to a client-side timeout.
+const blockingTimeoutMargin = 10 * time.Second
+
+// blockingReadTimeout returns the read timeout of a command that blocks on
+// the server for at most timeout. Zero timeout blocks indefinitely.
+func blockingReadTimeout(timeout time.Duration) time.Duration {
+	if timeout <= 0 {
+		return 0
+	}
+	return timeout + blockingTimeoutMargin
+}
+
+// formatTimeout formats the timeout of a blocking command in seconds.
+// Timeouts with a fraction of a second are sent as decimals, which requires
+// Redis 6.0 or later.
+func formatTimeout(dur time.Duration) interface{} {
+	if dur%time.Second == 0 {
+		return formatSec(dur)
+	}
+	return strconv.FormatFloat(dur.Seconds(), 'f', -1, 64)
+}
+
 // ---------------------------Database---------------------------
 
 func (client *RedisClient) Del(keys ...string) (int64, error) {
@@ -567,19 +708,6 @@ func (client *RedisClient) Scan(cursor uint64, match string, count int64) (uint6
 //	return cmd
 //}
 //
-//func (client *RedisClient) HScan(key string, cursor uint64, match string, count int64) *ScanCmd {
-//	args := []interface{}{"hscan", key, cursor}
-//	if match != "" {
-//		args = append(args, "match", match)
-//	}
-//	if count > 0 {
-//		args = append(args, "count", count)
-//	}
-//	cmd := NewScanCmd(c.process, args...)
-//	c.process(cmd)
-//	return cmd
-//}
-//
 //func (client *RedisClient) ZScan(key string, cursor uint64, match string, count int64) *ScanCmd {
 //	args := []interface{}{"zscan", key, cursor}
 //	if match != "" {
@@ -624,6 +752,9 @@ func (client *RedisClient) HGetAllToStruct(dest interface{}, key string) error {
 	if len(values) == 0 {
 		return ErrNil
 	}
+	if err := client.decryptFields(key, dest, values); err != nil {
+		return err
+	}
 	return ScanStruct(values, dest)
 }
 
@@ -661,7 +792,16 @@ func (client *RedisClient) HMGetToStruct(dest interface{}, key string, fields ..
 		//logs.Errorf("Failed to get values, the error is %#v", err)
 		return err
 	}
-	return ScanStruct(values, dest)
+	pairs := make([]interface{}, 0, 2*len(values))
+	for i, v := range values {
+		if v != nil && i < len(fields) {
+			pairs = append(pairs, []byte(fields[i]), v)
+		}
+	}
+	if err := client.decryptFields(key, dest, pairs); err != nil {
+		return err
+	}
+	return ScanStruct(pairs, dest)
 }
 
 func (client *RedisClient) HMSet(key string, fields map[string]interface{}) (string, error) {
@@ -673,7 +813,31 @@ func (client *RedisClient) HMSet(key string, fields map[string]interface{}) (str
 }
 
 func (client *RedisClient) HMSetObject(key string, object interface{}) (string, error) {
-	return client.String(HMSet, Args{key}.AddFlat(object)...)
+	args, err := Args{key}.addFlat(object)
+	if err != nil {
+		return "", err
+	}
+	if err := client.encryptFields(key, object, args[1:]); err != nil {
+		return "", err
+	}
+	return client.String(HMSet, args...)
+}
+
+// HMSetObjectWithTTL is like HMSetObject, but sets the fields of the object
+// with HSETEX so that they expire after ttl. Fields of the hash that are not
+// written keep their TTLs. Zero ttl removes the TTLs of the written fields.
+func (client *RedisClient) HMSetObjectWithTTL(key string, object interface{}, ttl time.Duration) error {
+	pairs, err := Args{}.addFlat(object)
+	if err != nil {
+		return err
+	}
+	if err := client.encryptFields(key, object, pairs); err != nil {
+		return err
+	}
+	args := appendExpiration([]interface{}{key}, ttl, time.Time{})
+	args = append(args, ParamFields, len(pairs)/2)
+	_, err = client.Do(HSetEx, append(args, pairs...)...)
+	return err
 }
 
 func (client *RedisClient) HSet(key, field string, value interface{}) (bool, error) {
@@ -688,15 +852,220 @@ func (client *RedisClient) HVals(key string) ([]string, error) {
 	return client.StringSlice(HVals, key)
 }
 
+// HStrLen returns the length of the value of field in the hash stored at
+// key, or 0 if the field does not exist.
+func (client *RedisClient) HStrLen(key, field string) (int64, error) {
+	return client.Int64(HStrLen, key, field)
+}
+
+// HScan returns the next cursor and a page of the fields and values of the
+// hash stored at key, alternating field and value. The iteration starts and
+// ends with cursor 0.
+func (client *RedisClient) HScan(key string, cursor uint64, match string, count int64) (uint64, []string, error) {
+	args := []interface{}{key, cursor}
+	if match != "" {
+		args = append(args, ParamMatch, match)
+	}
+	if count > 0 {
+		args = append(args, ParamCount, count)
+	}
+	return client.ScanValues(HScan, args...)
+}
+
+// HRandField returns up to count distinct random fields of the hash stored
+// at key. A negative count allows the same field more than once and returns
+// exactly -count fields.
+func (client *RedisClient) HRandField(key string, count int64) ([]string, error) {
+	return client.StringSlice(HRandField, key, count)
+}
+
+// HRandFieldWithValues is like HRandField, but also returns the values of
+// the fields. The fields returned more than once for a negative count
+// appear once in the map.
+func (client *RedisClient) HRandFieldWithValues(key string, count int64) (map[string]string, error) {
+	return client.StringMap(HRandField, key, count, ParamWithValues)
+}
+
+// appendFields appends the FIELDS numfields field... arguments of the hash
+// field expiration commands.
+func appendFields(args []interface{}, fields []string) []interface{} {
+	args = append(args, ParamFields, len(fields))
+	for _, field := range fields {
+		args = append(args, field)
+	}
+	return args
+}
+
+// hexpire sends a hash field expiration command. Mode is ParamNX, ParamXX,
+// ParamGT, ParamLT or empty.
+func (client *RedisClient) hexpire(commandName, key string, tm interface{}, mode string, fields []string) ([]int64, error) {
+	args := []interface{}{key, tm}
+	if mode != "" {
+		args = append(args, mode)
+	}
+	return Int64s(client.Do(commandName, appendFields(args, fields)...))
+}
+
+// HExpire sets the TTL of fields in the hash stored at key and returns a
+// status code per field: -2 if the field does not exist, 0 if the condition
+// of mode is not met, 1 if the TTL was set and 2 if the field was deleted
+// because ttl is zero. Mode is ParamNX to set only fields without a TTL,
+// ParamXX for fields with a TTL, ParamGT and ParamLT for a TTL greater or
+// less than the current one, or empty to always set the TTL. A ttl that is
+// not a whole number of seconds is sent with HPEXPIRE, so that a positive
+// ttl under a second does not delete the fields.
+func (client *RedisClient) HExpire(key string, ttl time.Duration, mode string, fields ...string) ([]int64, error) {
+	if ttl > 0 && usePrecise(ttl) {
+		return client.HPExpire(key, ttl, mode, fields...)
+	}
+	return client.hexpire(HExpire, key, formatSec(ttl), mode, fields)
+}
+
+// HPExpire is like HExpire, but with millisecond precision.
+func (client *RedisClient) HPExpire(key string, ttl time.Duration, mode string, fields ...string) ([]int64, error) {
+	return client.hexpire(HPExpire, key, formatMs(ttl), mode, fields)
+}
+
+// HExpireAt is like HExpire, but the fields expire at tm. Fields are
+// deleted if tm is in the past.
+func (client *RedisClient) HExpireAt(key string, tm time.Time, mode string, fields ...string) ([]int64, error) {
+	return client.hexpire(HExpireAt, key, tm.Unix(), mode, fields)
+}
+
+// HPExpireAt is like HExpireAt, but with millisecond precision.
+func (client *RedisClient) HPExpireAt(key string, tm time.Time, mode string, fields ...string) ([]int64, error) {
+	return client.hexpire(HPExpireAt, key, tm.UnixNano()/int64(time.Millisecond), mode, fields)
+}
+
+// HTTL returns the remaining TTL in seconds of fields in the hash stored at
+// key. The TTL of a field is -2 if the field does not exist and -1 if the
+// field has no TTL.
+func (client *RedisClient) HTTL(key string, fields ...string) ([]int64, error) {
+	return Int64s(client.Do(HTTL, appendFields([]interface{}{key}, fields)...))
+}
+
+// HPTTL is like HTTL, but returns the TTLs in milliseconds.
+func (client *RedisClient) HPTTL(key string, fields ...string) ([]int64, error) {
+	return Int64s(client.Do(HPTTL, appendFields([]interface{}{key}, fields)...))
+}
+
+// HExpireTime is like HTTL, but returns the Unix times in seconds at which
+// the fields expire.
+func (client *RedisClient) HExpireTime(key string, fields ...string) ([]int64, error) {
+	return Int64s(client.Do(HExpireTime, appendFields([]interface{}{key}, fields)...))
+}
+
+// HPExpireTime is like HExpireTime, but returns the times in milliseconds.
+func (client *RedisClient) HPExpireTime(key string, fields ...string) ([]int64, error) {
+	return Int64s(client.Do(HPExpireTime, appendFields([]interface{}{key}, fields)...))
+}
+
+// HPersist removes the TTL of fields in the hash stored at key and returns a
+// status code per field: -2 if the field does not exist, -1 if the field
+// has no TTL and 1 if the TTL was removed.
+func (client *RedisClient) HPersist(key string, fields ...string) ([]int64, error) {
+	return Int64s(client.Do(HPersist, appendFields([]interface{}{key}, fields)...))
+}
+
+// HGetDel returns the values of fields in the hash stored at key and
+// deletes the fields. The value of a field that does not exist is empty.
+// The key is deleted when the hash becomes empty.
+func (client *RedisClient) HGetDel(key string, fields ...string) ([]string, error) {
+	return client.StringSlice(HGetDel, appendFields([]interface{}{key}, fields)...)
+}
+
+// HGetEx returns the values of fields in the hash stored at key and sets or
+// removes the TTL of the fields with the options in a. The value of a field
+// that does not exist is empty.
+func (client *RedisClient) HGetEx(key string, a GetExArgs, fields ...string) ([]string, error) {
+	args := []interface{}{key}
+	if a.Persist {
+		args = append(args, ParamPersist)
+	} else {
+		args = appendExpiration(args, a.TTL, a.ExpireAt)
+	}
+	return client.StringSlice(HGetEx, appendFields(args, fields)...)
+}
+
+// HSetExArgs contains the options of HSetEx. The zero value sets the fields
+// without a TTL.
+type HSetExArgs struct {
+	// Mode is ParamFNX to set the fields only if none of them exist or
+	// ParamFXX to set them only if all of them exist. Empty sets the fields
+	// unconditionally.
+	Mode string
+
+	// TTL sets the TTL of the fields. ExpireAt sets the expiration time as a
+	// point in time and takes precedence over TTL.
+	TTL      time.Duration
+	ExpireAt time.Time
+
+	// KeepTTL keeps the TTLs of existing fields.
+	KeepTTL bool
+}
+
+// HSetEx sets fields in the hash stored at key with the options in a and
+// reports whether the fields were set, which is false when the condition of
+// a.Mode is not met.
+func (client *RedisClient) HSetEx(key string, a HSetExArgs, fields map[string]interface{}) (bool, error) {
+	args := []interface{}{key}
+	if a.Mode != "" {
+		args = append(args, a.Mode)
+	}
+	if a.KeepTTL {
+		args = append(args, ParamKeepTTL)
+	} else {
+		args = appendExpiration(args, a.TTL, a.ExpireAt)
+	}
+	args = append(args, ParamFields, len(fields))
+	for field, value := range fields {
+		args = append(args, field, value)
+	}
+	return client.Bool(HSetEx, args...)
+}
+
 // ---------------------------List---------------------------
 
+// ListDirection selects the end of a list in LMove, BLMove, LMPop and
+// BLMPop.
+type ListDirection string
+
+const (
+	// ListLeft is the head of a list.
+	ListLeft ListDirection = "LEFT"
+
+	// ListRight is the tail of a list.
+	ListRight ListDirection = "RIGHT"
+)
+
+// LPosArgs contains the options of LPos and LPosCount.
+type LPosArgs struct {
+	// Rank selects the match to return: 2 skips the first match, -1
+	// searches from the tail. Zero means the first match.
+	Rank int64
+
+	// MaxLen limits the number of elements compared. Zero compares all
+	// elements.
+	MaxLen int64
+}
+
+func (a LPosArgs) appendArgs(args []interface{}) []interface{} {
+	if a.Rank != 0 {
+		args = append(args, ParamRank, a.Rank)
+	}
+	if a.MaxLen > 0 {
+		args = append(args, ParamMaxLen, a.MaxLen)
+	}
+	return args
+}
+
 func (client *RedisClient) BLPop(timeout time.Duration, keys ...string) ([]string, error) {
 	var args []interface{}
 	for _, key := range keys {
 		args = append(args, key)
 	}
-	args = append(args, formatSec(timeout))
-	return client.StringSliceWithTimeout(timeout, CmdBLPop, args...)
+	args = append(args, formatTimeout(timeout))
+	return client.StringSliceWithTimeout(blockingReadTimeout(timeout), CmdBLPop, args...)
 }
 
 func (client *RedisClient) BRPop(timeout time.Duration, keys ...string) ([]string, error) {
@@ -704,12 +1073,58 @@ func (client *RedisClient) BRPop(timeout time.Duration, keys ...string) ([]strin
 	for _, key := range keys {
 		args = append(args, key)
 	}
-	args = append(args, formatSec(timeout))
-	return client.StringSliceWithTimeout(timeout, CmdBRPop, args...)
+	args = append(args, formatTimeout(timeout))
+	return client.StringSliceWithTimeout(blockingReadTimeout(timeout), CmdBRPop, args...)
 }
 
+// BRPopLPush is the blocking variant of RPopLPush.
+//
+// Deprecated: Use BLMove with ListRight and ListLeft.
 func (client *RedisClient) BRPopLPush(source, destination string, timeout time.Duration) (string, error) {
-	return client.StringWithTimeout(timeout, CmdBRPopLPush, source, destination, formatSec(timeout))
+	return client.StringWithTimeout(blockingReadTimeout(timeout), CmdBRPopLPush, source, destination, formatTimeout(timeout))
+}
+
+// BLMove is the blocking variant of LMove. BLMove returns ErrNil if the
+// source list is empty when the timeout expires. Zero timeout blocks
+// indefinitely.
+func (client *RedisClient) BLMove(source, destination string, srcDir, destDir ListDirection, timeout time.Duration) (string, error) {
+	return client.StringWithTimeout(blockingReadTimeout(timeout), CmdBLMove, source, destination, string(srcDir), string(destDir), formatTimeout(timeout))
+}
+
+// BLMPop is the blocking variant of LMPop. BLMPop returns ErrNil if the
+// lists are empty when the timeout expires. Zero timeout blocks
+// indefinitely.
+func (client *RedisClient) BLMPop(timeout time.Duration, direction ListDirection, count int64, keys ...string) (string, []string, error) {
+	args := []interface{}{formatTimeout(timeout), len(keys)}
+	for _, key := range keys {
+		args = append(args, key)
+	}
+	args = append(args, string(direction))
+	if count > 0 {
+		args = append(args, ParamCount, count)
+	}
+	return keyElements(client.DoWithTimeout(blockingReadTimeout(timeout), CmdBLMPop, args...))
+}
+
+// keyElements converts the reply of LMPOP and BLMPOP to the key and the
+// popped elements.
+func keyElements(reply interface{}, err error) (string, []string, error) {
+	values, err := Values(reply, err)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(values) != 2 {
+		return "", nil, fmt.Errorf("redigo: unexpected number of values in key and elements reply, got %d", len(values))
+	}
+	key, err := String(values[0], nil)
+	if err != nil {
+		return "", nil, err
+	}
+	elements, err := Strings(values[1], nil)
+	if err != nil {
+		return "", nil, err
+	}
+	return key, elements, nil
 }
 
 func (client *RedisClient) LIndex(key string, index int64) (string, error) {
@@ -732,10 +1147,52 @@ func (client *RedisClient) LLen(key string) (int64, error) {
 	return client.Int64(CmdLLen, key)
 }
 
+// LMove atomically pops an element from the srcDir end of the source list,
+// pushes it to the destDir end of the destination list and returns the
+// element. LMove returns ErrNil if the source list is empty.
+func (client *RedisClient) LMove(source, destination string, srcDir, destDir ListDirection) (string, error) {
+	return client.String(CmdLMove, source, destination, string(srcDir), string(destDir))
+}
+
+// LMPop pops up to count elements from the direction end of the first
+// non-empty list of keys and returns the key of the list and the elements.
+// Zero count pops one element. LMPop returns ErrNil if all lists are empty.
+func (client *RedisClient) LMPop(direction ListDirection, count int64, keys ...string) (string, []string, error) {
+	args := []interface{}{len(keys)}
+	for _, key := range keys {
+		args = append(args, key)
+	}
+	args = append(args, string(direction))
+	if count > 0 {
+		args = append(args, ParamCount, count)
+	}
+	return keyElements(client.Do(CmdLMPop, args...))
+}
+
 func (client *RedisClient) LPop(key string) (string, error) {
 	return client.String(CmdLPop, key)
 }
 
+// LPopCount pops up to count elements from the head of the list stored at
+// key. LPopCount returns ErrNil if the list does not exist.
+func (client *RedisClient) LPopCount(key string, count int64) ([]string, error) {
+	return client.StringSlice(CmdLPop, key, count)
+}
+
+// LPos returns the index of the first element of the list stored at key
+// that is equal to element. LPos returns ErrNil if there is no match.
+func (client *RedisClient) LPos(key string, element interface{}, a LPosArgs) (int64, error) {
+	return client.Int64(CmdLPos, a.appendArgs([]interface{}{key, element})...)
+}
+
+// LPosCount returns the indexes of up to count elements of the list stored
+// at key that are equal to element. Zero count returns all matches.
+func (client *RedisClient) LPosCount(key string, element interface{}, count int64, a LPosArgs) ([]int64, error) {
+	args := a.appendArgs([]interface{}{key, element})
+	args = append(args, ParamCount, count)
+	return Int64s(client.Do(CmdLPos, args...))
+}
+
 func (client *RedisClient) LPush(key string, values ...interface{}) (int64, error) {
 	args := []interface{}{key}
 	for _, value := range values {
@@ -768,6 +1225,16 @@ func (client *RedisClient) RPop(key string) (string, error) {
 	return client.String(CmdRPop, key)
 }
 
+// RPopCount pops up to count elements from the tail of the list stored at
+// key. RPopCount returns ErrNil if the list does not exist.
+func (client *RedisClient) RPopCount(key string, count int64) ([]string, error) {
+	return client.StringSlice(CmdRPop, key, count)
+}
+
+// RPopLPush atomically pops the tail of the source list and pushes it to the
+// head of the destination list.
+//
+// Deprecated: Use LMove with ListRight and ListLeft.
 func (client *RedisClient) RPopLPush(source, destination string) (string, error) {
 	return client.String(CmdRPopLPush, source, destination)
 }
@@ -901,7 +1368,7 @@ type Z struct {
 	Member interface{}
 }
 
-// ZStore is used as an arg to ZInterStore and ZUnionStore.
+// ZStore is used as an arg to ZInter, ZInterStore, ZUnion and ZUnionStore.
 type ZStore struct {
 	Weights []float64
 	// Can be SUM, MIN or MAX.
@@ -1003,20 +1470,7 @@ func (client *RedisClient) ZIncrBy(key string, increment float64, member string)
 }
 
 func (client *RedisClient) ZInterStore(destination string, store ZStore, keys ...string) (int64, error) {
-	args := []interface{}{destination, len(keys)}
-	for _, key := range keys {
-		args = append(args, key)
-	}
-	if len(store.Weights) > 0 {
-		args = append(args, ParamWeights)
-		for _, weight := range store.Weights {
-			args = append(args, weight)
-		}
-	}
-	if store.Aggregate != "" {
-		args = append(args, ParamAggregate, store.Aggregate)
-	}
-	return client.Int64(ZInterStore, args...)
+	return client.Int64(ZInterStore, store.appendArgs([]interface{}{destination}, keys)...)
 }
 
 func (client *RedisClient) zRange(key string, start, stop int64) ([]string, error) {
@@ -1168,7 +1622,89 @@ func (client *RedisClient) ZScore(key, member string) (float64, error) {
 }
 
 func (client *RedisClient) ZUnionStore(dest string, store ZStore, keys ...string) (int64, error) {
-	args := []interface{}{dest, len(keys)}
+	return client.Int64(ZUnionStore, store.appendArgs([]interface{}{dest}, keys)...)
+}
+
+// ZRangeArgs contains the arguments of the ZRANGE command of Redis 6.2.
+type ZRangeArgs struct {
+	// Start and Stop are ranks, or scores with ByScore, or lexicographical
+	// bounds such as "[a" with ByLex. Scores can be exclusive, such as
+	// "(1", or infinite, such as ParamMinimum. With Rev and ByScore or
+	// ByLex, Start is the upper bound.
+	Start, Stop interface{}
+
+	ByScore bool
+	ByLex   bool
+
+	// Rev orders the members from the highest to the lowest score.
+	Rev bool
+
+	// Offset and Count limit the members of a ByScore or ByLex range. A
+	// negative Count returns all members from Offset. Redis does not limit
+	// ranges of ranks, so ZRangeArgs and ZRangeStore return an error if
+	// Offset or Count is set without ByScore or ByLex.
+	Offset, Count int64
+
+	// WithScores returns the scores of the members. WithScores is ignored
+	// by ZRangeStore.
+	WithScores bool
+}
+
+var errZRangeLimit = errors.New("redigo: ZRangeArgs Offset and Count require ByScore or ByLex")
+
+func (a ZRangeArgs) appendArgs(args []interface{}) ([]interface{}, error) {
+	if !a.ByScore && !a.ByLex && (a.Offset != 0 || a.Count != 0) {
+		return nil, errZRangeLimit
+	}
+	args = append(args, a.Start, a.Stop)
+	if a.ByScore {
+		args = append(args, ParamByScore)
+	} else if a.ByLex {
+		args = append(args, ParamByLex)
+	}
+	if a.Rev {
+		args = append(args, ParamRev)
+	}
+	if (a.ByScore || a.ByLex) && (a.Offset != 0 || a.Count != 0) {
+		args = append(args, ParamLimit, a.Offset, a.Count)
+	}
+	return args, nil
+}
+
+// ZRangeArgs returns the members of the sorted set stored at key in the
+// range given by a. The scores are set if a.WithScores is set.
+func (client *RedisClient) ZRangeArgs(key string, a ZRangeArgs) ([]ZItem, error) {
+	args, err := a.appendArgs([]interface{}{key})
+	if err != nil {
+		return nil, err
+	}
+	if a.WithScores {
+		return client.ZItemList(ZRange, append(args, ParamWithScores)...)
+	}
+	members, err := client.StringSlice(ZRange, args...)
+	if err != nil {
+		return nil, err
+	}
+	items := make([]ZItem, len(members))
+	for i, member := range members {
+		items[i].Member = member
+	}
+	return items, nil
+}
+
+// ZRangeStore stores the members of the sorted set stored at source in the
+// range given by a in the destination sorted set and returns the number of
+// members in the destination.
+func (client *RedisClient) ZRangeStore(destination, source string, a ZRangeArgs) (int64, error) {
+	args, err := a.appendArgs([]interface{}{destination, source})
+	if err != nil {
+		return 0, err
+	}
+	return client.Int64(ZRangeStore, args...)
+}
+
+func (store ZStore) appendArgs(args []interface{}, keys []string) []interface{} {
+	args = append(args, len(keys))
 	for _, key := range keys {
 		args = append(args, key)
 	}
@@ -1181,7 +1717,257 @@ func (client *RedisClient) ZUnionStore(dest string, store ZStore, keys ...string
 	if store.Aggregate != "" {
 		args = append(args, ParamAggregate, store.Aggregate)
 	}
-	return client.Int64(ZUnionStore, args...)
+	return args
+}
+
+// ZInter returns the members of the intersection of the sorted sets stored
+// at keys.
+func (client *RedisClient) ZInter(store ZStore, keys ...string) ([]string, error) {
+	return client.StringSlice(ZInter, store.appendArgs(nil, keys)...)
+}
+
+// ZInterWithScores returns the members and the scores of the intersection
+// of the sorted sets stored at keys.
+func (client *RedisClient) ZInterWithScores(store ZStore, keys ...string) ([]ZItem, error) {
+	args := append(store.appendArgs(nil, keys), ParamWithScores)
+	return client.ZItemList(ZInter, args...)
+}
+
+// ZInterCard returns the number of members in the intersection of the
+// sorted sets stored at keys. A positive limit stops the computation when
+// the cardinality reaches limit.
+func (client *RedisClient) ZInterCard(limit int64, keys ...string) (int64, error) {
+	args := ZStore{}.appendArgs(nil, keys)
+	if limit > 0 {
+		args = append(args, ParamLimit, limit)
+	}
+	return client.Int64(ZInterCard, args...)
+}
+
+// ZUnion returns the members of the union of the sorted sets stored at
+// keys.
+func (client *RedisClient) ZUnion(store ZStore, keys ...string) ([]string, error) {
+	return client.StringSlice(ZUnion, store.appendArgs(nil, keys)...)
+}
+
+// ZUnionWithScores returns the members and the scores of the union of the
+// sorted sets stored at keys.
+func (client *RedisClient) ZUnionWithScores(store ZStore, keys ...string) ([]ZItem, error) {
+	args := append(store.appendArgs(nil, keys), ParamWithScores)
+	return client.ZItemList(ZUnion, args...)
+}
+
+// ZDiff returns the members of the first sorted set of keys that are not in
+// the other sorted sets.
+func (client *RedisClient) ZDiff(keys ...string) ([]string, error) {
+	return client.StringSlice(ZDiff, ZStore{}.appendArgs(nil, keys)...)
+}
+
+// ZDiffWithScores returns the members and the scores of the first sorted
+// set of keys that are not in the other sorted sets.
+func (client *RedisClient) ZDiffWithScores(keys ...string) ([]ZItem, error) {
+	args := append(ZStore{}.appendArgs(nil, keys), ParamWithScores)
+	return client.ZItemList(ZDiff, args...)
+}
+
+// ZDiffStore stores the result of ZDiff in destination and returns the
+// number of members in destination.
+func (client *RedisClient) ZDiffStore(destination string, keys ...string) (int64, error) {
+	return client.Int64(ZDiffStore, ZStore{}.appendArgs([]interface{}{destination}, keys)...)
+}
+
+// ZMScore returns the scores of members in the sorted set stored at key.
+// The score of a member that does not exist is nil.
+func (client *RedisClient) ZMScore(key string, members ...string) ([]*float64, error) {
+	args := []interface{}{key}
+	for _, member := range members {
+		args = append(args, member)
+	}
+	values, err := Values(client.Do(ZMScore, args...))
+	if err != nil {
+		return nil, err
+	}
+	scores := make([]*float64, len(values))
+	for i, v := range values {
+		if v == nil {
+			continue
+		}
+		score, err := Float64(v, nil)
+		if err != nil {
+			return nil, err
+		}
+		scores[i] = &score
+	}
+	return scores, nil
+}
+
+// ZRandMember returns up to count distinct random members of the sorted set
+// stored at key. A negative count allows the same member more than once
+// and returns exactly -count members.
+func (client *RedisClient) ZRandMember(key string, count int64) ([]string, error) {
+	return client.StringSlice(ZRandMember, key, count)
+}
+
+// ZRandMemberWithScores is like ZRandMember, but also returns the scores of
+// the members.
+func (client *RedisClient) ZRandMemberWithScores(key string, count int64) ([]ZItem, error) {
+	return client.ZItemList(ZRandMember, key, count, ParamWithScores)
+}
+
+// ZPopMin removes and returns up to count members with the lowest scores
+// in the sorted set stored at key.
+func (client *RedisClient) ZPopMin(key string, count int64) ([]ZItem, error) {
+	return client.ZItemList(ZPopMin, key, count)
+}
+
+// ZPopMax removes and returns up to count members with the highest scores
+// in the sorted set stored at key.
+func (client *RedisClient) ZPopMax(key string, count int64) ([]ZItem, error) {
+	return client.ZItemList(ZPopMax, key, count)
+}
+
+func (client *RedisClient) bzPop(zcmd string, timeout time.Duration, keys []string) (string, ZItem, error) {
+	var args []interface{}
+	for _, key := range keys {
+		args = append(args, key)
+	}
+	args = append(args, formatTimeout(timeout))
+	values, err := Values(client.DoWithTimeout(blockingReadTimeout(timeout), zcmd, args...))
+	if err != nil {
+		return "", ZItem{}, err
+	}
+	if len(values) != 3 {
+		return "", ZItem{}, fmt.Errorf("redigo: unexpected number of values in %s reply, got %d", zcmd, len(values))
+	}
+	key, err := String(values[0], nil)
+	if err != nil {
+		return "", ZItem{}, err
+	}
+	items, err := ZItemList(values[1:], nil)
+	if err != nil {
+		return "", ZItem{}, err
+	}
+	return key, items[0], nil
+}
+
+// BZPopMin is the blocking variant of ZPopMin. BZPopMin pops the member
+// with the lowest score from the first non-empty sorted set of keys and
+// returns the key and the member. BZPopMin returns ErrNil if the sorted
+// sets are empty when the timeout expires. Zero timeout blocks
+// indefinitely.
+func (client *RedisClient) BZPopMin(timeout time.Duration, keys ...string) (string, ZItem, error) {
+	return client.bzPop(BZPopMin, timeout, keys)
+}
+
+// BZPopMax is the blocking variant of ZPopMax. See BZPopMin.
+func (client *RedisClient) BZPopMax(timeout time.Duration, keys ...string) (string, ZItem, error) {
+	return client.bzPop(BZPopMax, timeout, keys)
+}
+
+// ZOrder selects the members with the lowest or the highest scores in
+// ZMPop and BZMPop.
+type ZOrder string
+
+const (
+	ZOrderMin ZOrder = "MIN"
+	ZOrderMax ZOrder = "MAX"
+)
+
+func zmpopArgs(args []interface{}, order ZOrder, count int64, keys []string) []interface{} {
+	args = append(args, len(keys))
+	for _, key := range keys {
+		args = append(args, key)
+	}
+	args = append(args, string(order))
+	if count > 0 {
+		args = append(args, ParamCount, count)
+	}
+	return args
+}
+
+// keyZItems converts the reply of ZMPOP and BZMPOP to the key and the
+// popped members.
+func keyZItems(reply interface{}, err error) (string, []ZItem, error) {
+	values, err := Values(reply, err)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(values) != 2 {
+		return "", nil, fmt.Errorf("redigo: unexpected number of values in key and members reply, got %d", len(values))
+	}
+	key, err := String(values[0], nil)
+	if err != nil {
+		return "", nil, err
+	}
+	pairs, err := Values(values[1], nil)
+	if err != nil {
+		return "", nil, err
+	}
+	items := make([]ZItem, len(pairs))
+	for i, pair := range pairs {
+		item, err := ZItemList(pair, nil)
+		if err != nil {
+			return "", nil, err
+		}
+		if len(item) != 1 {
+			return "", nil, errors.New("redigo: unexpected member in key and members reply")
+		}
+		items[i] = item[0]
+	}
+	return key, items, nil
+}
+
+// ZMPop pops up to count members with the lowest or highest scores, as
+// selected by order, from the first non-empty sorted set of keys and
+// returns the key and the members. Zero count pops one member. ZMPop
+// returns ErrNil if all sorted sets are empty.
+func (client *RedisClient) ZMPop(order ZOrder, count int64, keys ...string) (string, []ZItem, error) {
+	return keyZItems(client.Do(ZMPop, zmpopArgs(nil, order, count, keys)...))
+}
+
+// BZMPop is the blocking variant of ZMPop. BZMPop returns ErrNil if the
+// sorted sets are empty when the timeout expires. Zero timeout blocks
+// indefinitely.
+func (client *RedisClient) BZMPop(timeout time.Duration, order ZOrder, count int64, keys ...string) (string, []ZItem, error) {
+	args := zmpopArgs([]interface{}{formatTimeout(timeout)}, order, count, keys)
+	return keyZItems(client.DoWithTimeout(blockingReadTimeout(timeout), BZMPop, args...))
+}
+
+// ---------------------------Stream---------------------------
+
+// StreamEntry is an entry of a stream.
+type StreamEntry struct {
+	ID     string
+	Fields map[string]string
+}
+
+// XAdd appends an entry with fields to the stream stored at key and returns
+// the ID of the entry. Use "*" as the id to let the server generate the ID.
+func (client *RedisClient) XAdd(key, id string, fields map[string]interface{}) (string, error) {
+	args := []interface{}{key, id}
+	for k, v := range fields {
+		args = append(args, k, v)
+	}
+	return client.String(CmdXAdd, args...)
+}
+
+// XRange returns the entries of the stream stored at key with IDs between
+// start and end. The special IDs "-" and "+" are the smallest and largest
+// IDs. Zero count returns all entries in the range.
+func (client *RedisClient) XRange(key, start, end string, count int64) ([]StreamEntry, error) {
+	args := []interface{}{key, start, end}
+	if count > 0 {
+		args = append(args, ParamCount, count)
+	}
+	return StreamEntries(client.Do(CmdXRange, args...))
+}
+
+// ---------------------------Pub/Sub---------------------------
+
+// Publish posts message to channel and returns the number of clients that
+// received the message.
+func (client *RedisClient) Publish(channel string, message interface{}) (int64, error) {
+	return client.Int64(CmdPublish, channel, message)
 }
 
 // ---------------------------String---------------------------
@@ -1351,23 +2137,18 @@ func (client RedisClient) SetBit(key string, offset int64, value int) (int64, er
 
 // Redis `SET key value [expiration] NX` command.
 //
-// Zero expiration means the key has no expiration time.
+// Zero expiration means the key has no expiration time. With an expiration,
+// SetNX returns false, ErrNil if the key exists.
 func (client RedisClient) SetNX(key string, value interface{}, expiration time.Duration) (bool, error) {
-	var (
-		result string
-		err    error
-	)
 	if expiration == 0 {
 		// Use old `SETNX` to support old Redis versions.
-		result, err = client.String(CmdSetNX, key, value)
-	} else {
-		if usePrecise(expiration) {
-			result, err = client.String(CmdSet, key, value, ParamPX, formatMs(expiration), ParamNX)
-		} else {
-			result, err = client.String(CmdSet, key, value, ParamEX, formatSec(expiration), ParamNX)
-		}
+		return client.Bool(CmdSetNX, key, value)
 	}
-	return result == RedisStatusOK, err
+	_, ok, err := client.SetArgs(key, value, SetArgs{Mode: ParamNX, TTL: expiration})
+	if err == nil && !ok {
+		err = ErrNil
+	}
+	return ok, err
 }
 
 // Redis `SET key value [expiration] XX` command.
@@ -1385,6 +2166,240 @@ func (client RedisClient) SetXX(key string, value interface{}, expiration time.D
 	}
 }
 
+// SetArgs contains the options of the SET command.
+type SetArgs struct {
+	// Mode is ParamNX to only set a key that does not exist or ParamXX to
+	// only set a key that exists. Empty sets the key unconditionally.
+	Mode string
+
+	// TTL is the expiration time of the key. ExpireAt is the expiration
+	// time as a point in time and takes precedence over TTL. KeepTTL
+	// retains the expiration time of an existing key. If none is set, then
+	// the key has no expiration time.
+	TTL      time.Duration
+	ExpireAt time.Time
+	KeepTTL  bool
+
+	// Get returns the old value of the key.
+	Get bool
+}
+
+// appendExpiration appends the EX, PX, EXAT or PXAT option for ttl or at.
+// Whole seconds are sent with EX and EXAT.
+func appendExpiration(args []interface{}, ttl time.Duration, at time.Time) []interface{} {
+	switch {
+	case !at.IsZero() && at.Nanosecond() == 0:
+		return append(args, ParamEXAT, at.Unix())
+	case !at.IsZero():
+		return append(args, ParamPXAT, at.UnixNano()/int64(time.Millisecond))
+	case ttl <= 0:
+		return args
+	case usePrecise(ttl):
+		return append(args, ParamPX, formatMs(ttl))
+	}
+	return append(args, ParamEX, formatSec(ttl))
+}
+
+// SetArgs sets key to value with the options in a. If a.Get is set, then
+// SetArgs returns the old value and whether the key existed. Otherwise,
+// SetArgs returns an empty value and whether the key was set, which is
+// false when the condition of a.Mode is not met.
+func (client RedisClient) SetArgs(key string, value interface{}, a SetArgs) (string, bool, error) {
+	args := []interface{}{key, value}
+	if a.KeepTTL {
+		args = append(args, ParamKeepTTL)
+	} else {
+		args = appendExpiration(args, a.TTL, a.ExpireAt)
+	}
+	if a.Mode != "" {
+		args = append(args, a.Mode)
+	}
+	if a.Get {
+		args = append(args, ParamGet)
+	}
+	reply, err := client.Do(CmdSet, args...)
+	if err != nil {
+		return "", false, err
+	}
+	if a.Get {
+		old, err := String(reply, nil)
+		if err == ErrNil {
+			return "", false, nil
+		}
+		return old, err == nil, err
+	}
+	return "", reply != nil, nil
+}
+
+// GetExArgs contains the options of GetEx. The zero value leaves the
+// expiration time of the key unchanged.
+type GetExArgs struct {
+	// TTL sets the expiration time of the key. ExpireAt sets the
+	// expiration time as a point in time and takes precedence over TTL.
+	TTL      time.Duration
+	ExpireAt time.Time
+
+	// Persist removes the expiration time of the key.
+	Persist bool
+}
+
+// GetEx returns the value of key and sets or removes the expiration time of
+// the key. GetEx returns ErrNil if the key does not exist.
+func (client RedisClient) GetEx(key string, a GetExArgs) (string, error) {
+	args := []interface{}{key}
+	if a.Persist {
+		args = append(args, ParamPersist)
+	} else {
+		args = appendExpiration(args, a.TTL, a.ExpireAt)
+	}
+	return client.String(CmdGetEx, args...)
+}
+
+// GetDel returns the value of key and deletes the key. GetDel returns
+// ErrNil if the key does not exist.
+func (client RedisClient) GetDel(key string) (string, error) {
+	return client.String(CmdGetDel, key)
+}
+
+// LCSArgs contains the options of LCS.
+type LCSArgs struct {
+	// Len returns only the length of the longest common subsequence.
+	Len bool
+
+	// Idx returns the positions of the matches instead of the
+	// subsequence. MinMatchLen ignores matches shorter than MinMatchLen.
+	// WithMatchLen returns the length of each match.
+	Idx          bool
+	MinMatchLen  int64
+	WithMatchLen bool
+}
+
+// LCSPosition is a range of a string. End is inclusive.
+type LCSPosition struct {
+	Start, End int64
+}
+
+// LCSMatchedPosition is a match of LCS with the ranges in the two strings.
+// MatchLen is set if LCSArgs.WithMatchLen is set.
+type LCSMatchedPosition struct {
+	Key1, Key2 LCSPosition
+	MatchLen   int64
+}
+
+// LCSMatch is the result of LCS.
+type LCSMatch struct {
+	// MatchString is the longest common subsequence. MatchString is empty
+	// if LCSArgs.Len or LCSArgs.Idx is set.
+	MatchString string
+
+	// Len is the length of the longest common subsequence.
+	Len int64
+
+	// Matches are the matches from the end of the strings if LCSArgs.Idx
+	// is set.
+	Matches []LCSMatchedPosition
+}
+
+// LCS returns the longest common subsequence of the strings stored at key1
+// and key2. Keys that do not exist are treated as empty strings.
+func (client RedisClient) LCS(key1, key2 string, a LCSArgs) (*LCSMatch, error) {
+	args := []interface{}{key1, key2}
+	switch {
+	case a.Len:
+		args = append(args, ParamLen)
+	case a.Idx:
+		args = append(args, ParamIdx)
+		if a.MinMatchLen > 0 {
+			args = append(args, ParamMinMatchLen, a.MinMatchLen)
+		}
+		if a.WithMatchLen {
+			args = append(args, ParamWithMatchLen)
+		}
+	}
+	reply, err := client.Do(CmdLCS, args...)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case a.Len:
+		n, err := Int64(reply, nil)
+		if err != nil {
+			return nil, err
+		}
+		return &LCSMatch{Len: n}, nil
+	case a.Idx:
+		return lcsIdx(reply)
+	}
+	s, err := String(reply, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &LCSMatch{MatchString: s, Len: int64(len(s))}, nil
+}
+
+// lcsIdx converts the reply of LCS with the IDX option.
+func lcsIdx(reply interface{}) (*LCSMatch, error) {
+	values, err := Values(reply, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(values)%2 != 0 {
+		return nil, errors.New("redigo: LCS expects even number of values result")
+	}
+	m := &LCSMatch{}
+	for i := 0; i < len(values); i += 2 {
+		name, err := String(values[i], nil)
+		if err != nil {
+			return nil, err
+		}
+		switch name {
+		case "len":
+			if m.Len, err = Int64(values[i+1], nil); err != nil {
+				return nil, err
+			}
+		case "matches":
+			matches, err := Values(values[i+1], nil)
+			if err != nil {
+				return nil, err
+			}
+			m.Matches = make([]LCSMatchedPosition, len(matches))
+			for j, match := range matches {
+				if m.Matches[j], err = lcsMatchedPosition(match); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return m, nil
+}
+
+func lcsMatchedPosition(reply interface{}) (LCSMatchedPosition, error) {
+	var p LCSMatchedPosition
+	values, err := Values(reply, nil)
+	if err != nil {
+		return p, err
+	}
+	if len(values) != 2 && len(values) != 3 {
+		return p, fmt.Errorf("redigo: unexpected number of values in LCS match, got %d", len(values))
+	}
+	for i, pos := range []*LCSPosition{&p.Key1, &p.Key2} {
+		r, err := Int64s(values[i], nil)
+		if err != nil {
+			return p, err
+		}
+		if len(r) != 2 {
+			return p, fmt.Errorf("redigo: unexpected number of values in LCS range, got %d", len(r))
+		}
+		pos.Start, pos.End = r[0], r[1]
+	}
+	if len(values) == 3 {
+		if p.MatchLen, err = Int64(values[2], nil); err != nil {
+			return p, err
+		}
+	}
+	return p, nil
+}
+
 func (client RedisClient) SetRange(key string, offset int64, value string) (int64, error) {
 	return client.Int64(CmdSetRange, key, offset, value)
 }
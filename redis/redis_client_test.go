@@ -1,11 +1,16 @@
 package redis
 
 import (
+	"errors"
+	"flag"
 	"fmt"
+	"reflect"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/swanwish/redigo/internal/fakeredis"
 )
 
 const (
@@ -25,8 +30,25 @@ const (
 	pass = ""
 )
 
+var clientLive = flag.Bool("redis-client-live", false, "Run the RedisClient tests against the server at "+addr+" instead of an in-process fake server")
+
+var (
+	fakeServerOnce sync.Once
+	fakeServerAddr string
+)
+
 func getClient() *RedisClient {
-	return GetRedisClient(addr, pass, 0, 0)
+	if *clientLive {
+		return GetRedisClient(addr, pass, 0, 0)
+	}
+	fakeServerOnce.Do(func() {
+		s, err := fakeredis.NewServer()
+		if err != nil {
+			panic(err)
+		}
+		fakeServerAddr = s.Addr()
+	})
+	return GetRedisClient(fakeServerAddr, pass, 0, 0)
 }
 
 func isArraysEqual(array1, array2 []string) bool {
@@ -253,6 +275,74 @@ func TestFVRedisClient_HGetAllToStruct(t *testing.T) {
 	client.Del(key)
 }
 
+type testAddress struct {
+	City string `redis:"city"`
+}
+
+type testNestedStruct struct {
+	Name    string            `redis:"name"`
+	Created time.Time         `redis:"created"`
+	TTL     time.Duration     `redis:"ttl"`
+	Tags    []string          `redis:"tags,json"`
+	Attrs   map[string]string `redis:"attrs,json"`
+	Addr    testAddress       `redis:"addr"`
+}
+
+func TestFVRedisClient_HGetAllToStructNested(t *testing.T) {
+	client := getClient()
+
+	key := "tk_hgetalltostruct_nested"
+	client.Del(key)
+	defer client.Del(key)
+
+	obj := testNestedStruct{
+		Name:    "alice",
+		Created: time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC),
+		TTL:     time.Minute,
+		Tags:    []string{"a", "b"},
+		Attrs:   map[string]string{"k": "v"},
+		Addr:    testAddress{City: "Paris"},
+	}
+	if _, err := client.HMSetObject(key, &obj); err != nil {
+		t.Fatalf("HMSetObject returned %v", err)
+	}
+	city, err := client.HGet(key, "addr.city")
+	if err != nil || city != "Paris" {
+		t.Errorf("HGet(addr.city) returned %q, %v, want Paris", city, err)
+	}
+
+	var newObj testNestedStruct
+	if err := client.HGetAllToStruct(&newObj, key); err != nil {
+		t.Fatalf("HGetAllToStruct returned %v", err)
+	}
+	assert.Equal(t, obj, newObj)
+}
+
+type testMarshalError struct{}
+
+func (testMarshalError) MarshalText() ([]byte, error) {
+	return nil, errors.New("cannot marshal")
+}
+
+func TestFVRedisClient_HMSetObjectMarshalError(t *testing.T) {
+	client := getClient()
+
+	key := "tk_hmsetobject_marshal_error"
+	client.Del(key)
+	defer client.Del(key)
+
+	obj := struct {
+		Name string           `redis:"name"`
+		Bad  testMarshalError `redis:"bad"`
+	}{Name: "alice"}
+	if _, err := client.HMSetObject(key, &obj); err == nil {
+		t.Fatal("HMSetObject returned nil error for a field that cannot be marshaled")
+	}
+	if n, err := client.Exists(key); err != nil || n != 0 {
+		t.Errorf("Exists returned %d, %v, want 0", n, err)
+	}
+}
+
 func TestFVRedisClient_HIncrBy(t *testing.T) {
 	client := getClient()
 
@@ -487,13 +577,19 @@ func TestFVRedisClient_HMGetToStruct(t *testing.T) {
 		t.Errorf("Failed to save object, the result is %s", result)
 	}
 
-	newObj := TestStruct{}
-	err = client.HMGetToStruct(&newObj, key, FieldName1, FieldName2)
+	newObj := TestStruct{Field3: "Unchanged"}
+	err = client.HMGetToStruct(&newObj, key, FieldName2, FieldName0, FieldName1)
 	if err != nil {
 		t.Errorf("Failed to get all to struct for key %s, the error is %#v", key, err)
 	}
-	if newObj.Field1 != "Hello" && newObj.Field2 != "World" && newObj.Field3 != "" {
-		t.Errorf("Failed to getAllToStruct, the new object is %#v", newObj)
+	if newObj.Field1 != "Hello" {
+		t.Errorf("Field1 is %q, want Hello", newObj.Field1)
+	}
+	if newObj.Field2 != "World" {
+		t.Errorf("Field2 is %q, want World", newObj.Field2)
+	}
+	if newObj.Field3 != "Unchanged" {
+		t.Errorf("Field3 is %q, want the field not requested left unchanged", newObj.Field3)
 	}
 
 	client.Del(key)
@@ -693,6 +789,123 @@ func TestRedisClient_BRPopLPush(t *testing.T) {
 
 }
 
+func TestRedisClient_BLPopSubSecond(t *testing.T) {
+	client := getClient()
+	key := "tk_blpop_timeout"
+	client.Del(key)
+
+	start := time.Now()
+	if _, err := client.BLPop(50*time.Millisecond, key); err != ErrNil {
+		t.Errorf("BLPop of empty list returned %v, want ErrNil", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("BLPop blocked for %v, want about 50ms", d)
+	}
+}
+
+func TestBlockingTimeout(t *testing.T) {
+	if v := formatTimeout(2 * time.Second); v != int64(2) {
+		t.Errorf("formatTimeout(2s) = %v, want 2", v)
+	}
+	if v := formatTimeout(1500 * time.Millisecond); v != "1.5" {
+		t.Errorf("formatTimeout(1.5s) = %v, want 1.5", v)
+	}
+	if d := blockingReadTimeout(0); d != 0 {
+		t.Errorf("blockingReadTimeout(0) = %v, want 0", d)
+	}
+	if d := blockingReadTimeout(time.Second); d <= time.Second {
+		t.Errorf("blockingReadTimeout(1s) = %v, want more than 1s", d)
+	}
+}
+
+func TestRedisClient_LMove(t *testing.T) {
+	client := getClient()
+	src, dst := "tk_lmove_src", "tk_lmove_dst"
+	client.Del(src, dst)
+	defer client.Del(src, dst)
+
+	client.RPush(src, "one", "two", "three")
+	if item, err := client.LMove(src, dst, ListRight, ListLeft); err != nil || item != "three" {
+		t.Errorf("LMove returned %q, %v, want three, nil", item, err)
+	}
+	if item, err := client.BLMove(src, dst, ListLeft, ListRight, time.Second); err != nil || item != "one" {
+		t.Errorf("BLMove returned %q, %v, want one, nil", item, err)
+	}
+	if list, _ := client.LRange(dst, 0, -1); !isArraysEqualWithSameOrder(list, []string{"three", "one"}) {
+		t.Errorf("The list %#v is not correct", list)
+	}
+
+	client.Del(src)
+	if _, err := client.LMove(src, dst, ListLeft, ListLeft); err != ErrNil {
+		t.Errorf("LMove of empty list returned %v, want ErrNil", err)
+	}
+	if _, err := client.BLMove(src, dst, ListLeft, ListLeft, 10*time.Millisecond); err != ErrNil {
+		t.Errorf("BLMove of empty list returned %v, want ErrNil", err)
+	}
+}
+
+func TestRedisClient_LMPop(t *testing.T) {
+	client := getClient()
+	a, b := "tk_lmpop_a", "tk_lmpop_b"
+	client.Del(a, b)
+	defer client.Del(a, b)
+
+	client.RPush(b, "one", "two", "three")
+	key, items, err := client.LMPop(ListLeft, 2, a, b)
+	if err != nil || key != b || !isArraysEqualWithSameOrder(items, []string{"one", "two"}) {
+		t.Errorf("LMPop returned %q, %v, %v, want %s, [one two], nil", key, items, err, b)
+	}
+	key, items, err = client.BLMPop(time.Second, ListRight, 0, a, b)
+	if err != nil || key != b || !isArraysEqualWithSameOrder(items, []string{"three"}) {
+		t.Errorf("BLMPop returned %q, %v, %v, want %s, [three], nil", key, items, err, b)
+	}
+	if _, _, err := client.LMPop(ListLeft, 1, a, b); err != ErrNil {
+		t.Errorf("LMPop of empty lists returned %v, want ErrNil", err)
+	}
+	if _, _, err := client.BLMPop(10*time.Millisecond, ListLeft, 1, a, b); err != ErrNil {
+		t.Errorf("BLMPop of empty lists returned %v, want ErrNil", err)
+	}
+}
+
+func TestRedisClient_LPos(t *testing.T) {
+	client := getClient()
+	key := "tk_lpos"
+	client.Del(key)
+	defer client.Del(key)
+
+	client.RPush(key, "a", "b", "c", "b", "b")
+	if pos, err := client.LPos(key, "b", LPosArgs{}); err != nil || pos != 1 {
+		t.Errorf("LPos returned %d, %v, want 1, nil", pos, err)
+	}
+	if pos, err := client.LPos(key, "b", LPosArgs{Rank: -1}); err != nil || pos != 4 {
+		t.Errorf("LPos with rank -1 returned %d, %v, want 4, nil", pos, err)
+	}
+	if _, err := client.LPos(key, "b", LPosArgs{MaxLen: 1}); err != ErrNil {
+		t.Errorf("LPos with maxlen 1 returned %v, want ErrNil", err)
+	}
+	if positions, err := client.LPosCount(key, "b", 0, LPosArgs{Rank: 2}); err != nil || !reflect.DeepEqual(positions, []int64{3, 4}) {
+		t.Errorf("LPosCount returned %v, %v, want [3 4], nil", positions, err)
+	}
+}
+
+func TestRedisClient_PopCount(t *testing.T) {
+	client := getClient()
+	key := "tk_popcount"
+	client.Del(key)
+	defer client.Del(key)
+
+	client.RPush(key, "one", "two", "three", "four")
+	if items, err := client.LPopCount(key, 2); err != nil || !isArraysEqualWithSameOrder(items, []string{"one", "two"}) {
+		t.Errorf("LPopCount returned %v, %v, want [one two], nil", items, err)
+	}
+	if items, err := client.RPopCount(key, 5); err != nil || !isArraysEqualWithSameOrder(items, []string{"four", "three"}) {
+		t.Errorf("RPopCount returned %v, %v, want [four three], nil", items, err)
+	}
+	if _, err := client.LPopCount(key, 1); err != ErrNil {
+		t.Errorf("LPopCount of missing list returned %v, want ErrNil", err)
+	}
+}
+
 func TestRedisClient_LIndex(t *testing.T) {
 	client := getClient()
 
@@ -5294,9 +5507,445 @@ func TestRedisClient_Type(t *testing.T) {
 		result string
 		err    error
 	}{{"system.sh.610", "hash", nil}}
+	if _, err := client.HSet("system.sh.610", FieldName1, "foo"); err != nil {
+		t.Fatal(err)
+	}
 	for _, test := range testings {
 		result, err := client.Type(test.key)
 		assert.Equal(t, test.result, result)
 		assert.Equal(t, test.err, err)
 	}
 }
+
+func TestRedisClient_ZRangeArgs(t *testing.T) {
+	client := getClient()
+	key, dest := "tk_zrangeargs", "tk_zrangeargs_dest"
+	client.Del(key, dest)
+	defer client.Del(key, dest)
+
+	client.ZAdd(key, Z{1, "a"}, Z{2, "b"}, Z{3, "c"}, Z{4, "d"})
+	items, err := client.ZRangeArgs(key, ZRangeArgs{Start: "(1", Stop: ParamMaximum, ByScore: true, Offset: 1, Count: 2, WithScores: true})
+	if err != nil || !reflect.DeepEqual(items, []ZItem{{"c", 3}, {"d", 4}}) {
+		t.Errorf("ZRangeArgs by score returned %v, %v, want [{c 3} {d 4}], nil", items, err)
+	}
+	items, err = client.ZRangeArgs(key, ZRangeArgs{Start: 0, Stop: 1, Rev: true})
+	if err != nil || !reflect.DeepEqual(items, []ZItem{{Member: "d"}, {Member: "c"}}) {
+		t.Errorf("ZRangeArgs rev returned %v, %v, want [d c], nil", items, err)
+	}
+	items, err = client.ZRangeArgs(key, ZRangeArgs{Start: 0, Stop: -1, WithScores: true})
+	if err != nil || !reflect.DeepEqual(items, []ZItem{{"a", 1}, {"b", 2}, {"c", 3}, {"d", 4}}) {
+		t.Errorf("ZRangeArgs ranks with scores returned %v, %v, want [{a 1} {b 2} {c 3} {d 4}], nil", items, err)
+	}
+	for _, a := range []ZRangeArgs{
+		{Start: 0, Stop: -1, Offset: 1, Count: 2},
+		{Start: 0, Stop: 1, Rev: true, Count: 1},
+	} {
+		if items, err = client.ZRangeArgs(key, a); err == nil {
+			t.Errorf("ZRangeArgs ranks with limit %+v returned %v, nil, want error", a, items)
+		}
+		if n, err := client.ZRangeStore(dest, key, a); err == nil {
+			t.Errorf("ZRangeStore ranks with limit %+v returned %d, nil, want error", a, n)
+		}
+	}
+	items, err = client.ZRangeArgs(key, ZRangeArgs{Start: "[c", Stop: "-", ByLex: true, Rev: true})
+	if err != nil || !reflect.DeepEqual(items, []ZItem{{Member: "c"}, {Member: "b"}, {Member: "a"}}) {
+		t.Errorf("ZRangeArgs by lex returned %v, %v, want [c b a], nil", items, err)
+	}
+	items, err = client.ZRangeArgs(key, ZRangeArgs{Start: "[c", Stop: "-", ByLex: true, Rev: true, Offset: 1, Count: -1})
+	if err != nil || !reflect.DeepEqual(items, []ZItem{{Member: "b"}, {Member: "a"}}) {
+		t.Errorf("ZRangeArgs by lex with limit returned %v, %v, want [b a], nil", items, err)
+	}
+
+	if n, err := client.ZRangeStore(dest, key, ZRangeArgs{Start: 2, Stop: 3, ByScore: true}); err != nil || n != 2 {
+		t.Errorf("ZRangeStore returned %d, %v, want 2, nil", n, err)
+	}
+	if members, _ := client.ZRange(dest, 0, -1); !isArraysEqualWithSameOrder(members, []string{"b", "c"}) {
+		t.Errorf("The members %v are not correct", members)
+	}
+}
+
+func TestRedisClient_ZSetOperations(t *testing.T) {
+	client := getClient()
+	key1, key2, dest := "tk_zsetop1", "tk_zsetop2", "tk_zsetop_dest"
+	client.Del(key1, key2, dest)
+	defer client.Del(key1, key2, dest)
+
+	client.ZAdd(key1, Z{1, "one"}, Z{2, "two"})
+	client.ZAdd(key2, Z{1, "one"}, Z{2, "two"}, Z{3, "three"})
+
+	if items, err := client.ZInterWithScores(ZStore{Weights: []float64{2, 3}}, key1, key2); err != nil || !reflect.DeepEqual(items, []ZItem{{"one", 5}, {"two", 10}}) {
+		t.Errorf("ZInterWithScores returned %v, %v, want [{one 5} {two 10}], nil", items, err)
+	}
+	if members, err := client.ZUnion(ZStore{Aggregate: "MAX"}, key1, key2); err != nil || !isArraysEqualWithSameOrder(members, []string{"one", "two", "three"}) {
+		t.Errorf("ZUnion returned %v, %v, want [one two three], nil", members, err)
+	}
+	if items, err := client.ZUnionWithScores(ZStore{}, key1, key2); err != nil || !reflect.DeepEqual(items, []ZItem{{"one", 2}, {"three", 3}, {"two", 4}}) {
+		t.Errorf("ZUnionWithScores returned %v, %v", items, err)
+	}
+	if members, err := client.ZInter(ZStore{}, key1, key2); err != nil || !isArraysEqualWithSameOrder(members, []string{"one", "two"}) {
+		t.Errorf("ZInter returned %v, %v, want [one two], nil", members, err)
+	}
+	if items, err := client.ZDiffWithScores(key2, key1); err != nil || !reflect.DeepEqual(items, []ZItem{{"three", 3}}) {
+		t.Errorf("ZDiffWithScores returned %v, %v, want [{three 3}], nil", items, err)
+	}
+	if members, err := client.ZDiff(key1, key2); err != nil || len(members) != 0 {
+		t.Errorf("ZDiff returned %v, %v, want [], nil", members, err)
+	}
+	if n, err := client.ZDiffStore(dest, key2, key1); err != nil || n != 1 {
+		t.Errorf("ZDiffStore returned %d, %v, want 1, nil", n, err)
+	}
+	if n, err := client.ZInterCard(0, key1, key2); err != nil || n != 2 {
+		t.Errorf("ZInterCard returned %d, %v, want 2, nil", n, err)
+	}
+	if n, err := client.ZInterCard(1, key1, key2); err != nil || n != 1 {
+		t.Errorf("ZInterCard with limit returned %d, %v, want 1, nil", n, err)
+	}
+}
+
+func TestRedisClient_ZMScore(t *testing.T) {
+	client := getClient()
+	key := "tk_zmscore"
+	client.Del(key)
+	defer client.Del(key)
+
+	client.ZAdd(key, Z{1.5, "a"}, Z{2, "b"})
+	scores, err := client.ZMScore(key, "a", "missing", "b")
+	if err != nil || len(scores) != 3 {
+		t.Fatalf("ZMScore returned %v, %v", scores, err)
+	}
+	if scores[0] == nil || *scores[0] != 1.5 || scores[1] != nil || scores[2] == nil || *scores[2] != 2 {
+		t.Errorf("ZMScore returned %v, want [1.5 nil 2]", scores)
+	}
+}
+
+func TestRedisClient_ZRandMember(t *testing.T) {
+	client := getClient()
+	key := "tk_zrandmember"
+	client.Del(key)
+	defer client.Del(key)
+
+	client.ZAdd(key, Z{1, "a"}, Z{2, "b"}, Z{3, "c"})
+	if members, err := client.ZRandMember(key, 2); err != nil || len(members) != 2 || members[0] == members[1] {
+		t.Errorf("ZRandMember returned %v, %v, want 2 distinct members", members, err)
+	}
+	if members, err := client.ZRandMember(key, -5); err != nil || len(members) != 5 {
+		t.Errorf("ZRandMember with negative count returned %v, %v, want 5 members", members, err)
+	}
+	items, err := client.ZRandMemberWithScores(key, 3)
+	if err != nil || len(items) != 3 {
+		t.Fatalf("ZRandMemberWithScores returned %v, %v", items, err)
+	}
+	for _, item := range items {
+		if want := float64(item.Member[0]-'a') + 1; item.Score != want {
+			t.Errorf("The score of %s is %v, want %v", item.Member, item.Score, want)
+		}
+	}
+}
+
+func TestRedisClient_ZPop(t *testing.T) {
+	client := getClient()
+	key1, key2 := "tk_zpop1", "tk_zpop2"
+	client.Del(key1, key2)
+	defer client.Del(key1, key2)
+
+	client.ZAdd(key2, Z{1, "a"}, Z{2, "b"}, Z{3, "c"}, Z{4, "d"}, Z{5, "e"})
+	if items, err := client.ZPopMin(key2, 1); err != nil || !reflect.DeepEqual(items, []ZItem{{"a", 1}}) {
+		t.Errorf("ZPopMin returned %v, %v, want [{a 1}], nil", items, err)
+	}
+	if items, err := client.ZPopMax(key2, 1); err != nil || !reflect.DeepEqual(items, []ZItem{{"e", 5}}) {
+		t.Errorf("ZPopMax returned %v, %v, want [{e 5}], nil", items, err)
+	}
+	if key, item, err := client.BZPopMin(time.Second, key1, key2); err != nil || key != key2 || item != (ZItem{"b", 2}) {
+		t.Errorf("BZPopMin returned %q, %v, %v, want %s, {b 2}, nil", key, item, err, key2)
+	}
+	if key, item, err := client.BZPopMax(time.Second, key1, key2); err != nil || key != key2 || item != (ZItem{"d", 4}) {
+		t.Errorf("BZPopMax returned %q, %v, %v, want %s, {d 4}, nil", key, item, err, key2)
+	}
+	if key, items, err := client.ZMPop(ZOrderMin, 5, key1, key2); err != nil || key != key2 || !reflect.DeepEqual(items, []ZItem{{"c", 3}}) {
+		t.Errorf("ZMPop returned %q, %v, %v, want %s, [{c 3}], nil", key, items, err, key2)
+	}
+
+	if _, _, err := client.ZMPop(ZOrderMax, 1, key1, key2); err != ErrNil {
+		t.Errorf("ZMPop of empty sets returned %v, want ErrNil", err)
+	}
+	if _, _, err := client.BZPopMin(10*time.Millisecond, key1, key2); err != ErrNil {
+		t.Errorf("BZPopMin of empty sets returned %v, want ErrNil", err)
+	}
+	if _, _, err := client.BZMPop(10*time.Millisecond, ZOrderMax, 1, key1, key2); err != ErrNil {
+		t.Errorf("BZMPop of empty sets returned %v, want ErrNil", err)
+	}
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		client.ZAdd(key1, Z{1, "x"}, Z{2, "y"})
+	}()
+	if key, items, err := client.BZMPop(time.Second, ZOrderMax, 2, key1, key2); err != nil || key != key1 || !reflect.DeepEqual(items, []ZItem{{"y", 2}, {"x", 1}}) {
+		t.Errorf("BZMPop returned %q, %v, %v, want %s, [{y 2} {x 1}], nil", key, items, err, key1)
+	}
+}
+
+func TestRedisClient_SetNXExpiration(t *testing.T) {
+	client := getClient()
+	key := "tk_setnx_expiration"
+	client.Del(key)
+	defer client.Del(key)
+
+	if isSet, err := client.SetNX(key, "Hello", time.Minute); err != nil || !isSet {
+		t.Errorf("SetNX returned %v, %v, want true, nil", isSet, err)
+	}
+	if isSet, err := client.SetNX(key, "World", time.Minute); err != ErrNil || isSet {
+		t.Errorf("SetNX of existing key returned %v, %v, want false, ErrNil", isSet, err)
+	}
+	if value, _ := client.Get(key); value != "Hello" {
+		t.Errorf("Get returned %q, want Hello", value)
+	}
+}
+
+func TestRedisClient_SetArgs(t *testing.T) {
+	client := getClient()
+	key := "tk_setargs"
+	client.Del(key)
+	defer client.Del(key)
+
+	if old, found, err := client.SetArgs(key, "one", SetArgs{Get: true, TTL: time.Minute}); err != nil || found || old != "" {
+		t.Errorf("SetArgs of missing key returned %q, %v, %v, want \"\", false, nil", old, found, err)
+	}
+	if old, found, err := client.SetArgs(key, "two", SetArgs{Get: true, KeepTTL: true}); err != nil || !found || old != "one" {
+		t.Errorf("SetArgs returned %q, %v, %v, want one, true, nil", old, found, err)
+	}
+	if ttl, _ := client.TTL(key); ttl <= 0 {
+		t.Errorf("TTL is %d after KEEPTTL, want > 0", ttl)
+	}
+	if _, ok, err := client.SetArgs(key, "three", SetArgs{Mode: ParamNX}); err != nil || ok {
+		t.Errorf("SetArgs NX of existing key returned %v, %v, want false, nil", ok, err)
+	}
+	if _, ok, err := client.SetArgs(key, "three", SetArgs{Mode: ParamXX, ExpireAt: time.Now().Add(time.Hour)}); err != nil || !ok {
+		t.Errorf("SetArgs XX of existing key returned %v, %v, want true, nil", ok, err)
+	}
+	if ttl, _ := client.TTL(key); ttl <= 60 || ttl > 3600 {
+		t.Errorf("TTL is %d after EXAT, want (60, 3600]", ttl)
+	}
+	if old, found, err := client.SetArgs(key, "four", SetArgs{Mode: ParamNX, Get: true}); err != nil || !found || old != "three" {
+		t.Errorf("SetArgs NX GET returned %q, %v, %v, want three, true, nil", old, found, err)
+	}
+	if s, _ := client.Get(key); s != "three" {
+		t.Errorf("The value %q is not correct", s)
+	}
+}
+
+func TestRedisClient_GetExDel(t *testing.T) {
+	client := getClient()
+	key := "tk_getex"
+	client.Del(key)
+	defer client.Del(key)
+
+	client.Set(key, "Hello", 0)
+	if s, err := client.GetEx(key, GetExArgs{TTL: 1500 * time.Millisecond}); err != nil || s != "Hello" {
+		t.Errorf("GetEx returned %q, %v, want Hello, nil", s, err)
+	}
+	if ttl, _ := client.PTTL(key); ttl <= 0 || ttl > 1500 {
+		t.Errorf("PTTL is %d, want (0, 1500]", ttl)
+	}
+	client.GetEx(key, GetExArgs{Persist: true})
+	if ttl, _ := client.TTL(key); ttl != -1 {
+		t.Errorf("TTL is %d after PERSIST, want -1", ttl)
+	}
+	if s, err := client.GetDel(key); err != nil || s != "Hello" {
+		t.Errorf("GetDel returned %q, %v, want Hello, nil", s, err)
+	}
+	if _, err := client.GetDel(key); err != ErrNil {
+		t.Errorf("GetDel of missing key returned %v, want ErrNil", err)
+	}
+	if _, err := client.GetEx(key, GetExArgs{}); err != ErrNil {
+		t.Errorf("GetEx of missing key returned %v, want ErrNil", err)
+	}
+}
+
+func TestRedisClient_LCS(t *testing.T) {
+	client := getClient()
+	key1, key2 := "tk_lcs1", "tk_lcs2"
+	client.MSet(key1, "ohmytext", key2, "mynewtext")
+	defer client.Del(key1, key2)
+
+	if m, err := client.LCS(key1, key2, LCSArgs{}); err != nil || m.MatchString != "mytext" || m.Len != 6 {
+		t.Errorf("LCS returned %+v, %v, want mytext", m, err)
+	}
+	if m, err := client.LCS(key1, key2, LCSArgs{Len: true}); err != nil || m.Len != 6 {
+		t.Errorf("LCS LEN returned %+v, %v, want 6", m, err)
+	}
+	m, err := client.LCS(key1, key2, LCSArgs{Idx: true})
+	want := []LCSMatchedPosition{
+		{Key1: LCSPosition{4, 7}, Key2: LCSPosition{5, 8}},
+		{Key1: LCSPosition{2, 3}, Key2: LCSPosition{0, 1}},
+	}
+	if err != nil || m.Len != 6 || !reflect.DeepEqual(m.Matches, want) {
+		t.Errorf("LCS IDX returned %+v, %v, want %+v", m, err, want)
+	}
+	m, err = client.LCS(key1, key2, LCSArgs{Idx: true, MinMatchLen: 4, WithMatchLen: true})
+	want = []LCSMatchedPosition{{Key1: LCSPosition{4, 7}, Key2: LCSPosition{5, 8}, MatchLen: 4}}
+	if err != nil || !reflect.DeepEqual(m.Matches, want) {
+		t.Errorf("LCS IDX MINMATCHLEN returned %+v, %v, want %+v", m, err, want)
+	}
+}
+
+func TestRedisClient_HExpire(t *testing.T) {
+	client := getClient()
+	key := "tk_hexpire"
+	client.Del(key)
+	defer client.Del(key)
+
+	client.HMSet(key, map[string]interface{}{"a": "1", "b": "2", "c": "3"})
+	if codes, err := client.HExpire(key, time.Minute, "", "a", "missing"); err != nil || !reflect.DeepEqual(codes, []int64{1, -2}) {
+		t.Errorf("HExpire returned %v, %v, want [1 -2], nil", codes, err)
+	}
+	if codes, err := client.HExpire(key, time.Hour, ParamNX, "a", "b"); err != nil || !reflect.DeepEqual(codes, []int64{0, 1}) {
+		t.Errorf("HExpire NX returned %v, %v, want [0 1], nil", codes, err)
+	}
+	if codes, err := client.HPExpire(key, 30*time.Second, ParamGT, "a"); err != nil || !reflect.DeepEqual(codes, []int64{0}) {
+		t.Errorf("HPExpire GT returned %v, %v, want [0], nil", codes, err)
+	}
+	if ttls, err := client.HTTL(key, "a", "b", "c", "missing"); err != nil || ttls[0] != 60 || ttls[1] != 3600 || ttls[2] != -1 || ttls[3] != -2 {
+		t.Errorf("HTTL returned %v, %v, want [60 3600 -1 -2], nil", ttls, err)
+	}
+	at := time.Now().Add(time.Hour).Truncate(time.Second)
+	client.HExpireAt(key, at, ParamXX, "a")
+	if times, err := client.HExpireTime(key, "a"); err != nil || !reflect.DeepEqual(times, []int64{at.Unix()}) {
+		t.Errorf("HExpireTime returned %v, %v, want [%d], nil", times, err, at.Unix())
+	}
+	if codes, err := client.HPersist(key, "a", "c", "missing"); err != nil || !reflect.DeepEqual(codes, []int64{1, -1, -2}) {
+		t.Errorf("HPersist returned %v, %v, want [1 -1 -2], nil", codes, err)
+	}
+
+	// HSET removes the TTL of a field.
+	client.HSet(key, "b", "2")
+	if ttls, _ := client.HPTTL(key, "b"); !reflect.DeepEqual(ttls, []int64{-1}) {
+		t.Errorf("HPTTL returned %v after HSET, want [-1]", ttls)
+	}
+
+	// A ttl under a second expires the fields instead of deleting them.
+	if codes, err := client.HExpire(key, 500*time.Millisecond, "", "c"); err != nil || !reflect.DeepEqual(codes, []int64{1}) {
+		t.Errorf("HExpire of 500ms returned %v, %v, want [1], nil", codes, err)
+	}
+	if ttls, _ := client.HPTTL(key, "c"); len(ttls) != 1 || ttls[0] <= 0 || ttls[0] > 500 {
+		t.Errorf("HPTTL returned %v after HExpire of 500ms, want (0, 500]", ttls)
+	}
+
+	client.HPExpire(key, 10*time.Millisecond, "", "c")
+	time.Sleep(20 * time.Millisecond)
+	if exists, _ := client.HExists(key, "c"); exists {
+		t.Errorf("Field c exists after its TTL")
+	}
+	if codes, err := client.HPExpireAt(key, time.Now().Add(-time.Second), "", "a", "b"); err != nil || !reflect.DeepEqual(codes, []int64{2, 2}) {
+		t.Errorf("HPExpireAt in the past returned %v, %v, want [2 2], nil", codes, err)
+	}
+	if n, _ := client.Exists(key); n != 0 {
+		t.Errorf("The key exists after all fields were deleted")
+	}
+}
+
+func TestRedisClient_HGetDelEx(t *testing.T) {
+	client := getClient()
+	key := "tk_hgetdelex"
+	client.Del(key)
+	defer client.Del(key)
+
+	if ok, err := client.HSetEx(key, HSetExArgs{Mode: ParamFXX}, map[string]interface{}{"a": "1"}); err != nil || ok {
+		t.Errorf("HSetEx FXX of missing fields returned %v, %v, want false, nil", ok, err)
+	}
+	if ok, err := client.HSetEx(key, HSetExArgs{Mode: ParamFNX, TTL: time.Minute}, map[string]interface{}{"a": "1", "b": "2"}); err != nil || !ok {
+		t.Errorf("HSetEx FNX returned %v, %v, want true, nil", ok, err)
+	}
+	if ttls, _ := client.HTTL(key, "a", "b"); !reflect.DeepEqual(ttls, []int64{60, 60}) {
+		t.Errorf("HTTL returned %v after HSetEx, want [60 60]", ttls)
+	}
+	client.HSetEx(key, HSetExArgs{KeepTTL: true}, map[string]interface{}{"a": "one", "c": "3"})
+	if ttls, _ := client.HTTL(key, "a", "c"); !reflect.DeepEqual(ttls, []int64{60, -1}) {
+		t.Errorf("HTTL returned %v after KEEPTTL, want [60 -1]", ttls)
+	}
+
+	if values, err := client.HGetEx(key, GetExArgs{Persist: true}, "a", "missing"); err != nil || !reflect.DeepEqual(values, []string{"one", ""}) {
+		t.Errorf("HGetEx returned %v, %v, want [one ], nil", values, err)
+	}
+	if ttls, _ := client.HTTL(key, "a"); !reflect.DeepEqual(ttls, []int64{-1}) {
+		t.Errorf("HTTL returned %v after PERSIST, want [-1]", ttls)
+	}
+	client.HGetEx(key, GetExArgs{TTL: 1500 * time.Millisecond}, "c")
+	if ttls, _ := client.HPTTL(key, "c"); len(ttls) != 1 || ttls[0] <= 0 || ttls[0] > 1500 {
+		t.Errorf("HPTTL returned %v, want (0, 1500]", ttls)
+	}
+
+	if values, err := client.HGetDel(key, "a", "b", "c"); err != nil || !reflect.DeepEqual(values, []string{"one", "2", "3"}) {
+		t.Errorf("HGetDel returned %v, %v, want [one 2 3], nil", values, err)
+	}
+	if n, _ := client.Exists(key); n != 0 {
+		t.Errorf("The key exists after HGetDel of all fields")
+	}
+}
+
+func TestRedisClient_HRandFieldScan(t *testing.T) {
+	client := getClient()
+	key := "tk_hrandfield"
+	client.Del(key)
+	defer client.Del(key)
+
+	fields := map[string]string{"a": "1", "b": "22", "c": "333"}
+	for field, value := range fields {
+		client.HSet(key, field, value)
+	}
+	if n, err := client.HStrLen(key, "c"); err != nil || n != 3 {
+		t.Errorf("HStrLen returned %d, %v, want 3, nil", n, err)
+	}
+	if n, _ := client.HStrLen(key, "missing"); n != 0 {
+		t.Errorf("HStrLen of missing field returned %d, want 0", n)
+	}
+
+	if got, err := client.HRandField(key, 2); err != nil || len(got) != 2 || got[0] == got[1] {
+		t.Errorf("HRandField returned %v, %v, want 2 distinct fields", got, err)
+	}
+	if got, _ := client.HRandField(key, -5); len(got) != 5 {
+		t.Errorf("HRandField with negative count returned %d fields, want 5", len(got))
+	}
+	got, err := client.HRandFieldWithValues(key, 10)
+	if err != nil || !reflect.DeepEqual(got, fields) {
+		t.Errorf("HRandFieldWithValues returned %v, %v, want %v", got, err, fields)
+	}
+
+	scanned := map[string]string{}
+	for cursor := uint64(0); ; {
+		next, items, err := client.HScan(key, cursor, "[ab]", 1)
+		if err != nil {
+			t.Fatalf("HScan returned %v", err)
+		}
+		for i := 0; i+1 < len(items); i += 2 {
+			scanned[items[i]] = items[i+1]
+		}
+		if cursor = next; cursor == 0 {
+			break
+		}
+	}
+	if want := map[string]string{"a": "1", "b": "22"}; !reflect.DeepEqual(scanned, want) {
+		t.Errorf("HScan returned %v, want %v", scanned, want)
+	}
+}
+
+func TestRedisClient_HMSetObjectWithTTL(t *testing.T) {
+	client := getClient()
+	key := "tk_hmsetobject_ttl"
+	client.Del(key)
+	defer client.Del(key)
+
+	client.HSet(key, "other", "x")
+	obj := struct {
+		Name  string `redis:"name"`
+		Count int    `redis:"count"`
+	}{"session", 3}
+	if err := client.HMSetObjectWithTTL(key, &obj, time.Minute); err != nil {
+		t.Fatalf("HMSetObjectWithTTL returned %v", err)
+	}
+	if ttls, _ := client.HTTL(key, "name", "count", "other"); !reflect.DeepEqual(ttls, []int64{60, 60, -1}) {
+		t.Errorf("HTTL returned %v, want [60 60 -1]", ttls)
+	}
+	if s, _ := client.HGet(key, "count"); s != "3" {
+		t.Errorf("The value %q is not correct", s)
+	}
+}
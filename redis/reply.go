@@ -445,6 +445,29 @@ func ZItemList(result interface{}, err error) ([]ZItem, error) {
 	return list, nil
 }
 
+// StreamEntries is a helper that converts the reply of XRANGE to a
+// []StreamEntry.
+func StreamEntries(result interface{}, err error) ([]StreamEntry, error) {
+	values, err := Values(result, err)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]StreamEntry, len(values))
+	for i, v := range values {
+		entry, err := Values(v, nil)
+		if err != nil || len(entry) != 2 {
+			return nil, errors.New("redigo: StreamEntries expects an array of ID and fields")
+		}
+		if entries[i].ID, err = String(entry[0], nil); err != nil {
+			return nil, err
+		}
+		if entries[i].Fields, err = StringMap(entry[1], nil); err != nil {
+			return nil, err
+		}
+	}
+	return entries, nil
+}
+
 // IntMap is a helper that converts an array of strings (alternating key, value)
 // into a map[string]int. The HGETALL commands return replies in this format.
 // Requires an even number of values in result.
@@ -0,0 +1,508 @@
+//go:build go1.18
+// +build go1.18
+
+package redis
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+// ErrTxAborted is returned by Repository methods when the transaction that
+// updates an object and its indexes is repeatedly aborted by concurrent
+// modifications of the object.
+var ErrTxAborted = errors.New("redigo: transaction aborted by concurrent modification")
+
+// repositoryTxAttempts is the number of times a Repository transaction is
+// attempted before ErrTxAborted is returned.
+const repositoryTxAttempts = 16
+
+// Repository stores structs of type T in hashes and maintains secondary
+// indexes of the struct fields. The fields of T are mapped to hash fields
+// as described for ScanStruct and AddFlat. The 'redis' field tag options pk,
+// index and sorted declare the primary key and the indexes:
+//
+//	type User struct {
+//		ID        int64     `redis:"id,pk"`
+//		Email     string    `redis:"email,index"`
+//		CreatedAt time.Time `redis:"createdAt,sorted"`
+//	}
+//
+//	users, err := redis.NewRepository[User](client, "user")
+//	err = users.Save(&User{Email: "alice@example.com", CreatedAt: time.Now()})
+//	found, err := users.FindBy("email", "alice@example.com")
+//	recent, err := users.Range("createdAt", time.Now().Add(-time.Hour), nil)
+//
+// The object with ID id is stored in the hash prefix:id. IDs that start
+// with an underscore are reserved for the keys prefix:_seq and
+// prefix:_idx:... of the repository. An index field maintains a set
+// prefix:_idx:field:value with the IDs of the objects with the value. A
+// sorted field maintains a sorted set prefix:_idx:field with the IDs of the
+// objects scored by the field. Sorted fields must be numbers or time.Time
+// values. Save and Delete update an object and its indexes in
+// a single MULTI/EXEC transaction that is retried when the object is
+// modified concurrently.
+type Repository[T any] struct {
+	client  *RedisClient
+	prefix  string
+	pk      *fieldSpec
+	indexes []*fieldSpec
+	fields  map[string]*fieldSpec
+}
+
+// NewRepository returns a repository for the structs of type T stored with
+// the key prefix. T must have exactly one field with the pk tag option. The
+// primary key must be a string or an integer.
+func NewRepository[T any](client *RedisClient, prefix string) (*Repository[T], error) {
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	if t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("redigo: Repository type %v is not a struct", t)
+	}
+	r := &Repository[T]{client: client, prefix: prefix, fields: make(map[string]*fieldSpec)}
+	for _, fs := range structSpecForType(t).l {
+		ft := t.FieldByIndex(fs.index).Type
+		if fs.pk {
+			if r.pk != nil {
+				return nil, fmt.Errorf("redigo: Repository type %v has more than one pk field", t)
+			}
+			switch ft.Kind() {
+			case reflect.String, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+				reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			default:
+				return nil, fmt.Errorf("redigo: Repository pk field %s must be a string or an integer", fs.name)
+			}
+			r.pk = fs
+		}
+		if !fs.setIndex && !fs.sortedIndex {
+			continue
+		}
+		if fs.encrypt {
+			return nil, fmt.Errorf("redigo: Repository cannot index encrypted field %s", fs.name)
+		}
+		if fs.sortedIndex && !isScoreType(ft) {
+			return nil, fmt.Errorf("redigo: Repository sorted field %s must be a number or time.Time", fs.name)
+		}
+		r.indexes = append(r.indexes, fs)
+		r.fields[fs.name] = fs
+	}
+	if r.pk == nil {
+		return nil, fmt.Errorf("redigo: Repository type %v has no pk field", t)
+	}
+	return r, nil
+}
+
+func isScoreType(t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return t == timeType
+}
+
+// score returns the sorted set score of v. Times are scored by the seconds
+// since the Unix epoch.
+func score(v reflect.Value) (float64, error) {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return 0, errors.New("redigo: cannot score nil pointer")
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), nil
+	}
+	if t, ok := v.Interface().(time.Time); ok {
+		return float64(t.Unix()) + float64(t.Nanosecond())/1e9, nil
+	}
+	return 0, fmt.Errorf("redigo: cannot score value of type %v", v.Type())
+}
+
+func (r *Repository[T]) key(id string) string {
+	return r.prefix + ":" + id
+}
+
+func (r *Repository[T]) setIndexKey(fs *fieldSpec, value []byte) string {
+	return r.prefix + ":_idx:" + fs.name + ":" + string(value)
+}
+
+func (r *Repository[T]) sortedIndexKey(fs *fieldSpec) string {
+	return r.prefix + ":_idx:" + fs.name
+}
+
+func (r *Repository[T]) index(field string, sorted bool) (*fieldSpec, error) {
+	fs := r.fields[field]
+	if fs == nil || (sorted && !fs.sortedIndex) || (!sorted && !fs.setIndex) {
+		kind := "index"
+		if sorted {
+			kind = "sorted"
+		}
+		return nil, fmt.Errorf("redigo: Repository field %s is not declared with the %s option", field, kind)
+	}
+	return fs, nil
+}
+
+// idString returns the string form of id. IDs that start with an underscore
+// are reserved for the keys prefix:_seq and prefix:_idx:... and are
+// rejected.
+func idString(id interface{}) (string, error) {
+	p, err := argBytes(id)
+	if err != nil {
+		return "", err
+	}
+	if len(p) > 0 && p[0] == '_' {
+		return "", fmt.Errorf("redigo: Repository ID %q is reserved", p)
+	}
+	return string(p), nil
+}
+
+// transact executes the commands sent by queue in a transaction that
+// watches key. The function queue is called with the stored values of the
+// index fields and sends the commands of the transaction. The replies of
+// the commands are returned.
+func (r *Repository[T]) transact(key string, queue func(conn Conn, old [][]byte) error) ([]interface{}, error) {
+	conn, err := r.client.GetConn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	args := []interface{}{key}
+	for _, fs := range r.indexes {
+		args = append(args, fs.name)
+	}
+	for attempt := 0; attempt < repositoryTxAttempts; attempt++ {
+		if _, err := conn.Do(CmdWatch, key); err != nil {
+			return nil, err
+		}
+		var old [][]byte
+		if len(r.indexes) > 0 {
+			if old, err = ByteSlices(conn.Do(HMGet, args...)); err != nil {
+				return nil, err
+			}
+		}
+		if err := conn.Send(CmdMulti); err != nil {
+			return nil, err
+		}
+		if err := queue(conn, old); err != nil {
+			return nil, err
+		}
+		reply, err := conn.Do(CmdExec)
+		if err != nil {
+			return nil, err
+		}
+		if reply == nil {
+			// The watched key was modified. Back off to let the
+			// concurrent transactions complete.
+			sleepFunc(jitter(time.Duration(attempt+1) * time.Millisecond))
+			continue
+		}
+		replies, err := Values(reply, nil)
+		if err != nil {
+			return nil, err
+		}
+		for _, reply := range replies {
+			if err, ok := reply.(Error); ok {
+				return nil, err
+			}
+		}
+		return replies, nil
+	}
+	return nil, ErrTxAborted
+}
+
+// Save stores obj and updates the indexes. If the primary key of obj is
+// the zero value, then Save allocates a new ID and assigns it to the
+// primary key once the object is stored. Fields that are not stored because
+// they are nil or empty with the omitempty option are removed from the
+// indexes.
+func (r *Repository[T]) Save(obj *T) error {
+	// Work on a copy so that the primary key of obj is only set when the
+	// transaction succeeds.
+	stored := *obj
+	v := reflect.ValueOf(&stored).Elem()
+	pk, _ := fieldByIndex(v, r.pk.index, true)
+	allocated := pk.IsZero()
+	if allocated {
+		n, err := r.client.Int64(CmdIncr, r.prefix+":_seq")
+		if err != nil {
+			return err
+		}
+		switch pk.Kind() {
+		case reflect.String:
+			pk.SetString(strconv.FormatInt(n, 10))
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			pk.SetInt(n)
+		default:
+			pk.SetUint(uint64(n))
+		}
+	}
+	id, err := idString(pk.Interface())
+	if err != nil {
+		return err
+	}
+	key := r.key(id)
+	args, err := Args{key}.addFlat(&stored)
+	if err != nil {
+		return err
+	}
+
+	values := make(map[string][]byte)
+	scores := make(map[string]float64)
+	for i := 1; i+1 < len(args); i += 2 {
+		name := args[i].(string)
+		fs := r.fields[name]
+		if fs == nil {
+			continue
+		}
+		if values[name], err = argBytes(args[i+1]); err != nil {
+			return err
+		}
+		if fs.sortedIndex {
+			fv, _ := fieldByIndex(v, fs.index, false)
+			if scores[name], err = score(fv); err != nil {
+				return err
+			}
+		}
+	}
+	if err := r.client.encryptFields(key, &stored, args[1:]); err != nil {
+		return err
+	}
+
+	_, err = r.transact(key, func(conn Conn, old [][]byte) error {
+		if err := conn.Send(CmdDel, key); err != nil {
+			return err
+		}
+		if err := conn.Send(HMSet, args...); err != nil {
+			return err
+		}
+		for i, fs := range r.indexes {
+			value, ok := values[fs.name]
+			if fs.setIndex {
+				if old[i] != nil && (!ok || !bytes.Equal(old[i], value)) {
+					if err := conn.Send(CmdSRem, r.setIndexKey(fs, old[i]), id); err != nil {
+						return err
+					}
+				}
+				if ok {
+					if err := conn.Send(CmdSAdd, r.setIndexKey(fs, value), id); err != nil {
+						return err
+					}
+				}
+			}
+			if fs.sortedIndex {
+				var err error
+				if ok {
+					err = conn.Send(ZAdd, r.sortedIndexKey(fs), scores[fs.name], id)
+				} else {
+					err = conn.Send(ZRem, r.sortedIndexKey(fs), id)
+				}
+				if err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if allocated {
+		dst, _ := fieldByIndex(reflect.ValueOf(obj).Elem(), r.pk.index, true)
+		dst.Set(pk)
+	}
+	return nil
+}
+
+// Delete deletes the object with the given ID and removes it from the
+// indexes. Delete returns true if the object existed.
+func (r *Repository[T]) Delete(id interface{}) (bool, error) {
+	s, err := idString(id)
+	if err != nil {
+		return false, err
+	}
+	key := r.key(s)
+	replies, err := r.transact(key, func(conn Conn, old [][]byte) error {
+		if err := conn.Send(CmdDel, key); err != nil {
+			return err
+		}
+		for i, fs := range r.indexes {
+			if fs.setIndex && old[i] != nil {
+				if err := conn.Send(CmdSRem, r.setIndexKey(fs, old[i]), s); err != nil {
+					return err
+				}
+			}
+			if fs.sortedIndex {
+				if err := conn.Send(ZRem, r.sortedIndexKey(fs), s); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	n, err := Int64(replies[0], nil)
+	return n > 0, err
+}
+
+func (r *Repository[T]) decode(key string, values []interface{}) (*T, error) {
+	obj := new(T)
+	if err := r.client.decryptFields(key, obj, values); err != nil {
+		return nil, err
+	}
+	if err := ScanStruct(values, obj); err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
+// Load returns the object with the given ID. It returns ErrNil if the
+// object does not exist.
+func (r *Repository[T]) Load(id interface{}) (*T, error) {
+	s, err := idString(id)
+	if err != nil {
+		return nil, err
+	}
+	key := r.key(s)
+	values, err := r.client.Values(HGetAll, key)
+	if err != nil {
+		return nil, err
+	}
+	if len(values) == 0 {
+		return nil, ErrNil
+	}
+	return r.decode(key, values)
+}
+
+// LoadMany returns the objects with the given IDs in a single pipeline. The
+// element for an object that does not exist is nil.
+func (r *Repository[T]) LoadMany(ids ...interface{}) ([]*T, error) {
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		s, err := idString(id)
+		if err != nil {
+			return nil, err
+		}
+		keys[i] = r.key(s)
+	}
+	return r.loadKeys(keys)
+}
+
+func (r *Repository[T]) loadKeys(keys []string) ([]*T, error) {
+	objs := make([]*T, len(keys))
+	if len(keys) == 0 {
+		return objs, nil
+	}
+	conn, err := r.client.GetConn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	for _, key := range keys {
+		if err := conn.Send(HGetAll, key); err != nil {
+			return nil, err
+		}
+	}
+	if err := conn.Flush(); err != nil {
+		return nil, err
+	}
+	for i, key := range keys {
+		values, err := Values(conn.Receive())
+		if err != nil {
+			return nil, err
+		}
+		if len(values) == 0 {
+			continue
+		}
+		if objs[i], err = r.decode(key, values); err != nil {
+			return nil, err
+		}
+	}
+	return objs, nil
+}
+
+// loadIDs loads the objects with the given IDs and skips the objects that
+// do not exist.
+func (r *Repository[T]) loadIDs(ids []string) ([]*T, error) {
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = r.key(id)
+	}
+	objs, err := r.loadKeys(keys)
+	if err != nil {
+		return nil, err
+	}
+	result := objs[:0]
+	for _, obj := range objs {
+		if obj != nil {
+			result = append(result, obj)
+		}
+	}
+	return result, nil
+}
+
+// FindBy returns the objects with value in the field declared with the
+// index option. The objects are returned in no particular order.
+func (r *Repository[T]) FindBy(field string, value interface{}) ([]*T, error) {
+	fs, err := r.index(field, false)
+	if err != nil {
+		return nil, err
+	}
+	if value == nil {
+		return nil, errors.New("redigo: Repository FindBy value is nil")
+	}
+	arg, _, err := fieldArg(fs, reflect.ValueOf(value))
+	if err != nil {
+		return nil, err
+	}
+	p, err := argBytes(arg)
+	if err != nil {
+		return nil, err
+	}
+	ids, err := r.client.StringSlice(CmdSMembers, r.setIndexKey(fs, p))
+	if err != nil {
+		return nil, err
+	}
+	return r.loadIDs(ids)
+}
+
+// Range returns the objects with a value between from and to inclusive in
+// the field declared with the sorted option, ordered by the value. A nil
+// from or to leaves the range unbounded on that side.
+func (r *Repository[T]) Range(field string, from, to interface{}) ([]*T, error) {
+	fs, err := r.index(field, true)
+	if err != nil {
+		return nil, err
+	}
+	lo, hi := interface{}(ParamMinimum), interface{}(ParamMaximum)
+	if from != nil {
+		if lo, err = score(reflect.ValueOf(from)); err != nil {
+			return nil, err
+		}
+	}
+	if to != nil {
+		if hi, err = score(reflect.ValueOf(to)); err != nil {
+			return nil, err
+		}
+	}
+	ids, err := r.client.StringSlice(ZRangeByScore, r.sortedIndexKey(fs), lo, hi)
+	if err != nil {
+		return nil, err
+	}
+	return r.loadIDs(ids)
+}
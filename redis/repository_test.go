@@ -0,0 +1,275 @@
+//go:build go1.18
+// +build go1.18
+
+package redis
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+type repoUser struct {
+	ID        int64     `redis:"id,pk"`
+	Email     string    `redis:"email,index"`
+	Team      string    `redis:"team,index,omitempty"`
+	Age       int       `redis:"age,sorted"`
+	CreatedAt time.Time `redis:"createdAt,sorted"`
+}
+
+func repoUserIDs(users []*repoUser) []int64 {
+	ids := make([]int64, len(users))
+	for i, u := range users {
+		ids[i] = u.ID
+	}
+	return ids
+}
+
+func TestRepository(t *testing.T) {
+	client := getClient()
+	keys, _ := client.StringSlice(CmdKeys, "repo:*")
+	for _, key := range keys {
+		client.Del(key)
+	}
+
+	users, err := NewRepository[repoUser](client, "repo")
+	if err != nil {
+		t.Fatalf("NewRepository returned %v", err)
+	}
+
+	now := time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)
+	alice := &repoUser{Email: "alice@example.com", Team: "red", Age: 30, CreatedAt: now}
+	bob := &repoUser{Email: "bob@example.com", Team: "red", Age: 40, CreatedAt: now.Add(time.Hour)}
+	carol := &repoUser{Email: "carol@example.com", Team: "blue", Age: 20, CreatedAt: now.Add(2 * time.Hour)}
+	for _, u := range []*repoUser{alice, bob, carol} {
+		if err := users.Save(u); err != nil {
+			t.Fatalf("Save returned %v", err)
+		}
+	}
+	if alice.ID != 1 || bob.ID != 2 || carol.ID != 3 {
+		t.Fatalf("Save allocated IDs %d, %d, %d, want 1, 2, 3", alice.ID, bob.ID, carol.ID)
+	}
+
+	u, err := users.Load(2)
+	if err != nil || !reflect.DeepEqual(u, bob) {
+		t.Errorf("Load(2) returned %+v, %v, want %+v", u, err, bob)
+	}
+	if _, err := users.Load(42); err != ErrNil {
+		t.Errorf("Load(42) returned %v, want ErrNil", err)
+	}
+
+	many, err := users.LoadMany(3, 42, 1)
+	if err != nil || len(many) != 3 || many[1] != nil || !reflect.DeepEqual(many[0], carol) || !reflect.DeepEqual(many[2], alice) {
+		t.Errorf("LoadMany(3, 42, 1) returned %+v, %v", many, err)
+	}
+
+	found, err := users.FindBy("team", "red")
+	ids := repoUserIDs(found)
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	if err != nil || !reflect.DeepEqual(ids, []int64{1, 2}) {
+		t.Errorf("FindBy(team, red) returned IDs %v, %v, want [1 2]", ids, err)
+	}
+
+	found, err = users.Range("age", 25, nil)
+	if ids := repoUserIDs(found); err != nil || !reflect.DeepEqual(ids, []int64{1, 2}) {
+		t.Errorf("Range(age, 25, nil) returned IDs %v, %v, want [1 2]", ids, err)
+	}
+	found, err = users.Range("createdAt", now.Add(30*time.Minute), now.Add(2*time.Hour))
+	if ids := repoUserIDs(found); err != nil || !reflect.DeepEqual(ids, []int64{2, 3}) {
+		t.Errorf("Range(createdAt) returned IDs %v, %v, want [2 3]", ids, err)
+	}
+
+	// Moving bob to another team and clearing carol's team updates the set
+	// indexes.
+	bob.Team = "blue"
+	bob.Age = 10
+	carol.Team = ""
+	if err := users.Save(bob); err != nil {
+		t.Fatalf("Save returned %v", err)
+	}
+	if err := users.Save(carol); err != nil {
+		t.Fatalf("Save returned %v", err)
+	}
+	if found, err := users.FindBy("team", "red"); err != nil || !reflect.DeepEqual(repoUserIDs(found), []int64{1}) {
+		t.Errorf("FindBy(team, red) returned IDs %v, %v, want [1]", repoUserIDs(found), err)
+	}
+	if found, err := users.FindBy("team", "blue"); err != nil || !reflect.DeepEqual(repoUserIDs(found), []int64{2}) {
+		t.Errorf("FindBy(team, blue) returned IDs %v, %v, want [2]", repoUserIDs(found), err)
+	}
+	if found, err := users.Range("age", nil, nil); err != nil || !reflect.DeepEqual(repoUserIDs(found), []int64{2, 3, 1}) {
+		t.Errorf("Range(age) returned IDs %v, %v, want [2 3 1]", repoUserIDs(found), err)
+	}
+
+	if ok, err := users.Delete(1); err != nil || !ok {
+		t.Errorf("Delete(1) returned %v, %v, want true, nil", ok, err)
+	}
+	if ok, err := users.Delete(1); err != nil || ok {
+		t.Errorf("Delete(1) of deleted object returned %v, %v, want false, nil", ok, err)
+	}
+	if n, _ := client.Exists("repo:_idx:team:red"); n != 0 {
+		t.Errorf("index repo:_idx:team:red exists after Delete")
+	}
+	if found, err := users.Range("createdAt", nil, nil); err != nil || !reflect.DeepEqual(repoUserIDs(found), []int64{2, 3}) {
+		t.Errorf("Range(createdAt) returned IDs %v, %v, want [2 3]", repoUserIDs(found), err)
+	}
+
+	if _, err := users.FindBy("age", 10); err == nil {
+		t.Errorf("FindBy on sorted field returned nil error")
+	}
+}
+
+func TestRepositoryConcurrentSave(t *testing.T) {
+	client := getClient()
+	keys, _ := client.StringSlice(CmdKeys, "repoc:*")
+	for _, key := range keys {
+		client.Del(key)
+	}
+	users, err := NewRepository[repoUser](client, "repoc")
+	if err != nil {
+		t.Fatalf("NewRepository returned %v", err)
+	}
+
+	teams := []string{"a", "b", "c", "d"}
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			u := &repoUser{ID: 1, Email: "x@example.com", Team: teams[i%len(teams)], Age: i}
+			if err := users.Save(u); err != nil {
+				t.Errorf("Save returned %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	u, err := users.Load(1)
+	if err != nil {
+		t.Fatalf("Load returned %v", err)
+	}
+	for _, team := range teams {
+		found, err := users.FindBy("team", team)
+		if err != nil {
+			t.Fatalf("FindBy returned %v", err)
+		}
+		if want := team == u.Team; (len(found) == 1) != want || len(found) > 1 {
+			t.Errorf("FindBy(team, %s) returned %d objects, stored team is %s", team, len(found), u.Team)
+		}
+	}
+}
+
+func TestRepositoryStringID(t *testing.T) {
+	type item struct {
+		SKU   string  `redis:"sku,pk"`
+		Price float64 `redis:"price,sorted"`
+	}
+	client := getClient()
+	client.Del("repo:item:ab-1", "repo:item:_idx:price")
+	defer client.Del("repo:item:ab-1", "repo:item:_idx:price")
+
+	items, err := NewRepository[item](client, "repo:item")
+	if err != nil {
+		t.Fatalf("NewRepository returned %v", err)
+	}
+	if err := items.Save(&item{SKU: "ab-1", Price: 9.5}); err != nil {
+		t.Fatalf("Save returned %v", err)
+	}
+	found, err := items.Range("price", 9, 10)
+	if err != nil || len(found) != 1 || found[0].SKU != "ab-1" {
+		t.Errorf("Range(price) returned %+v, %v", found, err)
+	}
+
+	for _, sku := range []string{"_seq", "_idx:price"} {
+		if err := items.Save(&item{SKU: sku, Price: 1}); err == nil {
+			t.Errorf("Save with reserved ID %q returned nil error", sku)
+		}
+		if _, err := items.Load(sku); err == nil || err == ErrNil {
+			t.Errorf("Load of reserved ID %q returned %v", sku, err)
+		}
+	}
+}
+
+func TestRepositorySaveFailure(t *testing.T) {
+	client := getClient()
+	keys := []string{"repo:fail:_seq", "repo:fail:1", "repo:fail:_idx:email:x@example.com"}
+	client.Del(keys...)
+	defer client.Del(keys...)
+
+	users, err := NewRepository[repoUser](client, "repo:fail")
+	if err != nil {
+		t.Fatalf("NewRepository returned %v", err)
+	}
+	// The SADD to the email index fails in the transaction.
+	client.Set("repo:fail:_idx:email:x@example.com", "not a set", 0)
+	u := &repoUser{Email: "x@example.com"}
+	if err := users.Save(u); err == nil {
+		t.Fatal("Save returned nil error")
+	}
+	if u.ID != 0 {
+		t.Errorf("Save of a failed transaction assigned ID %d, want 0", u.ID)
+	}
+}
+
+// sendErrConn fails the Send of commandName with err.
+type sendErrConn struct {
+	Conn
+	commandName string
+	err         error
+}
+
+func (c sendErrConn) Send(commandName string, args ...interface{}) error {
+	if commandName == c.commandName {
+		return c.err
+	}
+	return c.Conn.Send(commandName, args...)
+}
+
+func TestRepositorySendError(t *testing.T) {
+	client := getClient()
+	client.Del("repo:send:7")
+	defer client.Del("repo:send:7")
+
+	sendErr := errors.New("send failed")
+	failing := NewRedisClient(&Pool{Dial: func() (Conn, error) {
+		c, err := client.pool.Dial()
+		if err != nil {
+			return nil, err
+		}
+		return sendErrConn{c, CmdSAdd, sendErr}, nil
+	}})
+	users, err := NewRepository[repoUser](failing, "repo:send")
+	if err != nil {
+		t.Fatalf("NewRepository returned %v", err)
+	}
+	if err := users.Save(&repoUser{ID: 7, Email: "x@example.com"}); err != sendErr {
+		t.Errorf("Save returned %v, want %v", err, sendErr)
+	}
+	if n, _ := client.Exists("repo:send:7"); n != 0 {
+		t.Errorf("Object stored after a failed Send")
+	}
+}
+
+func TestNewRepositoryErrors(t *testing.T) {
+	client := getClient()
+	if _, err := NewRepository[struct{ A string }](client, "x"); err == nil {
+		t.Errorf("NewRepository without pk returned nil error")
+	}
+	if _, err := NewRepository[struct {
+		A string `redis:"a,pk"`
+		B string `redis:"b,pk"`
+	}](client, "x"); err == nil {
+		t.Errorf("NewRepository with two pk fields returned nil error")
+	}
+	if _, err := NewRepository[struct {
+		A string `redis:"a,pk"`
+		B string `redis:"b,sorted"`
+	}](client, "x"); err == nil {
+		t.Errorf("NewRepository with string sorted field returned nil error")
+	}
+	if _, err := NewRepository[int](client, "x"); err == nil {
+		t.Errorf("NewRepository[int] returned nil error")
+	}
+}
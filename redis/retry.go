@@ -0,0 +1,228 @@
+package redis
+
+import (
+	"io"
+	"math/rand"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RetryPolicy specifies how RedisClient retries commands that fail with a
+// transient error.
+//
+// A command is retried when the error is transient (see IsTransientError) and
+// the command is safe to send again. Commands that are not idempotent, such as
+// INCR or LPUSH, are never sent again unless RetryNonIdempotent is set because
+// the first attempt may have been executed by the server before the error was
+// reported. The same applies to writes whose reply depends on the previous
+// state, such as DEL, HSET, SADD and SET with the NX, XX or GET options.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of times a command is sent,
+	// including the first attempt. Values less than 2 disable retries.
+	MaxAttempts int
+
+	// MinBackoff is the delay before the first retry. The delay doubles on
+	// each subsequent retry. If zero, then 8 milliseconds is used.
+	MinBackoff time.Duration
+
+	// MaxBackoff caps the delay between retries. If zero, then 512
+	// milliseconds is used.
+	MaxBackoff time.Duration
+
+	// Jitter is the fraction of each delay that is randomized. A value of
+	// 0.2 spreads the delay uniformly between 80% and 100% of the computed
+	// backoff. Values are clamped to [0, 1].
+	Jitter float64
+
+	// RetryNonIdempotent allows commands that are not known to be idempotent
+	// to be retried.
+	RetryNonIdempotent bool
+
+	// ShouldRetry optionally overrides the classification of errors. If
+	// nil, then IsTransientError is used.
+	ShouldRetry func(err error) bool
+
+	// IsIdempotent optionally overrides the classification of commands. If
+	// nil, then the package's command table is used.
+	IsIdempotent func(commandName string, args []interface{}) bool
+}
+
+var (
+	jitterMu   sync.Mutex
+	jitterRand = rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	sleepFunc = time.Sleep // for testing
+)
+
+// jitter returns a random duration in [0, d).
+func jitter(d time.Duration) time.Duration {
+	if d <= 0 {
+		return 0
+	}
+	jitterMu.Lock()
+	n := jitterRand.Int63n(int64(d))
+	jitterMu.Unlock()
+	return time.Duration(n)
+}
+
+// transientErrorPrefixes are the error reply prefixes returned by a server
+// that is temporarily unable to execute a command.
+var transientErrorPrefixes = []string{"LOADING", "BUSY", "TRYAGAIN", "READONLY", "MASTERDOWN"}
+
+// IsTransientError returns true if err is likely to go away when the command
+// is sent again on a fresh connection. Transient errors are network errors,
+// unexpected EOF on a connection and the LOADING, BUSY, TRYAGAIN, READONLY
+// and MASTERDOWN error replies.
+func IsTransientError(err error) bool {
+	switch err := err.(type) {
+	case nil:
+		return false
+	case Error:
+		s := string(err)
+		for _, prefix := range transientErrorPrefixes {
+			if strings.HasPrefix(s, prefix) {
+				return true
+			}
+		}
+		return false
+	case net.Error:
+		return true
+	}
+	return err == io.EOF || err == io.ErrUnexpectedEOF
+}
+
+// isCommandIdempotent returns true if the command can be safely sent again.
+func isCommandIdempotent(commandName string, args []interface{}) bool {
+	if !lookupCommandInfo(commandName).Idempotent {
+		return false
+	}
+	// SET with the GET option returns the previous value, which is changed
+	// by the first attempt. SET with NX or XX replies nil on a second
+	// attempt when the first attempt set the key.
+	if strings.EqualFold(commandName, CmdSet) && len(args) > 2 {
+		for _, arg := range args[2:] {
+			switch strings.ToUpper(argString(arg)) {
+			case ParamGet, ParamNX, ParamXX:
+				return false
+			}
+		}
+	}
+	// SCRIPT KILL and SCRIPT FLUSH act on the server state, so only the
+	// LOAD and EXISTS subcommands are sent again.
+	if strings.EqualFold(commandName, "SCRIPT") {
+		if len(args) == 0 {
+			return false
+		}
+		switch strings.ToUpper(argString(args[0])) {
+		case "LOAD", CmdExists:
+			return true
+		}
+		return false
+	}
+	return true
+}
+
+func (rp *RetryPolicy) attempts() int {
+	if rp == nil || rp.MaxAttempts < 1 {
+		return 1
+	}
+	return rp.MaxAttempts
+}
+
+// retryable returns true if a command that failed with err may be sent
+// again.
+func (rp *RetryPolicy) retryable(err error, commandName string, args []interface{}) bool {
+	if rp.ShouldRetry != nil {
+		if !rp.ShouldRetry(err) {
+			return false
+		}
+	} else if !IsTransientError(err) {
+		return false
+	}
+	if rp.RetryNonIdempotent {
+		return true
+	}
+	if rp.IsIdempotent != nil {
+		return rp.IsIdempotent(commandName, args)
+	}
+	return isCommandIdempotent(commandName, args)
+}
+
+// backoff returns the delay before retry number n, starting at 1.
+func (rp *RetryPolicy) backoff(n int) time.Duration {
+	minBackoff := rp.MinBackoff
+	if minBackoff <= 0 {
+		minBackoff = 8 * time.Millisecond
+	}
+	maxBackoff := rp.MaxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = 512 * time.Millisecond
+	}
+	d := minBackoff
+	for i := 1; i < n && d < maxBackoff; i++ {
+		d *= 2
+	}
+	if d > maxBackoff {
+		d = maxBackoff
+	}
+	f := rp.Jitter
+	if f > 1 {
+		f = 1
+	}
+	if f > 0 {
+		d -= jitter(time.Duration(float64(d)*f) + 1)
+	}
+	return d
+}
+
+// WithRetryPolicy returns a shallow copy of the client that uses policy for
+// the commands executed through the copy. Use a nil policy to disable
+// retries for a single call:
+//
+//	n, err := client.WithRetryPolicy(nil).Incr("counter")
+func (client *RedisClient) WithRetryPolicy(policy *RetryPolicy) *RedisClient {
+	c := *client
+	c.RetryPolicy = policy
+	return &c
+}
+
+// doWithRetry calls do with a connection from the pool until do succeeds or
+// the client's retry policy gives up.
+func (client *RedisClient) doWithRetry(commandName string, args []interface{}, do func(conn Conn) (interface{}, error)) (interface{}, error) {
+	rp := client.RetryPolicy
+	cb := client.circuitBreaker()
+	attempts := rp.attempts()
+	for n := 1; ; n++ {
+		if cb != nil {
+			if err := cb.check(); err != nil {
+				return nil, err
+			}
+		}
+		conn, err := client.GetConn()
+		if err != nil {
+			return 0, err
+		}
+		// Dial errors are reported by the pool.
+		_, dialFailed := conn.(errorConn)
+		var probe circuitProbe
+		if cb != nil && !dialFailed {
+			// The command is a probe when the circuit is half-open.
+			if probe, err = cb.acquire(); err != nil {
+				conn.Close()
+				return nil, err
+			}
+		}
+		reply, err := do(conn)
+		conn.Close()
+		if cb != nil && !dialFailed {
+			counted, failed := circuitOutcome(err)
+			cb.finish(probe, counted, failed, false)
+		}
+		if err == nil || n >= attempts || !rp.retryable(err, commandName, args) {
+			return reply, err
+		}
+		sleepFunc(rp.backoff(n))
+	}
+}
@@ -0,0 +1,225 @@
+package redis
+
+import (
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+// flakyConn fails the first failures commands with err.
+type flakyConn struct {
+	Conn
+	d *flakyDialer
+}
+
+func (c *flakyConn) Do(commandName string, args ...interface{}) (interface{}, error) {
+	if commandName == "" {
+		return nil, nil
+	}
+	c.d.commands = append(c.d.commands, commandName)
+	if c.d.failures > 0 {
+		c.d.failures--
+		return nil, c.d.err
+	}
+	return "OK", nil
+}
+
+func (c *flakyConn) Err() error   { return nil }
+func (c *flakyConn) Close() error { return nil }
+
+type flakyDialer struct {
+	failures int
+	err      error
+	commands []string
+}
+
+func (d *flakyDialer) client(rp *RetryPolicy) *RedisClient {
+	pool := &Pool{Dial: func() (Conn, error) { return &flakyConn{d: d}, nil }}
+	return &RedisClient{pool: pool, RetryPolicy: rp}
+}
+
+func setSleepFunc(t *testing.T) *[]time.Duration {
+	var delays []time.Duration
+	sleepFunc = func(d time.Duration) { delays = append(delays, d) }
+	t.Cleanup(func() { sleepFunc = time.Sleep })
+	return &delays
+}
+
+func TestIsTransientError(t *testing.T) {
+	for _, tt := range []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{io.EOF, true},
+		{Error("LOADING Redis is loading the dataset in memory"), true},
+		{Error("BUSY Redis is busy running a script"), true},
+		{Error("TRYAGAIN Multiple keys request during rehashing of slot"), true},
+		{Error("READONLY You can't write against a read only replica."), true},
+		{Error("MASTERDOWN Link with MASTER is down"), true},
+		{Error("ERR wrong number of arguments"), false},
+		{ErrPoolExhausted, false},
+	} {
+		if got := IsTransientError(tt.err); got != tt.want {
+			t.Errorf("IsTransientError(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestRetryTransientError(t *testing.T) {
+	delays := setSleepFunc(t)
+	d := &flakyDialer{failures: 2, err: Error("LOADING Redis is loading the dataset in memory")}
+	c := d.client(&RetryPolicy{MaxAttempts: 3, MinBackoff: time.Millisecond, MaxBackoff: 10 * time.Millisecond})
+	s, err := c.Get("key")
+	if err != nil || s != "OK" {
+		t.Fatalf("Get() = %q, %v, want %q, nil", s, err, "OK")
+	}
+	if len(d.commands) != 3 {
+		t.Errorf("commands = %v, want 3 attempts", d.commands)
+	}
+	if want := []time.Duration{time.Millisecond, 2 * time.Millisecond}; !equalDurations(*delays, want) {
+		t.Errorf("delays = %v, want %v", *delays, want)
+	}
+}
+
+func TestRetryGivesUp(t *testing.T) {
+	setSleepFunc(t)
+	d := &flakyDialer{failures: 5, err: io.EOF}
+	c := d.client(&RetryPolicy{MaxAttempts: 3})
+	if _, err := c.Get("key"); err != io.EOF {
+		t.Fatalf("Get() returned error %v, want %v", err, io.EOF)
+	}
+	if len(d.commands) != 3 {
+		t.Errorf("commands = %v, want 3 attempts", d.commands)
+	}
+}
+
+func TestRetryPermanentError(t *testing.T) {
+	setSleepFunc(t)
+	d := &flakyDialer{failures: 1, err: Error("ERR syntax error")}
+	c := d.client(&RetryPolicy{MaxAttempts: 3})
+	if _, err := c.Get("key"); err == nil {
+		t.Fatal("Get() returned nil error")
+	}
+	if len(d.commands) != 1 {
+		t.Errorf("commands = %v, want 1 attempt", d.commands)
+	}
+}
+
+func TestRetryNonIdempotent(t *testing.T) {
+	setSleepFunc(t)
+	d := &flakyDialer{failures: 1, err: io.EOF}
+	c := d.client(&RetryPolicy{MaxAttempts: 3})
+	if _, err := c.Do("INCR", "key"); err != io.EOF {
+		t.Fatalf("Do(INCR) returned error %v, want %v", err, io.EOF)
+	}
+	if len(d.commands) != 1 {
+		t.Errorf("commands = %v, want 1 attempt", d.commands)
+	}
+
+	d = &flakyDialer{failures: 1, err: io.EOF}
+	c = d.client(&RetryPolicy{MaxAttempts: 3, RetryNonIdempotent: true})
+	if _, err := c.Do("INCR", "key"); err != nil {
+		t.Fatalf("Do(INCR) returned error %v", err)
+	}
+	if len(d.commands) != 2 {
+		t.Errorf("commands = %v, want 2 attempts", d.commands)
+	}
+}
+
+func TestRetrySetGet(t *testing.T) {
+	setSleepFunc(t)
+	d := &flakyDialer{failures: 1, err: io.EOF}
+	c := d.client(&RetryPolicy{MaxAttempts: 3})
+	if _, err := c.Do("SET", "key", "value", "GET"); err != io.EOF {
+		t.Fatalf("Do(SET GET) returned error %v, want %v", err, io.EOF)
+	}
+	if len(d.commands) != 1 {
+		t.Errorf("commands = %v, want 1 attempt", d.commands)
+	}
+}
+
+func TestRetryNonIdempotentWrites(t *testing.T) {
+	for _, cmd := range [][]interface{}{
+		{"SET", "key", "value", []byte("get")},
+		{"SET", "key", "value", "nx", "PX", 1000},
+		{"SET", "key", "value", []byte("XX")},
+		{"DEL", "key"},
+		{"HSET", "key", "field", "value"},
+		{"SADD", "key", "member"},
+		{"SREM", "key", "member"},
+		{"ZREM", "key", "member"},
+		{"SCRIPT", "KILL"},
+		{"SCRIPT", []byte("flush"), "ASYNC"},
+		{"SCRIPT"},
+	} {
+		if isCommandIdempotent(cmd[0].(string), cmd[1:]) {
+			t.Errorf("isCommandIdempotent(%v) = true, want false", cmd)
+		}
+	}
+	if !isCommandIdempotent("SET", []interface{}{"key", "value", "EX", 10}) {
+		t.Errorf("isCommandIdempotent(SET EX) = false, want true")
+	}
+	for _, args := range [][]interface{}{{"LOAD", "return 1"}, {[]byte("exists"), "sha"}} {
+		if !isCommandIdempotent("script", args) {
+			t.Errorf("isCommandIdempotent(SCRIPT %v) = false, want true", args)
+		}
+	}
+
+	setSleepFunc(t)
+	d := &flakyDialer{failures: 1, err: io.EOF}
+	c := d.client(&RetryPolicy{MaxAttempts: 3})
+	if _, err := c.SetNX("key", "value", time.Second); err != io.EOF {
+		t.Fatalf("SetNX() returned error %v, want %v", err, io.EOF)
+	}
+	if len(d.commands) != 1 {
+		t.Errorf("commands = %v, want 1 attempt", d.commands)
+	}
+}
+
+func TestWithRetryPolicy(t *testing.T) {
+	setSleepFunc(t)
+	d := &flakyDialer{failures: 1, err: io.EOF}
+	c := d.client(&RetryPolicy{MaxAttempts: 3})
+	if _, err := c.WithRetryPolicy(nil).Get("key"); err != io.EOF {
+		t.Fatalf("Get() returned error %v, want %v", err, io.EOF)
+	}
+	if c.RetryPolicy == nil {
+		t.Fatal("WithRetryPolicy modified the receiver")
+	}
+
+	errCustom := errors.New("custom")
+	d = &flakyDialer{failures: 1, err: errCustom}
+	c = d.client(&RetryPolicy{MaxAttempts: 3, ShouldRetry: func(err error) bool { return err == errCustom }})
+	if _, err := c.Get("key"); err != nil {
+		t.Fatalf("Get() returned error %v", err)
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	rp := &RetryPolicy{MinBackoff: 10 * time.Millisecond, MaxBackoff: 50 * time.Millisecond}
+	for n, want := range []time.Duration{10, 20, 40, 50, 50} {
+		if got := rp.backoff(n + 1); got != want*time.Millisecond {
+			t.Errorf("backoff(%d) = %v, want %v", n+1, got, want*time.Millisecond)
+		}
+	}
+	rp.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if got := rp.backoff(1); got < 5*time.Millisecond || got > 10*time.Millisecond {
+			t.Fatalf("backoff(1) with jitter = %v, want value in [5ms, 10ms]", got)
+		}
+	}
+}
+
+func equalDurations(a, b []time.Duration) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -15,12 +15,15 @@
 package redis
 
 import (
+	"encoding"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"reflect"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 )
 
 var (
@@ -344,6 +347,15 @@ type fieldSpec struct {
 	name      string
 	index     []int
 	omitEmpty bool
+	encrypt   bool
+	json      bool
+	unix      bool
+	pk        bool
+
+	// setIndex and sortedIndex select the secondary indexes of the field
+	// in a Repository.
+	setIndex    bool
+	sortedIndex bool
 }
 
 type structSpec struct {
@@ -355,7 +367,49 @@ func (ss *structSpec) fieldSpec(name []byte) *fieldSpec {
 	return ss.m[string(name)]
 }
 
-func compileStructSpec(t reflect.Type, depth map[string]int, index []int, ss *structSpec) {
+var (
+	timeType            = reflect.TypeOf(time.Time{})
+	durationType        = reflect.TypeOf(time.Duration(0))
+	argumentType        = reflect.TypeOf((*Argument)(nil)).Elem()
+	textMarshalerType   = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// isNestedStruct returns true if fields of type t are flattened to the
+// fields of the struct. Structs that convert themselves to and from a
+// single value are not flattened.
+func isNestedStruct(t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || t == timeType {
+		return false
+	}
+	for _, it := range []reflect.Type{argumentType, scannerType, textMarshalerType, textUnmarshalerType, binaryMarshalerType, binaryUnmarshalerType} {
+		if t.Implements(it) || reflect.PtrTo(t).Implements(it) {
+			return false
+		}
+	}
+	return true
+}
+
+// compileStructSpec adds the fields of struct type t to ss. The names of
+// fields in nested structs are prefixed with prefix. The parents are the
+// types of the enclosing structs and stop the recursion on recursive
+// types.
+func compileStructSpec(t reflect.Type, depth map[string]int, index []int, prefix string, parents []reflect.Type, ss *structSpec) {
+	parents = append(parents, t)
+	recursive := func(ft reflect.Type) bool {
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		for _, p := range parents {
+			if p == ft {
+				return true
+			}
+		}
+		return false
+	}
 	for i := 0; i < t.NumField(); i++ {
 		f := t.Field(i)
 		switch {
@@ -364,15 +418,15 @@ func compileStructSpec(t reflect.Type, depth map[string]int, index []int, ss *st
 		case f.Anonymous:
 			switch f.Type.Kind() {
 			case reflect.Struct:
-				compileStructSpec(f.Type, depth, append(index, i), ss)
+				compileStructSpec(f.Type, depth, append(index, i), prefix, parents, ss)
 			case reflect.Ptr:
-				// TODO(steve): Protect against infinite recursion.
-				if f.Type.Elem().Kind() == reflect.Struct {
-					compileStructSpec(f.Type.Elem(), depth, append(index, i), ss)
+				if f.Type.Elem().Kind() == reflect.Struct && !recursive(f.Type) {
+					compileStructSpec(f.Type.Elem(), depth, append(index, i), prefix, parents, ss)
 				}
 			}
 		default:
 			fs := &fieldSpec{name: f.Name}
+			inline := false
 			tag := f.Tag.Get("redis")
 			p := strings.Split(tag, ",")
 			if len(p) > 0 {
@@ -386,11 +440,41 @@ func compileStructSpec(t reflect.Type, depth map[string]int, index []int, ss *st
 					switch s {
 					case "omitempty":
 						fs.omitEmpty = true
+					case "encrypt":
+						fs.encrypt = true
+					case "json":
+						fs.json = true
+					case "unix":
+						fs.unix = true
+					case "inline":
+						inline = true
+					case "pk":
+						fs.pk = true
+					case "index":
+						fs.setIndex = true
+					case "sorted":
+						fs.sortedIndex = true
 					default:
 						panic(fmt.Errorf("redigo: unknown field tag %s for type %s", s, t.Name()))
 					}
 				}
 			}
+			if !fs.json && isNestedStruct(f.Type) && !recursive(f.Type) {
+				ft := f.Type
+				if ft.Kind() == reflect.Ptr {
+					ft = ft.Elem()
+				}
+				nestedPrefix := prefix
+				if !inline {
+					nestedPrefix += fs.name + "."
+				}
+				compileStructSpec(ft, depth, append(index, i), nestedPrefix, parents, ss)
+				continue
+			}
+			if inline {
+				panic(fmt.Errorf("redigo: inline field tag on non-struct field %s of type %s", f.Name, t.Name()))
+			}
+			fs.name = prefix + fs.name
 			d, found := depth[fs.name]
 			if !found {
 				d = 1 << 30
@@ -419,6 +503,78 @@ func compileStructSpec(t reflect.Type, depth map[string]int, index []int, ss *st
 	}
 }
 
+// fieldByIndex returns the nested field of struct v at index. Nil pointers
+// to embedded or nested structs are allocated if alloc is true. Otherwise,
+// fieldByIndex returns false for a field behind a nil pointer.
+func fieldByIndex(v reflect.Value, index []int, alloc bool) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				if !alloc || !v.CanSet() {
+					return reflect.Value{}, false
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
+
+// convertAssignField converts a field value read from Redis to d using the
+// options of fs. Bulk strings are decoded as JSON for the json option and
+// with the UnmarshalText or UnmarshalBinary method of the field if
+// available. Time and duration fields are parsed in the formats written by
+// flattenStruct.
+func convertAssignField(d reflect.Value, fs *fieldSpec, s interface{}) error {
+	p, ok := s.([]byte)
+	if !ok {
+		return convertAssignValue(d, s)
+	}
+	t := d.Type()
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	pt := reflect.PtrTo(t)
+	if pt.Implements(scannerType) || (!fs.json && t != durationType &&
+		!pt.Implements(textUnmarshalerType) && !pt.Implements(binaryUnmarshalerType)) {
+		return convertAssignValue(d, s)
+	}
+	if d.Kind() == reflect.Ptr {
+		if d.IsNil() {
+			d.Set(reflect.New(t))
+		}
+		d = d.Elem()
+	}
+	switch {
+	case fs.json:
+		return json.Unmarshal(p, d.Addr().Interface())
+	case t == timeType && fs.unix:
+		n, err := strconv.ParseInt(string(p), 10, 64)
+		if err != nil {
+			return err
+		}
+		d.Set(reflect.ValueOf(time.Unix(n, 0).UTC()))
+		return nil
+	case t == durationType:
+		x, err := time.ParseDuration(string(p))
+		if err != nil {
+			n, err2 := strconv.ParseInt(string(p), 10, 64)
+			if err2 != nil {
+				return err
+			}
+			x = time.Duration(n)
+		}
+		d.SetInt(int64(x))
+		return nil
+	case pt.Implements(textUnmarshalerType):
+		return d.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText(p)
+	default:
+		return d.Addr().Interface().(encoding.BinaryUnmarshaler).UnmarshalBinary(p)
+	}
+}
+
 var (
 	structSpecMutex  sync.RWMutex
 	structSpecCache  = make(map[reflect.Type]*structSpec)
@@ -442,7 +598,7 @@ func structSpecForType(t reflect.Type) *structSpec {
 	}
 
 	ss = &structSpec{m: make(map[string]*fieldSpec)}
-	compileStructSpec(t, make(map[string]int), nil, ss)
+	compileStructSpec(t, make(map[string]int), nil, "", nil, ss)
 	structSpecCache[t] = ss
 	return ss
 }
@@ -457,13 +613,34 @@ var errScanStructValue = errors.New("redigo.ScanStruct: value must be non-nil po
 //
 //      Field int `redis:"myName"`
 //
-// Fields with the tag redis:"-" are ignored.
+// Fields with the tag redis:"-" are ignored. The encrypt option marks fields
+// that RedisClient encrypts with its Encryption codec; ScanStruct itself
+// does not decrypt.
 //
 // Each field uses RedisScan if available otherwise:
 // Integer, float, boolean, string and []byte fields are supported. Scan uses the
 // standard strconv package to convert bulk string values to numeric and
 // boolean types.
 //
+// Fields of type time.Time are read in RFC 3339 format or, with the unix
+// tag option, as seconds since the Unix epoch. Fields of type time.Duration
+// are read in the format of time.ParseDuration or as nanoseconds. Fields that
+// implement encoding.TextUnmarshaler or encoding.BinaryUnmarshaler are read
+// with UnmarshalText or UnmarshalBinary. The json tag option reads a field,
+// such as a map or slice, from its JSON encoding:
+//
+//	Tags    []string  `redis:"tags,json"`
+//	Created time.Time `redis:"created,unix"`
+//
+// The pk, index and sorted options declare the primary key and secondary
+// indexes of a Repository.
+//
+// The fields of a nested struct are named with the name of the struct field
+// and a dot as prefix. The inline option removes the prefix:
+//
+//	Addr Address `redis:"addr"`    // fields addr.city, addr.zip, ...
+//	Meta Meta    `redis:",inline"` // fields of Meta without a prefix
+//
 // If a src element is nil, then the corresponding field is not modified.
 func ScanStruct(src []interface{}, dest interface{}) error {
 	d := reflect.ValueOf(dest)
@@ -493,7 +670,11 @@ func ScanStruct(src []interface{}, dest interface{}) error {
 		if fs == nil {
 			continue
 		}
-		if err := convertAssignValue(d.FieldByIndex(fs.index), s); err != nil {
+		fv, ok := fieldByIndex(d, fs.index, true)
+		if !ok {
+			continue
+		}
+		if err := convertAssignField(fv, fs, s); err != nil {
 			return fmt.Errorf("redigo.ScanStruct: cannot assign field %s: %v", fs.name, err)
 		}
 	}
@@ -580,7 +761,11 @@ func ScanSlice(src []interface{}, dest interface{}, fieldNames ...string) error
 			if s == nil {
 				continue
 			}
-			if err := convertAssignValue(d.FieldByIndex(fs.index), s); err != nil {
+			fv, ok := fieldByIndex(d, fs.index, true)
+			if !ok {
+				continue
+			}
+			if err := convertAssignField(fv, fs, s); err != nil {
 				return fmt.Errorf("redigo.ScanSlice: cannot assign element %d to field %s: %v", i*len(fss)+j, fs.name, err)
 			}
 		}
@@ -604,15 +789,30 @@ func (args Args) Add(value ...interface{}) Args {
 //
 // Structs are flattened by appending the alternating names and values of
 // exported fields to args. If v is a nil struct pointer, then nothing is
-// appended. The 'redis' field tag overrides struct field names. See ScanStruct
-// for more information on the use of the 'redis' field tag.
+// appended. The 'redis' field tag overrides struct field names. Field values
+// are written in the formats read by ScanStruct, so that a struct flattened
+// with AddFlat can be read back with ScanStruct. Fields that are nil pointers
+// are not appended. AddFlat panics if the MarshalText, MarshalBinary or JSON
+// encoding of a field fails. See ScanStruct for more information on the use
+// of the 'redis' field tag.
 //
 // Other types are appended to args as is.
 func (args Args) AddFlat(v interface{}) Args {
+	args, err := args.addFlat(v)
+	if err != nil {
+		panic(err)
+	}
+	return args
+}
+
+// addFlat is like AddFlat but returns the error of a field that cannot be
+// marshaled.
+func (args Args) addFlat(v interface{}) (Args, error) {
+	var err error
 	rv := reflect.ValueOf(v)
 	switch rv.Kind() {
 	case reflect.Struct:
-		args = flattenStruct(args, rv)
+		args, err = flattenStruct(args, rv)
 	case reflect.Slice:
 		for i := 0; i < rv.Len(); i++ {
 			args = append(args, rv.Index(i).Interface())
@@ -624,7 +824,7 @@ func (args Args) AddFlat(v interface{}) Args {
 	case reflect.Ptr:
 		if rv.Type().Elem().Kind() == reflect.Struct {
 			if !rv.IsNil() {
-				args = flattenStruct(args, rv.Elem())
+				args, err = flattenStruct(args, rv.Elem())
 			}
 		} else {
 			args = append(args, v)
@@ -632,13 +832,16 @@ func (args Args) AddFlat(v interface{}) Args {
 	default:
 		args = append(args, v)
 	}
-	return args
+	return args, err
 }
 
-func flattenStruct(args Args, v reflect.Value) Args {
+func flattenStruct(args Args, v reflect.Value) (Args, error) {
 	ss := structSpecForType(v.Type())
 	for _, fs := range ss.l {
-		fv := v.FieldByIndex(fs.index)
+		fv, ok := fieldByIndex(v, fs.index, false)
+		if !ok {
+			continue
+		}
 		if fs.omitEmpty {
 			var empty = false
 			switch fv.Kind() {
@@ -654,20 +857,66 @@ func flattenStruct(args Args, v reflect.Value) Args {
 				empty = fv.Float() == 0
 			case reflect.Interface, reflect.Ptr:
 				empty = fv.IsNil()
+			case reflect.Struct:
+				if t, ok := fv.Interface().(time.Time); ok {
+					empty = t.IsZero()
+				}
 			}
 			if empty {
 				continue
 			}
 		}
-		if arg, ok := fv.Interface().(Argument); ok {
-			args = append(args, fs.name, arg.RedisArg())
-		} else if fv.Kind() == reflect.Ptr {
-			if !fv.IsNil() {
-				args = append(args, fs.name, fv.Elem().Interface())
-			}
-		} else {
-			args = append(args, fs.name, fv.Interface())
+		arg, ok, err := fieldArg(fs, fv)
+		if err != nil {
+			return args, fmt.Errorf("redigo: cannot marshal field %s: %v", fs.name, err)
+		}
+		if ok {
+			args = append(args, fs.name, arg)
 		}
 	}
-	return args
+	return args, nil
+}
+
+// fieldArg returns the command argument for field value fv. The boolean
+// result is false for nil pointers.
+func fieldArg(fs *fieldSpec, fv reflect.Value) (interface{}, bool, error) {
+	if arg, ok := fv.Interface().(Argument); ok {
+		return arg.RedisArg(), true, nil
+	}
+	if fv.Kind() == reflect.Ptr {
+		if fv.IsNil() {
+			return nil, false, nil
+		}
+		fv = fv.Elem()
+	}
+	if fs.json {
+		p, err := json.Marshal(fv.Interface())
+		return p, true, err
+	}
+	switch x := fv.Interface().(type) {
+	case time.Time:
+		if fs.unix {
+			return x.Unix(), true, nil
+		}
+		return x.Format(time.RFC3339Nano), true, nil
+	case time.Duration:
+		return x.String(), true, nil
+	case encoding.TextMarshaler:
+		p, err := x.MarshalText()
+		return p, true, err
+	case encoding.BinaryMarshaler:
+		p, err := x.MarshalBinary()
+		return p, true, err
+	}
+	if fv.CanAddr() {
+		switch x := fv.Addr().Interface().(type) {
+		case encoding.TextMarshaler:
+			p, err := x.MarshalText()
+			return p, true, err
+		case encoding.BinaryMarshaler:
+			p, err := x.MarshalBinary()
+			return p, true, err
+		}
+	}
+	return fv.Interface(), true, nil
 }
@@ -15,8 +15,10 @@
 package redis_test
 
 import (
+	"errors"
 	"fmt"
 	"math"
+	"net"
 	"reflect"
 	"strconv"
 	"testing"
@@ -513,6 +515,96 @@ var argsTests = []struct {
 	},
 }
 
+type roundTripAddress struct {
+	City string `redis:"city"`
+	Zip  string `redis:"zip,omitempty"`
+}
+
+type roundTripMeta struct {
+	Version int `redis:"version"`
+}
+
+type roundTripStruct struct {
+	Name     string            `redis:"name"`
+	Created  time.Time         `redis:"created"`
+	Seen     time.Time         `redis:"seen,unix"`
+	Deleted  time.Time         `redis:"deleted,omitempty"`
+	TTL      time.Duration     `redis:"ttl"`
+	IP       net.IP            `redis:"ip"`
+	Tags     []string          `redis:"tags,json"`
+	Attrs    map[string]int    `redis:"attrs,json"`
+	Addr     roundTripAddress  `redis:"addr"`
+	Work     *roundTripAddress `redis:"work"`
+	Home     *roundTripAddress `redis:"home"`
+	Meta     roundTripMeta     `redis:",inline"`
+	Duration *time.Duration    `redis:"duration"`
+}
+
+func TestArgsScanStructRoundTrip(t *testing.T) {
+	d := 90 * time.Second
+	in := roundTripStruct{
+		Name:     "alice",
+		Created:  time.Date(2021, 3, 4, 5, 6, 7, 8, time.UTC),
+		Seen:     time.Unix(1614834367, 0).UTC(),
+		TTL:      time.Hour + 30*time.Minute,
+		IP:       net.ParseIP("192.168.1.2"),
+		Tags:     []string{"a", "b"},
+		Attrs:    map[string]int{"x": 1},
+		Addr:     roundTripAddress{City: "Paris", Zip: "75001"},
+		Work:     &roundTripAddress{City: "Lyon"},
+		Meta:     roundTripMeta{Version: 3},
+		Duration: &d,
+	}
+	args := redis.Args{}.AddFlat(&in)
+
+	var names []string
+	reply := make([]interface{}, len(args))
+	for i, arg := range args {
+		switch arg := arg.(type) {
+		case []byte:
+			reply[i] = arg
+		default:
+			reply[i] = []byte(fmt.Sprint(arg))
+		}
+		if i%2 == 0 {
+			names = append(names, arg.(string))
+		}
+	}
+	require.Equal(t, []string{"name", "created", "seen", "ttl", "ip", "tags", "attrs", "addr.city", "addr.zip", "work.city", "version", "duration"}, names)
+
+	var out roundTripStruct
+	require.NoError(t, redis.ScanStruct(reply, &out))
+	require.Equal(t, in, out)
+}
+
+type failingMarshaler struct{}
+
+func (failingMarshaler) MarshalText() ([]byte, error) {
+	return nil, errors.New("cannot marshal")
+}
+
+func TestArgsFailingMarshaler(t *testing.T) {
+	require.PanicsWithError(t, "redigo: cannot marshal field b: cannot marshal", func() {
+		redis.Args{}.AddFlat(struct {
+			A string           `redis:"a"`
+			B failingMarshaler `redis:"b"`
+		}{A: "x"})
+	})
+}
+
+func TestArgsUnknownTagOption(t *testing.T) {
+	require.Panics(t, func() {
+		redis.Args{}.AddFlat(struct {
+			A string `redis:"a,bogus"`
+		}{})
+	})
+	require.Panics(t, func() {
+		redis.Args{}.AddFlat(struct {
+			A string `redis:",inline"`
+		}{})
+	})
+}
+
 func TestArgs(t *testing.T) {
 	for _, tt := range argsTests {
 		t.Run(tt.title, func(t *testing.T) {
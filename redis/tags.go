@@ -0,0 +1,146 @@
+package redis
+
+import (
+	"strconv"
+	"time"
+)
+
+// DefaultTagKeyPrefix is the prefix of the keys of the sorted sets that
+// record the keys tagged by SetWithTags when RedisClient.TagKeyPrefix is
+// empty.
+const DefaultTagKeyPrefix = "tag:"
+
+// tagChunkSize is the number of keys deleted by InvalidateTags per round
+// trip.
+const tagChunkSize = 500
+
+// tagKey returns the key of the sorted set of tag: the tag key prefix of
+// the client followed by the tag.
+func (client *RedisClient) tagKey(tag string) string {
+	if client.TagKeyPrefix != "" {
+		return client.TagKeyPrefix + tag
+	}
+	return DefaultTagKeyPrefix + tag
+}
+
+// tagScore returns the score of a key in a tag set: the expiry time of the
+// key in Unix milliseconds or +inf for a key without expiration.
+func tagScore(expiration time.Duration) interface{} {
+	if expiration <= 0 {
+		return ParamMaximum
+	}
+	return nowFunc().Add(expiration).UnixNano() / int64(time.Millisecond)
+}
+
+// execMulti executes the commands queued after MULTI on conn and returns the
+// first error reply of the transaction.
+func execMulti(conn Conn) ([]interface{}, error) {
+	replies, err := Values(conn.Do(CmdExec))
+	if err != nil {
+		return nil, err
+	}
+	for _, reply := range replies {
+		if err, ok := reply.(Error); ok {
+			return nil, err
+		}
+	}
+	return replies, nil
+}
+
+// SetWithTags sets key to the encoding of value and adds the key to the set
+// of each tag in a single transaction. Zero expiration means the key has no
+// expiration time. Use InvalidateTags to delete all keys with a tag.
+//
+// The sets record the expiry time of their keys. Members of expired keys
+// are removed from the sets of the tags written by SetWithTags and by
+// PruneTags.
+func (client *RedisClient) SetWithTags(key string, value interface{}, expiration time.Duration, tags ...string) error {
+	p, err := client.encodeKey(key, "", value)
+	if err != nil {
+		return err
+	}
+	args := []interface{}{key, p}
+	if expiration > 0 {
+		if usePrecise(expiration) {
+			args = append(args, ParamPX, formatMs(expiration))
+		} else {
+			args = append(args, ParamEX, formatSec(expiration))
+		}
+	}
+	score := tagScore(expiration)
+	now := strconv.FormatInt(nowFunc().UnixNano()/int64(time.Millisecond), 10)
+
+	conn, err := client.GetConn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.Send(CmdMulti)
+	conn.Send(CmdSet, args...)
+	for _, tag := range tags {
+		conn.Send(ZAdd, client.tagKey(tag), score, key)
+		conn.Send(ZRemRangeByScore, client.tagKey(tag), ParamMinimum, "("+now)
+	}
+	_, err = execMulti(conn)
+	return err
+}
+
+// InvalidateTags deletes the keys with any of the tags. The keys are read
+// from the tag sets and deleted in chunks, so that tags with many keys do not
+// block the server. The members of the deleted keys are removed from the tag
+// sets; keys tagged while InvalidateTags runs are left in the sets.
+// InvalidateTags returns the number of deleted keys.
+func (client *RedisClient) InvalidateTags(tags ...string) (int64, error) {
+	conn, err := client.GetConn()
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	var n int64
+	for _, tag := range tags {
+		tagKey := client.tagKey(tag)
+		for {
+			keys, err := Values(conn.Do(ZRange, tagKey, 0, tagChunkSize-1))
+			if err != nil {
+				return n, err
+			}
+			if len(keys) == 0 {
+				break
+			}
+			conn.Send(CmdMulti)
+			conn.Send(CmdDel, keys...)
+			conn.Send(ZRem, append([]interface{}{tagKey}, keys...)...)
+			replies, err := execMulti(conn)
+			if err != nil {
+				return n, err
+			}
+			deleted, _ := Int64(replies[0], nil)
+			n += deleted
+		}
+	}
+	return n, nil
+}
+
+// PruneTags removes the members of expired keys from the sets of the tags
+// and returns the number of removed members. Members are also pruned when
+// SetWithTags writes a tag, so PruneTags is only needed for tags that are
+// no longer written.
+func (client *RedisClient) PruneTags(tags ...string) (int64, error) {
+	now := strconv.FormatInt(nowFunc().UnixNano()/int64(time.Millisecond), 10)
+	var n int64
+	for _, tag := range tags {
+		removed, err := client.Int64(ZRemRangeByScore, client.tagKey(tag), ParamMinimum, "("+now)
+		if err != nil {
+			return n, err
+		}
+		n += removed
+	}
+	return n, nil
+}
+
+// TagMembers returns the keys recorded in the set of tag, including keys
+// that expired and are not yet pruned.
+func (client *RedisClient) TagMembers(tag string) ([]string, error) {
+	return client.StringSlice(ZRange, client.tagKey(tag), 0, -1)
+}
@@ -0,0 +1,185 @@
+package redis
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/swanwish/redigo/internal/fakeredis"
+)
+
+// newTagsClient returns a client of a new fake server. The client and the
+// server share the server clock.
+func newTagsClient(t *testing.T, dial func(c Conn) Conn) (*RedisClient, *fakeredis.Server) {
+	s, err := fakeredis.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SetTime(time.Unix(1600000000, 0))
+	nowFunc = s.Now
+	t.Cleanup(func() {
+		nowFunc = time.Now
+		s.Close()
+	})
+	pool := &Pool{Dial: func() (Conn, error) {
+		c, err := Dial("tcp", s.Addr())
+		if err != nil || dial == nil {
+			return c, err
+		}
+		return dial(c), nil
+	}}
+	return NewRedisClient(pool), s
+}
+
+// hookConn calls after with the command name and reply of each command.
+type hookConn struct {
+	Conn
+	after func(commandName string, reply interface{})
+}
+
+func (c hookConn) Do(commandName string, args ...interface{}) (interface{}, error) {
+	reply, err := c.Conn.Do(commandName, args...)
+	if err == nil {
+		c.after(commandName, reply)
+	}
+	return reply, err
+}
+
+func TestTags(t *testing.T) {
+	client := getClient()
+	client.Del("tagged:a", "tagged:b", "tagged:c", DefaultTagKeyPrefix+"product:42", DefaultTagKeyPrefix+"user:7")
+
+	if err := client.SetWithTags("tagged:a", "A", time.Minute, "product:42", "user:7"); err != nil {
+		t.Fatalf("SetWithTags returned %v", err)
+	}
+	client.SetWithTags("tagged:b", "B", 0, "product:42")
+	client.SetWithTags("tagged:c", "C", 0, "user:7")
+
+	if keys, err := client.TagMembers("product:42"); err != nil || !reflect.DeepEqual(keys, []string{"tagged:a", "tagged:b"}) {
+		t.Errorf("TagMembers returned %v, %v, want [tagged:a tagged:b]", keys, err)
+	}
+	var s string
+	if err := client.GetValue(&s, "tagged:a"); err != nil || s != "A" {
+		t.Errorf("GetValue returned %q, %v, want A, nil", s, err)
+	}
+
+	n, err := client.InvalidateTags("product:42")
+	if err != nil || n != 2 {
+		t.Errorf("InvalidateTags returned %d, %v, want 2, nil", n, err)
+	}
+	if n, _ := client.Exists("tagged:a", "tagged:b", DefaultTagKeyPrefix+"product:42"); n != 0 {
+		t.Errorf("%d keys exist after InvalidateTags, want 0", n)
+	}
+	if n, _ := client.Exists("tagged:c"); n != 1 {
+		t.Errorf("tagged:c deleted by InvalidateTags of another tag")
+	}
+
+	// The member of the deleted key is left in the set of user:7.
+	n, err = client.InvalidateTags("user:7", "missing")
+	if err != nil || n != 1 {
+		t.Errorf("InvalidateTags returned %d, %v, want 1, nil", n, err)
+	}
+}
+
+func TestTagKeyPrefix(t *testing.T) {
+	// Two applications that share a database use different prefixes.
+	app1, app2 := *getClient(), *getClient()
+	app1.TagKeyPrefix, app2.TagKeyPrefix = "app1:tag:", "app2:tag:"
+	app1.Del("app1:k", "app2:k", "app1:tag:t", "app2:tag:t")
+	defer app1.Del("app1:k", "app2:k", "app1:tag:t", "app2:tag:t")
+
+	app1.SetWithTags("app1:k", "1", 0, "t")
+	app2.SetWithTags("app2:k", "2", 0, "t")
+	if n, err := app1.InvalidateTags("t"); err != nil || n != 1 {
+		t.Errorf("InvalidateTags returned %d, %v, want 1, nil", n, err)
+	}
+	if n, _ := app1.Exists("app1:k", "app2:k"); n != 1 {
+		t.Errorf("%d keys exist after InvalidateTags, want 1", n)
+	}
+	if keys, _ := app2.TagMembers("t"); !reflect.DeepEqual(keys, []string{"app2:k"}) {
+		t.Errorf("TagMembers returned %v, want [app2:k]", keys)
+	}
+
+	// The tag keys of a namespaced client are in the namespace.
+	ns := app1.WithNamespace("ns:")
+	defer app1.Del("ns:k", "ns:app1:tag:t")
+	ns.SetWithTags("k", "v", 0, "t")
+	if n, _ := app1.Exists("ns:k", "ns:app1:tag:t"); n != 2 {
+		t.Errorf("%d of the namespaced key and tag key exist, want 2", n)
+	}
+	if n, err := ns.InvalidateTags("t"); err != nil || n != 1 {
+		t.Errorf("InvalidateTags of namespaced client returned %d, %v, want 1, nil", n, err)
+	}
+}
+
+func TestInvalidateTagsChunks(t *testing.T) {
+	client := getClient()
+	defer client.Del(DefaultTagKeyPrefix + "many")
+
+	count := tagChunkSize*2 + 10
+	for i := 0; i < count; i++ {
+		client.SetWithTags(fmt.Sprintf("tagged:many:%d", i), i, 0, "many")
+	}
+	n, err := client.InvalidateTags("many")
+	if err != nil || n != int64(count) {
+		t.Errorf("InvalidateTags returned %d, %v, want %d, nil", n, err, count)
+	}
+	if keys, _ := client.Keys("tagged:many:*"); len(keys) != 0 {
+		t.Errorf("%d keys exist after InvalidateTags", len(keys))
+	}
+}
+
+func TestInvalidateTagsConcurrentTag(t *testing.T) {
+	var (
+		other  *RedisClient
+		tagged bool
+	)
+	client, _ := newTagsClient(t, func(c Conn) Conn {
+		return hookConn{c, func(commandName string, reply interface{}) {
+			// Tag a key after InvalidateTags read the last chunk.
+			if values, ok := reply.([]interface{}); ok && commandName == ZRange && len(values) == 0 && !tagged {
+				tagged = true
+				if err := other.SetWithTags("tagged:late", "L", 0, "race"); err != nil {
+					t.Errorf("SetWithTags returned %v", err)
+				}
+			}
+		}}
+	})
+	other = NewRedisClient(&Pool{Dial: client.pool.Dial})
+
+	client.SetWithTags("tagged:early", "E", 0, "race")
+	n, err := client.InvalidateTags("race")
+	if err != nil || n != 1 {
+		t.Errorf("InvalidateTags returned %d, %v, want 1, nil", n, err)
+	}
+	if !tagged {
+		t.Fatal("key not tagged during InvalidateTags")
+	}
+	if keys, _ := client.TagMembers("race"); !reflect.DeepEqual(keys, []string{"tagged:late"}) {
+		t.Errorf("TagMembers returned %v, want [tagged:late]", keys)
+	}
+}
+
+func TestPruneTags(t *testing.T) {
+	client, s := newTagsClient(t, nil)
+
+	client.SetWithTags("tagged:short", "x", 10*time.Second, "prune")
+	client.SetWithTags("tagged:keep", "y", 0, "prune")
+	s.Advance(20 * time.Second)
+
+	if n, err := client.PruneTags("prune"); err != nil || n != 1 {
+		t.Errorf("PruneTags returned %d, %v, want 1, nil", n, err)
+	}
+	if keys, _ := client.TagMembers("prune"); !reflect.DeepEqual(keys, []string{"tagged:keep"}) {
+		t.Errorf("TagMembers returned %v, want [tagged:keep]", keys)
+	}
+
+	// Writing a tag prunes the members of expired keys.
+	client.SetWithTags("tagged:short", "x", 10*time.Second, "prune")
+	s.Advance(20 * time.Second)
+	client.SetWithTags("tagged:keep", "y", 0, "prune")
+	if keys, _ := client.TagMembers("prune"); !reflect.DeepEqual(keys, []string{"tagged:keep"}) {
+		t.Errorf("TagMembers returned %v after SetWithTags, want [tagged:keep]", keys)
+	}
+}
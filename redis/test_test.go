@@ -16,6 +16,7 @@ package redis
 
 import (
 	"bufio"
+	"context"
 	"errors"
 	"flag"
 	"fmt"
@@ -34,6 +35,13 @@ func SetNowFunc(f func() time.Time) {
 	nowFunc = f
 }
 
+// MaintainPool runs one cycle of the pool's maintenance goroutine.
+func MaintainPool(p *Pool) {
+	p.checkIdle()
+	p.fillIdle(context.Background(), p.minIdle())
+	p.checkLeaks()
+}
+
 var (
 	ErrNegativeInt = errNegativeInt
 
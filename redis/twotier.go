@@ -0,0 +1,391 @@
+package redis
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// TwoTierCache is an in-process LRU cache (L1) in front of the values stored
+// in Redis (L2). It is intended for small, read-heavy values such as
+// configuration.
+//
+// Set and Delete write through to Redis and publish the key on Channel. The
+// Listen method subscribes to the channel and drops the L1 entries of the
+// published keys, so that all processes that run Listen stop serving the old
+// value:
+//
+//	tc := &redis.TwoTierCache{Client: client, MaxEntries: 1000, LocalTTL: time.Minute}
+//	go tc.Listen(ctx)
+//	err := tc.Set("config:flags", flags, 0)
+//	err = tc.Get(&flags, "config:flags")
+//
+// Invalidations published while a process is not subscribed are missed.
+// The L1 is cleared when the subscription is established, and LocalTTL
+// bounds how long a missed invalidation can be served. If Strict is set,
+// then the L1 is bypassed while the process is not subscribed.
+//
+// The fields must not be modified after the cache is first used.
+type TwoTierCache struct {
+	// Client is the client used to access Redis.
+	Client *RedisClient
+
+	// Channel is the invalidation channel. If empty, then
+	// "redigo:invalidate" is used.
+	Channel string
+
+	// MaxEntries is the maximum number of entries in the L1. The least
+	// recently used entry is evicted when the limit is reached. If zero,
+	// then 1024 is used.
+	MaxEntries int
+
+	// LocalTTL is how long an entry is kept in the L1. LocalTTL should not
+	// be longer than the TTL of the keys in Redis. If zero, then one minute
+	// is used.
+	LocalTTL time.Duration
+
+	// Strict selects the consistency mode. If true, then reads go to Redis
+	// while the invalidation subscription is down.
+	Strict bool
+
+	// PingInterval is the interval at which Listen checks the health of
+	// the subscription. If zero, then 10 seconds is used.
+	PingInterval time.Duration
+
+	// ErrorHandler is called with the errors that interrupt Listen. If
+	// nil, then the errors are ignored.
+	ErrorHandler func(err error)
+
+	mu         sync.Mutex
+	ll         *list.List
+	entries    map[string]*list.Element
+	gen        uint64
+	subscribed bool
+	stats      TwoTierStats
+}
+
+// TwoTierStats contains the statistics of a TwoTierCache.
+type TwoTierStats struct {
+	// L1Hits is the number of reads served by the L1.
+	L1Hits int64
+
+	// L2Hits is the number of reads served by Redis.
+	L2Hits int64
+
+	// Misses is the number of reads of keys that do not exist.
+	Misses int64
+
+	// Evictions is the number of L1 entries evicted to make room for new
+	// entries.
+	Evictions int64
+
+	// Invalidations is the number of invalidation messages received.
+	Invalidations int64
+}
+
+// L1HitRate returns the fraction of reads served by the L1.
+func (s TwoTierStats) L1HitRate() float64 {
+	n := s.L1Hits + s.L2Hits + s.Misses
+	if n == 0 {
+		return 0
+	}
+	return float64(s.L1Hits) / float64(n)
+}
+
+// L2HitRate returns the fraction of reads not served by the L1 that are
+// served by Redis.
+func (s TwoTierStats) L2HitRate() float64 {
+	n := s.L2Hits + s.Misses
+	if n == 0 {
+		return 0
+	}
+	return float64(s.L2Hits) / float64(n)
+}
+
+type twoTierEntry struct {
+	key    string
+	value  []byte
+	expiry time.Time
+}
+
+func (tc *TwoTierCache) channel() string {
+	if tc.Channel == "" {
+		return "redigo:invalidate"
+	}
+	return tc.Channel
+}
+
+func (tc *TwoTierCache) maxEntries() int {
+	if tc.MaxEntries <= 0 {
+		return 1024
+	}
+	return tc.MaxEntries
+}
+
+func (tc *TwoTierCache) localTTL() time.Duration {
+	if tc.LocalTTL <= 0 {
+		return time.Minute
+	}
+	return tc.LocalTTL
+}
+
+func (tc *TwoTierCache) pingInterval() time.Duration {
+	if tc.PingInterval <= 0 {
+		return 10 * time.Second
+	}
+	return tc.PingInterval
+}
+
+// Stats returns the statistics of the cache.
+func (tc *TwoTierCache) Stats() TwoTierStats {
+	tc.mu.Lock()
+	stats := tc.stats
+	tc.mu.Unlock()
+	return stats
+}
+
+// Subscribed returns true if the cache is subscribed to the invalidation
+// channel.
+func (tc *TwoTierCache) Subscribed() bool {
+	tc.mu.Lock()
+	subscribed := tc.subscribed
+	tc.mu.Unlock()
+	return subscribed
+}
+
+// Len returns the number of entries in the L1.
+func (tc *TwoTierCache) Len() int {
+	tc.mu.Lock()
+	n := len(tc.entries)
+	tc.mu.Unlock()
+	return n
+}
+
+// useLocal returns true if the L1 can be used. The caller must hold tc.mu.
+func (tc *TwoTierCache) useLocal() bool {
+	return tc.subscribed || !tc.Strict
+}
+
+// lookup returns the L1 value of key. The caller must hold tc.mu.
+func (tc *TwoTierCache) lookup(key string) ([]byte, bool) {
+	if !tc.useLocal() {
+		return nil, false
+	}
+	e, ok := tc.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := e.Value.(*twoTierEntry)
+	if !nowFunc().Before(entry.expiry) {
+		tc.remove(key)
+		return nil, false
+	}
+	tc.ll.MoveToFront(e)
+	return entry.value, true
+}
+
+// add adds key to the L1. The caller must hold tc.mu.
+func (tc *TwoTierCache) add(key string, value []byte) {
+	if tc.entries == nil {
+		tc.entries = make(map[string]*list.Element)
+		tc.ll = list.New()
+	}
+	expiry := nowFunc().Add(tc.localTTL())
+	if e, ok := tc.entries[key]; ok {
+		tc.ll.MoveToFront(e)
+		entry := e.Value.(*twoTierEntry)
+		entry.value, entry.expiry = value, expiry
+		return
+	}
+	tc.entries[key] = tc.ll.PushFront(&twoTierEntry{key: key, value: value, expiry: expiry})
+	for len(tc.entries) > tc.maxEntries() {
+		e := tc.ll.Back()
+		tc.ll.Remove(e)
+		delete(tc.entries, e.Value.(*twoTierEntry).key)
+		tc.stats.Evictions++
+	}
+}
+
+// remove drops key from the L1. The caller must hold tc.mu.
+func (tc *TwoTierCache) remove(key string) {
+	if e, ok := tc.entries[key]; ok {
+		tc.ll.Remove(e)
+		delete(tc.entries, key)
+	}
+}
+
+// invalidateLocal drops keys from the L1. An empty list of keys clears the
+// L1. Reads from Redis that started before the invalidation do not add
+// their value to the L1.
+func (tc *TwoTierCache) invalidateLocal(keys ...string) {
+	tc.mu.Lock()
+	tc.gen++
+	if len(keys) == 0 {
+		tc.entries = nil
+		tc.ll = nil
+	}
+	for _, key := range keys {
+		tc.remove(key)
+	}
+	tc.mu.Unlock()
+}
+
+// Get decodes the value of key into the value pointed to by dest. The
+// value is read from the L1 if present and from Redis otherwise. Get
+// returns ErrNil if the key does not exist.
+func (tc *TwoTierCache) Get(dest interface{}, key string) error {
+	tc.mu.Lock()
+	p, ok := tc.lookup(key)
+	if ok {
+		tc.stats.L1Hits++
+	}
+	gen := tc.gen
+	tc.mu.Unlock()
+	if ok {
+		return tc.Client.decodeKey(key, "", p, dest)
+	}
+
+	p, err := Bytes(tc.Client.Do(CmdGet, key))
+	tc.mu.Lock()
+	switch err {
+	case nil:
+		tc.stats.L2Hits++
+		if gen == tc.gen && tc.useLocal() {
+			tc.add(key, p)
+		}
+	case ErrNil:
+		tc.stats.Misses++
+	}
+	tc.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return tc.Client.decodeKey(key, "", p, dest)
+}
+
+// Set sets key to the encoding of value and invalidates the key in all
+// processes. Zero expiration means the key has no expiration time.
+func (tc *TwoTierCache) Set(key string, value interface{}, expiration time.Duration) error {
+	p, err := tc.Client.encodeKey(key, "", value)
+	if err != nil {
+		return err
+	}
+	if _, err := tc.Client.Set(key, p, expiration); err != nil {
+		return err
+	}
+	return tc.Invalidate(key)
+}
+
+// Delete deletes keys and invalidates them in all processes.
+func (tc *TwoTierCache) Delete(keys ...string) error {
+	if _, err := tc.Client.Del(keys...); err != nil {
+		return err
+	}
+	return tc.Invalidate(keys...)
+}
+
+// Invalidate drops keys from the L1 and publishes the keys on the
+// invalidation channel. Use Invalidate after modifying keys without Set or
+// Delete.
+func (tc *TwoTierCache) Invalidate(keys ...string) error {
+	tc.invalidateLocal(keys...)
+	for _, key := range keys {
+		if _, err := tc.Client.Publish(tc.channel(), key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Listen subscribes to the invalidation channel and drops the L1 entries of
+// the keys published on the channel until ctx is done. Listen reconnects
+// after errors and returns ctx.Err(). Run Listen in its own goroutine.
+func (tc *TwoTierCache) Listen(ctx context.Context) error {
+	attempt := 0
+	for {
+		err := tc.listen(ctx)
+		tc.mu.Lock()
+		if tc.subscribed {
+			attempt = 0
+		}
+		tc.subscribed = false
+		tc.mu.Unlock()
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil && tc.ErrorHandler != nil {
+			tc.ErrorHandler(err)
+		}
+		backoff := 100 * time.Millisecond << uint(attempt)
+		if attempt < 5 {
+			attempt++
+		}
+		select {
+		case <-time.After(backoff - jitter(backoff/2)):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (tc *TwoTierCache) listen(ctx context.Context) error {
+	conn, err := tc.Client.GetConn()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	psc := PubSubConn{Conn: conn}
+	if err := psc.Subscribe(tc.channel()); err != nil {
+		return err
+	}
+
+	interval := tc.pingInterval()
+	done := make(chan error, 1)
+	go func() {
+		for {
+			switch n := psc.ReceiveWithTimeout(2 * interval).(type) {
+			case error:
+				done <- n
+				return
+			case Message:
+				tc.invalidateLocal(string(n.Data))
+				tc.mu.Lock()
+				tc.stats.Invalidations++
+				tc.mu.Unlock()
+			case Subscription:
+				switch n.Count {
+				case 1:
+					// Invalidations may have been missed before the
+					// subscription.
+					tc.invalidateLocal()
+					tc.mu.Lock()
+					tc.subscribed = true
+					tc.mu.Unlock()
+				case 0:
+					done <- nil
+					return
+				}
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := psc.Ping(""); err != nil {
+				// The receive loop fails when the connection is broken
+				// or the pong is not received in time.
+				<-done
+				return err
+			}
+		case <-ctx.Done():
+			psc.Unsubscribe()
+			return <-done
+		case err := <-done:
+			return err
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestTwoTierCache(t *testing.T) {
+	client := getClient()
+	client.Del("tier:a", "tier:b")
+	defer client.Del("tier:a", "tier:b")
+
+	tc := &TwoTierCache{Client: client, Channel: "tier:test"}
+	if err := tc.Set("tier:a", map[string]int{"x": 1}, 0); err != nil {
+		t.Fatalf("Set returned %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		var v map[string]int
+		if err := tc.Get(&v, "tier:a"); err != nil || v["x"] != 1 {
+			t.Fatalf("Get returned %v, %v, want map[x:1], nil", v, err)
+		}
+	}
+	var v map[string]int
+	if err := tc.Get(&v, "tier:b"); err != ErrNil {
+		t.Errorf("Get of missing key returned %v, want ErrNil", err)
+	}
+
+	stats := tc.Stats()
+	if stats.L1Hits != 2 || stats.L2Hits != 1 || stats.Misses != 1 {
+		t.Errorf("Stats returned %+v, want 2 L1 hits, 1 L2 hit and 1 miss", stats)
+	}
+	if r := stats.L1HitRate(); r != 0.5 {
+		t.Errorf("L1HitRate returned %v, want 0.5", r)
+	}
+	if r := stats.L2HitRate(); r != 0.5 {
+		t.Errorf("L2HitRate returned %v, want 0.5", r)
+	}
+
+	if err := tc.Delete("tier:a"); err != nil {
+		t.Fatalf("Delete returned %v", err)
+	}
+	if err := tc.Get(&v, "tier:a"); err != ErrNil {
+		t.Errorf("Get of deleted key returned %v, want ErrNil", err)
+	}
+}
+
+func TestTwoTierCacheInvalidation(t *testing.T) {
+	client := getClient()
+	client.Del("tier:c")
+	defer client.Del("tier:c")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	writer := &TwoTierCache{Client: client, Channel: "tier:invalidate"}
+	reader := &TwoTierCache{Client: client, Channel: "tier:invalidate", LocalTTL: time.Hour}
+	done := make(chan error, 1)
+	go func() { done <- reader.Listen(ctx) }()
+	waitFor(t, reader.Subscribed)
+
+	writer.Set("tier:c", "v1", 0)
+	waitFor(t, func() bool { return reader.Stats().Invalidations == 1 })
+	var s string
+	if err := reader.Get(&s, "tier:c"); err != nil || s != "v1" {
+		t.Fatalf("Get returned %q, %v, want v1, nil", s, err)
+	}
+	if reader.Len() != 1 {
+		t.Fatalf("Len returned %d, want 1", reader.Len())
+	}
+
+	writer.Set("tier:c", "v2", 0)
+	waitFor(t, func() bool { return reader.Len() == 0 })
+	if err := reader.Get(&s, "tier:c"); err != nil || s != "v2" {
+		t.Errorf("Get returned %q, %v, want v2, nil", s, err)
+	}
+	if n := reader.Stats().Invalidations; n != 2 {
+		t.Errorf("Invalidations is %d, want 2", n)
+	}
+
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("Listen returned %v, want %v", err, context.Canceled)
+	}
+	if reader.Subscribed() {
+		t.Errorf("Subscribed returned true after Listen returned")
+	}
+}
+
+func TestTwoTierCacheStrict(t *testing.T) {
+	client := getClient()
+	client.Set("tier:d", `"v"`, 0)
+	defer client.Del("tier:d")
+
+	for _, strict := range []bool{false, true} {
+		tc := &TwoTierCache{Client: client, Strict: strict}
+		var s string
+		tc.Get(&s, "tier:d")
+		tc.Get(&s, "tier:d")
+		want := int64(1)
+		if strict {
+			// The cache is not subscribed.
+			want = 0
+		}
+		if n := tc.Stats().L1Hits; n != want {
+			t.Errorf("strict=%v: L1Hits is %d, want %d", strict, n, want)
+		}
+	}
+}
+
+func TestTwoTierCacheEviction(t *testing.T) {
+	client := getClient()
+	client.Set("tier:e1", `1`, 0)
+	client.Set("tier:e2", `2`, 0)
+	client.Set("tier:e3", `3`, 0)
+	defer client.Del("tier:e1", "tier:e2", "tier:e3")
+
+	tc := &TwoTierCache{Client: client, MaxEntries: 2, LocalTTL: 50 * time.Millisecond}
+	var n int
+	tc.Get(&n, "tier:e1")
+	tc.Get(&n, "tier:e2")
+	tc.Get(&n, "tier:e1")
+	tc.Get(&n, "tier:e3")
+	if stats := tc.Stats(); stats.Evictions != 1 || tc.Len() != 2 {
+		t.Fatalf("Evictions is %d and Len is %d, want 1 and 2", stats.Evictions, tc.Len())
+	}
+	// tier:e2 is the least recently used entry.
+	tc.Get(&n, "tier:e1")
+	tc.Get(&n, "tier:e2")
+	if stats := tc.Stats(); stats.L1Hits != 2 || stats.L2Hits != 4 {
+		t.Errorf("Stats returned %+v, want 2 L1 hits and 4 L2 hits", stats)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	tc.Get(&n, "tier:e1")
+	if stats := tc.Stats(); stats.L2Hits != 5 {
+		t.Errorf("L2Hits is %d after LocalTTL, want 5", stats.L2Hits)
+	}
+}
@@ -0,0 +1,415 @@
+// Package redismock provides a mock redis.Conn for unit tests.
+//
+// Tests declare the commands that the code under test is expected to
+// execute along with the replies to return:
+//
+//	c := redismock.NewConn()
+//	c.Expect("GET", "user:1:name").Reply([]byte("gopher"))
+//	c.Expect("INCR", redismock.Regexp(`^visits:\d+$`)).Reply(int64(1))
+//	c.Expect("SET", "lock", redismock.AnyArgs()).Error(redis.Error("READONLY You can't write against a read only replica."))
+//
+//	... run the code under test with c ...
+//
+//	if err := c.ExpectationsWereMet(); err != nil {
+//		t.Error(err)
+//	}
+//
+// Expectations are matched in the order declared unless MatchInOrder(false)
+// is called. A command that does not match an expectation returns an error
+// and is reported by ExpectationsWereMet.
+//
+// Replies are returned as is and should have the types listed in the
+// section 'Executing Commands' of the redis package documentation: int64,
+// string for status replies, []byte for bulk strings, []interface{}, nil
+// and redis.Error.
+package redismock
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/swanwish/redigo/redis"
+)
+
+var (
+	errClosed  = errors.New("redismock: closed")
+	errTimeout = errors.New("redismock: receive timeout")
+)
+
+// Conn is a mock implementation of redis.Conn and redis.ConnWithTimeout.
+// The methods are safe to call concurrently.
+type Conn struct {
+	*expectations
+	pending []result // replies to commands sent with Send
+	closed  bool
+	err     error
+}
+
+// expectations is the state shared by a Conn and the connections returned
+// by its Dial method.
+type expectations struct {
+	mu         sync.Mutex
+	cond       *sync.Cond
+	expected   []*Expectation
+	unordered  bool
+	pushed     []interface{}
+	unexpected []string
+}
+
+type result struct {
+	reply interface{}
+	err   error // non-nil for errors other than redis.Error
+}
+
+// NewConn returns a new mock connection with no expectations.
+func NewConn() *Conn {
+	x := &expectations{}
+	x.cond = sync.NewCond(&x.mu)
+	return &Conn{expectations: x}
+}
+
+// MatchInOrder sets whether commands must match the expectations in the
+// order declared. The default is true.
+func (c *Conn) MatchInOrder(ordered bool) {
+	c.mu.Lock()
+	c.unordered = !ordered
+	c.mu.Unlock()
+}
+
+// Expect declares that the command is expected once. Each argument is a
+// Matcher or a value. Values match arguments that have the same encoding
+// on the wire, for example the value 1 matches the arguments 1, int64(1)
+// and "1".
+//
+// The expectation replies with nil until Reply, Error or ReplyFunc is
+// called.
+func (c *Conn) Expect(commandName string, args ...interface{}) *Expectation {
+	e := &Expectation{commandName: commandName, args: args, times: 1}
+	c.mu.Lock()
+	c.expected = append(c.expected, e)
+	c.mu.Unlock()
+	return e
+}
+
+// Push queues a reply that is not the reply to a command, such as a pub/sub
+// message. Receive returns pushed replies after the replies to all sent
+// commands. Receive blocks until a reply is pushed or the connection is
+// closed. The pushed replies are shared with the connections returned by
+// Dial and each reply is received by one connection.
+func (c *Conn) Push(reply interface{}) {
+	c.mu.Lock()
+	c.pushed = append(c.pushed, reply)
+	c.mu.Unlock()
+	c.cond.Broadcast()
+}
+
+// ExpectationsWereMet returns an error describing the expectations that
+// were not met and the commands that did not match an expectation.
+func (c *Conn) ExpectationsWereMet() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var msgs []string
+	for _, e := range c.expected {
+		if e.calls < e.times {
+			msgs = append(msgs, fmt.Sprintf("expected %s %d time(s), called %d time(s)", e, e.times, e.calls))
+		}
+	}
+	for _, cmd := range c.unexpected {
+		msgs = append(msgs, "unexpected command "+cmd)
+	}
+	if len(msgs) == 0 {
+		return nil
+	}
+	return errors.New("redismock: " + strings.Join(msgs, "; "))
+}
+
+// Dial returns a new connection that shares the expectations and pushed
+// replies of c. Dial has the signature of the Dial field of redis.Pool. Each
+// connection has its own pending replies and is closed independently of c
+// and the other connections.
+//
+// The pool executes commands to reset the state of a connection returned to
+// the pool. Tests that leave a transaction or subscription open should
+// expect the DISCARD, UNWATCH, UNSUBSCRIBE, PUNSUBSCRIBE and ECHO commands
+// sent by the pool.
+func (c *Conn) Dial() (redis.Conn, error) {
+	return &Conn{expectations: c.expectations}, nil
+}
+
+// Close closes the connection.
+func (c *Conn) Close() error {
+	c.mu.Lock()
+	c.closed = true
+	c.mu.Unlock()
+	c.cond.Broadcast()
+	return nil
+}
+
+// Err returns a non-nil value if the connection is closed or an expectation
+// returned an error other than redis.Error.
+func (c *Conn) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.usable()
+}
+
+func (c *Conn) usable() error {
+	if c.err != nil {
+		return c.err
+	}
+	if c.closed {
+		return errClosed
+	}
+	return nil
+}
+
+// Send matches the command with the expectations and queues the reply for
+// Receive.
+func (c *Conn) Send(commandName string, args ...interface{}) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.usable(); err != nil {
+		return err
+	}
+	c.send(commandName, args)
+	return nil
+}
+
+func (c *Conn) send(commandName string, args []interface{}) {
+	e, next := c.match(commandName, args)
+	if e == nil {
+		cmd := formatCommand(commandName, args)
+		c.unexpected = append(c.unexpected, cmd)
+		msg := "redismock: unexpected command " + cmd
+		if next != nil {
+			msg += ", next expected " + next.String()
+		}
+		c.pending = append(c.pending, result{reply: redis.Error(msg)})
+		return
+	}
+	e.calls++
+	c.pending = append(c.pending, e.result(args))
+}
+
+// match returns the expectation for the command. When no expectation
+// matches, match returns the next expectation in order, if any.
+func (c *Conn) match(commandName string, args []interface{}) (e, next *Expectation) {
+	for _, e := range c.expected {
+		if e.calls >= e.times {
+			continue
+		}
+		if e.matches(commandName, args) {
+			return e, nil
+		}
+		if !c.unordered {
+			return nil, e
+		}
+	}
+	return nil, nil
+}
+
+// Flush returns an error if the connection is not usable.
+func (c *Conn) Flush() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.usable()
+}
+
+// Do sends the command and returns the reply.
+func (c *Conn) Do(commandName string, args ...interface{}) (interface{}, error) {
+	return c.DoWithTimeout(0, commandName, args...)
+}
+
+// DoWithTimeout sends the command and returns the reply. The timeout is
+// ignored.
+func (c *Conn) DoWithTimeout(timeout time.Duration, commandName string, args ...interface{}) (interface{}, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.usable(); err != nil {
+		return nil, err
+	}
+	if commandName != "" {
+		c.send(commandName, args)
+	}
+	pending := c.pending
+	c.pending = nil
+
+	if commandName == "" {
+		replies := make([]interface{}, len(pending))
+		for i, r := range pending {
+			if r.err != nil {
+				c.err = r.err
+				return nil, r.err
+			}
+			replies[i] = r.reply
+		}
+		if len(replies) == 0 {
+			return nil, nil
+		}
+		return replies, nil
+	}
+
+	var err error
+	var reply interface{}
+	for _, r := range pending {
+		if r.err != nil {
+			c.err = r.err
+			return nil, r.err
+		}
+		reply = r.reply
+		if e, ok := reply.(redis.Error); ok && err == nil {
+			err = e
+		}
+	}
+	return reply, err
+}
+
+// Receive returns the reply to the oldest sent command or, if there are no
+// sent commands, the oldest pushed reply.
+func (c *Conn) Receive() (interface{}, error) {
+	return c.ReceiveWithTimeout(0)
+}
+
+// ReceiveWithTimeout is like Receive, but returns an error if there is no
+// reply within the timeout. A zero timeout waits indefinitely.
+func (c *Conn) ReceiveWithTimeout(timeout time.Duration) (interface{}, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	timedOut := false
+	if timeout > 0 {
+		t := time.AfterFunc(timeout, func() {
+			c.mu.Lock()
+			timedOut = true
+			c.mu.Unlock()
+			c.cond.Broadcast()
+		})
+		defer t.Stop()
+	}
+	for len(c.pending) == 0 && len(c.pushed) == 0 {
+		if err := c.usable(); err != nil {
+			return nil, err
+		}
+		if timedOut {
+			return nil, errTimeout
+		}
+		c.cond.Wait()
+	}
+	if err := c.usable(); err != nil {
+		return nil, err
+	}
+
+	var reply interface{}
+	if len(c.pending) > 0 {
+		r := c.pending[0]
+		c.pending = c.pending[1:]
+		if r.err != nil {
+			c.err = r.err
+			return nil, r.err
+		}
+		reply = r.reply
+	} else {
+		reply = c.pushed[0]
+		c.pushed = c.pushed[1:]
+	}
+	if err, ok := reply.(redis.Error); ok {
+		return nil, err
+	}
+	return reply, nil
+}
+
+// Expectation is an expected command. The methods of Expectation configure
+// the expectation and must be called before the code under test executes
+// the command.
+type Expectation struct {
+	commandName string
+	args        []interface{}
+	reply       interface{}
+	err         error
+	fn          func(args []interface{}) (interface{}, error)
+	times       int
+	calls       int
+}
+
+// Reply sets the reply to the command.
+func (e *Expectation) Reply(reply interface{}) *Expectation {
+	e.reply, e.err, e.fn = reply, nil, nil
+	return e
+}
+
+// Error sets the error returned for the command. A redis.Error is returned
+// as an error reply. Other errors are returned as connection errors: the
+// connection is not usable after the error is returned.
+func (e *Expectation) Error(err error) *Expectation {
+	e.reply, e.err, e.fn = nil, err, nil
+	return e
+}
+
+// ReplyFunc sets a function that computes the reply from the command
+// arguments.
+func (e *Expectation) ReplyFunc(fn func(args []interface{}) (interface{}, error)) *Expectation {
+	e.reply, e.err, e.fn = nil, nil, fn
+	return e
+}
+
+// Times sets the number of times the command is expected. The default is
+// one.
+func (e *Expectation) Times(n int) *Expectation {
+	e.times = n
+	return e
+}
+
+func (e *Expectation) result(args []interface{}) result {
+	reply, err := e.reply, e.err
+	if e.fn != nil {
+		reply, err = e.fn(args)
+	}
+	if err == nil {
+		return result{reply: reply}
+	}
+	if rerr, ok := err.(redis.Error); ok {
+		return result{reply: rerr}
+	}
+	return result{err: err}
+}
+
+func (e *Expectation) matches(commandName string, args []interface{}) bool {
+	if !strings.EqualFold(e.commandName, commandName) {
+		return false
+	}
+	for i, want := range e.args {
+		if _, ok := want.(anyArgs); ok {
+			return true
+		}
+		if i >= len(args) {
+			return false
+		}
+		if m, ok := want.(Matcher); ok {
+			if !m.Match(argString(args[i])) {
+				return false
+			}
+		} else if argString(want) != argString(args[i]) {
+			return false
+		}
+	}
+	return len(args) == len(e.args)
+}
+
+func (e *Expectation) String() string {
+	return formatCommand(e.commandName, e.args)
+}
+
+func formatCommand(commandName string, args []interface{}) string {
+	parts := []string{strings.ToUpper(commandName)}
+	for _, arg := range args {
+		if m, ok := arg.(Matcher); ok {
+			parts = append(parts, m.String())
+		} else {
+			parts = append(parts, fmt.Sprintf("%q", argString(arg)))
+		}
+	}
+	return strings.Join(parts, " ")
+}
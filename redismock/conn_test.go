@@ -0,0 +1,197 @@
+package redismock_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/swanwish/redigo/redis"
+	"github.com/swanwish/redigo/redismock"
+)
+
+func TestExpectDo(t *testing.T) {
+	c := redismock.NewConn()
+	c.Expect("SET", "foo", 1).Reply("OK")
+	c.Expect("get", redismock.Regexp("^f")).Reply([]byte("1"))
+	c.Expect("HSET", "h", redismock.AnyArgs()).Reply(int64(2))
+	c.Expect("INCR", "foo").Error(redis.Error("ERR value is not an integer or out of range"))
+
+	if _, err := c.Do("SET", "foo", int64(1)); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := redis.Int(c.Do("GET", "foo")); err != nil || v != 1 {
+		t.Errorf("GET returned %d, %v, want 1, nil", v, err)
+	}
+	if n, err := redis.Int(c.Do("HSET", "h", "a", 1, "b", 2)); err != nil || n != 2 {
+		t.Errorf("HSET returned %d, %v, want 2, nil", n, err)
+	}
+	if _, err := c.Do("INCR", "foo"); err == nil {
+		t.Error("INCR did not return an error")
+	}
+	if err := c.Err(); err != nil {
+		t.Errorf("Err() = %v, want nil after error reply", err)
+	}
+	if err := c.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestExpectationsWereMet(t *testing.T) {
+	c := redismock.NewConn()
+	c.Expect("GET", "a").Reply(nil)
+	c.Expect("GET", "b").Reply(nil)
+
+	_, err := c.Do("GET", "b")
+	if err == nil || !strings.Contains(err.Error(), `next expected GET "a"`) {
+		t.Errorf("out of order command returned %v", err)
+	}
+	err = c.ExpectationsWereMet()
+	if err == nil {
+		t.Fatal("ExpectationsWereMet() returned nil")
+	}
+	for _, want := range []string{`expected GET "a" 1 time(s), called 0 time(s)`, `unexpected command GET "b"`} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("ExpectationsWereMet() = %q, want %q", err, want)
+		}
+	}
+
+	c = redismock.NewConn()
+	c.MatchInOrder(false)
+	c.Expect("GET", "a").Reply([]byte("1"))
+	c.Expect("GET", "b").Reply([]byte("2")).Times(2)
+	for _, key := range []string{"b", "a", "b"} {
+		if _, err := c.Do("GET", key); err != nil {
+			t.Errorf("GET %s returned %v", key, err)
+		}
+	}
+	if err := c.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPipeline(t *testing.T) {
+	c := redismock.NewConn()
+	c.Expect("MULTI").Reply("OK")
+	c.Expect("INCR", "n").Reply("QUEUED")
+	c.Expect("EXEC").Reply([]interface{}{int64(1)})
+	c.Expect("SET", "k", "v").Reply("OK")
+	c.Expect("GET", "k").ReplyFunc(func(args []interface{}) (interface{}, error) {
+		return []byte("v"), nil
+	})
+
+	c.Send("MULTI")
+	c.Send("INCR", "n")
+	reply, err := c.Do("EXEC")
+	if err != nil || !reflect.DeepEqual(reply, []interface{}{int64(1)}) {
+		t.Errorf("EXEC returned %v, %v", reply, err)
+	}
+
+	c.Send("SET", "k", "v")
+	c.Send("GET", "k")
+	if err := c.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []interface{}{"OK", []byte("v")} {
+		reply, err := c.Receive()
+		if err != nil || !reflect.DeepEqual(reply, want) {
+			t.Errorf("Receive() = %v, %v, want %v", reply, err, want)
+		}
+	}
+}
+
+func TestConnectionError(t *testing.T) {
+	c := redismock.NewConn()
+	c.Expect("GET", "k").Error(redis.ErrPoolExhausted)
+	if _, err := c.Do("GET", "k"); err != redis.ErrPoolExhausted {
+		t.Errorf("GET returned %v, want %v", err, redis.ErrPoolExhausted)
+	}
+	if c.Err() == nil {
+		t.Error("Err() = nil after connection error")
+	}
+}
+
+func TestPubSub(t *testing.T) {
+	c := redismock.NewConn()
+	c.Expect("SUBSCRIBE", "news").Reply(redismock.Subscription("subscribe", "news", 1))
+	c.Push(redismock.Message("news", "hello"))
+
+	psc := redis.PubSubConn{Conn: c}
+	if err := psc.Subscribe("news"); err != nil {
+		t.Fatal(err)
+	}
+	if sub, ok := psc.Receive().(redis.Subscription); !ok || sub.Count != 1 {
+		t.Errorf("Receive() = %v, want subscription", sub)
+	}
+	if m, ok := psc.Receive().(redis.Message); !ok || string(m.Data) != "hello" {
+		t.Errorf("Receive() = %v, want message", m)
+	}
+
+	done := make(chan interface{})
+	go func() { done <- psc.Receive() }()
+	time.Sleep(10 * time.Millisecond)
+	c.Push(redismock.PMessage("n*", "news", "world"))
+	if m, ok := (<-done).(redis.Message); !ok || m.Pattern != "n*" || string(m.Data) != "world" {
+		t.Errorf("Receive() = %v, want pmessage", m)
+	}
+
+	if _, ok := psc.ReceiveWithTimeout(10 * time.Millisecond).(error); !ok {
+		t.Error("ReceiveWithTimeout did not time out")
+	}
+}
+
+func TestPool(t *testing.T) {
+	c := redismock.NewConn()
+	c.Expect("SET", "k", "v").Reply("OK")
+	c.Expect("GET", "k").Reply([]byte("v"))
+
+	p := &redis.Pool{Dial: c.Dial}
+	defer p.Close()
+	client := redis.NewRedisClient(p)
+	if _, err := client.Set("k", "v", 0); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := client.Get("k"); err != nil || v != "v" {
+		t.Errorf("Get returned %q, %v, want v, nil", v, err)
+	}
+	if err := c.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPoolConcurrentConns(t *testing.T) {
+	c := redismock.NewConn()
+	c.MatchInOrder(false)
+	c.Expect("GET", "a").Reply([]byte("1"))
+	c.Expect("GET", "b").Reply([]byte("2"))
+
+	p := &redis.Pool{Dial: c.Dial, MaxIdle: 1}
+	c1 := p.Get()
+	c2 := p.Get()
+	if err := c1.Send("GET", "a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c2.Send("GET", "b"); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := redis.String(c2.Receive()); err != nil || v != "2" {
+		t.Errorf("Receive on the second connection returned %q, %v, want 2, nil", v, err)
+	}
+
+	// Closing the second connection exceeds MaxIdle and closes the mock
+	// connection. The first connection is still usable.
+	c3 := p.Get()
+	c3.Close()
+	c2.Close()
+	if err := c1.Err(); err != nil {
+		t.Fatalf("Err on the first connection returned %v", err)
+	}
+	if v, err := redis.String(c1.Receive()); err != nil || v != "1" {
+		t.Errorf("Receive on the first connection returned %q, %v, want 1, nil", v, err)
+	}
+	c1.Close()
+	p.Close()
+	if err := c.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
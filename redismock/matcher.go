@@ -0,0 +1,83 @@
+package redismock
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"github.com/swanwish/redigo/redis"
+)
+
+// Matcher matches a command argument. The argument is converted to the
+// string sent to the server before matching.
+type Matcher interface {
+	Match(arg string) bool
+
+	// String describes the matcher in error messages.
+	String() string
+}
+
+type matcherFunc struct {
+	desc string
+	fn   func(string) bool
+}
+
+func (m matcherFunc) Match(arg string) bool { return m.fn(arg) }
+func (m matcherFunc) String() string        { return m.desc }
+
+// MatchFunc returns a matcher that calls fn. The description is used in
+// error messages.
+func MatchFunc(description string, fn func(arg string) bool) Matcher {
+	return matcherFunc{description, fn}
+}
+
+// Any returns a matcher that matches any argument.
+func Any() Matcher {
+	return MatchFunc("<any>", func(string) bool { return true })
+}
+
+// Regexp returns a matcher that matches arguments matching the regular
+// expression.
+func Regexp(expr string) Matcher {
+	re := regexp.MustCompile(expr)
+	return MatchFunc("<regexp "+expr+">", re.MatchString)
+}
+
+type anyArgs struct{}
+
+func (anyArgs) Match(string) bool { return true }
+func (anyArgs) String() string    { return "<any args...>" }
+
+// AnyArgs returns a matcher for zero or more arguments. AnyArgs must be the
+// last argument of an expectation.
+func AnyArgs() Matcher {
+	return anyArgs{}
+}
+
+// argString converts arg to a string using the conversions of the redis
+// package.
+func argString(arg interface{}) string {
+	switch arg := arg.(type) {
+	case string:
+		return arg
+	case []byte:
+		return string(arg)
+	case int:
+		return strconv.Itoa(arg)
+	case int64:
+		return strconv.FormatInt(arg, 10)
+	case float64:
+		return strconv.FormatFloat(arg, 'g', -1, 64)
+	case bool:
+		if arg {
+			return "1"
+		}
+		return "0"
+	case nil:
+		return ""
+	case redis.Argument:
+		return argString(arg.RedisArg())
+	default:
+		return fmt.Sprint(arg)
+	}
+}
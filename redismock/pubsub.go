@@ -0,0 +1,25 @@
+package redismock
+
+// The functions in this file return replies for the pub/sub commands. Use
+// the replies with Expectation.Reply and Conn.Push:
+//
+//	c.Expect("SUBSCRIBE", "news").Reply(redismock.Subscription("subscribe", "news", 1))
+//	c.Push(redismock.Message("news", "hello"))
+
+// Subscription returns the reply to a SUBSCRIBE, PSUBSCRIBE, UNSUBSCRIBE or
+// PUNSUBSCRIBE command for one channel. The kind is the lower case command
+// name and count is the number of subscriptions after the command.
+func Subscription(kind, channel string, count int) []interface{} {
+	return []interface{}{[]byte(kind), []byte(channel), int64(count)}
+}
+
+// Message returns a message published to a subscribed channel.
+func Message(channel, data string) []interface{} {
+	return []interface{}{[]byte("message"), []byte(channel), []byte(data)}
+}
+
+// PMessage returns a message published to a channel matching a subscribed
+// pattern.
+func PMessage(pattern, channel, data string) []interface{} {
+	return []interface{}{[]byte("pmessage"), []byte(pattern), []byte(channel), []byte(data)}
+}
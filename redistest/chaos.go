@@ -0,0 +1,492 @@
+package redistest
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/swanwish/redigo/redis"
+)
+
+// Errors returned by a Redis server that is not ready to serve a command.
+const (
+	ErrLoading  = redis.Error("LOADING Redis is loading the dataset in memory")
+	ErrReadOnly = redis.Error("READONLY You can't write against a read only replica.")
+	ErrTryAgain = redis.Error("TRYAGAIN Multiple keys request during rehashing of slot")
+)
+
+// ErrInjected is the default error for injected dial failures.
+var ErrInjected = errors.New("redistest: injected fault")
+
+// Fault describes a fault injected by Chaos into commands.
+type Fault struct {
+	// Pattern is a pattern in the syntax of path.Match for the names of the
+	// commands affected by the fault. The pattern and command names are
+	// compared in upper case. An empty pattern matches all commands.
+	Pattern string
+
+	// Probability is the probability in the range [0, 1] that the fault is
+	// injected into a matching command.
+	Probability float64
+
+	// Latency delays the reply to the command.
+	Latency time.Duration
+
+	// Error is returned instead of executing the command. A redis.Error is
+	// returned as an error reply. Other errors are returned as connection
+	// errors.
+	Error error
+
+	// Drop closes the connection after the command is executed and before
+	// the reply is read.
+	Drop bool
+
+	// Truncate closes the connection after part of the reply is read.
+	// Connections returned by Conn and Dial can not truncate a reply and
+	// drop the connection instead.
+	Truncate bool
+}
+
+// Chaos injects faults into connections for testing the behavior of an
+// application when the Redis server is slow or unreliable. Chaos wraps
+// connections at two levels: Conn and Dial wrap redis.Conn values and plug
+// into Pool.Dial, NetConn and NetDial wrap net.Conn values and plug into the
+// DialNetDial option:
+//
+//	chaos := &redistest.Chaos{
+//		Seed: 1,
+//		Faults: []redistest.Fault{
+//			{Pattern: "GET", Probability: 0.1, Error: redistest.ErrLoading},
+//			{Pattern: "*", Probability: 0.01, Truncate: true},
+//		},
+//	}
+//	c, err := redis.Dial("tcp", addr, redis.DialNetDial(chaos.NetDial(nil)))
+//
+// Faults are selected with a pseudo-random generator initialized from Seed.
+// The faults injected into a sequence of commands executed by one goroutine
+// are the same in every run of a test.
+//
+// Faults apply to replies in the order of the commands. Messages received
+// by connections in the subscribe state are not affected.
+type Chaos struct {
+	// Seed initializes the pseudo-random generator.
+	Seed int64
+
+	// Faults are evaluated in order for every command. The latencies of all
+	// injected faults are added. The first injected error, drop or
+	// truncation is used.
+	Faults []Fault
+
+	// DialFailure is the probability that a dial fails.
+	DialFailure float64
+
+	// DialError is returned for failed dials. The default is ErrInjected.
+	DialError error
+
+	once sync.Once
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+// action is the combined effect of the faults selected for a command.
+type action struct {
+	latency  time.Duration
+	err      error
+	drop     bool
+	truncate bool
+}
+
+func (a *action) replyError() bool {
+	_, ok := a.err.(redis.Error)
+	return ok
+}
+
+func (ch *Chaos) init() {
+	ch.once.Do(func() {
+		ch.rand = rand.New(rand.NewSource(ch.Seed))
+	})
+}
+
+func (ch *Chaos) decide(commandName string) *action {
+	ch.init()
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	a := &action{}
+	name := strings.ToUpper(commandName)
+	for i := range ch.Faults {
+		f := &ch.Faults[i]
+		if f.Pattern != "" {
+			if ok, _ := path.Match(strings.ToUpper(f.Pattern), name); !ok {
+				continue
+			}
+		}
+		if ch.rand.Float64() >= f.Probability {
+			continue
+		}
+		a.latency += f.Latency
+		if a.err == nil && !a.drop && !a.truncate {
+			a.err, a.drop, a.truncate = f.Error, f.Drop, f.Truncate
+		}
+	}
+	return a
+}
+
+func (ch *Chaos) dialFault() error {
+	ch.init()
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	if ch.rand.Float64() >= ch.DialFailure {
+		return nil
+	}
+	if ch.DialError != nil {
+		return ch.DialError
+	}
+	return ErrInjected
+}
+
+// Dial returns a function for Pool.Dial that fails with probability
+// DialFailure and otherwise wraps the connection returned by dial with
+// Conn.
+func (ch *Chaos) Dial(dial func() (redis.Conn, error)) func() (redis.Conn, error) {
+	return func() (redis.Conn, error) {
+		if err := ch.dialFault(); err != nil {
+			return nil, err
+		}
+		c, err := dial()
+		if err != nil {
+			return nil, err
+		}
+		return ch.Conn(c), nil
+	}
+}
+
+// NetDial returns a function for the DialNetDial option that fails with
+// probability DialFailure and otherwise wraps the connection returned by
+// dial with NetConn. If dial is nil, net.Dial is used.
+func (ch *Chaos) NetDial(dial func(network, addr string) (net.Conn, error)) func(network, addr string) (net.Conn, error) {
+	if dial == nil {
+		dial = net.Dial
+	}
+	return func(network, addr string) (net.Conn, error) {
+		if err := ch.dialFault(); err != nil {
+			return nil, err
+		}
+		c, err := dial(network, addr)
+		if err != nil {
+			return nil, err
+		}
+		return ch.NetConn(c), nil
+	}
+}
+
+// Conn returns a wrapper around c that injects faults. The wrapper uses
+// the Send, Flush and Receive methods of c to execute commands.
+func (ch *Chaos) Conn(c redis.Conn) redis.Conn {
+	return &chaosConn{Conn: c, ch: ch}
+}
+
+type chaosConn struct {
+	redis.Conn
+	ch      *Chaos
+	pending []*action
+	err     error
+}
+
+func (c *chaosConn) Err() error {
+	if c.err != nil {
+		return c.err
+	}
+	return c.Conn.Err()
+}
+
+func (c *chaosConn) fatal(err error) error {
+	if c.err == nil {
+		c.err = err
+		c.Conn.Close()
+	}
+	return err
+}
+
+func (c *chaosConn) Send(commandName string, args ...interface{}) error {
+	if c.err != nil {
+		return c.err
+	}
+	a := c.ch.decide(commandName)
+	if a.err != nil && !a.replyError() {
+		return c.fatal(a.err)
+	}
+	if !a.replyError() {
+		if err := c.Conn.Send(commandName, args...); err != nil {
+			return err
+		}
+	}
+	c.pending = append(c.pending, a)
+	return nil
+}
+
+func (c *chaosConn) Flush() error {
+	if c.err != nil {
+		return c.err
+	}
+	return c.Conn.Flush()
+}
+
+func (c *chaosConn) Receive() (interface{}, error) {
+	return c.receive(-1)
+}
+
+func (c *chaosConn) ReceiveWithTimeout(timeout time.Duration) (interface{}, error) {
+	return c.receive(timeout)
+}
+
+// receive receives a reply. A negative timeout uses the default read
+// timeout of the connection.
+func (c *chaosConn) receive(timeout time.Duration) (interface{}, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	a := &action{}
+	if len(c.pending) > 0 {
+		a = c.pending[0]
+		c.pending = c.pending[1:]
+	}
+	time.Sleep(a.latency)
+	if a.replyError() {
+		return nil, a.err
+	}
+	var reply interface{}
+	var err error
+	if timeout < 0 {
+		reply, err = c.Conn.Receive()
+	} else {
+		reply, err = redis.ReceiveWithTimeout(c.Conn, timeout)
+	}
+	if a.drop || a.truncate {
+		return nil, c.fatal(io.ErrUnexpectedEOF)
+	}
+	return reply, err
+}
+
+func (c *chaosConn) Do(commandName string, args ...interface{}) (interface{}, error) {
+	return c.do(-1, commandName, args)
+}
+
+func (c *chaosConn) DoWithTimeout(timeout time.Duration, commandName string, args ...interface{}) (interface{}, error) {
+	return c.do(timeout, commandName, args)
+}
+
+// do executes the command and receives the replies to the pending commands
+// with the same semantics as the Do method of connections returned by
+// redis.Dial.
+func (c *chaosConn) do(timeout time.Duration, commandName string, args []interface{}) (interface{}, error) {
+	if commandName != "" {
+		if err := c.Send(commandName, args...); err != nil {
+			return nil, err
+		}
+	}
+	if err := c.Flush(); err != nil {
+		return nil, err
+	}
+	n := len(c.pending)
+	if commandName == "" && n == 0 {
+		return nil, nil
+	}
+	replies := make([]interface{}, n)
+	var err error
+	for i := range replies {
+		reply, e := c.receive(timeout)
+		if rerr, ok := e.(redis.Error); ok {
+			reply = rerr
+			if err == nil {
+				err = rerr
+			}
+		} else if e != nil {
+			return nil, e
+		}
+		replies[i] = reply
+	}
+	if commandName == "" {
+		return replies, nil
+	}
+	return replies[n-1], err
+}
+
+var (
+	crlf        = []byte("\r\n")
+	pingCommand = []byte("*1\r\n$4\r\nPING\r\n")
+)
+
+// NetConn returns a wrapper around c that injects faults. The wrapper
+// parses the commands written to c and the replies read from c.
+func (ch *Chaos) NetConn(c net.Conn) net.Conn {
+	return &chaosNetConn{Conn: c, ch: ch}
+}
+
+type chaosNetConn struct {
+	net.Conn
+	ch *Chaos
+
+	mu      sync.Mutex
+	actions []*action // actions for the replies to written commands
+
+	wbuf []byte // incomplete command
+
+	rbuf    []byte // incomplete reply
+	out     []byte // replies to return from Read
+	readErr error
+}
+
+func (c *chaosNetConn) Write(p []byte) (int, error) {
+	c.wbuf = append(c.wbuf, p...)
+	var fwd []byte
+	for {
+		n := frameLen(c.wbuf)
+		if n < 0 {
+			break
+		}
+		frame := c.wbuf[:n]
+		c.wbuf = c.wbuf[n:]
+		a := c.ch.decide(commandName(frame))
+		switch {
+		case a.err != nil && !a.replyError():
+			c.Conn.Close()
+			return 0, a.err
+		case a.replyError():
+			// Replace the command with a command that does not change
+			// the data. The reply is replaced with the error.
+			fwd = append(fwd, pingCommand...)
+		default:
+			fwd = append(fwd, frame...)
+		}
+		c.mu.Lock()
+		c.actions = append(c.actions, a)
+		c.mu.Unlock()
+	}
+	if len(fwd) > 0 {
+		if _, err := c.Conn.Write(fwd); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+func (c *chaosNetConn) Read(p []byte) (int, error) {
+	var buf [4096]byte
+	for len(c.out) == 0 {
+		if c.readErr != nil {
+			return 0, c.readErr
+		}
+		n, err := c.Conn.Read(buf[:])
+		c.rbuf = append(c.rbuf, buf[:n]...)
+		c.process()
+		if err != nil && c.readErr == nil {
+			c.readErr = err
+		}
+	}
+	n := copy(p, c.out)
+	c.out = c.out[n:]
+	return n, nil
+}
+
+// process moves the complete replies in rbuf to out and applies the
+// actions for the replies.
+func (c *chaosNetConn) process() {
+	for c.readErr == nil {
+		n := frameLen(c.rbuf)
+		if n < 0 {
+			return
+		}
+		frame := c.rbuf[:n]
+		c.rbuf = c.rbuf[n:]
+
+		c.mu.Lock()
+		a := &action{}
+		if len(c.actions) > 0 {
+			a = c.actions[0]
+			c.actions = c.actions[1:]
+		}
+		c.mu.Unlock()
+
+		time.Sleep(a.latency)
+		switch {
+		case a.err != nil:
+			c.out = append(c.out, '-')
+			c.out = append(c.out, a.err.Error()...)
+			c.out = append(c.out, crlf...)
+		case a.drop:
+			c.Conn.Close()
+			c.readErr = io.EOF
+		case a.truncate:
+			c.out = append(c.out, frame[:len(frame)/2]...)
+			c.Conn.Close()
+			c.readErr = io.ErrUnexpectedEOF
+		default:
+			c.out = append(c.out, frame...)
+		}
+	}
+}
+
+// frameLen returns the length of the RESP value at the start of p or -1 if
+// p does not contain a complete value. Malformed lines are returned as a
+// value.
+func frameLen(p []byte) int {
+	i := bytes.Index(p, crlf)
+	if i < 0 {
+		return -1
+	}
+	line := p[:i]
+	n := i + 2
+	if len(line) == 0 {
+		return n
+	}
+	switch line[0] {
+	case '$':
+		size, err := strconv.Atoi(string(line[1:]))
+		if err != nil || size < 0 {
+			return n
+		}
+		if len(p) < n+size+2 {
+			return -1
+		}
+		return n + size + 2
+	case '*':
+		count, err := strconv.Atoi(string(line[1:]))
+		if err != nil || count < 0 {
+			return n
+		}
+		for j := 0; j < count; j++ {
+			m := frameLen(p[n:])
+			if m < 0 {
+				return -1
+			}
+			n += m
+		}
+		return n
+	}
+	return n
+}
+
+// commandName returns the name of the command encoded in frame.
+func commandName(frame []byte) string {
+	if len(frame) == 0 || frame[0] != '*' {
+		return ""
+	}
+	i := bytes.Index(frame, crlf)
+	frame = frame[i+2:]
+	if len(frame) == 0 || frame[0] != '$' {
+		return ""
+	}
+	i = bytes.Index(frame, crlf)
+	size, err := strconv.Atoi(string(frame[1:i]))
+	if err != nil || size < 0 || len(frame) < i+2+size {
+		return ""
+	}
+	return string(frame[i+2 : i+2+size])
+}
@@ -0,0 +1,135 @@
+package redistest_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/swanwish/redigo/redis"
+	"github.com/swanwish/redigo/redistest"
+)
+
+func TestChaosConn(t *testing.T) {
+	s, err := redistest.NewFakeServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	chaos := &redistest.Chaos{
+		Faults: []redistest.Fault{
+			{Pattern: "SET", Probability: 1, Error: redistest.ErrReadOnly},
+			{Pattern: "GET", Probability: 1, Latency: 20 * time.Millisecond},
+			{Pattern: "INCR", Probability: 1, Drop: true},
+		},
+	}
+	p := &redis.Pool{
+		Dial: chaos.Dial(func() (redis.Conn, error) {
+			return redis.Dial("tcp", s.Addr())
+		}),
+	}
+	defer p.Close()
+
+	c := p.Get()
+	defer c.Close()
+	if _, err := c.Do("SET", "k", "v"); err != redistest.ErrReadOnly {
+		t.Errorf("SET returned %v, want %v", err, redistest.ErrReadOnly)
+	}
+	start := time.Now()
+	if v, err := c.Do("GET", "k"); err != nil || v != nil {
+		t.Errorf("GET returned %v, %v, want nil, nil", v, err)
+	}
+	if d := time.Since(start); d < 20*time.Millisecond {
+		t.Errorf("GET took %v, want at least 20ms", d)
+	}
+
+	c.Send("SET", "k", "v")
+	c.Send("PING")
+	c.Flush()
+	if _, err := c.Receive(); err != redistest.ErrReadOnly {
+		t.Errorf("Receive() returned %v, want %v", err, redistest.ErrReadOnly)
+	}
+	if v, err := c.Receive(); v != "PONG" || err != nil {
+		t.Errorf("Receive() returned %v, %v, want PONG, nil", v, err)
+	}
+
+	if _, err := c.Do("INCR", "n"); err == nil {
+		t.Error("INCR returned nil error")
+	}
+	if c.Err() == nil {
+		t.Error("Err() returned nil after dropped connection")
+	}
+}
+
+func TestChaosNetConn(t *testing.T) {
+	s, err := redistest.NewFakeServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	chaos := &redistest.Chaos{
+		Faults: []redistest.Fault{
+			{Pattern: "SET", Probability: 1, Error: redistest.ErrLoading},
+			{Pattern: "LRANGE", Probability: 1, Truncate: true},
+		},
+	}
+	dial := func() redis.Conn {
+		c, err := redis.Dial("tcp", s.Addr(), redis.DialNetDial(chaos.NetDial(nil)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	c := dial()
+	defer c.Close()
+	c.Send("SET", "k", "v")
+	c.Send("RPUSH", "l", "a", "b", "c")
+	reply, err := c.Do("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []interface{}{redistest.ErrLoading, int64(3)}; !reflect.DeepEqual(reply, expected) {
+		t.Errorf("replies are %v, want %v", reply, expected)
+	}
+	if n, err := redis.Int(c.Do("EXISTS", "k")); err != nil || n != 0 {
+		t.Errorf("EXISTS returned %d, %v, want 0, nil", n, err)
+	}
+
+	if _, err := c.Do("LRANGE", "l", 0, -1); err == nil {
+		t.Error("LRANGE returned nil error for truncated reply")
+	}
+	if c.Err() == nil {
+		t.Error("Err() returned nil after truncated reply")
+	}
+}
+
+func TestChaosDeterministic(t *testing.T) {
+	run := func() []bool {
+		chaos := &redistest.Chaos{
+			Seed:        42,
+			DialFailure: 0.5,
+		}
+		dial := chaos.Dial(func() (redis.Conn, error) { return nil, nil })
+		var failed []bool
+		for i := 0; i < 32; i++ {
+			_, err := dial()
+			failed = append(failed, err == redistest.ErrInjected)
+		}
+		return failed
+	}
+	first := run()
+	if !reflect.DeepEqual(run(), first) {
+		t.Error("dial failures differ between runs with the same seed")
+	}
+	n := 0
+	for _, failed := range first {
+		if failed {
+			n++
+		}
+	}
+	if n == 0 || n == len(first) {
+		t.Errorf("%d of %d dials failed with probability 0.5", n, len(first))
+	}
+}
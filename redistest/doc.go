@@ -0,0 +1,36 @@
+// Package redistest contains utilities for testing applications that use
+// Redigo.
+//
+// FakeServer is an in-process Redis server written in Go. It speaks the
+// RESP protocol on a random local port or over net.Pipe and implements the
+// commands for strings, hashes, lists, sets, sorted sets, streams, key
+// expiration, pub/sub and transactions. The server clock is controllable so
+// that tests of expiration do not need to sleep:
+//
+//	s, err := redistest.NewFakeServer()
+//	if err != nil {
+//		t.Fatal(err)
+//	}
+//	defer s.Close()
+//
+//	c, err := redis.Dial("tcp", s.Addr())
+//	...
+//	s.Advance(time.Minute) // expire keys with a TTL of one minute
+//
+// Server manages redis-server processes for integration tests. The
+// functions StartServer, StartReplicaPair and StartCluster start servers on
+// free local ports, wait until the servers are ready and stop the servers
+// when the test completes. The tests are skipped when the redis-server
+// binary is not installed:
+//
+//	func TestIntegration(t *testing.T) {
+//		s := redistest.StartServer(t, "--maxmemory", "10mb")
+//		c := s.Pool().Get()
+//		defer c.Close()
+//		...
+//	}
+//
+// Chaos injects latency, errors, dropped connections, truncated replies and
+// dial failures into connections to test how an application handles a slow
+// or unreliable server.
+package redistest
@@ -0,0 +1,22 @@
+package redistest
+
+import "github.com/swanwish/redigo/internal/fakeredis"
+
+// FakeServer is an in-process Redis server written in Go. The server keeps
+// all data in memory and executes one command at a time.
+//
+// Keys expire according to the server clock. The clock follows the system
+// time until SetTime or Advance is called.
+type FakeServer = fakeredis.Server
+
+// NewFakeServer starts a fake server listening on a random port of the
+// loopback interface.
+func NewFakeServer() (*FakeServer, error) {
+	return fakeredis.NewServer()
+}
+
+// NewPipeServer returns a fake server that does not listen on the network.
+// Use the Dial method to connect to the server over net.Pipe.
+func NewPipeServer() *FakeServer {
+	return fakeredis.NewPipeServer()
+}
@@ -0,0 +1,289 @@
+package redistest_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/swanwish/redigo/redis"
+	"github.com/swanwish/redigo/redistest"
+)
+
+func dialFake(t *testing.T) (*redistest.FakeServer, redis.Conn) {
+	s, err := redistest.NewFakeServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := redis.Dial("tcp", s.Addr())
+	if err != nil {
+		s.Close()
+		t.Fatal(err)
+	}
+	return s, c
+}
+
+type commandTest struct {
+	args     []interface{}
+	expected interface{}
+}
+
+func runCommands(t *testing.T, c redis.Conn, tests []commandTest) {
+	t.Helper()
+	for _, tt := range tests {
+		actual, err := c.Do(tt.args[0].(string), tt.args[1:]...)
+		if err != nil {
+			actual = err
+		}
+		if !reflect.DeepEqual(actual, tt.expected) {
+			t.Errorf("%v returned %#v, want %#v", tt.args, actual, tt.expected)
+		}
+	}
+}
+
+func strs(s ...string) []interface{} {
+	result := make([]interface{}, len(s))
+	for i := range s {
+		result[i] = []byte(s[i])
+	}
+	return result
+}
+
+func TestFakeServerCommands(t *testing.T) {
+	s, c := dialFake(t)
+	defer s.Close()
+	defer c.Close()
+
+	runCommands(t, c, []commandTest{
+		{[]interface{}{"SET", "foo", "bar"}, "OK"},
+		{[]interface{}{"GET", "foo"}, []byte("bar")},
+		{[]interface{}{"APPEND", "foo", "baz"}, int64(6)},
+		{[]interface{}{"INCR", "foo"}, redis.Error("ERR value is not an integer or out of range")},
+		{[]interface{}{"INCRBY", "n", 5}, int64(5)},
+		{[]interface{}{"HSET", "foo", "f", "v"}, redis.Error("WRONGTYPE Operation against a key holding the wrong kind of value")},
+		{[]interface{}{"HSET", "h", "f1", "v1", "f2", "v2"}, int64(2)},
+		{[]interface{}{"HGETALL", "h"}, strs("f1", "v1", "f2", "v2")},
+		{[]interface{}{"HINCRBY", "h", "n", 3}, int64(3)},
+		{[]interface{}{"RPUSH", "l", "a", "b", "c"}, int64(3)},
+		{[]interface{}{"LPUSH", "l", "z"}, int64(4)},
+		{[]interface{}{"LRANGE", "l", 0, -2}, strs("z", "a", "b")},
+		{[]interface{}{"LPOP", "l", 2}, strs("z", "a")},
+		{[]interface{}{"LINSERT", "l", "BEFORE", "c", "x"}, int64(3)},
+		{[]interface{}{"LPOS", "l", "c"}, int64(2)},
+		{[]interface{}{"SADD", "s1", "a", "b", "c"}, int64(3)},
+		{[]interface{}{"SADD", "s2", "b", "c", "d"}, int64(3)},
+		{[]interface{}{"SINTER", "s1", "s2"}, strs("b", "c")},
+		{[]interface{}{"SDIFF", "s1", "s2"}, strs("a")},
+		{[]interface{}{"SUNIONSTORE", "s3", "s1", "s2"}, int64(4)},
+		{[]interface{}{"ZADD", "z", 1, "one", 2, "two", 3, "three"}, int64(3)},
+		{[]interface{}{"ZRANGEBYSCORE", "z", "(1", "+inf", "WITHSCORES"}, strs("two", "2", "three", "3")},
+		{[]interface{}{"ZREVRANGE", "z", 0, 0}, strs("three")},
+		{[]interface{}{"ZRANGE", "z", "(3", "-inf", "BYSCORE", "REV", "LIMIT", 0, 1}, strs("two")},
+		{[]interface{}{"ZINCRBY", "z", 2.5, "one"}, []byte("3.5")},
+		{[]interface{}{"ZRANK", "z", "one"}, int64(2)},
+		{[]interface{}{"ZPOPMIN", "z"}, strs("two", "2")},
+		{[]interface{}{"TYPE", "z"}, "zset"},
+		{[]interface{}{"KEYS", "s*"}, strs("s1", "s2", "s3")},
+		{[]interface{}{"DEL", "s1", "s2", "missing"}, int64(2)},
+		{[]interface{}{"EXISTS", "s1", "s3"}, int64(1)},
+		{[]interface{}{"NOSUCHCOMMAND"}, redis.Error("ERR unknown command 'NOSUCHCOMMAND'")},
+	})
+}
+
+func TestFakeServerStreams(t *testing.T) {
+	s, c := dialFake(t)
+	defer s.Close()
+	defer c.Close()
+
+	entry := func(id string, fields ...string) []interface{} {
+		return []interface{}{[]byte(id), strs(fields...)}
+	}
+	runCommands(t, c, []commandTest{
+		{[]interface{}{"XADD", "st", "1-1", "a", "1"}, []byte("1-1")},
+		{[]interface{}{"XADD", "st", "1-1", "a", "2"}, redis.Error("ERR The ID specified in XADD is equal or smaller than the target stream top item")},
+		{[]interface{}{"XADD", "st", "2", "a", "2", "b", "3"}, []byte("2-0")},
+		{[]interface{}{"XADD", "st", "5-0", "a", "5"}, []byte("5-0")},
+		{[]interface{}{"TYPE", "st"}, "stream"},
+		{[]interface{}{"XRANGE", "st", "-", "+"}, []interface{}{entry("1-1", "a", "1"), entry("2-0", "a", "2", "b", "3"), entry("5-0", "a", "5")}},
+		{[]interface{}{"XRANGE", "st", "(1-1", "+", "COUNT", 1}, []interface{}{entry("2-0", "a", "2", "b", "3")}},
+		{[]interface{}{"XRANGE", "st", "(5", "+"}, []interface{}{}},
+	})
+}
+
+func TestFakeServerExpire(t *testing.T) {
+	s, c := dialFake(t)
+	defer s.Close()
+	defer c.Close()
+
+	s.SetTime(time.Unix(1000, 0))
+	runCommands(t, c, []commandTest{
+		{[]interface{}{"SET", "a", "1", "EX", 10}, "OK"},
+		{[]interface{}{"SET", "b", "1"}, "OK"},
+		{[]interface{}{"EXPIRE", "b", 20}, int64(1)},
+		{[]interface{}{"TTL", "a"}, int64(10)},
+		{[]interface{}{"PTTL", "b"}, int64(20000)},
+		{[]interface{}{"TTL", "missing"}, int64(-2)},
+		{[]interface{}{"EXPIRETIME", "a"}, int64(1010)},
+	})
+	s.Advance(10 * time.Second)
+	runCommands(t, c, []commandTest{
+		{[]interface{}{"GET", "a"}, nil},
+		{[]interface{}{"TTL", "b"}, int64(10)},
+		{[]interface{}{"PERSIST", "b"}, int64(1)},
+		{[]interface{}{"TTL", "b"}, int64(-1)},
+	})
+	s.Advance(time.Hour)
+	runCommands(t, c, []commandTest{
+		{[]interface{}{"GET", "b"}, []byte("1")},
+	})
+}
+
+func TestFakeServerTransaction(t *testing.T) {
+	s, c := dialFake(t)
+	defer s.Close()
+	defer c.Close()
+
+	c.Send("MULTI")
+	c.Send("INCR", "n")
+	c.Send("INCR", "n")
+	reply, err := c.Do("EXEC")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []interface{}{int64(1), int64(2)}; !reflect.DeepEqual(reply, expected) {
+		t.Errorf("EXEC returned %v, want %v", reply, expected)
+	}
+
+	c2, err := redis.Dial("tcp", s.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c2.Close()
+
+	if _, err := c.Do("WATCH", "n"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c2.Do("SET", "n", "10"); err != nil {
+		t.Fatal(err)
+	}
+	c.Send("MULTI")
+	c.Send("INCR", "n")
+	reply, err = c.Do("EXEC")
+	if err != nil || reply != nil {
+		t.Errorf("EXEC after conflicting write returned %v, %v, want nil, nil", reply, err)
+	}
+}
+
+func TestFakeServerBlockingPop(t *testing.T) {
+	s, c := dialFake(t)
+	defer s.Close()
+	defer c.Close()
+
+	c2, err := redis.Dial("tcp", s.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c2.Close()
+
+	done := make(chan interface{})
+	go func() {
+		reply, err := c.Do("BLPOP", "q", 0)
+		if err != nil {
+			reply = err
+		}
+		done <- reply
+	}()
+	time.Sleep(10 * time.Millisecond)
+	if _, err := c2.Do("RPUSH", "q", "x"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case reply := <-done:
+		if expected := strs("q", "x"); !reflect.DeepEqual(reply, expected) {
+			t.Errorf("BLPOP returned %v, want %v", reply, expected)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("BLPOP did not return")
+	}
+
+	reply, err := c.Do("BRPOP", "q", 0.01)
+	if err != nil || reply != nil {
+		t.Errorf("BRPOP on empty list returned %v, %v, want nil, nil", reply, err)
+	}
+}
+
+func TestFakeServerPubSub(t *testing.T) {
+	s, c := dialFake(t)
+	defer s.Close()
+	defer c.Close()
+
+	pub, err := redis.Dial("tcp", s.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pub.Close()
+
+	psc := redis.PubSubConn{Conn: c}
+	if err := psc.Subscribe("news"); err != nil {
+		t.Fatal(err)
+	}
+	if err := psc.PSubscribe("n*"); err != nil {
+		t.Fatal(err)
+	}
+	expected := []interface{}{
+		redis.Subscription{Kind: "subscribe", Channel: "news", Count: 1},
+		redis.Subscription{Kind: "psubscribe", Channel: "n*", Count: 2},
+	}
+	for _, e := range expected {
+		if actual := psc.Receive(); !reflect.DeepEqual(actual, e) {
+			t.Fatalf("Receive returned %#v, want %#v", actual, e)
+		}
+	}
+
+	n, err := redis.Int(pub.Do("PUBLISH", "news", "hello"))
+	if err != nil || n != 2 {
+		t.Fatalf("PUBLISH returned %d, %v, want 2, nil", n, err)
+	}
+	got := map[string]bool{}
+	for i := 0; i < 2; i++ {
+		switch m := psc.Receive().(type) {
+		case redis.Message:
+			got[m.Pattern+"|"+m.Channel+"|"+string(m.Data)] = true
+		default:
+			t.Fatalf("Receive returned %#v, want message", m)
+		}
+	}
+	if !got["|news|hello"] || !got["n*|news|hello"] {
+		t.Errorf("received %v", got)
+	}
+
+	if _, err := c.Do("GET", "foo"); err == nil {
+		t.Error("GET in subscribe mode did not return an error")
+	}
+}
+
+func TestPipeServer(t *testing.T) {
+	s := redistest.NewPipeServer()
+	defer s.Close()
+
+	p := &redis.Pool{
+		Dial: func() (redis.Conn, error) {
+			netConn, err := s.Dial()
+			if err != nil {
+				return nil, err
+			}
+			return redis.NewConn(netConn, 0, 0), nil
+		},
+	}
+	defer p.Close()
+
+	c := p.Get()
+	defer c.Close()
+	runCommands(t, c, []commandTest{
+		{[]interface{}{"PING"}, "PONG"},
+		{[]interface{}{"SELECT", 1}, "OK"},
+		{[]interface{}{"SET", "k", "v"}, "OK"},
+		{[]interface{}{"DBSIZE"}, int64(1)},
+		{[]interface{}{"SELECT", 0}, "OK"},
+		{[]interface{}{"DBSIZE"}, int64(0)},
+	})
+}
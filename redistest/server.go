@@ -0,0 +1,325 @@
+package redistest
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/swanwish/redigo/redis"
+)
+
+// ServerPath is the path of the redis-server binary started by StartServer.
+// The default is the value of the REDIS_SERVER environment variable or
+// "redis-server" if the variable is not set.
+var ServerPath = defaultServerPath()
+
+// StartTimeout is the maximum time to wait for servers to become ready.
+var StartTimeout = 10 * time.Second
+
+func defaultServerPath() string {
+	if path := os.Getenv("REDIS_SERVER"); path != "" {
+		return path
+	}
+	return "redis-server"
+}
+
+// Server is a redis-server process started by StartServer.
+type Server struct {
+	name string
+	addr string
+	cmd  *exec.Cmd
+	done chan struct{}
+	stop sync.Once
+
+	mu   sync.Mutex
+	log  bytes.Buffer
+	pool *redis.Pool
+}
+
+// StartServer starts a redis-server process on a free port of the loopback
+// interface and waits until the server accepts connections. The arguments
+// are appended to the server command line and override the defaults, for
+// example:
+//
+//	s := redistest.StartServer(t, "--maxmemory", "10mb", "--maxmemory-policy", "allkeys-lru")
+//
+// The server is stopped when the test and its subtests complete. The server
+// log is written to the test log if the test fails. StartServer skips the
+// test if ServerPath is not found.
+func StartServer(t testing.TB, args ...string) *Server {
+	t.Helper()
+	if _, err := exec.LookPath(ServerPath); err != nil {
+		t.Skipf("redistest: %s not found", ServerPath)
+	}
+	s, err := startServer(t, args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func startServer(t testing.TB, args []string) (*Server, error) {
+	port, err := freePort()
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{
+		name: "redis-server :" + strconv.Itoa(port),
+		addr: net.JoinHostPort("127.0.0.1", strconv.Itoa(port)),
+		done: make(chan struct{}),
+	}
+	args = append([]string{
+		"--port", strconv.Itoa(port),
+		"--bind", "127.0.0.1",
+		"--dir", t.TempDir(),
+		"--save", "",
+		"--appendonly", "no",
+	}, args...)
+	s.cmd = exec.Command(ServerPath, args...)
+	r, err := s.cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	s.cmd.Stderr = s.cmd.Stdout
+	if err := s.cmd.Start(); err != nil {
+		return nil, err
+	}
+	t.Cleanup(func() {
+		s.Stop()
+		if t.Failed() {
+			t.Logf("%s log:\n%s", s.name, s.Log())
+		}
+	})
+
+	ready := make(chan error, 1)
+	go s.watch(r, ready)
+	select {
+	case err = <-ready:
+	case <-time.After(StartTimeout):
+		err = errors.New("timeout waiting for server to start")
+	}
+	if err != nil {
+		s.Stop()
+		return nil, fmt.Errorf("redistest: %s: %v", s.name, err)
+	}
+	return s, nil
+}
+
+// freePort returns a port that is not in use on the loopback interface.
+func freePort() (int, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer ln.Close()
+	return ln.Addr().(*net.TCPAddr).Port, nil
+}
+
+// watch copies the server output to the log and reports when the server is
+// ready to accept connections.
+func (s *Server) watch(r io.Reader, ready chan error) {
+	var listening bool
+	var text string
+	scn := bufio.NewScanner(r)
+	for scn.Scan() {
+		text = scn.Text()
+		s.mu.Lock()
+		s.log.WriteString(text)
+		s.log.WriteByte('\n')
+		s.mu.Unlock()
+		if !listening {
+			if strings.Contains(text, " * Ready to accept connections") ||
+				strings.Contains(text, " * The server is now ready to accept connections on port") {
+				listening = true
+				ready <- nil
+			}
+		}
+	}
+	if !listening {
+		ready <- fmt.Errorf("server exited: %s", text)
+	}
+	s.cmd.Wait()
+	close(s.done)
+}
+
+// Stop stops the server. It is not necessary to call Stop because the
+// server is stopped when the test completes.
+func (s *Server) Stop() {
+	s.stop.Do(func() {
+		s.mu.Lock()
+		if s.pool != nil {
+			s.pool.Close()
+		}
+		s.mu.Unlock()
+		s.cmd.Process.Signal(os.Interrupt)
+		select {
+		case <-s.done:
+		case <-time.After(StartTimeout):
+			s.cmd.Process.Kill()
+			<-s.done
+		}
+	})
+}
+
+// Addr returns the host:port address of the server.
+func (s *Server) Addr() string {
+	return s.addr
+}
+
+// URL returns the address of the server as a URL for redis.DialURL.
+func (s *Server) URL() string {
+	return "redis://" + s.addr
+}
+
+// Dial connects to the server.
+func (s *Server) Dial(options ...redis.DialOption) (redis.Conn, error) {
+	return redis.Dial("tcp", s.addr, options...)
+}
+
+// Pool returns a pool of connections to the server. The pool is closed when
+// the server stops.
+func (s *Server) Pool() *redis.Pool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.pool == nil {
+		s.pool = &redis.Pool{
+			MaxIdle:     8,
+			IdleTimeout: time.Minute,
+			Dial: func() (redis.Conn, error) {
+				return s.Dial()
+			},
+		}
+	}
+	return s.pool
+}
+
+// Log returns the output of the server process.
+func (s *Server) Log() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.log.String()
+}
+
+// do executes a command on a new connection to the server.
+func (s *Server) do(cmd string, args ...interface{}) (interface{}, error) {
+	c, err := s.Dial(redis.DialConnectTimeout(time.Second), redis.DialReadTimeout(time.Second))
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+	return c.Do(cmd, args...)
+}
+
+// waitFor waits until the reply to the INFO or CLUSTER INFO command contains
+// all of the lines in want.
+func (s *Server) waitFor(want []string, cmd string, args ...interface{}) error {
+	deadline := time.Now().Add(StartTimeout)
+	for {
+		info, err := redis.String(s.do(cmd, args...))
+		if err == nil {
+			ok := true
+			for _, line := range want {
+				if !strings.Contains(info, line+"\r\n") {
+					ok = false
+				}
+			}
+			if ok {
+				return nil
+			}
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("redistest: %s: timeout waiting for %s", s.name, strings.Join(want, ", "))
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// StartReplicaPair starts a primary server and a replica of the primary. The
+// arguments are passed to both servers. StartReplicaPair waits until the
+// replica is connected to the primary.
+func StartReplicaPair(t testing.TB, args ...string) (primary, replica *Server) {
+	t.Helper()
+	primary = StartServer(t, args...)
+	host, port, _ := net.SplitHostPort(primary.addr)
+	replica = StartServer(t, append(append([]string{}, args...), "--replicaof", host, port)...)
+	if err := replica.waitFor([]string{"master_link_status:up"}, "INFO", "replication"); err != nil {
+		t.Fatal(err)
+	}
+	return primary, replica
+}
+
+// Cluster is a Redis Cluster started by StartCluster.
+type Cluster struct {
+	// Nodes are the primary servers in the cluster. Node i serves the i-th
+	// range of hash slots.
+	Nodes []*Server
+}
+
+// StartCluster starts a cluster of n primary servers with the hash slots
+// divided evenly between the servers. The arguments are passed to all
+// servers. StartCluster waits until all nodes report that the cluster is
+// ok.
+func StartCluster(t testing.TB, n int, args ...string) *Cluster {
+	t.Helper()
+	if n < 1 {
+		t.Fatalf("redistest: invalid number of cluster nodes %d", n)
+	}
+	c := &Cluster{}
+	for i := 0; i < n; i++ {
+		c.Nodes = append(c.Nodes, StartServer(t, append([]string{
+			"--cluster-enabled", "yes",
+			"--cluster-config-file", "nodes.conf",
+			"--cluster-node-timeout", "5000",
+		}, args...)...))
+	}
+	if err := c.form(); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func (c *Cluster) form() error {
+	const numSlots = 16384
+	first := c.Nodes[0]
+	for i, node := range c.Nodes {
+		if i > 0 {
+			host, port, _ := net.SplitHostPort(node.addr)
+			if _, err := first.do("CLUSTER", "MEET", host, port); err != nil {
+				return fmt.Errorf("redistest: %s: %v", node.name, err)
+			}
+		}
+		slots := redis.Args{"ADDSLOTS"}
+		for slot := i * numSlots / len(c.Nodes); slot < (i+1)*numSlots/len(c.Nodes); slot++ {
+			slots = append(slots, slot)
+		}
+		if _, err := node.do("CLUSTER", slots...); err != nil {
+			return fmt.Errorf("redistest: %s: %v", node.name, err)
+		}
+	}
+	want := []string{"cluster_state:ok", "cluster_known_nodes:" + strconv.Itoa(len(c.Nodes))}
+	for _, node := range c.Nodes {
+		if err := node.waitFor(want, "CLUSTER", "INFO"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Addrs returns the addresses of the nodes.
+func (c *Cluster) Addrs() []string {
+	addrs := make([]string, len(c.Nodes))
+	for i, node := range c.Nodes {
+		addrs[i] = node.addr
+	}
+	return addrs
+}
@@ -0,0 +1,70 @@
+package redistest_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/swanwish/redigo/redis"
+	"github.com/swanwish/redigo/redistest"
+)
+
+func TestStartServer(t *testing.T) {
+	s := redistest.StartServer(t, "--maxmemory", "10mb")
+
+	c := s.Pool().Get()
+	defer c.Close()
+	if _, err := c.Do("SET", "foo", "bar"); err != nil {
+		t.Fatal(err)
+	}
+
+	c2, err := redis.DialURL(s.URL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c2.Close()
+	v, err := redis.String(c2.Do("GET", "foo"))
+	if err != nil || v != "bar" {
+		t.Errorf("GET returned %q, %v, want bar, nil", v, err)
+	}
+}
+
+func TestStartReplicaPair(t *testing.T) {
+	primary, replica := redistest.StartReplicaPair(t)
+
+	c := primary.Pool().Get()
+	defer c.Close()
+	if _, err := c.Do("SET", "foo", "bar"); err != nil {
+		t.Fatal(err)
+	}
+
+	rc := replica.Pool().Get()
+	defer rc.Close()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		v, err := redis.String(rc.Do("GET", "foo"))
+		if err == nil && v == "bar" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("GET on replica returned %q, %v, want bar, nil", v, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestStartCluster(t *testing.T) {
+	cluster := redistest.StartCluster(t, 3)
+
+	if n := len(cluster.Addrs()); n != 3 {
+		t.Fatalf("len(Addrs()) = %d, want 3", n)
+	}
+	c := cluster.Nodes[0].Pool().Get()
+	defer c.Close()
+	slots, err := redis.Values(c.Do("CLUSTER", "SLOTS"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(slots) != 3 {
+		t.Errorf("CLUSTER SLOTS returned %d ranges, want 3", len(slots))
+	}
+}
@@ -16,6 +16,8 @@ package redisx
 
 import (
 	"strings"
+
+	"github.com/swanwish/redigo/redis"
 )
 
 const (
@@ -26,18 +28,25 @@ const (
 )
 
 type commandInfo struct {
+	// notMuxable is set for the commands that change the state of the
+	// connection as reported by redis.ChangesConnState.
 	notMuxable bool
+
+	// blocking is set for commands that block the connection until data is
+	// available.
+	blocking bool
 }
 
 var commandInfos = map[string]commandInfo{
-	"WATCH":      {notMuxable: true},
-	"UNWATCH":    {notMuxable: true},
-	"MULTI":      {notMuxable: true},
-	"EXEC":       {notMuxable: true},
-	"DISCARD":    {notMuxable: true},
-	"PSUBSCRIBE": {notMuxable: true},
-	"SUBSCRIBE":  {notMuxable: true},
-	"MONITOR":    {notMuxable: true},
+	"BLPOP":      {blocking: true},
+	"BRPOP":      {blocking: true},
+	"BRPOPLPUSH": {blocking: true},
+	"BLMOVE":     {blocking: true},
+	"BLMPOP":     {blocking: true},
+	"BZPOPMIN":   {blocking: true},
+	"BZPOPMAX":   {blocking: true},
+	"BZMPOP":     {blocking: true},
+	"WAIT":       {blocking: true},
 }
 
 func init() {
@@ -47,8 +56,27 @@ func init() {
 }
 
 func lookupCommandInfo(commandName string) commandInfo {
-	if ci, ok := commandInfos[commandName]; ok {
-		return ci
+	ci, ok := commandInfos[commandName]
+	if !ok {
+		ci = commandInfos[strings.ToUpper(commandName)]
+	}
+	ci.notMuxable = redis.ChangesConnState(commandName)
+	return ci
+}
+
+// isBlocking returns true if the command blocks the connection. XREAD and
+// XREADGROUP block when called with the BLOCK option.
+func isBlocking(commandName string, args []interface{}) bool {
+	if lookupCommandInfo(commandName).blocking {
+		return true
+	}
+	if !strings.EqualFold(commandName, "XREAD") && !strings.EqualFold(commandName, "XREADGROUP") {
+		return false
+	}
+	for _, arg := range args {
+		if s, ok := arg.(string); ok && strings.EqualFold(s, "BLOCK") {
+			return true
+		}
 	}
-	return commandInfos[strings.ToUpper(commandName)]
+	return false
 }
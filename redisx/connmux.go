@@ -17,135 +17,389 @@ package redisx
 import (
 	"errors"
 	"sync"
+	"sync/atomic"
 
 	"github.com/swanwish/redigo/redis"
 )
 
-// ConnMux multiplexes one or more connections to a single underlying
-// connection. The ConnMux connections do not support concurrency, commands
-// that associate server side state with the connection or commands that put
-// the connection in a special mode.
+// ErrNotMuxable is returned for commands that associate server side state
+// with the connection or put the connection in a special mode. These
+// commands cannot be multiplexed.
+var ErrNotMuxable = errors.New("redisx: command not supported by ConnMux")
+
+var errMuxClosed = errors.New("redisx: ConnMux closed")
+
+// ConnMux multiplexes concurrent callers on a single underlying connection.
+//
+// A writer goroutine collects the commands sent by all callers and writes
+// them to the connection with a single flush per batch. A reader goroutine
+// reads the replies and dispatches them to the callers in the order that the
+// commands were written.
+//
+// Commands that associate server side state with the connection or put the
+// connection in a special mode, such as MULTI, WATCH, SELECT, SUBSCRIBE, AUTH
+// and CLIENT, are rejected with ErrNotMuxable; see redis.ChangesConnState.
+// Blocking commands, such as BLPOP or XREAD with the BLOCK option, would
+// stall every caller. These commands are executed on a dedicated connection
+// when the ConnMuxDialBlocking option is set and are rejected with
+// ErrNotMuxable otherwise.
+//
+// When the underlying connection fails, pending and future commands return
+// the connection error. Create a new ConnMux to reconnect.
 type ConnMux struct {
-	c redis.Conn
+	// Accessed atomically. Keep at the top of the struct for alignment.
+	commands int64
+	batches  int64
+	routed   int64
+
+	c            redis.Conn
+	maxBatch     int
+	dialBlocking func() (redis.Conn, error)
 
-	sendMu sync.Mutex
-	sendID uint
+	writeWake chan struct{}
+	readWake  chan struct{}
+	done      chan struct{}
 
-	recvMu   sync.Mutex
-	recvID   uint
-	recvWait map[uint]chan struct{}
+	mu       sync.Mutex
+	err      error
+	queue    []*muxRequest // waiting for the writer
+	inflight []*muxRequest // written, waiting for the reader
 }
 
-func NewConnMux(c redis.Conn) *ConnMux {
-	return &ConnMux{c: c, recvWait: make(map[uint]chan struct{})}
+type muxRequest struct {
+	cmd   string
+	args  []interface{}
+	reply chan muxReply
 }
 
-// Get gets a connection. The application must close the returned connection.
-func (p *ConnMux) Get() redis.Conn {
-	c := &muxConn{p: p}
-	c.ids = c.buf[:0]
-	return c
+type muxReply struct {
+	v   interface{}
+	err error
 }
 
-// Close closes the underlying connection.
-func (p *ConnMux) Close() error {
-	return p.c.Close()
+func (r *muxRequest) done(v interface{}, err error) {
+	r.reply <- muxReply{v, err}
 }
 
-type muxConn struct {
-	p   *ConnMux
-	ids []uint
-	buf [8]uint
+// ConnMuxOption specifies an option for a ConnMux.
+type ConnMuxOption struct {
+	f func(*ConnMux)
 }
 
-func (c *muxConn) send(flush bool, cmd string, args ...interface{}) error {
-	if lookupCommandInfo(cmd).notMuxable {
-		return errors.New("command not supported by mux pool")
-	}
-	p := c.p
-	p.sendMu.Lock()
-	id := p.sendID
-	c.ids = append(c.ids, id)
-	p.sendID++
-	err := p.c.Send(cmd, args...)
-	if flush {
-		err = p.c.Flush()
-	}
-	p.sendMu.Unlock()
-	return err
+// ConnMuxMaxBatch specifies the maximum number of commands written to the
+// connection per flush. The default is 256.
+func ConnMuxMaxBatch(n int) ConnMuxOption {
+	return ConnMuxOption{func(m *ConnMux) {
+		m.maxBatch = n
+	}}
 }
 
-func (c *muxConn) Send(cmd string, args ...interface{}) error {
-	return c.send(false, cmd, args...)
+// ConnMuxDialBlocking specifies the function used to get a dedicated
+// connection for a blocking command. The connection is closed after the
+// command completes. Use a pool to reuse the connections:
+//
+//	redisx.ConnMuxDialBlocking(func() (redis.Conn, error) {
+//		c := pool.Get()
+//		return c, c.Err()
+//	})
+func ConnMuxDialBlocking(dial func() (redis.Conn, error)) ConnMuxOption {
+	return ConnMuxOption{func(m *ConnMux) {
+		m.dialBlocking = dial
+	}}
 }
 
-func (c *muxConn) Flush() error {
-	p := c.p
-	p.sendMu.Lock()
-	err := p.c.Flush()
-	p.sendMu.Unlock()
+// NewConnMux returns a ConnMux for the connection c. The ConnMux owns the
+// connection; the application must not use c after calling NewConnMux.
+func NewConnMux(c redis.Conn, options ...ConnMuxOption) *ConnMux {
+	m := &ConnMux{
+		c:         c,
+		maxBatch:  256,
+		writeWake: make(chan struct{}, 1),
+		readWake:  make(chan struct{}, 1),
+		done:      make(chan struct{}),
+	}
+	for _, option := range options {
+		option.f(m)
+	}
+	if m.maxBatch < 1 {
+		m.maxBatch = 1
+	}
+	go m.writeLoop()
+	go m.readLoop()
+	return m
+}
+
+// Get gets a connection. The connection supports Send, Flush and Receive
+// for pipelining and must not be used concurrently. The application must
+// close the returned connection.
+func (m *ConnMux) Get() redis.Conn {
+	return &muxConn{m: m}
+}
+
+// Do sends a command and returns the reply. Do is safe to call from
+// multiple goroutines.
+func (m *ConnMux) Do(cmd string, args ...interface{}) (interface{}, error) {
+	r, err := m.submit(cmd, args)
+	if err != nil {
+		return nil, err
+	}
+	reply := <-r.reply
+	return reply.v, reply.err
+}
+
+// Err returns a non-nil value when the underlying connection has failed or
+// the ConnMux is closed.
+func (m *ConnMux) Err() error {
+	m.mu.Lock()
+	err := m.err
+	m.mu.Unlock()
 	return err
 }
 
-func (c *muxConn) Receive() (interface{}, error) {
-	if len(c.ids) == 0 {
-		return nil, errors.New("mux pool underflow")
+// Close closes the underlying connection. Commands waiting for a reply
+// return an error.
+func (m *ConnMux) Close() error {
+	m.fail(errMuxClosed)
+	return nil
+}
+
+// ConnMuxStats contains ConnMux statistics.
+type ConnMuxStats struct {
+	// Commands is the number of commands written to the connection.
+	Commands int64
+
+	// Batches is the number of flushes. Commands divided by Batches is the
+	// average number of commands per flush.
+	Batches int64
+
+	// Routed is the number of blocking commands executed on dedicated
+	// connections.
+	Routed int64
+
+	// Pending is the number of commands waiting to be written or waiting
+	// for a reply.
+	Pending int
+}
+
+// Stats returns ConnMux statistics.
+func (m *ConnMux) Stats() ConnMuxStats {
+	m.mu.Lock()
+	pending := len(m.queue) + len(m.inflight)
+	m.mu.Unlock()
+	return ConnMuxStats{
+		Commands: atomic.LoadInt64(&m.commands),
+		Batches:  atomic.LoadInt64(&m.batches),
+		Routed:   atomic.LoadInt64(&m.routed),
+		Pending:  pending,
 	}
+}
 
-	id := c.ids[0]
-	c.ids = c.ids[1:]
-	if len(c.ids) == 0 {
-		c.ids = c.buf[:0]
+// submit queues a command for the writer goroutine or routes a blocking
+// command to a dedicated connection.
+func (m *ConnMux) submit(cmd string, args []interface{}) (*muxRequest, error) {
+	if lookupCommandInfo(cmd).notMuxable {
+		return nil, ErrNotMuxable
+	}
+	r := &muxRequest{cmd: cmd, args: args, reply: make(chan muxReply, 1)}
+	if isBlocking(cmd, args) {
+		if m.dialBlocking == nil {
+			return nil, ErrNotMuxable
+		}
+		if err := m.Err(); err != nil {
+			return nil, err
+		}
+		atomic.AddInt64(&m.routed, 1)
+		go m.doBlocking(r)
+		return r, nil
+	}
+	m.mu.Lock()
+	if m.err != nil {
+		err := m.err
+		m.mu.Unlock()
+		return nil, err
 	}
+	m.queue = append(m.queue, r)
+	m.mu.Unlock()
+	wake(m.writeWake)
+	return r, nil
+}
 
-	p := c.p
-	p.recvMu.Lock()
-	if p.recvID != id {
-		ch := make(chan struct{})
-		p.recvWait[id] = ch
-		p.recvMu.Unlock()
-		<-ch
-		p.recvMu.Lock()
-		if p.recvID != id {
-			panic("out of sync")
+func (m *ConnMux) doBlocking(r *muxRequest) {
+	c, err := m.dialBlocking()
+	if err != nil {
+		r.done(nil, err)
+		return
+	}
+	v, err := c.Do(r.cmd, r.args...)
+	c.Close()
+	r.done(v, err)
+}
+
+func wake(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+// fail records the first fatal error, closes the connection and fails the
+// commands that are not owned by the writer or reader goroutines.
+func (m *ConnMux) fail(err error) {
+	m.mu.Lock()
+	if m.err != nil {
+		m.mu.Unlock()
+		return
+	}
+	m.err = err
+	reqs := append(m.queue, m.inflight...)
+	m.queue, m.inflight = nil, nil
+	close(m.done)
+	m.mu.Unlock()
+	m.c.Close()
+	for _, r := range reqs {
+		r.done(nil, err)
+	}
+}
+
+func (m *ConnMux) writeLoop() {
+	for {
+		select {
+		case <-m.writeWake:
+		case <-m.done:
+			return
+		}
+		for {
+			m.mu.Lock()
+			n := len(m.queue)
+			if n == 0 || m.err != nil {
+				m.mu.Unlock()
+				break
+			}
+			if n > m.maxBatch {
+				n = m.maxBatch
+			}
+			batch := m.queue[:n:n]
+			m.queue = m.queue[n:]
+			m.mu.Unlock()
+
+			if err := m.writeBatch(batch); err != nil {
+				m.fail(err)
+				return
+			}
+		}
+	}
+}
+
+func (m *ConnMux) writeBatch(batch []*muxRequest) error {
+	for _, r := range batch {
+		if err := m.c.Send(r.cmd, r.args...); err != nil {
+			// None of the commands in the batch were flushed.
+			for _, r := range batch {
+				r.done(nil, err)
+			}
+			return err
 		}
 	}
 
-	v, err := p.c.Receive()
+	// Hand the batch to the reader before flushing so that the reader is
+	// ready for the replies.
+	m.mu.Lock()
+	if m.err != nil {
+		err := m.err
+		m.mu.Unlock()
+		for _, r := range batch {
+			r.done(nil, err)
+		}
+		return err
+	}
+	m.inflight = append(m.inflight, batch...)
+	m.mu.Unlock()
+	wake(m.readWake)
+
+	atomic.AddInt64(&m.commands, int64(len(batch)))
+	atomic.AddInt64(&m.batches, 1)
+	return m.c.Flush()
+}
+
+func (m *ConnMux) readLoop() {
+	for {
+		m.mu.Lock()
+		if len(m.inflight) == 0 {
+			m.mu.Unlock()
+			select {
+			case <-m.readWake:
+			case <-m.done:
+				return
+			}
+			continue
+		}
+		r := m.inflight[0]
+		m.inflight[0] = nil
+		m.inflight = m.inflight[1:]
+		m.mu.Unlock()
 
-	id++
-	p.recvID = id
-	ch, ok := p.recvWait[id]
-	if ok {
-		delete(p.recvWait, id)
+		v, err := m.c.Receive()
+		r.done(v, err)
+		if _, ok := err.(redis.Error); err != nil && !ok {
+			m.fail(err)
+			return
+		}
 	}
-	p.recvMu.Unlock()
-	if ok {
-		ch <- struct{}{}
+}
+
+type muxConn struct {
+	m       *ConnMux
+	pending []*muxRequest
+}
+
+func (c *muxConn) Send(cmd string, args ...interface{}) error {
+	r, err := c.m.submit(cmd, args)
+	if err != nil {
+		return err
 	}
+	c.pending = append(c.pending, r)
+	return nil
+}
+
+// Flush returns the error of the underlying connection. Commands are
+// written by the writer goroutine as soon as they are sent.
+func (c *muxConn) Flush() error {
+	return c.m.Err()
+}
 
-	return v, err
+func (c *muxConn) Receive() (interface{}, error) {
+	if len(c.pending) == 0 {
+		return nil, errors.New("mux pool underflow")
+	}
+	r := c.pending[0]
+	c.pending[0] = nil
+	c.pending = c.pending[1:]
+	reply := <-r.reply
+	return reply.v, reply.err
 }
 
 func (c *muxConn) Close() error {
 	var err error
-	if len(c.ids) == 0 {
-		return nil
-	}
-	c.Flush()
-	for _ = range c.ids {
+	for len(c.pending) > 0 {
 		_, err = c.Receive()
 	}
 	return err
 }
 
 func (c *muxConn) Do(cmd string, args ...interface{}) (interface{}, error) {
-	if err := c.send(true, cmd, args...); err != nil {
-		return nil, err
+	if cmd != "" {
+		if err := c.Send(cmd, args...); err != nil {
+			return nil, err
+		}
+	}
+	var reply interface{}
+	var err error
+	for len(c.pending) > 0 {
+		reply, err = c.Receive()
 	}
-	return c.Receive()
+	return reply, err
 }
 
 func (c *muxConn) Err() error {
-	return c.p.c.Err()
+	return c.m.Err()
 }
@@ -15,9 +15,15 @@
 package redisx_test
 
 import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
 	"net/textproto"
+	"strconv"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/swanwish/redigo/redis"
 	"github.com/swanwish/redigo/redisx"
@@ -90,6 +96,209 @@ func TestConnMuxClose(t *testing.T) {
 	c2.Close()
 }
 
+// pipeConn returns a connection to an in-memory server that implements PING,
+// ECHO and BLPOP. The server closes the connection on SHUTDOWN.
+func pipeConn(t *testing.T) redis.Conn {
+	client, server := net.Pipe()
+	go serve(server)
+	t.Cleanup(func() { client.Close() })
+	return redis.NewConn(client, time.Second, time.Second)
+}
+
+func serve(c net.Conn) {
+	defer c.Close()
+	br := bufio.NewReader(c)
+	bw := bufio.NewWriter(c)
+	for {
+		args, err := readCommand(br)
+		if err != nil {
+			return
+		}
+		switch args[0] {
+		case "PING":
+			bw.WriteString("+PONG\r\n")
+		case "ECHO":
+			fmt.Fprintf(bw, "$%d\r\n%s\r\n", len(args[1]), args[1])
+		case "BLPOP":
+			time.Sleep(10 * time.Millisecond)
+			fmt.Fprintf(bw, "*2\r\n$%d\r\n%s\r\n$1\r\nv\r\n", len(args[1]), args[1])
+		case "SHUTDOWN":
+			return
+		default:
+			fmt.Fprintf(bw, "-ERR unknown command '%s'\r\n", args[0])
+		}
+		if br.Buffered() == 0 {
+			if err := bw.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func readCommand(br *bufio.Reader) ([]string, error) {
+	line, err := br.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(line[1 : len(line)-2])
+	if err != nil || line[0] != '*' || n < 1 {
+		return nil, fmt.Errorf("bad request %q", line)
+	}
+	args := make([]string, n)
+	for i := range args {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(line[1 : len(line)-2])
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(br, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
+
+func TestConnMuxConcurrentDo(t *testing.T) {
+	m := redisx.NewConnMux(pipeConn(t))
+	defer m.Close()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, numConcurrent)
+	for i := 0; i < numConcurrent; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			c := m.Get()
+			defer c.Close()
+			for j := 0; j < 100; j++ {
+				want := fmt.Sprintf("%d-%d", i, j)
+				var s string
+				var err error
+				if j%2 == 0 {
+					s, err = redis.String(m.Do("ECHO", want))
+				} else {
+					s, err = redis.String(c.Do("ECHO", want))
+				}
+				if err != nil || s != want {
+					errs <- fmt.Errorf("ECHO returned %q, %v, want %q", s, err, want)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	stats := m.Stats()
+	if stats.Commands != numConcurrent*100 {
+		t.Errorf("Commands = %d, want %d", stats.Commands, numConcurrent*100)
+	}
+	if stats.Batches == 0 || stats.Batches > stats.Commands {
+		t.Errorf("Batches = %d, want in [1, %d]", stats.Batches, stats.Commands)
+	}
+	if stats.Pending != 0 {
+		t.Errorf("Pending = %d, want 0", stats.Pending)
+	}
+}
+
+func TestConnMuxPipeline(t *testing.T) {
+	m := redisx.NewConnMux(pipeConn(t))
+	defer m.Close()
+
+	c := m.Get()
+	defer c.Close()
+	for _, s := range []string{"a", "b", "c"} {
+		if err := c.Send("ECHO", s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := c.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"a", "b", "c"} {
+		s, err := redis.String(c.Receive())
+		if err != nil || s != want {
+			t.Fatalf("Receive() = %q, %v, want %q", s, err, want)
+		}
+	}
+	if _, err := c.Receive(); err == nil {
+		t.Fatal("Receive() with no pending replies returned nil error")
+	}
+}
+
+func TestConnMuxNotMuxable(t *testing.T) {
+	m := redisx.NewConnMux(pipeConn(t))
+	defer m.Close()
+
+	for _, cmd := range []string{"MULTI", "subscribe", "SELECT", "BLPOP", "AUTH", "hello", "CLIENT", "RESET", "QUIT", "UNSUBSCRIBE", "PUNSUBSCRIBE", "SUNSUBSCRIBE"} {
+		if _, err := m.Do(cmd, "x", 0); err != redisx.ErrNotMuxable {
+			t.Errorf("Do(%q) returned %v, want %v", cmd, err, redisx.ErrNotMuxable)
+		}
+	}
+	if _, err := m.Do("XREAD", "BLOCK", 0, "STREAMS", "s", "$"); err != redisx.ErrNotMuxable {
+		t.Errorf("Do(XREAD BLOCK) returned %v, want %v", err, redisx.ErrNotMuxable)
+	}
+}
+
+func TestConnMuxBlockingRouted(t *testing.T) {
+	dials := 0
+	m := redisx.NewConnMux(pipeConn(t), redisx.ConnMuxDialBlocking(func() (redis.Conn, error) {
+		dials++
+		return pipeConn(t), nil
+	}))
+	defer m.Close()
+
+	c := m.Get()
+	defer c.Close()
+	c.Send("BLPOP", "list", 0)
+	c.Send("ECHO", "hello")
+	v, err := redis.Strings(c.Receive())
+	if err != nil || len(v) != 2 || v[0] != "list" {
+		t.Fatalf("BLPOP returned %q, %v", v, err)
+	}
+	if s, err := redis.String(c.Receive()); err != nil || s != "hello" {
+		t.Fatalf("ECHO returned %q, %v", s, err)
+	}
+	if dials != 1 {
+		t.Errorf("dials = %d, want 1", dials)
+	}
+	if n := m.Stats().Routed; n != 1 {
+		t.Errorf("Routed = %d, want 1", n)
+	}
+}
+
+func TestConnMuxConnError(t *testing.T) {
+	m := redisx.NewConnMux(pipeConn(t))
+	defer m.Close()
+
+	if _, err := m.Do("ECHO", "hello"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Do("SHUTDOWN"); err == nil {
+		t.Fatal("Do(SHUTDOWN) returned nil error")
+	}
+	if err := m.Err(); err == nil {
+		t.Fatal("Err() returned nil after connection failure")
+	}
+	if _, err := m.Do("PING"); err == nil {
+		t.Fatal("Do(PING) after connection failure returned nil error")
+	}
+
+	m = redisx.NewConnMux(pipeConn(t))
+	m.Close()
+	if _, err := m.Do("PING"); err == nil {
+		t.Fatal("Do(PING) after close returned nil error")
+	}
+}
+
 func BenchmarkConn(b *testing.B) {
 	b.StopTimer()
 	c, err := redisx.DialTest()